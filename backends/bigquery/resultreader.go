@@ -2,12 +2,14 @@ package bigquery
 
 import (
 	"database/sql/driver"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/bigquery"
 	"cloud.google.com/go/civil"
 	u "github.com/araddon/gou"
 	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 
 	"github.com/araddon/qlbridge/datasource"
@@ -15,6 +17,8 @@ import (
 	"github.com/araddon/qlbridge/expr"
 	"github.com/araddon/qlbridge/rel"
 	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/models"
 )
 
 var (
@@ -128,7 +132,7 @@ func (m *ResultReader) Run() error {
 	client, err := bigquery.NewClient(context.Background(), m.Req.s.billingProject)
 	if err != nil {
 		u.Warnf("Could not create bigquery client billing_project=%q  err=%v", m.Req.s.billingProject, err)
-		return err
+		return bqError(err)
 	}
 
 	bqWriter := expr.NewDialectWriter('"', '`')
@@ -140,18 +144,18 @@ func (m *ResultReader) Run() error {
 	job, err := q.Run(ctx)
 	if err != nil {
 		u.Warnf("could not run %v", err)
-		return err
+		return bqError(err)
 	}
 
 	// Wait until async querying is done.
 	status, err := job.Wait(ctx)
 	if err != nil {
 		u.Warnf("could not run %v", err)
-		return err
+		return bqError(err)
 	}
 	if err := status.Err(); err != nil {
 		u.Warnf("could not run %v", err)
-		return err
+		return bqError(err)
 	}
 
 	// u.Debugf("Status state:%#v stats:%#v", status.State, status.Statistics)
@@ -164,7 +168,7 @@ func (m *ResultReader) Run() error {
 			break
 		}
 		if err != nil {
-			return err
+			return bqError(err)
 		}
 		//u.Debugf("row %#v", row)
 
@@ -196,3 +200,53 @@ func (m *ResultReader) Run() error {
 	u.Debugf("finished query, took: %v for %v rows", time.Now().Sub(queryStart), m.Total)
 	return nil
 }
+
+// bqError err with the kind of failure frontends report it as
+func bqError(err error) error {
+	switch e := err.(type) {
+	case *googleapi.Error:
+		switch {
+		case e.Code == 404:
+			return models.WrapNotFound(bqObject(e.Message), err)
+		case e.Code == 401 || e.Code == 403:
+			return models.WrapError(models.ErrDenied, err)
+		case e.Code == 400:
+			return models.WrapError(models.ErrSyntax, err)
+		case e.Code >= 500:
+			return models.WrapError(models.ErrUnavailable, err)
+		}
+		return err
+	case *bigquery.Error:
+		switch e.Reason {
+		case "notFound":
+			return models.WrapNotFound(bqObject(e.Message), err)
+		case "accessDenied":
+			return models.WrapError(models.ErrDenied, err)
+		case "invalidQuery":
+			if strings.HasPrefix(e.Message, "Unrecognized name:") {
+				return models.WrapNotFound(models.ObjectColumn, err)
+			}
+			return models.WrapError(models.ErrSyntax, err)
+		case "backendError", "internalError":
+			return models.WrapError(models.ErrUnavailable, err)
+		case "timeout":
+			return models.WrapError(models.ErrTimeout, err)
+		case "notImplemented":
+			return models.WrapError(models.ErrUnsupported, err)
+		}
+		return err
+	}
+	return models.NetError(err)
+}
+
+// bqObject the kind of object a bigquery not found message is missing,
+// ie "Not found: Dataset project:dataset"
+func bqObject(msg string) models.ErrorObject {
+	switch {
+	case strings.Contains(msg, "Not found: Dataset"):
+		return models.ObjectSchema
+	case strings.Contains(msg, "Not found: Table"):
+		return models.ObjectTable
+	}
+	return models.ObjectUnknown
+}
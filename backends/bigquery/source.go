@@ -17,6 +17,8 @@ import (
 	"github.com/araddon/qlbridge/rel"
 	"github.com/araddon/qlbridge/schema"
 	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/models"
 )
 
 const (
@@ -59,6 +61,8 @@ type Source struct {
 	lastSchemaUpdate time.Time
 	mu               sync.Mutex
 	closed           bool
+	clientMu         sync.Mutex
+	client           *bigquery.Client // of dataProject for writes, created on first use
 }
 
 // Mutator a bigquery mutator connection
@@ -259,9 +263,33 @@ func (m *Source) Close() error {
 	defer m.mu.Unlock()
 
 	m.closed = true
+
+	m.clientMu.Lock()
+	defer m.clientMu.Unlock()
+	if m.client != nil {
+		err := m.client.Close()
+		m.client = nil
+		return err
+	}
 	return nil
 }
 
+// writeClient the client of the data project shared by mutators, so
+// batches of a load don't each open their own connections.
+func (m *Source) writeClient() (*bigquery.Client, error) {
+	m.clientMu.Lock()
+	defer m.clientMu.Unlock()
+	if m.client != nil {
+		return m.client, nil
+	}
+	client, err := bigquery.NewClient(context.Background(), m.dataProject)
+	if err != nil {
+		return nil, err
+	}
+	m.client = client
+	return client, nil
+}
+
 func (m *Source) DataSource() schema.Source { return m }
 func (m *Source) Tables() []string          { return m.tables }
 func (m *Source) Table(table string) (*schema.Table, error) {
@@ -299,7 +327,7 @@ func (m *Source) Open(tableName string) (schema.Conn, error) {
 	}
 	if tbl == nil {
 		u.Errorf("Could not find table for '%s'.'%s'", m.schema.Name, tableName)
-		return nil, fmt.Errorf("Could not find '%v'.'%v' schema", m.schema.Name, tableName)
+		return nil, models.NotFoundError(models.ObjectTable, "Could not find table '%v'.'%v'", m.schema.Name, tableName)
 	}
 
 	return NewSqlToBQ(m, tbl), nil
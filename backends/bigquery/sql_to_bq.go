@@ -163,6 +163,20 @@ func (m *SqlToBQ) WalkExecSource(p *plan.Source) (exec.Task, error) {
 	return reader, nil
 }
 
+// Explain the standard sql WalkExecSource would run, without calling
+// bigquery.
+func (m *SqlToBQ) Explain() (interface{}, []string, error) {
+	if m.p == nil || m.p.Stmt == nil || m.p.Stmt.Source == nil {
+		return nil, nil, fmt.Errorf("bigquery sql for %s was not planned", m.tbl.Name)
+	}
+	if err := m.queryRewrite(m.p.Stmt.Source); err != nil {
+		return nil, nil, err
+	}
+	bqWriter := expr.NewDialectWriter('"', '`')
+	m.sel.WriteDialect(bqWriter)
+	return bqWriter.String(), nil, nil
+}
+
 // CreateMutator part of Mutator interface to allow data sources create a stateful
 //  mutation context for update/delete operations.
 func (m *SqlToBQ) CreateMutator(pc interface{}) (schema.ConnMutator, error) {
@@ -177,6 +191,38 @@ func (m *SqlToBQ) CreateMutator(pc interface{}) (schema.ConnMutator, error) {
 // Put Interface for mutation (insert, update)
 func (m *SqlToBQ) Put(ctx context.Context, key schema.Key, val interface{}) (schema.Key, error) {
 
+	if key == nil {
+		u.Warnf("didn't have key?  %v", val)
+		// If we don't have a key we MUST choose one from columns via
+		// the schema ie the "primary key"
+		//return nil, fmt.Errorf("Must have key for updates in bigtable")
+	}
+
+	row, err := m.rowVals(val)
+	if err != nil {
+		return nil, err
+	}
+
+	goctx := context.Background()
+	// [START bigquery_insert_stream]
+	client, err := m.s.writeClient()
+	if err != nil {
+		u.Warnf("Could not create bigquery client %v", err)
+		return nil, err
+	}
+
+	tu := client.Dataset(m.s.dataset).Table(m.tbl.Name).Uploader()
+	if err := tu.Put(goctx, row); err != nil {
+		return nil, err
+	}
+
+	newKey := datasource.NewKeyCol("id", "fixme")
+	return newKey, nil
+}
+
+// rowVals the row to upload for val
+func (m *SqlToBQ) rowVals(val interface{}) (*RowVals, error) {
+
 	if m.schema == nil {
 		u.Warnf("must have schema")
 		return nil, fmt.Errorf("Must have schema for updates in bigtable")
@@ -186,13 +232,6 @@ func (m *SqlToBQ) Put(ctx context.Context, key schema.Key, val interface{}) (sch
 		return nil, fmt.Errorf("Must have parent for big-table put")
 	}
 
-	if key == nil {
-		u.Warnf("didn't have key?  %v", val)
-		// If we don't have a key we MUST choose one from columns via
-		// the schema ie the "primary key"
-		//return nil, fmt.Errorf("Must have key for updates in bigtable")
-	}
-
 	cols := m.tbl.Columns()
 	if m.stmt == nil {
 		return nil, fmt.Errorf("Must have stmts to infer columns ")
@@ -286,21 +325,7 @@ func (m *SqlToBQ) Put(ctx context.Context, key schema.Key, val interface{}) (sch
 		return nil, fmt.Errorf("Was not []driver.Value?  %T", val)
 	}
 
-	goctx := context.Background()
-	// [START bigquery_insert_stream]
-	client, err := bigquery.NewClient(context.Background(), m.s.dataProject)
-	if err != nil {
-		u.Warnf("Could not create bigquery client %v", err)
-		return nil, err
-	}
-
-	tu := client.Dataset(m.s.dataset).Table(m.tbl.Name).Uploader()
-	if err := tu.Put(goctx, row); err != nil {
-		return nil, err
-	}
-
-	newKey := datasource.NewKeyCol("id", "fixme")
-	return newKey, nil
+	return row, nil
 }
 
 type RowVals struct {
@@ -317,8 +342,39 @@ func (r *RowVals) Save() (map[string]bigquery.Value, string, error) {
 	return r.vals, r.id, nil
 }
 
+// PutMulti write multiple rows, as one streaming insert.
 func (m *SqlToBQ) PutMulti(ctx context.Context, keys []schema.Key, src interface{}) ([]schema.Key, error) {
-	return nil, schema.ErrNotImplemented
+
+	rows, ok := src.([][]driver.Value)
+	if !ok {
+		return nil, fmt.Errorf("Was not [][]driver.Value?  %T", src)
+	}
+
+	vals := make([]*RowVals, len(rows))
+	for i, row := range rows {
+		rv, err := m.rowVals(row)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = rv
+	}
+
+	client, err := m.s.writeClient()
+	if err != nil {
+		u.Warnf("Could not create bigquery client %v", err)
+		return nil, bqError(err)
+	}
+
+	tu := client.Dataset(m.s.dataset).Table(m.tbl.Name).Uploader()
+	if err := tu.Put(ctx, vals); err != nil {
+		return nil, bqError(err)
+	}
+
+	newKeys := make([]schema.Key, len(rows))
+	for i := range rows {
+		newKeys[i] = datasource.NewKeyCol("id", "fixme")
+	}
+	return newKeys, nil
 }
 
 // Delete delete by row key
@@ -16,6 +16,8 @@ import (
 	"github.com/araddon/qlbridge/rel"
 	"github.com/araddon/qlbridge/schema"
 	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/models"
 )
 
 const (
@@ -323,7 +325,7 @@ func (m *Source) Open(tableName string) (schema.Conn, error) {
 	}
 	if tbl == nil {
 		u.Errorf("Could not find table for '%s'.'%s'", m.schema.Name, tableName)
-		return nil, fmt.Errorf("Could not find '%v'.'%v' schema", m.schema.Name, tableName)
+		return nil, models.NotFoundError(models.ObjectTable, "Could not find table '%v'.'%v'", m.schema.Name, tableName)
 	}
 
 	return NewSqlToBT(m, tbl), nil
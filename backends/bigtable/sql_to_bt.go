@@ -241,13 +241,31 @@ func (m *SqlToBT) CreateMutator(pc interface{}) (schema.ConnMutator, error) {
 // Put Interface for mutation (insert, update)
 func (m *SqlToBT) Put(ctx context.Context, key schema.Key, val interface{}) (schema.Key, error) {
 
+	keyVal, mut, err := m.rowMutation(key, val)
+	if err != nil {
+		return nil, err
+	}
+
+	tbl := m.s.client.Open(m.tbl.Parent)
+
+	u.Infof("insert key = %s", keyVal)
+	if err := tbl.Apply(ctx, keyVal, mut); err != nil {
+		u.Errorf("Error Applying mutation: %v", err)
+	}
+	newKey := datasource.NewKeyCol("id", "fixme")
+	return newKey, nil
+}
+
+// rowMutation the row key and mutation to write val
+func (m *SqlToBT) rowMutation(key schema.Key, val interface{}) (string, *bigtable.Mutation, error) {
+
 	if m.schema == nil {
 		u.Warnf("must have schema")
-		return nil, fmt.Errorf("Must have schema for updates in bigtable")
+		return "", nil, fmt.Errorf("Must have schema for updates in bigtable")
 	}
 
 	if m.tbl.Parent == "" {
-		return nil, fmt.Errorf("Must have parent for big-table put")
+		return "", nil, fmt.Errorf("Must have parent for big-table put")
 	}
 
 	keyVal := ""
@@ -262,14 +280,14 @@ func (m *SqlToBT) Put(ctx context.Context, key schema.Key, val interface{}) (sch
 
 	cols := m.tbl.Columns()
 	if m.stmt == nil {
-		return nil, fmt.Errorf("Must have stmts to infer columns ")
+		return "", nil, fmt.Errorf("Must have stmts to infer columns ")
 	}
 
 	switch q := m.stmt.(type) {
 	case *rel.SqlInsert:
 		cols = q.ColumnNames()
 	default:
-		return nil, fmt.Errorf("%T not yet supported ", q)
+		return "", nil, fmt.Errorf("%T not yet supported ", q)
 	}
 
 	var row []driver.Value
@@ -353,19 +371,11 @@ func (m *SqlToBT) Put(ctx context.Context, key schema.Key, val interface{}) (sch
 
 	default:
 		u.Warnf("unsupported type: %T  %#v", val, val)
-		return nil, fmt.Errorf("Was not []driver.Value?  %T", val)
+		return "", nil, fmt.Errorf("Was not []driver.Value?  %T", val)
 	}
 
-	tbl := m.s.client.Open(m.tbl.Parent)
-
-	u.Infof("insert key = %s", keyVal)
 	//u.Debugf("mut: %v  row: %v   cols: %v  %d %d", m.tbl.Name, row, cols, len(row), len(cols))
-	mut := Mutation(m.tbl.Name, row, cols)
-	if err := tbl.Apply(ctx, keyVal, mut); err != nil {
-		u.Errorf("Error Applying mutation: %v", err)
-	}
-	newKey := datasource.NewKeyCol("id", "fixme")
-	return newKey, nil
+	return keyVal, Mutation(m.tbl.Name, row, cols), nil
 }
 
 // Mutation function
@@ -395,9 +405,46 @@ func Mutation(fam string, vals []driver.Value, cols []string) *bigtable.Mutation
 	return mut
 }
 
-// PutMulti write multiple rows.
+// PutMulti write multiple rows, as one bulk apply.
 func (m *SqlToBT) PutMulti(ctx context.Context, keys []schema.Key, src interface{}) ([]schema.Key, error) {
-	return nil, schema.ErrNotImplemented
+
+	rows, ok := src.([][]driver.Value)
+	if !ok {
+		return nil, fmt.Errorf("Was not [][]driver.Value?  %T", src)
+	}
+
+	rowKeys := make([]string, len(rows))
+	muts := make([]*bigtable.Mutation, len(rows))
+	for i, row := range rows {
+		var key schema.Key
+		if i < len(keys) {
+			key = keys[i]
+		}
+		keyVal, mut, err := m.rowMutation(key, row)
+		if err != nil {
+			return nil, err
+		}
+		rowKeys[i] = keyVal
+		muts[i] = mut
+	}
+
+	tbl := m.s.client.Open(m.tbl.Parent)
+	errs, err := tbl.ApplyBulk(ctx, rowKeys, muts)
+	if err != nil {
+		u.Errorf("Error Applying mutations: %v", err)
+		return nil, err
+	}
+	for i, err := range errs {
+		if err != nil {
+			u.Errorf("Error Applying mutation key=%s: %v", rowKeys[i], err)
+			return nil, err
+		}
+	}
+	newKeys := make([]schema.Key, len(rows))
+	for i, keyVal := range rowKeys {
+		newKeys[i] = datasource.NewKeyCol("id", keyVal)
+	}
+	return newKeys, nil
 }
 
 // Delete delete by row key
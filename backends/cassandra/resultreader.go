@@ -1,16 +1,22 @@
 package cassandra
 
 import (
+	"context"
 	"database/sql/driver"
+	"strings"
 	"time"
 
 	u "github.com/araddon/gou"
+	"github.com/gocql/gocql"
 
 	"github.com/araddon/qlbridge/datasource"
 	"github.com/araddon/qlbridge/exec"
 	"github.com/araddon/qlbridge/expr"
 	"github.com/araddon/qlbridge/rel"
 	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/models"
+	"github.com/dataux/dataux/planner"
 )
 
 var (
@@ -128,7 +134,9 @@ func (m *ResultReader) Run() error {
 	cassWriter := NewCassDialect()
 	sel.WriteDialect(cassWriter)
 	cqlQuery := cassWriter.String()
-	cassQry := m.Req.s.session.Query(cqlQuery).PageSize(limit)
+	// the context stops fetching pages once the statement is cancelled
+	ctx := planner.Context(m.Ctx)
+	cassQry := m.Req.s.session.Query(cqlQuery).PageSize(limit).WithContext(ctx)
 	iter := cassQry.Iter()
 
 	for {
@@ -162,6 +170,10 @@ func (m *ResultReader) Run() error {
 		//u.Debugf("In gds source iter %#v", vals)
 		select {
 		case <-sigChan:
+			iter.Close()
+			return nil
+		case <-ctx.Done():
+			iter.Close()
 			return nil
 		case outCh <- msg:
 			// continue
@@ -173,5 +185,45 @@ func (m *ResultReader) Run() error {
 	//u.Errorf("could not close iter %T err:%v", err, err)
 	//}
 	u.Infof("finished query, took: %v for %v rows err:%v", time.Now().Sub(queryStart), m.Total, err)
-	return nil
+	return cassError(err)
+}
+
+// cassError err with the kind of failure frontends report it as
+func cassError(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case gocql.ErrNoConnections, gocql.ErrConnectionClosed:
+		return models.WrapError(models.ErrUnavailable, err)
+	case gocql.ErrTimeoutNoResponse, context.DeadlineExceeded:
+		return models.WrapError(models.ErrTimeout, err)
+	case gocql.ErrNotFound:
+		return models.WrapNotFound(models.ObjectTable, err)
+	}
+	switch e := err.(type) {
+	case *gocql.RequestErrUnavailable:
+		return models.WrapError(models.ErrUnavailable, err)
+	case *gocql.RequestErrReadTimeout, *gocql.RequestErrWriteTimeout:
+		return models.WrapError(models.ErrTimeout, err)
+	case gocql.RequestError:
+		switch e.Code() {
+		case 0x0100, 0x2100: // bad credentials, unauthorized
+			return models.WrapError(models.ErrDenied, err)
+		case 0x2000: // syntax error
+			return models.WrapError(models.ErrSyntax, err)
+		case 0x2200: // invalid query
+			msg := e.Message()
+			switch {
+			case strings.HasPrefix(msg, "Keyspace ") && strings.HasSuffix(msg, "does not exist"):
+				return models.WrapNotFound(models.ObjectSchema, err)
+			case strings.HasPrefix(msg, "unconfigured table"):
+				return models.WrapNotFound(models.ObjectTable, err)
+			case strings.HasPrefix(msg, "Undefined column name"):
+				return models.WrapNotFound(models.ObjectColumn, err)
+			}
+			return models.WrapError(models.ErrUnsupported, err)
+		}
+		return err
+	}
+	return models.NetError(err)
 }
@@ -21,12 +21,17 @@ import (
 	"github.com/araddon/qlbridge/schema"
 	"github.com/araddon/qlbridge/value"
 	"github.com/araddon/qlbridge/vm"
+
+	"github.com/dataux/dataux/models"
 )
 
 var (
 	// DefaultLimit is page limit
 	DefaultLimit = 5000
 
+	// MaxBatchRows is the most rows of a PutMulti sent in one batch
+	MaxBatchRows = 100
+
 	// Ensure we implment appropriate interfaces
 	_ schema.Conn         = (*SqlToCql)(nil)
 	_ plan.SourcePlanner  = (*SqlToCql)(nil)
@@ -194,6 +199,7 @@ func (m *SqlToCql) WalkExecSource(p *plan.Source) (exec.Task, error) {
 		gb := exec.NewGroupByFinal(m.Ctx, gbplan)
 		reader.Add(gb)
 		m.needsPolyFill = true
+		models.Warnf(m.Ctx, models.WarnPolyFill, "GROUP BY and aggregates of %s evaluated locally, not pushed down to cassandra", m.tbl.Name)
 	}
 
 	if m.needsWherePolyFill {
@@ -201,6 +207,7 @@ func (m *SqlToCql) WalkExecSource(p *plan.Source) (exec.Task, error) {
 		wt := exec.NewWhere(m.Ctx, wp)
 		reader.Add(wt)
 		m.needsPolyFill = true
+		models.Warnf(m.Ctx, models.WarnPolyFill, "WHERE %s evaluated locally, not pushed down to cassandra", m.original.Where)
 	}
 
 	// do we need poly fill Having?
@@ -214,6 +221,7 @@ func (m *SqlToCql) WalkExecSource(p *plan.Source) (exec.Task, error) {
 		ot := exec.NewOrder(m.Ctx, op)
 		reader.Add(ot)
 		m.needsPolyFill = true
+		models.Warnf(m.Ctx, models.WarnPolyFill, "ORDER BY %s not pushed down to cassandra, sorted locally", m.original.OrderBy)
 	}
 
 	u.Debugf("%p  needsPolyFill?%v  limit:%d ", m.sel, m.needsPolyFill, m.sel.Limit)
@@ -231,6 +239,34 @@ func (m *SqlToCql) WalkExecSource(p *plan.Source) (exec.Task, error) {
 	return reader, nil
 }
 
+// Explain the cql WalkExecSource would run and the clauses poly-filled
+// on its result, without calling cassandra.
+func (m *SqlToCql) Explain() (interface{}, []string, error) {
+	if m.p == nil || m.p.Stmt == nil || m.p.Stmt.Source == nil {
+		return nil, nil, fmt.Errorf("cql for %s was not planned", m.tbl.Name)
+	}
+	if err := m.queryRewrite(m.p.Stmt.Source); err != nil {
+		return nil, nil, err
+	}
+	polyFill := make([]string, 0)
+	if m.sel.IsAggQuery() {
+		polyFill = append(polyFill, "group by")
+	}
+	if m.needsWherePolyFill {
+		polyFill = append(polyFill, "where")
+	}
+	if m.needsOrderByPolyFill {
+		polyFill = append(polyFill, "order by")
+	}
+	if len(polyFill) > 0 {
+		// as in WalkExecSource the limit is not valid before poly-fill
+		m.sel.Limit = 0
+	}
+	cassWriter := NewCassDialect()
+	m.sel.WriteDialect(cassWriter)
+	return cassWriter.String(), polyFill, nil
+}
+
 // CreateMutator part of Mutator interface to allow data sources create a stateful
 //  mutation context for update/delete operations.
 func (m *SqlToCql) CreateMutator(pc interface{}) (schema.ConnMutator, error) {
@@ -250,14 +286,32 @@ func (m *SqlToCql) Put(ctx context.Context, key schema.Key, val interface{}) (sc
 		//return nil, fmt.Errorf("Must have key for updates in cassandra")
 	}
 
+	upsertCql, curRow, err := m.upsertRow(val)
+	if err != nil {
+		return nil, err
+	}
+
+	//u.Debugf("writing %s \n%v", upsertCql, curRow)
+	err = m.s.session.Query(upsertCql, curRow...).Exec()
+	if err != nil {
+		u.Errorf("could not insert: %v", err)
+		return nil, err
+	}
+	newKey := datasource.NewKeyCol("id", "fixme")
+	return newKey, nil
+}
+
+// upsertRow the cql and its args to write val
+func (m *SqlToCql) upsertRow(val interface{}) (string, []interface{}, error) {
+
 	if m.schema == nil {
 		u.Warnf("must have schema")
-		return nil, fmt.Errorf("Must have schema for updates in cassandra")
+		return "", nil, fmt.Errorf("Must have schema for updates in cassandra")
 	}
 
 	cols := m.tbl.Columns()
 	if m.stmt == nil {
-		return nil, fmt.Errorf("Must have stmts to infer columns ")
+		return "", nil, fmt.Errorf("Must have stmts to infer columns ")
 	}
 	upsertCql := ""
 	switch q := m.stmt.(type) {
@@ -266,7 +320,7 @@ func (m *SqlToCql) Put(ctx context.Context, key schema.Key, val interface{}) (sc
 		upsertCql = q.RewriteAsPrepareable(1, '?')
 		//u.Debugf("prepared:  \n%s", upsertCql)
 	default:
-		return nil, fmt.Errorf("%T not yet supported ", q)
+		return "", nil, fmt.Errorf("%T not yet supported ", q)
 	}
 
 	var row []driver.Value
@@ -347,21 +401,44 @@ func (m *SqlToCql) Put(ctx context.Context, key schema.Key, val interface{}) (sc
 
 	default:
 		u.Warnf("unsupported type: %T  %#v", val, val)
-		return nil, fmt.Errorf("Was not []driver.Value?  %T", val)
+		return "", nil, fmt.Errorf("Was not []driver.Value?  %T", val)
 	}
 
-	//u.Debugf("writing %s \n%v", upsertCql, curRow)
-	err := m.s.session.Query(upsertCql, curRow...).Exec()
-	if err != nil {
-		u.Errorf("could not insert: %v", err)
-		return nil, err
-	}
-	newKey := datasource.NewKeyCol("id", "fixme")
-	return newKey, nil
+	return upsertCql, curRow, nil
 }
 
+// PutMulti write multiple rows, in unlogged batches of MaxBatchRows.
 func (m *SqlToCql) PutMulti(ctx context.Context, keys []schema.Key, src interface{}) ([]schema.Key, error) {
-	return nil, schema.ErrNotImplemented
+
+	rows, ok := src.([][]driver.Value)
+	if !ok {
+		return nil, fmt.Errorf("Was not [][]driver.Value?  %T", src)
+	}
+
+	newKeys := make([]schema.Key, 0, len(rows))
+	for len(rows) > 0 {
+		n := len(rows)
+		if n > MaxBatchRows {
+			n = MaxBatchRows
+		}
+		batch := m.s.session.NewBatch(gocql.UnloggedBatch)
+		for _, row := range rows[:n] {
+			upsertCql, curRow, err := m.upsertRow(row)
+			if err != nil {
+				return nil, err
+			}
+			batch.Query(upsertCql, curRow...)
+		}
+		if err := m.s.session.ExecuteBatch(batch); err != nil {
+			u.Errorf("could not insert batch: %v", err)
+			return nil, cassError(err)
+		}
+		for range rows[:n] {
+			newKeys = append(newKeys, datasource.NewKeyCol("id", "fixme"))
+		}
+		rows = rows[n:]
+	}
+	return newKeys, nil
 }
 
 // Delete delete by row
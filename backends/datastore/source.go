@@ -21,6 +21,8 @@ import (
 	"github.com/araddon/qlbridge/rel"
 	"github.com/araddon/qlbridge/schema"
 	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/models"
 )
 
 const (
@@ -196,7 +198,7 @@ func (m *Source) Open(tableName string) (schema.Conn, error) {
 	}
 	if tbl == nil {
 		u.Errorf("Could not find table for '%s'.'%s'", m.schema.Name, tableName)
-		return nil, fmt.Errorf("Could not find '%v'.'%v' schema", m.schema.Name, tableName)
+		return nil, models.NotFoundError(models.ObjectTable, "Could not find table '%v'.'%v'", m.schema.Name, tableName)
 	}
 
 	gdsSource := NewSQLToDatstore(tbl, m.dsClient, m.dsCtx)
@@ -213,7 +215,7 @@ func (m *Source) selectQuery(stmt *rel.SqlSelect) (*ResultReader, error) {
 	}
 	if tbl == nil {
 		u.Errorf("Could not find table for '%s'.'%s'", m.schema.Name, tblName)
-		return nil, fmt.Errorf("Could not find '%v'.'%v' schema", m.schema.Name, tblName)
+		return nil, models.NotFoundError(models.ObjectTable, "Could not find table '%v'.'%v'", m.schema.Name, tblName)
 	}
 
 	sqlDs := NewSQLToDatstore(tbl, m.dsClient, m.dsCtx)
@@ -222,9 +222,33 @@ func (m *SQLToDatstore) Put(ctx context.Context, key schema.Key, val interface{}
 		//return nil, fmt.Errorf("Must have key for updates in DataStore")
 	}
 
+	dskey, pl, err := m.entity(key, val)
+	if err != nil {
+		return nil, err
+	}
+
+	//u.Debugf("has key? sourcekey: %v  dskey:%#v", key, dskey)
+	//u.Debugf("dskey:  %s   table=%s", dskey, m.tbl.NameOriginal)
+	// u.Debugf("props:  %v", props)
+	// for i, prop := range props {
+	// 	u.Debugf("i %d prop %#v", i, prop)
+	// }
+
+	dskey, err = m.dsClient.Put(m.dsCtx, dskey, &pl)
+	if err != nil {
+		u.Errorf("could not save? %v", err)
+		return nil, err
+	}
+	newKey := datasource.NewKeyCol("id", dskey.String())
+	return newKey, nil
+}
+
+// entity the key and properties to write val
+func (m *SQLToDatstore) entity(key schema.Key, val interface{}) (*datastore.Key, datastore.PropertyList, error) {
+
 	if m.schema == nil {
 		u.Warnf("must have schema")
-		return nil, fmt.Errorf("Must have schema for updates in DataStore")
+		return nil, nil, fmt.Errorf("Must have schema for updates in DataStore")
 	}
 
 	/*
@@ -265,7 +289,7 @@ func (m *SQLToDatstore) Put(ctx context.Context, key schema.Key, val interface{}
 		entity, err := m.getEntity(sel)
 		if err != nil {
 			u.Errorf("could not retrieve current entity state for update?  %v", err)
-			return nil, err
+			return nil, nil, err
 		}
 
 		if len(entity.props) > 0 {
@@ -339,28 +363,45 @@ func (m *SQLToDatstore) Put(ctx context.Context, key schema.Key, val interface{}
 
 	default:
 		u.Warnf("unsupported type: %T  %#v", val, val)
-		return nil, fmt.Errorf("Was not []driver.Value?  %T", val)
+		return nil, nil, fmt.Errorf("Was not []driver.Value?  %T", val)
 	}
 
-	//u.Debugf("has key? sourcekey: %v  dskey:%#v", key, dskey)
-	//u.Debugf("dskey:  %s   table=%s", dskey, m.tbl.NameOriginal)
-	// u.Debugf("props:  %v", props)
-	// for i, prop := range props {
-	// 	u.Debugf("i %d prop %#v", i, prop)
-	// }
+	return dskey, datastore.PropertyList(props), nil
+}
+
+// PutMulti write multiple rows, as one multi put.
+func (m *SQLToDatstore) PutMulti(ctx context.Context, keys []schema.Key, src interface{}) ([]schema.Key, error) {
+
+	rows, ok := src.([][]driver.Value)
+	if !ok {
+		return nil, fmt.Errorf("Was not [][]driver.Value?  %T", src)
+	}
+
+	dskeys := make([]*datastore.Key, len(rows))
+	pls := make([]datastore.PropertyList, len(rows))
+	for i, row := range rows {
+		var key schema.Key
+		if i < len(keys) {
+			key = keys[i]
+		}
+		dskey, pl, err := m.entity(key, row)
+		if err != nil {
+			return nil, err
+		}
+		dskeys[i] = dskey
+		pls[i] = pl
+	}
 
-	pl := datastore.PropertyList(props)
-	dskey, err := m.dsClient.Put(m.dsCtx, dskey, &pl)
+	dskeys, err := m.dsClient.PutMulti(m.dsCtx, dskeys, pls)
 	if err != nil {
 		u.Errorf("could not save? %v", err)
 		return nil, err
 	}
-	newKey := datasource.NewKeyCol("id", dskey.String())
-	return newKey, nil
-}
-
-func (m *SQLToDatstore) PutMulti(ctx context.Context, keys []schema.Key, src interface{}) ([]schema.Key, error) {
-	return nil, fmt.Errorf("not implemented")
+	newKeys := make([]schema.Key, len(dskeys))
+	for i, dskey := range dskeys {
+		newKeys[i] = datasource.NewKeyCol("id", dskey.String())
+	}
+	return newKeys, nil
 }
 
 func (m *SQLToDatstore) Delete(key driver.Value) (int, error) {
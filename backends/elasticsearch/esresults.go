@@ -12,6 +12,8 @@ import (
 	"github.com/araddon/qlbridge/exec"
 	"github.com/araddon/qlbridge/rel"
 	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/planner"
 )
 
 var (
@@ -128,6 +130,7 @@ func (m *ResultReader) Run() error {
 
 	sigChan := m.SigChan()
 	outCh := m.MessageOut()
+	done := planner.Context(m.Req.ctx).Done()
 
 	m.finalized = true
 	m.buildProjection()
@@ -232,6 +235,8 @@ func (m *ResultReader) Run() error {
 		select {
 		case <-sigChan:
 			return nil
+		case <-done:
+			return nil
 		case outCh <- msg:
 			// continue
 		}
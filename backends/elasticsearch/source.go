@@ -9,6 +9,8 @@ import (
 
 	"github.com/araddon/qlbridge/schema"
 	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/models"
 )
 
 var (
@@ -73,7 +75,7 @@ func (m *Source) Open(schemaName string) (schema.Conn, error) {
 	}
 	if tbl == nil {
 		u.Errorf("Could not find table for '%s'.'%s'", m.schema.Name, schemaName)
-		return nil, fmt.Errorf("Could not find '%v'.'%v' schema", m.schema.Name, schemaName)
+		return nil, models.NotFoundError(models.ObjectTable, "Could not find table '%v'.'%v'", m.schema.Name, schemaName)
 	}
 
 	sqlConverter := NewSqlToEs(tbl)
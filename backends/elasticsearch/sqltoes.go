@@ -1,7 +1,11 @@
 package elasticsearch
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
@@ -16,6 +20,9 @@ import (
 	"github.com/araddon/qlbridge/schema"
 	"github.com/araddon/qlbridge/value"
 	"github.com/araddon/qlbridge/vm"
+
+	"github.com/dataux/dataux/models"
+	"github.com/dataux/dataux/planner"
 )
 
 var (
@@ -49,6 +56,7 @@ type SqlToEs struct {
 	hasMultiValue  bool    // Multi-Value vs Single-Value aggs
 	hasSingleValue bool    // single value agg
 	needsPolyFill  bool    // do we request that features be polyfilled?
+	defaultLimit   bool    // the limit is ours, not the statement's
 	projections    map[string]string
 }
 
@@ -117,8 +125,10 @@ func (m *SqlToEs) WalkSourceSelect(planner plan.Planner, p *plan.Source) (plan.T
 	m.sel = p.Stmt.Source
 	if m.sel.Limit == 0 && p.Final {
 		req.Limit = DefaultLimit
+		m.defaultLimit = true
 	} else if req.Limit == 0 {
 		req.Limit = 1000
+		m.defaultLimit = true
 	}
 
 	if req.Where != nil {
@@ -231,31 +241,18 @@ func (m *SqlToEs) WalkExecSource(p *plan.Source) (exec.Task, error) {
 	}
 
 	req := p.Stmt.Source
-
-	// TODO:  hostpool
-	qs := make(url.Values)
-	qs.Set("size", strconv.Itoa(req.Limit))
-	if len(m.projections) > 0 {
-		fields := make([]string, 0)
-		for field, _ := range m.projections {
-			fields = append(fields, field)
-		}
-		// TODO: need to filter out non-leaf fields from above using
-		//       schema, as es doesn't support filtering on non-leaf nodes
-		//qs.Set("fields", strings.Join(fields, ","))
-	}
-	query := fmt.Sprintf("%s/%s/_search?%s", m.Host(), m.tbl.Name, qs.Encode())
+	query := m.searchUrl(req)
 
 	u.Infof("%v url=%v  filter=%v   \n\n%s", m.req, query, m.filter, u.JsonHelper(m.req).PrettyJson())
-	jhResp, err := u.JsonHelperHttp("POST", query, m.req)
+	jhResp, err := jsonHelperHttp(planner.Context(m.ctx), "POST", query, m.req)
 	if err != nil {
 		u.Errorf("err %v", err)
-		return nil, err
+		return nil, models.NetError(err)
 	}
 	//u.Debugf("%s", jhResp.PrettyJson())
 
 	if len(jhResp) == 0 {
-		return nil, fmt.Errorf("No response, error fetching elasticsearch query")
+		return nil, models.NewError(models.ErrUnavailable, "No response, error fetching elasticsearch query")
 	}
 
 	resp := NewResultReader(m)
@@ -273,11 +270,75 @@ func (m *SqlToEs) WalkExecSource(p *plan.Source) (exec.Task, error) {
 	}
 
 	resp.Docs = jhResp.Helpers("hits.hits")
+	if m.defaultLimit && len(m.aggs) == 0 && len(resp.Docs) >= req.Limit && resp.Total > len(resp.Docs) {
+		models.Warnf(m.ctx, models.WarnTruncated, "result of %s truncated at %d of %d rows, add a LIMIT", m.tbl.Name, len(resp.Docs), resp.Total)
+	}
 	u.Debugf("p:%p resp %T  doc.ct = %v  cols:%v", resp, resp, len(resp.Docs), resp.Columns())
 	p.Complete = true
 	return resp, nil
 }
 
+// warnIgnored warns the statement a where expression could not be
+// translated, the search is not filtered by it
+func (m *SqlToEs) warnIgnored(node expr.Node) {
+	if m.p == nil {
+		return
+	}
+	models.Warnf(m.p.Context(), models.WarnIgnored, "WHERE %s not supported by elasticsearch, it was not applied", node)
+}
+
+// jsonHelperHttp u.JsonHelperHttp of a request that is cancelled with ctx,
+// ie when the statement is killed or runs past its max_execution_time.
+func jsonHelperHttp(ctx context.Context, method, urlStr string, data interface{}) (u.JsonHelper, error) {
+	by, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, urlStr, bytes.NewReader(by))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	jh := make(u.JsonHelper)
+	if err := json.NewDecoder(resp.Body).Decode(&jh); err != nil {
+		return nil, err
+	}
+	return jh, nil
+}
+
+// searchUrl the _search url the request of req is POSTed to
+func (m *SqlToEs) searchUrl(req *rel.SqlSelect) string {
+	// TODO:  hostpool
+	qs := make(url.Values)
+	qs.Set("size", strconv.Itoa(req.Limit))
+	if len(m.projections) > 0 {
+		fields := make([]string, 0)
+		for field, _ := range m.projections {
+			fields = append(fields, field)
+		}
+		// TODO: need to filter out non-leaf fields from above using
+		//       schema, as es doesn't support filtering on non-leaf nodes
+		//qs.Set("fields", strings.Join(fields, ","))
+	}
+	return fmt.Sprintf("%s/%s/_search?%s", m.Host(), m.tbl.Name, qs.Encode())
+}
+
+// Explain the search request WalkExecSource would POST, without
+// calling elasticsearch
+func (m *SqlToEs) Explain() (interface{}, []string, error) {
+	if m.p == nil || m.p.Stmt == nil || m.p.Stmt.Source == nil {
+		return nil, nil, fmt.Errorf("elasticsearch request for %s was not planned", m.tbl.Name)
+	}
+	return esMap{"method": "POST", "url": m.searchUrl(m.p.Stmt.Source), "body": m.req}, nil, nil
+}
+
 // Aggregations from the <select_list>
 //
 //    SELECT <select_list> FROM ... WHERE
@@ -539,9 +600,11 @@ func (m *SqlToEs) walkFilterBinary(node *expr.BinaryNode, q *esMap) (value.Value
 			*q = esMap{"terms": esMap{lhval.ToString(): vt.Values()}}
 		default:
 			u.Warnf("not implemented type %#v  node=%v", rhval, node)
+			m.warnIgnored(node)
 		}
 	default:
 		u.Warnf("not implemented: %v", node)
+		m.warnIgnored(node)
 	}
 	if q != nil {
 		return nil, nil
@@ -578,6 +641,7 @@ func (m *SqlToEs) walkFilterFunc(node *expr.FuncNode, q *esMap) (value.Value, er
 		*q = esMap{funcName: esMap{"field": fieldName}}
 	default:
 		u.Warnf("not implemented %s", node.String())
+		m.warnIgnored(node)
 	}
 	if q != nil {
 		return nil, nil
@@ -0,0 +1,69 @@
+package mongo
+
+import (
+	"time"
+
+	u "github.com/araddon/gou"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/dataux/dataux/models"
+)
+
+var (
+	// Ensure changefeeds are notified of collection changes
+	_ models.ChangeNotifier = (*Source)(nil)
+)
+
+// changeStreamWait how long a change stream waits for a change before
+// checking if it was stopped
+const changeStreamWait = time.Second
+
+// NotifyChanges watches the change stream of collection table, sending on
+// ch for each change until stop is closed.  Change streams need a replica
+// set, a standalone server is only polled.
+func (m *Source) NotifyChanges(table string, ch chan<- struct{}, stop <-chan struct{}) error {
+
+	m.mu.Lock()
+	if m.closed || m.sess == nil {
+		m.mu.Unlock()
+		return nil
+	}
+	sess := m.sess.Copy()
+	m.mu.Unlock()
+
+	cs, err := sess.DB(m.db).C(table).Watch(nil, mgo.ChangeStreamOptions{MaxAwaitTimeMS: changeStreamWait})
+	if err != nil {
+		sess.Close()
+		u.Debugf("no change stream for %s.%s, polling it: %v", m.db, table, err)
+		return nil
+	}
+
+	go func() {
+		defer sess.Close()
+		defer cs.Close()
+
+		var change bson.Raw
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if cs.Next(&change) {
+				select {
+				case ch <- struct{}{}:
+				default:
+					// a notification is already pending
+				}
+				continue
+			}
+			if err := cs.Err(); err != nil {
+				u.Warnf("change stream of %s.%s stopped: %v", m.db, table, err)
+				return
+			}
+			// no change within changeStreamWait
+		}
+	}()
+	return nil
+}
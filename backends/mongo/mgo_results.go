@@ -1,9 +1,12 @@
 package mongo
 
 import (
+	"context"
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"io"
+	"time"
 
 	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
@@ -12,6 +15,9 @@ import (
 	"github.com/araddon/qlbridge/datasource"
 	"github.com/araddon/qlbridge/exec"
 	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/models"
+	"github.com/dataux/dataux/planner"
 )
 
 var (
@@ -109,13 +115,19 @@ func (m *ResultReader) Run() error {
 
 	//u.Debugf("sqltomgo:%p  resultreader:%p colnames? %v", m.sql, m, colNames)
 
+	ctx := planner.Context(m.Ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		// mongo stops the query itself at the deadline of the statement
+		m.query = m.query.SetMaxTime(time.Until(deadline))
+	}
+
 	if sql.CountStar() {
 		// select count(*)
 		vals := make([]driver.Value, 1)
 		ct, err := m.query.Count()
 		if err != nil {
 			u.Errorf("could not get count(*) from mongo: %v", err)
-			return err
+			return mgoError(err)
 		}
 		// we are going to write the count as a string?  whatevers mysql.
 		vals[0] = fmt.Sprintf("%d", ct)
@@ -139,6 +151,19 @@ func (m *ResultReader) Run() error {
 	//n := time.Now()
 	m.Vals = make([][]driver.Value, 0)
 	iter := m.query.Iter()
+
+	// mgo has no context, closing the cursor from another goroutine kills
+	// it on the server which interrupts a Next waiting on it
+	stop := make(chan bool)
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			iter.Close()
+		case <-stop:
+		}
+	}()
+
 	for {
 		var bm bson.M
 		if !iter.Next(&bm) {
@@ -178,15 +203,47 @@ func (m *ResultReader) Run() error {
 		//u.Debugf("mongo result msg out %#v", msg)
 		select {
 		case <-sigChan:
+			iter.Close()
+			return nil
+		case <-ctx.Done():
 			return nil
 		case outCh <- msg:
 			// continue
 		}
 	}
 	if err := iter.Close(); err != nil {
+		switch ctx.Err() {
+		case context.Canceled:
+			// killed, the frontend reports it
+			return nil
+		case context.DeadlineExceeded:
+			return models.WrapError(models.ErrTimeout, ctx.Err())
+		}
 		u.Errorf("could not iter: %v", err)
-		return err
+		return mgoError(err)
+	}
+	if m.sql.defaultLimit && len(m.Vals) >= m.limit {
+		models.Warnf(m.Ctx, models.WarnTruncated, "result of %s may be truncated at the default limit of %d rows, add a LIMIT", m.sql.tbl.Name, m.limit)
 	}
 	//u.Debugf("finished query, took: %v for %v rows", time.Now().Sub(n), len(m.Vals))
 	return nil
 }
+
+// mgoError err with the kind of failure frontends report it as
+func mgoError(err error) error {
+	if qe, ok := err.(*mgo.QueryError); ok {
+		switch qe.Code {
+		case 13: // Unauthorized
+			return models.WrapError(models.ErrDenied, err)
+		case 26: // NamespaceNotFound
+			return models.WrapNotFound(models.ObjectTable, err)
+		case 50: // MaxTimeMSExpired
+			return models.WrapError(models.ErrTimeout, err)
+		}
+		return err
+	}
+	if err == io.EOF || (err != nil && err.Error() == "no reachable servers") {
+		return models.WrapError(models.ErrUnavailable, err)
+	}
+	return models.NetError(err)
+}
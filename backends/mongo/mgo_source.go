@@ -13,6 +13,8 @@ import (
 
 	"github.com/araddon/qlbridge/schema"
 	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/models"
 )
 
 var (
@@ -121,7 +123,7 @@ func (m *Source) Open(collectionName string) (schema.Conn, error) {
 	}
 	if tbl == nil {
 		u.Errorf("Could not find table for '%s'.'%s'", m.srcschema.Name, collectionName)
-		return nil, fmt.Errorf("Could not find '%v'.'%v' schema", m.srcschema.Name, collectionName)
+		return nil, models.NotFoundError(models.ObjectTable, "Could not find table '%v'.'%v'", m.srcschema.Name, collectionName)
 	}
 
 	mgoSource := NewSqlToMgo(tbl, m.sess.Clone())
@@ -18,6 +18,8 @@ import (
 	"github.com/araddon/qlbridge/schema"
 	"github.com/araddon/qlbridge/value"
 	"github.com/araddon/qlbridge/vm"
+
+	"github.com/dataux/dataux/models"
 )
 
 var (
@@ -54,6 +56,7 @@ type SqlToMgo struct {
 	hasMultiValue  bool // Multi-Value vs Single-Value aggs
 	hasSingleValue bool // single value agg
 	needsPolyFill  bool // do we request that features be polyfilled?
+	defaultLimit   bool // the limit is ours, not the statement's
 }
 
 // NewSqlToMgo create sql to mongo converter
@@ -99,9 +102,11 @@ func (m *SqlToMgo) WalkSourceSelect(planner plan.Planner, p *plan.Source) (plan.
 	m.limit = req.Limit
 	if m.limit == 0 {
 		m.limit = DefaultLimit
+		m.defaultLimit = true
 	}
 	if !p.Final {
 		m.limit = 1e10
+		m.defaultLimit = false
 	}
 
 	if req.Where != nil {
@@ -248,6 +253,36 @@ func (m *SqlToMgo) WalkExecSource(p *plan.Source) (exec.Task, error) {
 	return resultReader, nil
 }
 
+// Explain the find WalkExecSource would run, without calling mongo.
+// Aggregates mongo can't run are poly-filled from the select list.
+func (m *SqlToMgo) Explain() (interface{}, []string, error) {
+	if m.p == nil || m.sel == nil {
+		return nil, nil, fmt.Errorf("mongo query for %s was not planned", m.tbl.Name)
+	}
+	filter := m.filter
+	if filter == nil {
+		filter = bson.M{}
+	}
+	req := bson.M{
+		"db":         m.schema.Name,
+		"collection": m.tbl.Name,
+		"filter":     filter,
+		"limit":      m.limit,
+		"skip":       m.sel.Offset,
+	}
+	if len(m.sort) > 0 {
+		req["sort"] = m.sort
+	}
+	if len(m.aggs) > 0 {
+		req["aggs"] = m.aggs
+	}
+	var polyFill []string
+	if m.needsPolyFill {
+		polyFill = []string{"select"}
+	}
+	return req, polyFill, nil
+}
+
 // eval() returns
 //     value, isOk, isIdentity
 func (m *SqlToMgo) eval(arg expr.Node) (value.Value, bool, bool) {
@@ -592,10 +627,12 @@ func (m *SqlToMgo) walkFilterBinary(node *expr.BinaryNode, q *bson.M) (value.Val
 			*q = bson.M{lhval.ToString(): bson.M{"$in": vt.Values()}}
 		default:
 			u.Warnf("not implemented type %#v", rhval)
+			m.warnIgnored(node)
 		}
 
 	default:
 		u.Warnf("not implemented: %v", node.Operator)
+		m.warnIgnored(node)
 	}
 	if q != nil {
 		return nil, nil
@@ -603,6 +640,15 @@ func (m *SqlToMgo) walkFilterBinary(node *expr.BinaryNode, q *bson.M) (value.Val
 	return nil, fmt.Errorf("not implemented %v", node.String())
 }
 
+// warnIgnored warns the statement a where expression could not be
+// translated, the find is not filtered by it
+func (m *SqlToMgo) warnIgnored(node expr.Node) {
+	if m.p == nil {
+		return
+	}
+	models.Warnf(m.p.Context(), models.WarnIgnored, "WHERE %s not supported by mongo, it was not applied", node)
+}
+
 // Take an expression func, ensure we don't do runtime-checking (as the function)
 // doesn't really exist, then map that function to a mongo operation
 //
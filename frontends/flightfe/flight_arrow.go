@@ -0,0 +1,336 @@
+package flightfe
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/arrow/go/arrow/memory"
+
+	"github.com/araddon/qlbridge/expr"
+	"github.com/araddon/qlbridge/plan"
+	"github.com/araddon/qlbridge/rel"
+	"github.com/araddon/qlbridge/schema"
+	"github.com/araddon/qlbridge/value"
+)
+
+// timestampType times are microseconds in utc
+var timestampType = &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+
+// arrowType the arrow type qlbridge values of typ are sent as, values
+// without a columnar type such as json and maps are sent as json text.
+func arrowType(typ value.ValueType) arrow.DataType {
+	switch typ {
+	case value.IntType:
+		return arrow.PrimitiveTypes.Int64
+	case value.NumberType:
+		return arrow.PrimitiveTypes.Float64
+	case value.BoolType:
+		return arrow.FixedWidthTypes.Boolean
+	case value.TimeType:
+		return timestampType
+	case value.ByteSliceType:
+		return arrow.BinaryTypes.Binary
+	}
+	return arrow.BinaryTypes.String
+}
+
+// arrowSchema the schema of the result of a planned statement.  Columns
+// of a table are typed by its schema.Field, others such as expressions by
+// their projected type.
+func arrowSchema(ctx *plan.Context) *arrow.Schema {
+
+	var tbl *schema.Table
+	if sel, ok := ctx.Stmt.(*rel.SqlSelect); ok && len(sel.From) == 1 && sel.From[0].Name != "" && ctx.Schema != nil {
+		tbl, _ = ctx.Schema.Table(sel.From[0].Name)
+	}
+
+	fields := make([]arrow.Field, 0)
+	if ctx.Projection == nil || ctx.Projection.Proj == nil {
+		return arrow.NewSchema(fields, nil)
+	}
+	for _, col := range ctx.Projection.Proj.Columns {
+		name := col.Name
+		if col.Col != nil {
+			name = col.Col.As
+		}
+		field := arrow.Field{Name: name, Type: arrowType(col.Type), Nullable: true}
+		if f := tableField(tbl, col); f != nil {
+			field.Type = arrowType(f.ValueType())
+			field.Nullable = !f.NoNulls
+		}
+		fields = append(fields, field)
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+// tableField the schema.Field of tbl a result column is the value of,
+// nil if it is not a plain column of tbl.
+func tableField(tbl *schema.Table, col *rel.ResultColumn) *schema.Field {
+	if tbl == nil || col.Col == nil || col.Col.SourceField == "" {
+		return nil
+	}
+	if _, isIdent := col.Col.Expr.(*expr.IdentityNode); col.Col.Expr != nil && !isIdent {
+		return nil
+	}
+	return tbl.FieldMap[col.Col.SourceField]
+}
+
+// batchBuilder builds record batches of rows
+type batchBuilder struct {
+	schema *arrow.Schema
+	b      *array.RecordBuilder
+	rows   int
+}
+
+func newBatchBuilder(mem memory.Allocator, s *arrow.Schema) *batchBuilder {
+	return &batchBuilder{schema: s, b: array.NewRecordBuilder(mem, s)}
+}
+
+// append a row, converting its values to the column types
+func (m *batchBuilder) append(vals []driver.Value) error {
+	for i, f := range m.schema.Fields() {
+		var v driver.Value
+		if i < len(vals) {
+			v = vals[i]
+		}
+		if err := appendValue(m.b.Field(i), v); err != nil {
+			// the row is incomplete, the builder can't be used again
+			return fmt.Errorf("column %q: %v", f.Name, err)
+		}
+	}
+	m.rows++
+	return nil
+}
+
+// record the rows appended since the last record, caller must Release it
+func (m *batchBuilder) record() array.Record {
+	m.rows = 0
+	return m.b.NewRecord()
+}
+
+func (m *batchBuilder) release() {
+	m.b.Release()
+}
+
+// recordWriter writes record batches to a DoGet stream, each message of
+// the arrow ipc stream they are encoded as is sent as a FlightData.
+type recordWriter struct {
+	stream flightDoGetServer
+	buf    bytes.Buffer
+	w      *ipc.Writer
+}
+
+func newRecordWriter(stream flightDoGetServer, s *arrow.Schema, mem memory.Allocator) *recordWriter {
+	m := &recordWriter{stream: stream}
+	m.w = ipc.NewWriter(&m.buf, ipc.WithSchema(s), ipc.WithAllocator(mem))
+	return m
+}
+
+// Write rec, preceded by the schema if it is the first
+func (m *recordWriter) Write(rec array.Record) error {
+	if err := m.w.Write(rec); err != nil {
+		return err
+	}
+	return m.flush()
+}
+
+// Close sends the schema if no record was written
+func (m *recordWriter) Close() error {
+	if err := m.w.Close(); err != nil {
+		return err
+	}
+	return m.flush()
+}
+
+// flush sends the messages written to buf, they reference buf which is
+// only reset once Send has marshalled them.
+func (m *recordWriter) flush() error {
+	msgs, err := splitMessages(m.buf.Bytes())
+	if err != nil {
+		return err
+	}
+	for _, fd := range msgs {
+		if err := m.stream.Send(fd); err != nil {
+			return err
+		}
+	}
+	m.buf.Reset()
+	return nil
+}
+
+// splitMessages the FlightData of each message of an arrow ipc stream,
+// its header is the flatbuffer after the length prefix.
+func splitMessages(b []byte) ([]*FlightData, error) {
+	mr := ipc.NewMessageReader(bytes.NewReader(b))
+	defer mr.Release()
+
+	var msgs []*FlightData
+	for off := 0; off < len(b); {
+		msg, err := mr.Message()
+		if err == io.EOF {
+			// end of stream marker
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if binary.LittleEndian.Uint32(b[off:]) == 0xFFFFFFFF {
+			// continuation marker
+			off += 4
+		}
+		n := int(binary.LittleEndian.Uint32(b[off:]))
+		off += 4
+		fd := &FlightData{DataHeader: b[off : off+n]}
+		off += n
+		n = int(msg.BodyLen())
+		fd.DataBody = b[off : off+n]
+		off += n
+		msgs = append(msgs, fd)
+	}
+	return msgs, nil
+}
+
+// serializeSchema the schema of s as sent in a FlightInfo, an ipc stream
+// without records.
+func serializeSchema(s *arrow.Schema, mem memory.Allocator) []byte {
+	var buf bytes.Buffer
+	w := ipc.NewWriter(&buf, ipc.WithSchema(s), ipc.WithAllocator(mem))
+	w.Close()
+	return buf.Bytes()
+}
+
+func appendValue(b array.Builder, v driver.Value) error {
+	if v == nil {
+		b.AppendNull()
+		return nil
+	}
+	switch b := b.(type) {
+	case *array.Int64Builder:
+		n, err := toInt(v)
+		if err != nil {
+			return err
+		}
+		b.Append(n)
+	case *array.Float64Builder:
+		f, err := toFloat(v)
+		if err != nil {
+			return err
+		}
+		b.Append(f)
+	case *array.BooleanBuilder:
+		switch x := v.(type) {
+		case bool:
+			b.Append(x)
+		case int64:
+			b.Append(x != 0)
+		case string:
+			t, err := strconv.ParseBool(x)
+			if err != nil {
+				return err
+			}
+			b.Append(t)
+		default:
+			return fmt.Errorf("could not convert %T to bool", v)
+		}
+	case *array.TimestampBuilder:
+		t, ok := v.(time.Time)
+		if !ok {
+			return fmt.Errorf("could not convert %T to timestamp", v)
+		}
+		b.Append(arrow.Timestamp(t.UnixNano() / 1000))
+	case *array.BinaryBuilder:
+		switch x := v.(type) {
+		case []byte:
+			b.Append(x)
+		case string:
+			b.AppendString(x)
+		default:
+			return fmt.Errorf("could not convert %T to binary", v)
+		}
+	case *array.StringBuilder:
+		s, err := toString(v)
+		if err != nil {
+			return err
+		}
+		b.Append(s)
+	default:
+		return fmt.Errorf("unsupported column builder %T", b)
+	}
+	return nil
+}
+
+func toInt(v driver.Value) (int64, error) {
+	switch x := v.(type) {
+	case int64:
+		return x, nil
+	case int:
+		return int64(x), nil
+	case int32:
+		return int64(x), nil
+	case uint64:
+		return int64(x), nil
+	case float64:
+		return int64(x), nil
+	case bool:
+		if x {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		return strconv.ParseInt(x, 10, 64)
+	case []byte:
+		return strconv.ParseInt(string(x), 10, 64)
+	}
+	return 0, fmt.Errorf("could not convert %T to int64", v)
+}
+
+func toFloat(v driver.Value) (float64, error) {
+	switch x := v.(type) {
+	case float64:
+		return x, nil
+	case float32:
+		return float64(x), nil
+	case int64:
+		return float64(x), nil
+	case int:
+		return float64(x), nil
+	case string:
+		return strconv.ParseFloat(x, 64)
+	case []byte:
+		return strconv.ParseFloat(string(x), 64)
+	}
+	return 0, fmt.Errorf("could not convert %T to float64", v)
+}
+
+// toString the text of a value, json for values without one
+func toString(v driver.Value) (string, error) {
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case []byte:
+		return string(x), nil
+	case time.Time:
+		return x.Format(time.RFC3339Nano), nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	case int64:
+		return strconv.FormatInt(x, 10), nil
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64), nil
+	case fmt.Stringer:
+		return x.String(), nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,230 @@
+package flightfe
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	u "github.com/araddon/gou"
+
+	"github.com/apache/arrow/go/arrow/memory"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/dataux/dataux/models"
+)
+
+// ListenerType the frontend config type of the arrow flight listener
+const ListenerType = "flight"
+
+var (
+	// Ensure we meet our interfaces
+	_ models.Listener     = (*FlightListener)(nil)
+	_ flightServiceServer = (*FlightListener)(nil)
+)
+
+func init() {
+	// Register our Arrow Flight Frontend Listener
+	models.ListenerRegister(ListenerType, func() models.Listener { return &FlightListener{} })
+}
+
+// FlightListener a frontend serving query results as arrow record batches
+// over the Flight rpc protocol.  A ticket is the sql to run, as json with
+// the schema to run it in, or plain sql with the schema in the
+// "x-dataux-schema" header.
+//
+//	client = flight.FlightClient("grpc://127.0.0.1:4090")
+//	ticket = flight.Ticket(json.dumps({"schema": "datauxtest", "sql": "SELECT * FROM article"}))
+//	df = client.do_get(ticket).read_pandas()
+type FlightListener struct {
+	svr  *models.ServerCtx
+	conf *models.ListenerConfig
+	auth models.Authenticator
+	mem  memory.Allocator
+	l    net.Listener
+	srv  *grpc.Server
+}
+
+// Init is part of frontend interface to accept config and global server context at start
+func (m *FlightListener) Init(conf *models.ListenerConfig, svr *models.ServerCtx) error {
+	m.svr = svr
+	m.conf = conf
+	m.auth = svr.Auth
+	m.mem = memory.NewGoAllocator()
+	if len(conf.Users) > 0 {
+		if m.auth == nil {
+			u.Warnf("ignoring users of listener %s, there is no users config", conf.Addr)
+		} else {
+			m.auth = models.NewListenerAuthenticator(m.auth, conf.Users)
+		}
+	}
+
+	tlsConf, err := conf.TLSConfig()
+	if err != nil {
+		return err
+	}
+	var opts []grpc.ServerOption
+	if tlsConf != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConf)))
+	}
+	m.l, err = net.Listen("tcp", conf.Addr)
+	if err != nil {
+		u.Errorf("could not init flight listener: %v", err)
+		return err
+	}
+	m.srv = grpc.NewServer(opts...)
+	m.srv.RegisterService(&flightServiceDesc, m)
+	return nil
+}
+
+func (m *FlightListener) Run(stop chan bool) error {
+	err := m.srv.Serve(m.l)
+	if err == grpc.ErrServerStopped {
+		return nil
+	}
+	return err
+}
+
+func (m *FlightListener) Close() error {
+	if m.srv == nil {
+		return nil
+	}
+	m.srv.Stop()
+	return nil
+}
+
+func (m *FlightListener) String() string {
+	return fmt.Sprintf("Flight Frontend address:%v", m.conf.Addr)
+}
+
+// ticket the query of a flight ticket or command descriptor
+type ticket struct {
+	Sql    string `json:"sql"`
+	Schema string `json:"schema"`
+}
+
+// parseTicket a json ticket, or plain sql run in the schema of the
+// x-dataux-schema header.
+func parseTicket(ctx context.Context, b []byte) (*ticket, error) {
+	t := &ticket{}
+	if s := strings.TrimSpace(string(b)); strings.HasPrefix(s, "{") {
+		if err := json.Unmarshal(b, t); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid json ticket: %v", err)
+		}
+	} else {
+		t.Sql = s
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok && t.Schema == "" {
+		if vals := md.Get("x-dataux-schema"); len(vals) > 0 {
+			t.Schema = vals[0]
+		}
+	}
+	t.Sql = strings.TrimRight(strings.TrimSpace(t.Sql), ";")
+	if t.Sql == "" {
+		return nil, status.Error(codes.InvalidArgument, "no sql in ticket")
+	}
+	return t, nil
+}
+
+// authenticate the user of the basic "authorization" header of a call.
+// Without an authenticator there are no users and any client may query,
+// with the listener password if there is one.
+func (m *FlightListener) authenticate(ctx context.Context) (*models.UserConfig, error) {
+
+	denied := status.Error(codes.Unauthenticated, "invalid user or password")
+	name, password, hasAuth := "", "", false
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vals := md.Get("authorization"); len(vals) > 0 && strings.HasPrefix(vals[0], "Basic ") {
+			if b, err := base64.StdEncoding.DecodeString(vals[0][len("Basic "):]); err == nil {
+				if i := strings.IndexByte(string(b), ':'); i >= 0 {
+					name, password, hasAuth = string(b[:i]), string(b[i+1:]), true
+				}
+			}
+		}
+	}
+
+	if m.auth == nil {
+		if m.conf.Password == "" || (hasAuth && subtle.ConstantTimeCompare([]byte(password), []byte(m.conf.Password)) == 1) {
+			return nil, nil
+		}
+		return nil, denied
+	}
+	if !hasAuth {
+		return nil, denied
+	}
+	user, err := m.auth.User(name)
+	if err != nil {
+		if err != models.ErrUserNotFound {
+			u.Warnf("could not find user %q: %v", name, err)
+		}
+		return nil, denied
+	}
+	if !user.CheckPassword(password) {
+		return nil, denied
+	}
+	return user, nil
+}
+
+// GetFlightInfo plans a command descriptor's sql to describe its result,
+// whose single endpoint has the command as its ticket.
+func (m *FlightListener) GetFlightInfo(ctx context.Context, desc *FlightDescriptor) (*FlightInfo, error) {
+
+	if desc.Type != flightDescriptorCmd {
+		return nil, status.Error(codes.InvalidArgument, "only command descriptors of sql are supported")
+	}
+	user, err := m.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t, err := parseTicket(ctx, desc.Cmd)
+	if err != nil {
+		return nil, err
+	}
+	job, err := m.plan(user, t)
+	if err != nil {
+		return nil, err
+	}
+	s := arrowSchema(job.Ctx)
+	job.Close()
+
+	return &FlightInfo{
+		Schema:           serializeSchema(s, m.mem),
+		FlightDescriptor: desc,
+		Endpoint:         []*FlightEndpoint{{Ticket: &Ticket{Ticket: desc.Cmd}}},
+		TotalRecords:     -1,
+		TotalBytes:       -1,
+	}, nil
+}
+
+// DoGet runs the sql of a ticket streaming its result as record batches
+func (m *FlightListener) DoGet(tkt *Ticket, stream flightDoGetServer) error {
+
+	ctx := stream.Context()
+	user, err := m.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	t, err := parseTicket(ctx, tkt.Ticket)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	job, err := m.plan(user, t)
+	if err != nil {
+		return err
+	}
+	if err := m.run(ctx, job, stream); err != nil {
+		u.Debugf("flight query error: %v", err)
+		return err
+	}
+	u.Infof("flight query completed in %v", time.Since(start))
+	return nil
+}
@@ -0,0 +1,146 @@
+package flightfe
+
+import (
+	"context"
+
+	proto "github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+// The messages and service of arrow's Flight.proto this listener serves.
+// Arrow's generated go/arrow/flight package needs grpc >= 1.32, which
+// removed the balancer api the etcd 3.3 client of the grid planner uses,
+// so the few we need are declared here against the grpc of Gopkg.lock.
+// Methods not in flightServiceDesc are answered Unimplemented by grpc.
+
+type flightDescriptorType int32
+
+const (
+	flightDescriptorUnknown flightDescriptorType = 0
+	flightDescriptorPath    flightDescriptorType = 1
+	flightDescriptorCmd     flightDescriptorType = 2
+)
+
+type FlightDescriptor struct {
+	Type flightDescriptorType `protobuf:"varint,1,opt,name=type,proto3" json:"type,omitempty"`
+	Cmd  []byte               `protobuf:"bytes,2,opt,name=cmd,proto3" json:"cmd,omitempty"`
+	Path []string             `protobuf:"bytes,3,rep,name=path,proto3" json:"path,omitempty"`
+}
+
+func (m *FlightDescriptor) Reset()         { *m = FlightDescriptor{} }
+func (m *FlightDescriptor) String() string { return proto.CompactTextString(m) }
+func (*FlightDescriptor) ProtoMessage()    {}
+
+type FlightInfo struct {
+	Schema           []byte            `protobuf:"bytes,1,opt,name=schema,proto3" json:"schema,omitempty"`
+	FlightDescriptor *FlightDescriptor `protobuf:"bytes,2,opt,name=flight_descriptor,json=flightDescriptor,proto3" json:"flight_descriptor,omitempty"`
+	Endpoint         []*FlightEndpoint `protobuf:"bytes,3,rep,name=endpoint,proto3" json:"endpoint,omitempty"`
+	TotalRecords     int64             `protobuf:"varint,4,opt,name=total_records,json=totalRecords,proto3" json:"total_records,omitempty"`
+	TotalBytes       int64             `protobuf:"varint,5,opt,name=total_bytes,json=totalBytes,proto3" json:"total_bytes,omitempty"`
+}
+
+func (m *FlightInfo) Reset()         { *m = FlightInfo{} }
+func (m *FlightInfo) String() string { return proto.CompactTextString(m) }
+func (*FlightInfo) ProtoMessage()    {}
+
+type FlightEndpoint struct {
+	Ticket   *Ticket     `protobuf:"bytes,1,opt,name=ticket,proto3" json:"ticket,omitempty"`
+	Location []*Location `protobuf:"bytes,2,rep,name=location,proto3" json:"location,omitempty"`
+}
+
+func (m *FlightEndpoint) Reset()         { *m = FlightEndpoint{} }
+func (m *FlightEndpoint) String() string { return proto.CompactTextString(m) }
+func (*FlightEndpoint) ProtoMessage()    {}
+
+type Location struct {
+	Uri string `protobuf:"bytes,1,opt,name=uri,proto3" json:"uri,omitempty"`
+}
+
+func (m *Location) Reset()         { *m = Location{} }
+func (m *Location) String() string { return proto.CompactTextString(m) }
+func (*Location) ProtoMessage()    {}
+
+type Ticket struct {
+	Ticket []byte `protobuf:"bytes,1,opt,name=ticket,proto3" json:"ticket,omitempty"`
+}
+
+func (m *Ticket) Reset()         { *m = Ticket{} }
+func (m *Ticket) String() string { return proto.CompactTextString(m) }
+func (*Ticket) ProtoMessage()    {}
+
+// FlightData an arrow ipc message, its flatbuffer header and its body
+type FlightData struct {
+	FlightDescriptor *FlightDescriptor `protobuf:"bytes,1,opt,name=flight_descriptor,json=flightDescriptor,proto3" json:"flight_descriptor,omitempty"`
+	DataHeader       []byte            `protobuf:"bytes,2,opt,name=data_header,json=dataHeader,proto3" json:"data_header,omitempty"`
+	AppMetadata      []byte            `protobuf:"bytes,3,opt,name=app_metadata,json=appMetadata,proto3" json:"app_metadata,omitempty"`
+	DataBody         []byte            `protobuf:"bytes,1000,opt,name=data_body,json=dataBody,proto3" json:"data_body,omitempty"`
+}
+
+func (m *FlightData) Reset()         { *m = FlightData{} }
+func (m *FlightData) String() string { return proto.CompactTextString(m) }
+func (*FlightData) ProtoMessage()    {}
+
+// flightServiceServer the methods of the Flight service we serve
+type flightServiceServer interface {
+	GetFlightInfo(context.Context, *FlightDescriptor) (*FlightInfo, error)
+	DoGet(*Ticket, flightDoGetServer) error
+}
+
+// flightDoGetServer the stream of a DoGet call
+type flightDoGetServer interface {
+	Send(*FlightData) error
+	grpc.ServerStream
+}
+
+type doGetServer struct {
+	grpc.ServerStream
+}
+
+func (x *doGetServer) Send(m *FlightData) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func getFlightInfoHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FlightDescriptor)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(flightServiceServer).GetFlightInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/arrow.flight.protocol.FlightService/GetFlightInfo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(flightServiceServer).GetFlightInfo(ctx, req.(*FlightDescriptor))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func doGetHandler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Ticket)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(flightServiceServer).DoGet(m, &doGetServer{stream})
+}
+
+var flightServiceDesc = grpc.ServiceDesc{
+	ServiceName: "arrow.flight.protocol.FlightService",
+	HandlerType: (*flightServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetFlightInfo",
+			Handler:    getFlightInfoHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "DoGet",
+			Handler:       doGetHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "Flight.proto",
+}
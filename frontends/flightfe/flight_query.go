@@ -0,0 +1,161 @@
+package flightfe
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+
+	u "github.com/araddon/gou"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/araddon/qlbridge/datasource"
+	"github.com/araddon/qlbridge/expr"
+	"github.com/araddon/qlbridge/plan"
+	"github.com/araddon/qlbridge/rel"
+	"github.com/araddon/qlbridge/schema"
+	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/frontends/mysqlfe"
+	"github.com/dataux/dataux/frontends/results"
+	"github.com/dataux/dataux/models"
+)
+
+// recordBatchSize rows per record batch sent to the client
+const recordBatchSize = 4096
+
+var fr = expr.NewFuncRegistry()
+
+// plan the sql of a ticket into a job, checking the user may query it.
+// Only statements returning rows can be sent as record batches.
+func (m *FlightListener) plan(user *models.UserConfig, t *ticket) (*mysqlfe.MySqlJob, error) {
+
+	var sch *schema.Schema
+	if t.Schema == "" {
+		s, err := m.svr.InfoSchema()
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		sch = s.InfoSchema
+	} else {
+		if user != nil && !user.AllowSchema(t.Schema) {
+			return nil, status.Errorf(codes.PermissionDenied, "access denied for user %q to schema %q", user.Name, t.Schema)
+		}
+		s, ok := m.svr.Schema(t.Schema)
+		if s == nil || !ok {
+			return nil, status.Errorf(codes.NotFound, "unknown schema %q", t.Schema)
+		}
+		sch = s
+	}
+
+	sess := datasource.NewContextSimple()
+	sess.Data["@@database"] = value.NewStringValue(sch.Name)
+	if user != nil {
+		sess.Data["@@user"] = value.NewStringValue(user.Name)
+	}
+
+	ctx := plan.NewContext(t.Sql)
+	ctx.DisableRecover = m.svr.Config.SupressRecover
+	ctx.Session = sess
+	ctx.Schema = sch
+	ctx.Funcs = fr
+	job, err := mysqlfe.BuildMySqlJob(m.svr, ctx, user)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if user != nil {
+		if table := user.DeniedTable(job.Ctx); table != "" {
+			job.Close()
+			u.Warnf("user %q not allowed table=%s", user.Name, table)
+			return nil, status.Errorf(codes.PermissionDenied, "access denied for user %q to table %s", user.Name, table)
+		}
+	}
+	switch stmt := job.Ctx.Stmt.(type) {
+	case *rel.SqlSelect, *rel.SqlShow, *rel.SqlDescribe:
+		return job, nil
+	default:
+		job.Close()
+		return nil, status.Errorf(codes.Unimplemented, "statement type %T returns no rows", stmt)
+	}
+}
+
+// run the job streaming its rows to the client as record batches of
+// recordBatchSize rows.  The job is cancelled if the client goes away or
+// it runs longer than max_execution_time.
+func (m *FlightListener) run(ctx context.Context, job *mysqlfe.MySqlJob, stream flightDoGetServer) error {
+
+	s := arrowSchema(job.Ctx)
+	w := newRecordWriter(stream, s, m.mem)
+	bb := newBatchBuilder(m.mem, s)
+	defer bb.release()
+
+	write := func() error {
+		rec := bb.record()
+		defer rec.Release()
+		return w.Write(rec)
+	}
+	rw := results.NewRowWriter(job.Ctx, func(vals []driver.Value) error {
+		if err := bb.append(vals); err != nil {
+			return status.Errorf(codes.Internal, "%v", err)
+		}
+		if bb.rows >= recordBatchSize {
+			return write()
+		}
+		return nil
+	})
+	if err := job.Finalize(rw); err != nil {
+		job.Close()
+		return toStatus(err)
+	}
+
+	var timeout time.Duration
+	if _, isSelect := job.Ctx.Stmt.(*rel.SqlSelect); isSelect && m.svr.Config.MaxExecTime > 0 {
+		timeout = time.Duration(m.svr.Config.MaxExecTime) * time.Millisecond
+	}
+	err := results.RunWithDeadline(job.GridTask, ctx, timeout)
+	switch {
+	case err == results.ErrDeadlineExceeded:
+		err = status.Errorf(codes.DeadlineExceeded, "query exceeded max_execution_time of %v", timeout)
+	case err == results.ErrCancelled:
+		err = status.Error(codes.Canceled, "query was cancelled")
+	case err == nil:
+		err = rw.Err
+	}
+	if closeErr := job.Close(); closeErr != nil {
+		u.Errorf("could not close ? %v", closeErr)
+	}
+	if err != nil {
+		return toStatus(err)
+	}
+	if bb.rows > 0 {
+		if err := write(); err != nil {
+			return err
+		}
+	}
+	// sends the schema if there were no rows, and the end of stream
+	return w.Close()
+}
+
+// toStatus the grpc status of err, errors of the planner and backends
+// are mapped to a code where known.
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch models.ErrorKindOf(err) {
+	case models.ErrNotFound:
+		return status.Errorf(codes.NotFound, "%v", err)
+	case models.ErrUnavailable:
+		return status.Errorf(codes.Unavailable, "%v", err)
+	case models.ErrTimeout:
+		return status.Errorf(codes.DeadlineExceeded, "%v", err)
+	case models.ErrUnsupported:
+		return status.Errorf(codes.Unimplemented, "%v", err)
+	case models.ErrDenied:
+		return status.Errorf(codes.PermissionDenied, "%v", err)
+	case models.ErrSyntax:
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return status.Errorf(codes.Internal, "%v", err)
+}
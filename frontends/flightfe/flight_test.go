@@ -0,0 +1,140 @@
+package flightfe
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/arrow/go/arrow/memory"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/araddon/qlbridge/value"
+)
+
+func TestArrowType(t *testing.T) {
+	assert.Equal(t, arrow.PrimitiveTypes.Int64, arrowType(value.IntType))
+	assert.Equal(t, arrow.PrimitiveTypes.Float64, arrowType(value.NumberType))
+	assert.Equal(t, arrow.FixedWidthTypes.Boolean, arrowType(value.BoolType))
+	assert.Equal(t, arrow.DataType(timestampType), arrowType(value.TimeType))
+	assert.Equal(t, arrow.BinaryTypes.String, arrowType(value.StringType))
+	assert.Equal(t, arrow.BinaryTypes.String, arrowType(value.MapValueType))
+}
+
+func TestBatchBuilder(t *testing.T) {
+
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	s := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "score", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+		{Name: "ok", Type: arrow.FixedWidthTypes.Boolean, Nullable: true},
+		{Name: "created", Type: timestampType, Nullable: true},
+		{Name: "tags", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	bb := newBatchBuilder(mem, s)
+	defer bb.release()
+
+	ts := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	assert.Equal(t, nil, bb.append([]driver.Value{int64(1), 1.5, true, ts, []string{"a", "b"}}))
+	assert.Equal(t, nil, bb.append([]driver.Value{"2", int64(3), "false", nil}))
+	assert.Equal(t, 2, bb.rows)
+
+	rec := bb.record()
+	defer rec.Release()
+	assert.Equal(t, 0, bb.rows)
+	assert.Equal(t, int64(2), rec.NumRows())
+	assert.Equal(t, []int64{1, 2}, rec.Column(0).(*array.Int64).Int64Values())
+	assert.Equal(t, []float64{1.5, 3}, rec.Column(1).(*array.Float64).Float64Values())
+	assert.Equal(t, false, rec.Column(2).(*array.Boolean).Value(1))
+	assert.Equal(t, arrow.Timestamp(ts.UnixNano()/1000), rec.Column(3).(*array.Timestamp).Value(0))
+	assert.True(t, rec.Column(3).IsNull(1))
+	assert.Equal(t, `["a","b"]`, rec.Column(4).(*array.String).Value(0))
+	assert.True(t, rec.Column(4).IsNull(1))
+}
+
+// flightDataStream a DoGet stream keeping the ipc stream it was sent
+type flightDataStream struct {
+	grpc.ServerStream
+	msgs int
+	buf  bytes.Buffer
+}
+
+func (m *flightDataStream) Send(fd *FlightData) error {
+	var prefix [8]byte
+	binary.LittleEndian.PutUint32(prefix[:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(fd.DataHeader)))
+	m.buf.Write(prefix[:])
+	m.buf.Write(fd.DataHeader)
+	m.buf.Write(fd.DataBody)
+	m.msgs++
+	return nil
+}
+
+func TestRecordWriter(t *testing.T) {
+
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	s := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: true}}, nil)
+	bb := newBatchBuilder(mem, s)
+	defer bb.release()
+
+	// the schema only, if there are no rows
+	stream := &flightDataStream{}
+	w := newRecordWriter(stream, s, mem)
+	assert.Equal(t, nil, w.Close())
+	assert.Equal(t, 1, stream.msgs)
+	r, err := ipc.NewReader(&stream.buf)
+	assert.Equal(t, nil, err)
+	assert.True(t, r.Schema().Equal(s))
+	assert.False(t, r.Next())
+	r.Release()
+
+	stream = &flightDataStream{}
+	w = newRecordWriter(stream, s, mem)
+	for i := int64(1); i <= 3; i++ {
+		assert.Equal(t, nil, bb.append([]driver.Value{i}))
+		rec := bb.record()
+		assert.Equal(t, nil, w.Write(rec))
+		rec.Release()
+	}
+	assert.Equal(t, nil, w.Close())
+	assert.Equal(t, 4, stream.msgs)
+
+	r, err = ipc.NewReader(&stream.buf, ipc.WithAllocator(mem))
+	assert.Equal(t, nil, err)
+	defer r.Release()
+	var ids []int64
+	for r.Next() {
+		ids = append(ids, r.Record().Column(0).(*array.Int64).Int64Values()...)
+	}
+	assert.Equal(t, []int64{1, 2, 3}, ids)
+}
+
+func TestParseTicket(t *testing.T) {
+
+	tk, err := parseTicket(context.Background(), []byte(`{"sql":"SELECT 1;","schema":"datauxtest"}`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, &ticket{Sql: "SELECT 1", Schema: "datauxtest"}, tk)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-dataux-schema", "datauxtest"))
+	tk, err = parseTicket(ctx, []byte(" SELECT 2 "))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, &ticket{Sql: "SELECT 2", Schema: "datauxtest"}, tk)
+
+	_, err = parseTicket(ctx, []byte(`{"sql":`))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = parseTicket(ctx, []byte(" ; "))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,487 @@
+package httpfe
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	u "github.com/araddon/gou"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/araddon/qlbridge/rel"
+	"github.com/araddon/qlbridge/schema"
+
+	"github.com/dataux/dataux/models"
+)
+
+const (
+	// defaultPollInterval how often a changefeed re-runs its query
+	defaultPollInterval = 5 * time.Second
+
+	// minPollInterval the shortest interval a client may ask for
+	minPollInterval = 250 * time.Millisecond
+
+	// maxFeedRows the most rows of a changefeed result, the whole result
+	// is kept to diff against the next
+	maxFeedRows = 10000
+
+	// heartbeatInterval event streams get a heartbeat so proxies don't
+	// close them while there are no changes
+	heartbeatInterval = 15 * time.Second
+)
+
+// changesRequest a subscription to the changing result of a select.  Rows
+// are identified by their key columns, an id column if none are given,
+// or else by all their values so a change is a remove and an add.
+type changesRequest struct {
+	queryRequest
+	interval time.Duration
+	key      []string
+}
+
+// parseChangesRequest the query of a subscription
+//
+//	/changes?schema=datauxtest&sql=SELECT...&interval=2s&key=id
+func parseChangesRequest(r *http.Request) (*changesRequest, error) {
+
+	q := r.URL.Query()
+	req := &changesRequest{interval: defaultPollInterval}
+	req.Schema = q.Get("schema")
+	req.Sql = strings.TrimRight(strings.TrimSpace(q.Get("sql")), ";")
+	if req.Sql == "" {
+		return nil, newError(http.StatusBadRequest, codeBadRequest, "no sql in request")
+	}
+	if s := q.Get("interval"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, newError(http.StatusBadRequest, codeBadRequest, "invalid interval %q", s)
+		}
+		if d < minPollInterval {
+			return nil, newError(http.StatusBadRequest, codeBadRequest, "interval must be at least %v", minPollInterval)
+		}
+		req.interval = d
+	}
+	for _, name := range strings.Split(q.Get("key"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			req.key = append(req.key, name)
+		}
+	}
+	return req, nil
+}
+
+// handleChanges GET /changes, subscribing to the result of a select.  The
+// first event is a snapshot of the result, then the query is re-run
+// every interval, or when a source notifies of a change, sending the
+// rows removed, updated and added since.  Events are server sent events,
+// or websocket messages if the request is a websocket upgrade.
+func (m *HttpListener) handleChanges(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		writeError(w, newError(http.StatusMethodNotAllowed, codeBadRequest, "changes must be a GET"))
+		return
+	}
+	user, ok := m.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="dataux"`)
+		writeError(w, newError(http.StatusUnauthorized, codeUnauthorized, "invalid user or password"))
+		return
+	}
+	req, err := parseChangesRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		srv := websocket.Server{
+			Handshake: checkOrigin,
+			Handler: func(ws *websocket.Conn) {
+				ctx, cancel := context.WithCancel(r.Context())
+				defer cancel()
+				// clients send nothing, the read ends when they go away
+				go func() {
+					io.Copy(ioutil.Discard, ws)
+					cancel()
+				}()
+				m.serveChanges(r.WithContext(ctx), user, req, &wsEvents{ws: ws})
+			},
+		}
+		srv.ServeHTTP(w, r)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, newError(http.StatusInternalServerError, codeInternal, "streaming is not supported"))
+		return
+	}
+	m.serveChanges(r, user, req, &sseEvents{w: w, flusher: flusher})
+}
+
+func (m *HttpListener) serveChanges(r *http.Request, user *models.UserConfig, req *changesRequest, out events) {
+	start := time.Now()
+	if err := m.changefeed(r, user, req, out); err != nil {
+		u.Debugf("changefeed error: %v", err)
+		out.fail(err)
+		return
+	}
+	u.Infof("changefeed closed after %v", time.Since(start))
+}
+
+// changefeed runs the query of req sending its snapshot then its changes,
+// until the client goes away or the query fails.  A new snapshot is sent
+// if the columns of the result change.
+func (m *HttpListener) changefeed(r *http.Request, user *models.UserConfig, req *changesRequest, out events) error {
+
+	poll := time.NewTicker(req.interval)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	stop := make(chan struct{})
+	defer close(stop)
+	changed := make(chan struct{}, 1)
+
+	var last *feedResult
+	for {
+		res, err := m.feedQuery(r, user, req)
+		if err != nil {
+			if r.Context().Err() != nil {
+				// the client went away while it ran
+				return nil
+			}
+			return err
+		}
+		if last == nil {
+			if err := notifyChanges(res.schema, res.tables, changed, stop); err != nil {
+				return err
+			}
+		}
+		if last == nil || !sameColumns(last.cols, res.cols) {
+			if err := out.send("snapshot", res.snapshot()); err != nil {
+				return err
+			}
+		} else {
+			for _, e := range diffRows(last.rows, res.rows) {
+				if err := out.send(e.Type, e); err != nil {
+					return err
+				}
+			}
+		}
+		last = res
+
+	wait:
+		for {
+			select {
+			case <-r.Context().Done():
+				return nil
+			case <-poll.C:
+				break wait
+			case <-changed:
+				break wait
+			case <-heartbeat.C:
+				if err := out.heartbeat(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// feedQuery plans and runs the select of a changefeed
+func (m *HttpListener) feedQuery(r *http.Request, user *models.UserConfig, req *changesRequest) (*feedResult, error) {
+	job, err := m.plan(user, &req.queryRequest)
+	if err != nil {
+		return nil, err
+	}
+	sel, ok := job.Ctx.Stmt.(*rel.SqlSelect)
+	if !ok {
+		job.Close()
+		return nil, newError(http.StatusBadRequest, codeNotSupported, "only a select can be subscribed to, not %T", job.Ctx.Stmt)
+	}
+	res := &feedResult{keyNames: req.key, schema: job.Ctx.Schema, tables: models.SelectTables(sel, nil)}
+	if err := m.run(r, job, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// notifyChanges asks the sources of tables that are a
+// models.ChangeNotifier to send on ch when they change
+func notifyChanges(sch *schema.Schema, tables []string, ch chan<- struct{}, stop <-chan struct{}) error {
+	if sch == nil {
+		return nil
+	}
+	for _, table := range tables {
+		ss, err := sch.SchemaForTable(table)
+		if err != nil || ss == nil {
+			continue
+		}
+		if n, ok := ss.DS.(models.ChangeNotifier); ok {
+			if err := n.NotifyChanges(table, ch, stop); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// feedResult a result of a changefeed query
+type feedResult struct {
+	keyNames []string
+	key      []int // positions of the key columns
+	cols     []column
+	rows     []feedRow
+	schema   *schema.Schema
+	tables   []string
+}
+
+func (m *feedResult) columns(cols []column) error {
+	m.cols = cols
+	names := m.keyNames
+	if len(names) == 0 {
+		for _, col := range cols {
+			if strings.EqualFold(col.Name, "id") || col.Name == "_id" {
+				names = []string{col.Name}
+				break
+			}
+		}
+	}
+	for _, name := range names {
+		idx := -1
+		for i, col := range cols {
+			if col.Name == name {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return newError(http.StatusBadRequest, codeBadRequest, "key column %q is not in the result", name)
+		}
+		m.key = append(m.key, idx)
+	}
+	return nil
+}
+
+func (m *feedResult) row(vals []driver.Value) error {
+	if len(m.rows) >= maxFeedRows {
+		return newError(http.StatusRequestEntityTooLarge, codeTooLarge, "changefeed result is larger than %d rows", maxFeedRows)
+	}
+	row, err := newFeedRow(jsonValues(vals), m.key)
+	if err != nil {
+		return err
+	}
+	m.rows = append(m.rows, row)
+	return nil
+}
+
+func (m *feedResult) snapshot() *snapshotEvent {
+	rows := make([][]interface{}, len(m.rows))
+	for i, row := range m.rows {
+		rows[i] = row.vals
+	}
+	return &snapshotEvent{Type: "snapshot", Columns: m.cols, Rows: rows}
+}
+
+// feedRow a row of a changefeed result, with the json of its key and of
+// all its values to compare rows by
+type feedRow struct {
+	vals []interface{}
+	key  string
+	enc  string
+}
+
+func newFeedRow(vals []interface{}, key []int) (feedRow, error) {
+	enc, err := json.Marshal(vals)
+	if err != nil {
+		return feedRow{}, err
+	}
+	row := feedRow{vals: vals, key: string(enc), enc: string(enc)}
+	if len(key) > 0 {
+		kv := make([]interface{}, len(key))
+		for i, idx := range key {
+			kv[i] = vals[idx]
+		}
+		b, err := json.Marshal(kv)
+		if err != nil {
+			return feedRow{}, err
+		}
+		row.key = string(b)
+	}
+	return row, nil
+}
+
+// diffRows the events changing the rows of prev into those of next, rows
+// of the same key are updated else removed or added.
+func diffRows(prev, next []feedRow) []*rowEvent {
+
+	left := make(map[string][]feedRow, len(prev))
+	for _, row := range prev {
+		left[row.key] = append(left[row.key], row)
+	}
+	var updates, adds []*rowEvent
+	for _, row := range next {
+		olds := left[row.key]
+		if len(olds) == 0 {
+			adds = append(adds, &rowEvent{Type: "add", Row: row.vals})
+			continue
+		}
+		left[row.key] = olds[1:]
+		if olds[0].enc != row.enc {
+			updates = append(updates, &rowEvent{Type: "update", Old: olds[0].vals, Row: row.vals})
+		}
+	}
+
+	events := make([]*rowEvent, 0)
+	for _, row := range prev {
+		if olds := left[row.key]; len(olds) > 0 {
+			events = append(events, &rowEvent{Type: "remove", Row: olds[0].vals})
+			left[row.key] = olds[1:]
+		}
+	}
+	events = append(events, updates...)
+	return append(events, adds...)
+}
+
+func sameColumns(a, b []column) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// snapshotEvent the whole result, the first event of a changefeed
+//
+//	{"type":"snapshot","columns":[{"name":"id","type":"int"}],"rows":[[1],[2]]}
+type snapshotEvent struct {
+	Type    string          `json:"type"`
+	Columns []column        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// rowEvent a row added, removed or updated
+//
+//	{"type":"add","row":[2,"alice"]}
+//	{"type":"remove","row":[1,"bob"]}
+//	{"type":"update","old":[2,"alice"],"row":[2,"alicia"]}
+type rowEvent struct {
+	Type string        `json:"type"`
+	Old  []interface{} `json:"old,omitempty"`
+	Row  []interface{} `json:"row"`
+}
+
+// errorEvent the error ending a changefeed
+//
+//	{"type":"error","error":{"code":"timeout","message":"..."}}
+type errorEvent struct {
+	Type  string     `json:"type"`
+	Error *httpError `json:"error"`
+}
+
+// events sends the events of a changefeed to the client
+type events interface {
+	send(typ string, data interface{}) error
+	heartbeat() error
+	// fail ends the changefeed with err
+	fail(err error)
+}
+
+// sseEvents sends events as server sent events, named by their type
+//
+//	event: add
+//	data: {"type":"add","row":[2,"alice"]}
+type sseEvents struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	started bool
+}
+
+func (m *sseEvents) start() {
+	if m.started {
+		return
+	}
+	m.started = true
+	h := m.w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	// nginx buffers responses unless told not to
+	h.Set("X-Accel-Buffering", "no")
+	m.w.WriteHeader(http.StatusOK)
+}
+
+func (m *sseEvents) send(typ string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	m.start()
+	if _, err := fmt.Fprintf(m.w, "event: %s\ndata: %s\n\n", typ, b); err != nil {
+		return err
+	}
+	m.flusher.Flush()
+	return nil
+}
+
+func (m *sseEvents) heartbeat() error {
+	m.start()
+	if _, err := io.WriteString(m.w, ": heartbeat\n\n"); err != nil {
+		return err
+	}
+	m.flusher.Flush()
+	return nil
+}
+
+// fail sends err as an error response if the stream has not started,
+// else as an error event
+func (m *sseEvents) fail(err error) {
+	if !m.started {
+		writeError(m.w, err)
+		return
+	}
+	m.send("error", &errorEvent{Type: "error", Error: toHttpError(err)})
+}
+
+// wsEvents sends events as websocket text messages of their json
+type wsEvents struct {
+	ws *websocket.Conn
+}
+
+func (m *wsEvents) send(typ string, data interface{}) error {
+	return websocket.JSON.Send(m.ws, data)
+}
+
+func (m *wsEvents) heartbeat() error {
+	return websocket.JSON.Send(m.ws, map[string]string{"type": "heartbeat"})
+}
+
+func (m *wsEvents) fail(err error) {
+	websocket.JSON.Send(m.ws, &errorEvent{Type: "error", Error: toHttpError(err)})
+}
+
+// checkOrigin allows websocket clients without an Origin, which are not
+// browsers, and pages of this host.  Pages of other sites could
+// otherwise read results with the credentials of a browser.
+func checkOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	o, err := url.Parse(origin)
+	if err != nil || o.Host != r.Host {
+		return fmt.Errorf("origin %q not allowed", origin)
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package httpfe
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	u "github.com/araddon/gou"
+
+	"github.com/araddon/qlbridge/datasource"
+	"github.com/araddon/qlbridge/exec"
+	"github.com/araddon/qlbridge/expr"
+	"github.com/araddon/qlbridge/plan"
+	"github.com/araddon/qlbridge/rel"
+	"github.com/araddon/qlbridge/schema"
+	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/frontends/mysqlfe"
+	"github.com/dataux/dataux/frontends/results"
+	"github.com/dataux/dataux/models"
+)
+
+// maxRequestBytes the largest query request body accepted
+const maxRequestBytes = 1 << 20
+
+var fr = expr.NewFuncRegistry()
+
+// queryRequest the body of POST /query as json.  A body of any other
+// content type is the sql, with schema from the url ie /query?schema=name
+type queryRequest struct {
+	Sql    string `json:"sql"`
+	Schema string `json:"schema"`
+}
+
+// parseQueryRequest the sql and schema of a request
+func parseQueryRequest(w http.ResponseWriter, r *http.Request) (*queryRequest, error) {
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	if err != nil {
+		return nil, newError(http.StatusRequestEntityTooLarge, codeBadRequest, "could not read request: %v", err)
+	}
+
+	req := &queryRequest{}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		if err := json.Unmarshal(body, req); err != nil {
+			return nil, newError(http.StatusBadRequest, codeBadRequest, "invalid json request: %v", err)
+		}
+	} else {
+		req.Sql = string(body)
+	}
+	if req.Schema == "" {
+		req.Schema = r.URL.Query().Get("schema")
+	}
+	req.Sql = strings.TrimRight(strings.TrimSpace(req.Sql), ";")
+	if req.Sql == "" {
+		return nil, newError(http.StatusBadRequest, codeBadRequest, "no sql in request")
+	}
+	return req, nil
+}
+
+// handleQuery POST /query, running the sql and streaming its result in
+// the format of the Accept header.
+func (m *HttpListener) handleQuery(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeError(w, newError(http.StatusMethodNotAllowed, codeBadRequest, "query must be POSTed"))
+		return
+	}
+	user, ok := m.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="dataux"`)
+		writeError(w, newError(http.StatusUnauthorized, codeUnauthorized, "invalid user or password"))
+		return
+	}
+	req, err := parseQueryRequest(w, r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	start := time.Now()
+	out := newStream(w, negotiateFormat(r.Header.Get("Accept")))
+	err = m.query(r, user, req, out)
+	out.end(err)
+	if err != nil {
+		u.Debugf("http query error: %v", err)
+		return
+	}
+	u.Infof("http query completed in %v", time.Since(start))
+}
+
+// result receives the columns then rows of a query
+type result interface {
+	columns(cols []column) error
+	row(vals []driver.Value) error
+}
+
+// query plans and runs the request, writing its result to out
+func (m *HttpListener) query(r *http.Request, user *models.UserConfig, req *queryRequest, out result) error {
+	job, err := m.plan(user, req)
+	if err != nil {
+		return err
+	}
+	return m.run(r, job, out)
+}
+
+// plan the sql of a request into a job, checking the user may run it
+func (m *HttpListener) plan(user *models.UserConfig, req *queryRequest) (*mysqlfe.MySqlJob, error) {
+
+	sch, err := m.schema(user, req.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	sess := datasource.NewContextSimple()
+	sess.Data["@@database"] = value.NewStringValue(sch.Name)
+	if user != nil {
+		sess.Data["@@user"] = value.NewStringValue(user.Name)
+	}
+
+	ctx := plan.NewContext(req.Sql)
+	ctx.DisableRecover = m.svr.Config.SupressRecover
+	ctx.Session = sess
+	ctx.Schema = sch
+	ctx.Funcs = fr
+	job, err := mysqlfe.BuildMySqlJob(m.svr, ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		if table := user.DeniedTable(job.Ctx); table != "" {
+			job.Close()
+			u.Warnf("user %q not allowed table=%s", user.Name, table)
+			return nil, newError(http.StatusForbidden, codeAccessDenied, "access denied for user %q to table %s", user.Name, table)
+		}
+	}
+	return job, nil
+}
+
+// run the job writing its result to out.  It is cancelled if the client
+// goes away or a select runs longer than max_execution_time.
+func (m *HttpListener) run(r *http.Request, job *mysqlfe.MySqlJob, out result) error {
+
+	var timeout time.Duration
+	var resultWriter exec.Task
+	var rw *results.RowWriter
+	var ew *results.ExecWriter
+	switch stmt := job.Ctx.Stmt.(type) {
+	case *rel.SqlSelect, *rel.SqlShow, *rel.SqlDescribe:
+		if err := out.columns(projColumns(job.Ctx)); err != nil {
+			job.Close()
+			return err
+		}
+		rw = results.NewRowWriter(job.Ctx, out.row)
+		resultWriter = rw
+		if _, isSelect := stmt.(*rel.SqlSelect); isSelect && m.svr.Config.MaxExecTime > 0 {
+			timeout = time.Duration(m.svr.Config.MaxExecTime) * time.Millisecond
+		}
+	case *rel.SqlInsert, *rel.SqlUpsert, *rel.SqlUpdate, *rel.SqlDelete:
+		ew = results.NewExecWriter(job.Ctx)
+		resultWriter = ew
+	case *rel.SqlCommand, *rel.SqlCreate, *rel.SqlDrop, *rel.SqlAlter:
+		err := job.Run()
+		job.Close()
+		if err != nil {
+			return err
+		}
+		return out.columns([]column{})
+	default:
+		job.Close()
+		u.Warnf("sql not supported?  %v  %T", stmt, stmt)
+		return newError(http.StatusBadRequest, codeNotSupported, "statement type %T not supported", stmt)
+	}
+
+	if err := job.Finalize(resultWriter); err != nil {
+		job.Close()
+		return err
+	}
+
+	err := results.RunWithDeadline(job.GridTask, r.Context(), timeout)
+	switch {
+	case err == results.ErrDeadlineExceeded:
+		err = newError(http.StatusGatewayTimeout, codeTimeout, "query exceeded max_execution_time of %v", timeout)
+	case err == results.ErrCancelled:
+		err = newError(http.StatusServiceUnavailable, codeCanceled, "query was cancelled")
+	case err == nil && rw != nil:
+		err = rw.Err
+	case err == nil && ew != nil:
+		err = ew.Err
+	}
+	if closeErr := job.Close(); closeErr != nil {
+		u.Errorf("could not close ? %v", closeErr)
+	}
+	if err != nil || ew == nil {
+		return err
+	}
+	if err := out.columns([]column{{Name: "affected_rows", Type: value.IntType.String()}}); err != nil {
+		return err
+	}
+	return out.row([]driver.Value{ew.Affected})
+}
+
+// schema the named schema, the information_schema if name is empty
+func (m *HttpListener) schema(user *models.UserConfig, name string) (*schema.Schema, error) {
+	if name == "" {
+		s, err := m.svr.InfoSchema()
+		if err != nil {
+			return nil, err
+		}
+		return s.InfoSchema, nil
+	}
+	if user != nil && !user.AllowSchema(name) {
+		return nil, newError(http.StatusForbidden, codeAccessDenied, "access denied for user %q to schema %q", user.Name, name)
+	}
+	s, ok := m.svr.Schema(name)
+	if s == nil || !ok {
+		return nil, newError(http.StatusNotFound, codeUnknownSchema, "unknown schema %q", name)
+	}
+	return s, nil
+}
+
+// httpError an error response, as json
+//
+//	{"error":{"code":"unknown_schema","message":"unknown schema \"x\""}}
+type httpError struct {
+	status  int
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// error codes of httpError
+const (
+	codeBadRequest    = "bad_request"
+	codeUnauthorized  = "unauthorized"
+	codeAccessDenied  = "access_denied"
+	codeNotFound      = "not_found"
+	codeUnknownSchema = "unknown_schema"
+	codeUnavailable   = "unavailable"
+	codeParseError    = "parse_error"
+	codeNotSupported  = "not_supported"
+	codeTooLarge      = "too_large"
+	codeTimeout       = "timeout"
+	codeCanceled      = "canceled"
+	codeInternal      = "internal"
+)
+
+func newError(status int, code, format string, args ...interface{}) *httpError {
+	return &httpError{status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func (m *httpError) Error() string {
+	return m.Message
+}
+
+// toHttpError the response of err, errors of the planner and backends
+// are mapped to a status where known.
+func toHttpError(err error) *httpError {
+	if e, ok := err.(*httpError); ok {
+		return e
+	}
+	switch models.ErrorKindOf(err) {
+	case models.ErrNotFound:
+		return newError(http.StatusNotFound, codeNotFound, "%v", err)
+	case models.ErrUnavailable:
+		return newError(http.StatusBadGateway, codeUnavailable, "%v", err)
+	case models.ErrTimeout:
+		return newError(http.StatusGatewayTimeout, codeTimeout, "%v", err)
+	case models.ErrUnsupported:
+		return newError(http.StatusBadRequest, codeNotSupported, "%v", err)
+	case models.ErrDenied:
+		return newError(http.StatusForbidden, codeAccessDenied, "%v", err)
+	case models.ErrSyntax:
+		return newError(http.StatusBadRequest, codeParseError, "%v", err)
+	}
+	return newError(http.StatusInternalServerError, codeInternal, "%v", err)
+}
+
+// writeError the response of a request that failed before its result
+// was started
+func writeError(w http.ResponseWriter, err error) {
+	he := toHttpError(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(he.status)
+	json.NewEncoder(w).Encode(map[string]*httpError{"error": he})
+}
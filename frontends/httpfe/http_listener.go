@@ -0,0 +1,126 @@
+package httpfe
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	u "github.com/araddon/gou"
+
+	"github.com/dataux/dataux/models"
+)
+
+// ListenerType the frontend config type of the http listener
+const ListenerType = "http"
+
+var (
+	// Ensure we meet our interfaces
+	_ models.Listener = (*HttpListener)(nil)
+	_ http.Handler    = (*HttpListener)(nil)
+)
+
+func init() {
+	// Register our Http Frontend Listener
+	models.ListenerRegister(ListenerType, func() models.Listener { return &HttpListener{} })
+}
+
+// HttpListener a frontend answering sql queries POSTed over http with
+// results streamed as json, newline delimited json or csv.
+//
+//	curl -u analyst:secret -H "Accept: text/csv" \
+//	    -H "Content-Type: application/json" \
+//	    -d '{"schema":"datauxtest","sql":"SELECT * FROM article"}' \
+//	    http://127.0.0.1:4080/query
+type HttpListener struct {
+	svr  *models.ServerCtx
+	conf *models.ListenerConfig
+	auth models.Authenticator
+	l    net.Listener
+	srv  *http.Server
+}
+
+// Init is part of frontend interface to accept config and global server context at start
+func (m *HttpListener) Init(conf *models.ListenerConfig, svr *models.ServerCtx) error {
+	m.svr = svr
+	m.conf = conf
+	m.auth = svr.Auth
+	if len(conf.Users) > 0 {
+		if m.auth == nil {
+			u.Warnf("ignoring users of listener %s, there is no users config", conf.Addr)
+		} else {
+			m.auth = models.NewListenerAuthenticator(m.auth, conf.Users)
+		}
+	}
+
+	tlsConf, err := conf.TLSConfig()
+	if err != nil {
+		return err
+	}
+	m.l, err = net.Listen("tcp", conf.Addr)
+	if err != nil {
+		u.Errorf("could not init http listener: %v", err)
+		return err
+	}
+	if tlsConf != nil {
+		m.l = tls.NewListener(m.l, tlsConf)
+	}
+	m.srv = &http.Server{Handler: m, ReadHeaderTimeout: 30 * time.Second}
+	return nil
+}
+
+func (m *HttpListener) Run(stop chan bool) error {
+	err := m.srv.Serve(m.l)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+func (m *HttpListener) Close() error {
+	if m.srv == nil {
+		return nil
+	}
+	return m.srv.Close()
+}
+
+func (m *HttpListener) String() string {
+	return fmt.Sprintf("Http Frontend address:%v", m.conf.Addr)
+}
+
+func (m *HttpListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/query":
+		m.handleQuery(w, r)
+	case "/changes":
+		m.handleChanges(w, r)
+	default:
+		writeError(w, newError(http.StatusNotFound, codeNotFound, "no such endpoint %s", r.URL.Path))
+	}
+}
+
+// authenticate the basic auth user of a request.  Without an
+// authenticator there are no users and any client may query, with the
+// listener password if there is one.
+func (m *HttpListener) authenticate(r *http.Request) (*models.UserConfig, bool) {
+	name, password, hasAuth := r.BasicAuth()
+	if m.auth == nil {
+		if m.conf.Password == "" {
+			return nil, true
+		}
+		return nil, hasAuth && subtle.ConstantTimeCompare([]byte(password), []byte(m.conf.Password)) == 1
+	}
+	if !hasAuth {
+		return nil, false
+	}
+	user, err := m.auth.User(name)
+	if err != nil {
+		if err != models.ErrUserNotFound {
+			u.Warnf("could not find user %q: %v", name, err)
+		}
+		return nil, false
+	}
+	return user, user.CheckPassword(password)
+}
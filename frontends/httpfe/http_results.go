@@ -0,0 +1,260 @@
+package httpfe
+
+import (
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/araddon/qlbridge/plan"
+)
+
+const (
+	// result formats, chosen by the Accept header
+	formatJSON   = "application/json"
+	formatNDJSON = "application/x-ndjson"
+	formatCSV    = "text/csv"
+
+	// errorTrailer the trailer carrying an error that happened after the
+	// result started, the only way csv results can report one
+	errorTrailer = "X-Dataux-Error"
+
+	// rowBatchSize rows written between flushes to the client
+	rowBatchSize = 200
+)
+
+// column the name and qlbridge value type of a result column
+type column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// projColumns the result columns of a planned statement
+func projColumns(ctx *plan.Context) []column {
+	cols := make([]column, 0)
+	if ctx.Projection == nil || ctx.Projection.Proj == nil {
+		return cols
+	}
+	for _, col := range ctx.Projection.Proj.Columns {
+		name := col.Name
+		if col.Col != nil {
+			name = col.Col.As
+		}
+		cols = append(cols, column{Name: name, Type: col.Type.String()})
+	}
+	return cols
+}
+
+// negotiateFormat the result format of an Accept header, json unless
+// csv or ndjson is asked for.
+func negotiateFormat(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		switch strings.ToLower(mediaType) {
+		case formatCSV:
+			return formatCSV
+		case formatNDJSON, "application/ndjson":
+			return formatNDJSON
+		case formatJSON:
+			return formatJSON
+		}
+	}
+	return formatJSON
+}
+
+// stream writes a result to the client as rows arrive, flushing every
+// rowBatchSize rows.  Columns come first, then rows, then the row count
+// and error if any:
+//
+//	json:    {"columns":[...],"rows":[[...],...],"row_count":2}
+//	ndjson:  {"columns":[...]}  [...]  [...]  {"row_count":2}  one per line
+//	csv:     header of column names, then rows, errors in the trailer
+type stream struct {
+	w       http.ResponseWriter
+	format  string
+	csv     *csv.Writer
+	started bool
+	rowCt   int64
+	pending int // rows written since last flush
+}
+
+func newStream(w http.ResponseWriter, format string) *stream {
+	m := &stream{w: w, format: format}
+	if format == formatCSV {
+		m.csv = csv.NewWriter(w)
+	}
+	return m
+}
+
+// columns starts the result, writing its columns
+func (m *stream) columns(cols []column) error {
+	if m.started {
+		return fmt.Errorf("result already started")
+	}
+	m.started = true
+	m.w.Header().Set("Content-Type", m.format)
+	m.w.Header().Set("Trailer", errorTrailer)
+	m.w.WriteHeader(http.StatusOK)
+
+	switch m.format {
+	case formatCSV:
+		names := make([]string, len(cols))
+		for i, col := range cols {
+			names[i] = col.Name
+		}
+		return m.csv.Write(names)
+	case formatNDJSON:
+		return m.writeJSON(map[string]interface{}{"columns": cols}, "\n")
+	}
+	if _, err := m.w.Write([]byte(`{"columns":`)); err != nil {
+		return err
+	}
+	return m.writeJSON(cols, `,"rows":[`)
+}
+
+// row writes a row of the result
+func (m *stream) row(vals []driver.Value) error {
+	var err error
+	switch m.format {
+	case formatCSV:
+		rec := make([]string, len(vals))
+		for i, v := range vals {
+			rec[i] = csvValue(v)
+		}
+		err = m.csv.Write(rec)
+	case formatNDJSON:
+		err = m.writeJSON(jsonValues(vals), "\n")
+	default:
+		sep := ",\n"
+		if m.rowCt == 0 {
+			sep = "\n"
+		}
+		if _, err = m.w.Write([]byte(sep)); err == nil {
+			err = m.writeJSON(jsonValues(vals), "")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	m.rowCt++
+	m.pending++
+	if m.pending >= rowBatchSize {
+		m.flush()
+	}
+	return nil
+}
+
+// end finishes the result, err is sent as an error response if the
+// result has not started, else after the rows.
+func (m *stream) end(err error) {
+	if !m.started {
+		if err == nil {
+			err = fmt.Errorf("no result")
+		}
+		writeError(m.w, err)
+		return
+	}
+	var he *httpError
+	if err != nil {
+		he = toHttpError(err)
+		m.w.Header().Set(errorTrailer, he.Message)
+	}
+	trailer := map[string]interface{}{"row_count": m.rowCt}
+	if he != nil {
+		trailer["error"] = he
+	}
+	switch m.format {
+	case formatCSV:
+	case formatNDJSON:
+		m.writeJSON(trailer, "\n")
+	default:
+		m.w.Write([]byte("\n],"))
+		b, _ := json.Marshal(trailer)
+		// the trailer object's fields close the result object
+		m.w.Write(b[1:])
+		m.w.Write([]byte("\n"))
+	}
+	m.flush()
+}
+
+func (m *stream) writeJSON(v interface{}, suffix string) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := m.w.Write(append(b, suffix...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *stream) flush() {
+	if m.csv != nil {
+		m.csv.Flush()
+	}
+	if f, ok := m.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	m.pending = 0
+}
+
+// jsonValues the values of a row as json marshals them
+func jsonValues(vals []driver.Value) []interface{} {
+	out := make([]interface{}, len(vals))
+	for i, v := range vals {
+		switch x := v.(type) {
+		case time.Time:
+			out[i] = x.Format(time.RFC3339Nano)
+		case []byte:
+			// bytes are base64 encoded only if they are not text
+			if utf8.Valid(x) {
+				out[i] = string(x)
+			} else {
+				out[i] = x
+			}
+		case float64:
+			if math.IsNaN(x) || math.IsInf(x, 0) {
+				out[i] = nil
+			} else {
+				out[i] = x
+			}
+		default:
+			out[i] = v
+		}
+	}
+	return out
+}
+
+// csvValue the text of a value in a csv row, nil is empty
+func csvValue(v driver.Value) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case bool:
+		return strconv.FormatBool(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case int:
+		return strconv.Itoa(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case fmt.Stringer:
+		return x.String()
+	}
+	if b, err := json.Marshal(v); err == nil {
+		return string(b)
+	}
+	return fmt.Sprintf("%v", v)
+}
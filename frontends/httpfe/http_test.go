@@ -0,0 +1,211 @@
+package httpfe
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dataux/dataux/models"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	assert.Equal(t, formatJSON, negotiateFormat(""))
+	assert.Equal(t, formatJSON, negotiateFormat("*/*"))
+	assert.Equal(t, formatCSV, negotiateFormat("text/csv; charset=utf-8"))
+	assert.Equal(t, formatNDJSON, negotiateFormat("text/html, application/x-ndjson;q=0.9"))
+	assert.Equal(t, formatNDJSON, negotiateFormat("application/ndjson"))
+}
+
+func TestParseQueryRequest(t *testing.T) {
+
+	r := httptest.NewRequest("POST", "/query?schema=other", strings.NewReader(`{"sql":"SELECT 1;","schema":"datauxtest"}`))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req, err := parseQueryRequest(httptest.NewRecorder(), r)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, &queryRequest{Sql: "SELECT 1", Schema: "datauxtest"}, req)
+
+	r = httptest.NewRequest("POST", "/query?schema=datauxtest", strings.NewReader("SELECT 2"))
+	req, err = parseQueryRequest(httptest.NewRecorder(), r)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, &queryRequest{Sql: "SELECT 2", Schema: "datauxtest"}, req)
+
+	r = httptest.NewRequest("POST", "/query", strings.NewReader(`{"sql":`))
+	r.Header.Set("Content-Type", "application/json")
+	_, err = parseQueryRequest(httptest.NewRecorder(), r)
+	assert.Equal(t, http.StatusBadRequest, toHttpError(err).status)
+
+	r = httptest.NewRequest("POST", "/query", strings.NewReader(" ; "))
+	_, err = parseQueryRequest(httptest.NewRecorder(), r)
+	assert.Equal(t, codeBadRequest, toHttpError(err).Code)
+}
+
+func writeResult(format string, err error) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	out := newStream(w, format)
+	out.columns([]column{{Name: "id", Type: "int"}, {Name: "name", Type: "string"}})
+	out.row([]driver.Value{int64(1), "bob"})
+	out.row([]driver.Value{int64(2), nil})
+	out.end(err)
+	return w
+}
+
+func TestStreamJSON(t *testing.T) {
+
+	w := writeResult(formatJSON, nil)
+	assert.Equal(t, formatJSON, w.Header().Get("Content-Type"))
+	var res struct {
+		Columns  []column
+		Rows     [][]interface{}
+		RowCount int64 `json:"row_count"`
+		Error    *httpError
+	}
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &res), w.Body.String())
+	assert.Equal(t, []column{{"id", "int"}, {"name", "string"}}, res.Columns)
+	assert.Equal(t, [][]interface{}{{float64(1), "bob"}, {float64(2), nil}}, res.Rows)
+	assert.Equal(t, int64(2), res.RowCount)
+	assert.True(t, res.Error == nil)
+
+	w = writeResult(formatJSON, fmt.Errorf("backend went away"))
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &res), w.Body.String())
+	assert.Equal(t, codeInternal, res.Error.Code)
+	assert.Equal(t, "backend went away", w.Result().Trailer.Get(errorTrailer))
+}
+
+func TestStreamNDJSON(t *testing.T) {
+	w := writeResult(formatNDJSON, nil)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Equal(t, []string{
+		`{"columns":[{"name":"id","type":"int"},{"name":"name","type":"string"}]}`,
+		`[1,"bob"]`,
+		`[2,null]`,
+		`{"row_count":2}`,
+	}, lines)
+}
+
+func TestStreamCSV(t *testing.T) {
+	w := writeResult(formatCSV, nil)
+	assert.Equal(t, "id,name\n1,bob\n2,\n", w.Body.String())
+}
+
+func TestStreamNotStarted(t *testing.T) {
+	w := httptest.NewRecorder()
+	newStream(w, formatCSV).end(newError(http.StatusNotFound, codeUnknownSchema, "unknown schema %q", "x"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"error":{"code":"unknown_schema","message":"unknown schema \"x\""}}`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestValues(t *testing.T) {
+	ts := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	assert.Equal(t, []interface{}{"2017-03-04T05:06:07Z", "abc", []byte{0xff}, nil}, jsonValues([]driver.Value{ts, []byte("abc"), []byte{0xff}, nil}))
+	assert.Equal(t, "1.5", csvValue(1.5))
+	assert.Equal(t, `{"a":1}`, csvValue(map[string]int{"a": 1}))
+}
+
+func TestAuthenticate(t *testing.T) {
+
+	auth, err := models.NewConfigAuthenticator([]*models.UserConfig{{Name: "analyst", Password: "secret"}})
+	assert.Equal(t, nil, err)
+	m := &HttpListener{conf: &models.ListenerConfig{}, auth: auth}
+
+	r := httptest.NewRequest("POST", "/query", nil)
+	_, ok := m.authenticate(r)
+	assert.True(t, !ok)
+	r.SetBasicAuth("analyst", "secret")
+	user, ok := m.authenticate(r)
+	assert.True(t, ok)
+	assert.Equal(t, "analyst", user.Name)
+	r.SetBasicAuth("analyst", "wrong")
+	_, ok = m.authenticate(r)
+	assert.True(t, !ok)
+
+	// without users only the listener password is checked
+	m = &HttpListener{conf: &models.ListenerConfig{Password: "pwd"}}
+	r = httptest.NewRequest("POST", "/query", nil)
+	_, ok = m.authenticate(r)
+	assert.True(t, !ok)
+	r.SetBasicAuth("anyone", "pwd")
+	_, ok = m.authenticate(r)
+	assert.True(t, ok)
+}
+
+func TestParseChangesRequest(t *testing.T) {
+
+	r := httptest.NewRequest("GET", "/changes?schema=datauxtest&sql=SELECT+*+FROM+users%3B&interval=1s&key=id,+name", nil)
+	req, err := parseChangesRequest(r)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "SELECT * FROM users", req.Sql)
+	assert.Equal(t, time.Second, req.interval)
+	assert.Equal(t, []string{"id", "name"}, req.key)
+
+	req, err = parseChangesRequest(httptest.NewRequest("GET", "/changes?sql=SELECT+1", nil))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, defaultPollInterval, req.interval)
+	assert.Equal(t, 0, len(req.key))
+
+	_, err = parseChangesRequest(httptest.NewRequest("GET", "/changes?sql=SELECT+1&interval=1ms", nil))
+	assert.Equal(t, http.StatusBadRequest, toHttpError(err).status)
+	_, err = parseChangesRequest(httptest.NewRequest("GET", "/changes", nil))
+	assert.Equal(t, http.StatusBadRequest, toHttpError(err).status)
+}
+
+func feedRows(t *testing.T, key []string, rows ...[]driver.Value) *feedResult {
+	res := &feedResult{keyNames: key}
+	assert.Equal(t, nil, res.columns([]column{{Name: "id", Type: "int"}, {Name: "name", Type: "string"}}))
+	for _, row := range rows {
+		assert.Equal(t, nil, res.row(row))
+	}
+	return res
+}
+
+func TestDiffRows(t *testing.T) {
+
+	prev := feedRows(t, nil, []driver.Value{int64(1), "bob"}, []driver.Value{int64(2), "alice"}, []driver.Value{int64(3), "carol"})
+	next := feedRows(t, nil, []driver.Value{int64(2), "alicia"}, []driver.Value{int64(3), "carol"}, []driver.Value{int64(4), "dan"})
+	b, err := json.Marshal(diffRows(prev.rows, next.rows))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `[{"type":"remove","row":[1,"bob"]},`+
+		`{"type":"update","old":[2,"alice"],"row":[2,"alicia"]},`+
+		`{"type":"add","row":[4,"dan"]}]`, string(b))
+
+	// rows keyed by name, the changed id is an update
+	prev = feedRows(t, []string{"name"}, []driver.Value{int64(1), "bob"})
+	next = feedRows(t, []string{"name"}, []driver.Value{int64(5), "bob"})
+	events := diffRows(prev.rows, next.rows)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, "update", events[0].Type)
+	assert.Equal(t, 0, len(diffRows(next.rows, next.rows)))
+
+	res := &feedResult{keyNames: []string{"email"}}
+	err = res.columns([]column{{Name: "id", Type: "int"}})
+	assert.Equal(t, http.StatusBadRequest, toHttpError(err).status)
+}
+
+func TestSSEEvents(t *testing.T) {
+
+	w := httptest.NewRecorder()
+	out := &sseEvents{w: w, flusher: w}
+	res := feedRows(t, nil, []driver.Value{int64(1), "bob"})
+	assert.Equal(t, nil, out.send("snapshot", res.snapshot()))
+	assert.Equal(t, nil, out.heartbeat())
+	out.fail(fmt.Errorf("backend went away"))
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, "event: snapshot\n"+
+		`data: {"type":"snapshot","columns":[{"name":"id","type":"int"},{"name":"name","type":"string"}],"rows":[[1,"bob"]]}`+"\n\n"+
+		": heartbeat\n\n"+
+		"event: error\n"+
+		`data: {"type":"error","error":{"code":"internal","message":"backend went away"}}`+"\n\n", w.Body.String())
+
+	// errors before the first event are an error response
+	w = httptest.NewRecorder()
+	out = &sseEvents{w: w, flusher: w}
+	out.fail(newError(http.StatusNotFound, codeUnknownSchema, "unknown schema %q", "x"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+}
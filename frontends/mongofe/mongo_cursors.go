@@ -0,0 +1,156 @@
+package mongofe
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+const (
+	// defaultBatchSize documents in the first batch of a find, as mongod
+	defaultBatchSize = 101
+
+	// maxBatchBytes bytes of documents in a batch, leaving room for the
+	// rest of the reply within the max document size
+	maxBatchBytes = maxBsonObjectSize - 16*1024
+
+	// cursorTimeout cursors idle this long are closed
+	cursorTimeout = 10 * time.Minute
+
+	// maxResultBytes bytes of documents a query may return, they are all
+	// kept until the client has read them
+	maxResultBytes = 64 * 1024 * 1024
+
+	// maxCursorBytes bytes of documents kept by the open cursors of a
+	// listener, the least recently used are closed beyond it
+	maxCursorBytes = 512 * 1024 * 1024
+)
+
+// cursor the documents of a query not yet returned to the client
+type cursor struct {
+	ns   string // database.collection
+	user string
+	docs []bson.Raw
+	size int // bytes of docs
+	used time.Time
+}
+
+// next removes the next batch of at most n documents, any number if n is
+// negative, within maxBatchBytes
+func (m *cursor) next(n int) []bson.Raw {
+	size, i := 0, 0
+	for ; i < len(m.docs) && (n < 0 || i < n); i++ {
+		size += len(m.docs[i].Data)
+		if size > maxBatchBytes && i > 0 {
+			break
+		}
+	}
+	batch := m.docs[:i:i]
+	m.docs = m.docs[i:]
+	for _, doc := range batch {
+		m.size -= len(doc.Data)
+	}
+	return batch
+}
+
+// cursorRegistry the open cursors of a listener by id.  Drivers may send
+// a getMore on another connection of their pool, so cursors are shared
+// by the connections of a listener but only usable by the user that
+// opened them.
+type cursorRegistry struct {
+	mu      sync.Mutex
+	size    int // bytes of the documents of cursors
+	cursors map[int64]*cursor
+}
+
+func newCursorRegistry() *cursorRegistry {
+	return &cursorRegistry{cursors: make(map[int64]*cursor)}
+}
+
+// add a cursor returning its id, closing cursors idle too long and the
+// least recently used while there are more than maxCursorBytes
+func (m *cursorRegistry) add(c *cursor) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for id, old := range m.cursors {
+		if now.Sub(old.used) > cursorTimeout {
+			m.remove(id)
+		}
+	}
+	c.size = 0
+	for _, doc := range c.docs {
+		c.size += len(doc.Data)
+	}
+	for len(m.cursors) > 0 && m.size+c.size > maxCursorBytes {
+		var lru int64
+		for id, old := range m.cursors {
+			if lru == 0 || old.used.Before(m.cursors[lru].used) {
+				lru = id
+			}
+		}
+		m.remove(lru)
+	}
+	c.used = now
+	id := m.newID()
+	m.cursors[id] = c
+	m.size += c.size
+	return id
+}
+
+// newID a random positive 63 bit cursor id not in use, ids are not
+// guessable by other users of the listener
+func (m *cursorRegistry) newID() int64 {
+	var b [8]byte
+	for {
+		rand.Read(b[:])
+		id := int64(binary.BigEndian.Uint64(b[:]) >> 1)
+		if _, used := m.cursors[id]; id != 0 && !used {
+			return id
+		}
+	}
+}
+
+// remove cursor id
+func (m *cursorRegistry) remove(id int64) {
+	if c := m.cursors[id]; c != nil {
+		m.size -= c.size
+		delete(m.cursors, id)
+	}
+}
+
+// next the next batch of at most n documents of cursor id, and the id to
+// continue with which is 0 once the cursor is exhausted.  ok is false
+// if there is no such cursor of ns and user.
+func (m *cursorRegistry) next(id int64, ns, user string, n int) (batch []bson.Raw, nextID int64, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.cursors[id]
+	if c == nil || c.ns != ns || c.user != user {
+		return nil, 0, false
+	}
+	m.size -= c.size
+	batch = c.next(n)
+	m.size += c.size
+	c.used = time.Now()
+	if len(c.docs) == 0 {
+		m.remove(id)
+		return batch, 0, true
+	}
+	return batch, id, true
+}
+
+// kill cursor id of ns and user, false if there is none
+func (m *cursorRegistry) kill(id int64, ns, user string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.cursors[id]
+	if c == nil || c.ns != ns || c.user != user {
+		return false
+	}
+	m.remove(id)
+	return true
+}
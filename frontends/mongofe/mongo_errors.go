@@ -0,0 +1,96 @@
+package mongofe
+
+import (
+	"fmt"
+
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/dataux/dataux/models"
+)
+
+// error codes of the command errors we send
+//
+//	https://github.com/mongodb/mongo/blob/master/src/mongo/base/error_codes.yml
+const (
+	codeInternalError        = 1
+	codeBadValue             = 2
+	codeHostUnreachable      = 6
+	codeFailedToParse        = 9
+	codeUnauthorized         = 13
+	codeAuthenticationFailed = 18
+	codeNamespaceNotFound    = 26
+	codeCursorNotFound       = 43
+	codeMaxTimeMSExpired     = 50
+	codeCommandNotFound      = 59
+	codeCommandNotSupported  = 115
+	codeExceededMemoryLimit  = 146
+	codeMechanismUnavailable = 334
+	codeInterrupted          = 11601
+)
+
+// codeNames the codeName of each code sent
+var codeNames = map[int]string{
+	codeInternalError:        "InternalError",
+	codeBadValue:             "BadValue",
+	codeHostUnreachable:      "HostUnreachable",
+	codeFailedToParse:        "FailedToParse",
+	codeUnauthorized:         "Unauthorized",
+	codeAuthenticationFailed: "AuthenticationFailed",
+	codeNamespaceNotFound:    "NamespaceNotFound",
+	codeCursorNotFound:       "CursorNotFound",
+	codeMaxTimeMSExpired:     "MaxTimeMSExpired",
+	codeCommandNotFound:      "CommandNotFound",
+	codeCommandNotSupported:  "CommandNotSupported",
+	codeExceededMemoryLimit:  "ExceededMemoryLimit",
+	codeMechanismUnavailable: "MechanismUnavailable",
+	codeInterrupted:          "Interrupted",
+}
+
+// mongoError a command that failed, sent as its reply
+//
+//	{ok: 0, errmsg: "...", code: 26, codeName: "NamespaceNotFound"}
+type mongoError struct {
+	code    int
+	message string
+}
+
+func newError(code int, format string, args ...interface{}) *mongoError {
+	return &mongoError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+func (m *mongoError) Error() string {
+	return m.message
+}
+
+// reply the error reply document
+func (m *mongoError) reply() bson.D {
+	return bson.D{
+		{Name: "ok", Value: 0.0},
+		{Name: "errmsg", Value: m.message},
+		{Name: "code", Value: m.code},
+		{Name: "codeName", Value: codeNames[m.code]},
+	}
+}
+
+// toMongoError the command error of err, errors of the planner and
+// backends are mapped to a code where known.
+func toMongoError(err error) *mongoError {
+	if e, ok := err.(*mongoError); ok {
+		return e
+	}
+	switch models.ErrorKindOf(err) {
+	case models.ErrNotFound:
+		return newError(codeNamespaceNotFound, "%v", err)
+	case models.ErrUnavailable:
+		return newError(codeHostUnreachable, "%v", err)
+	case models.ErrTimeout:
+		return newError(codeMaxTimeMSExpired, "%v", err)
+	case models.ErrUnsupported:
+		return newError(codeCommandNotSupported, "%v", err)
+	case models.ErrDenied:
+		return newError(codeUnauthorized, "%v", err)
+	case models.ErrSyntax:
+		return newError(codeFailedToParse, "%v", err)
+	}
+	return newError(codeInternalError, "%v", err)
+}
@@ -0,0 +1,332 @@
+package mongofe
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	u "github.com/araddon/gou"
+
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/dataux/dataux/frontends/mysqlfe"
+	"github.com/dataux/dataux/models"
+	"github.com/dataux/dataux/version"
+)
+
+const (
+	// maxWireVersion the wire version of mongo 4.4 whose commands we
+	// speak, clients use OP_MSG from 3.6
+	maxWireVersion = 9
+
+	// mongoVersion the server version reported by buildInfo
+	mongoVersion = "4.4.0"
+)
+
+// connectionID the id of each connection, as reported by hello
+var connectionID int32
+
+// mongoHandler a client connection of the mongo listener
+type mongoHandler struct {
+	l         *MongoListener
+	conn      net.Conn
+	r         *bufio.Reader
+	id        int32
+	requestID int32
+	authed    bool               // may run commands
+	name      string             // the authenticated user name
+	user      *models.UserConfig // the authenticated user, nil without an authenticator
+	mu        sync.Mutex
+	job       *mysqlfe.MySqlJob
+}
+
+func newMongoHandler(l *MongoListener, c net.Conn) *mongoHandler {
+	return &mongoHandler{
+		l:      l,
+		conn:   c,
+		r:      bufio.NewReader(c),
+		id:     atomic.AddInt32(&connectionID, 1),
+		authed: !l.requiresAuth(),
+	}
+}
+
+// run reads and replies to commands until the client goes away
+func (m *mongoHandler) run() {
+	for {
+		req, err := readMessage(m.r)
+		if err != nil {
+			if err != io.EOF {
+				u.Warnf("mongo read error %s: %v", m.conn.RemoteAddr(), err)
+			}
+			return
+		}
+		doc, err := m.handle(req)
+		if err != nil {
+			u.Debugf("mongo %s error: %v", req.name(), err)
+			doc = toMongoError(err).reply()
+		}
+		if req.moreToCome {
+			continue
+		}
+		m.requestID++
+		if err := writeReply(m.conn, m.requestID, req, doc); err != nil {
+			u.Warnf("mongo write error %s: %v", m.conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// Close the connection, cancelling any running query
+func (m *mongoHandler) Close() error {
+	m.mu.Lock()
+	job := m.job
+	m.mu.Unlock()
+	if job != nil {
+		job.Cancel()
+	}
+	return m.conn.Close()
+}
+
+func (m *mongoHandler) setJob(job *mysqlfe.MySqlJob) {
+	m.mu.Lock()
+	m.job = job
+	m.mu.Unlock()
+}
+
+// userName the authenticated user name, "" if none
+func (m *mongoHandler) userName() string {
+	return m.name
+}
+
+// handle a command returning its reply.  Until authenticated only the
+// commands of the handshake and authentication may run.
+func (m *mongoHandler) handle(req *message) (bson.D, error) {
+
+	name := req.name()
+	switch name {
+	case "":
+		return nil, newError(codeFailedToParse, "empty command")
+	case "hello", "isMaster", "ismaster":
+		return m.hello(req), nil
+	case "buildInfo", "buildinfo":
+		return buildInfo(), nil
+	case "ping", "endSessions":
+		return okReply(), nil
+	case "whatsmyuri":
+		return bson.D{{Name: "you", Value: m.conn.RemoteAddr().String()}, {Name: "ok", Value: 1.0}}, nil
+	case "connectionStatus":
+		return m.connectionStatus(), nil
+	case "saslStart":
+		return m.saslStart(req)
+	case "logout":
+		m.authed, m.name, m.user = !m.l.requiresAuth(), "", nil
+		return okReply(), nil
+	}
+
+	if !m.authed {
+		return nil, newError(codeUnauthorized, "command %s requires authentication", name)
+	}
+	switch name {
+	case "listDatabases":
+		return m.listDatabases(req)
+	case "listCollections":
+		return m.listCollections(req)
+	case "find":
+		return m.find(req)
+	case "aggregate":
+		return m.aggregate(req)
+	case "getMore":
+		return m.getMore(req)
+	case "killCursors":
+		return m.killCursors(req)
+	}
+	return nil, newError(codeCommandNotFound, "no such command: '%s'", name)
+}
+
+func okReply() bson.D {
+	return bson.D{{Name: "ok", Value: 1.0}}
+}
+
+// hello the handshake reply describing this server, to hello or the
+// legacy isMaster
+func (m *mongoHandler) hello(req *message) bson.D {
+	primary := "ismaster"
+	if req.name() == "hello" {
+		primary = "isWritablePrimary"
+	}
+	doc := bson.D{
+		{Name: primary, Value: true},
+		{Name: "maxBsonObjectSize", Value: maxBsonObjectSize},
+		{Name: "maxMessageSizeBytes", Value: maxMessageSize},
+		{Name: "maxWriteBatchSize", Value: 100000},
+		{Name: "localTime", Value: time.Now()},
+		{Name: "connectionId", Value: m.id},
+		{Name: "minWireVersion", Value: 0},
+		{Name: "maxWireVersion", Value: maxWireVersion},
+		{Name: "readOnly", Value: true},
+	}
+	if truthy(lookup(req.cmd, "helloOk")) {
+		doc = append(doc, bson.DocElem{Name: "helloOk", Value: true})
+	}
+	if _, ok := lookup(req.cmd, "saslSupportedMechs").(string); ok {
+		doc = append(doc, bson.DocElem{Name: "saslSupportedMechs", Value: []string{"PLAIN"}})
+	}
+	return append(doc, bson.DocElem{Name: "ok", Value: 1.0})
+}
+
+func buildInfo() bson.D {
+	return bson.D{
+		{Name: "version", Value: mongoVersion},
+		{Name: "versionArray", Value: []int{4, 4, 0, 0}},
+		{Name: "dataux", Value: version.Version},
+		{Name: "bits", Value: 64},
+		{Name: "maxBsonObjectSize", Value: maxBsonObjectSize},
+		{Name: "modules", Value: []string{}},
+		{Name: "ok", Value: 1.0},
+	}
+}
+
+// connectionStatus the authenticated user of the connection
+func (m *mongoHandler) connectionStatus() bson.D {
+	users := make([]bson.D, 0, 1)
+	if m.name != "" {
+		users = append(users, bson.D{{Name: "user", Value: m.name}, {Name: "db", Value: "$external"}})
+	}
+	return bson.D{
+		{Name: "authInfo", Value: bson.D{
+			{Name: "authenticatedUsers", Value: users},
+			{Name: "authenticatedUserRoles", Value: []bson.D{}},
+		}},
+		{Name: "ok", Value: 1.0},
+	}
+}
+
+// saslStart authenticates with the PLAIN mechanism, whose one message is
+// authzid NUL user NUL password.  The native password hash of a user
+// can't derive the keys of SCRAM, so it isn't supported.
+func (m *mongoHandler) saslStart(req *message) (bson.D, error) {
+
+	mech, _ := lookup(req.cmd, "mechanism").(string)
+	if mech != "PLAIN" {
+		return nil, newError(codeMechanismUnavailable, "Received authentication for mechanism %s which is not enabled", mech)
+	}
+	var payload []byte
+	switch p := lookup(req.cmd, "payload").(type) {
+	case []byte:
+		payload = p
+	case bson.Binary:
+		payload = p.Data
+	case string:
+		payload = []byte(p)
+	}
+	denied := newError(codeAuthenticationFailed, "Authentication failed.")
+	parts := bytes.Split(payload, []byte{0})
+	if len(parts) != 3 {
+		return nil, denied
+	}
+	name := string(parts[1])
+	user, ok := m.l.authenticate(name, string(parts[2]))
+	if !ok {
+		u.Warnf("mongo authentication failed for user %q from %s", name, m.conn.RemoteAddr())
+		return nil, denied
+	}
+	m.authed, m.name, m.user = true, name, user
+	return bson.D{
+		{Name: "conversationId", Value: 1},
+		{Name: "done", Value: true},
+		{Name: "payload", Value: []byte{}},
+		{Name: "ok", Value: 1.0},
+	}, nil
+}
+
+// listDatabases the schemas the user may use
+func (m *mongoHandler) listDatabases(req *message) (bson.D, error) {
+
+	match, err := nameFilter(req.cmd)
+	if err != nil {
+		return nil, err
+	}
+	nameOnly := truthy(lookup(req.cmd, "nameOnly"))
+	names := m.l.svr.Reg.Schemas()
+	sort.Strings(names)
+	dbs := make([]bson.D, 0, len(names))
+	for _, name := range names {
+		if (match != "" && name != match) || (m.user != nil && !m.user.AllowSchema(name)) {
+			continue
+		}
+		if nameOnly {
+			dbs = append(dbs, bson.D{{Name: "name", Value: name}})
+			continue
+		}
+		dbs = append(dbs, bson.D{
+			{Name: "name", Value: name},
+			{Name: "sizeOnDisk", Value: int64(0)},
+			{Name: "empty", Value: false},
+		})
+	}
+	doc := bson.D{{Name: "databases", Value: dbs}}
+	if !nameOnly {
+		doc = append(doc, bson.DocElem{Name: "totalSize", Value: int64(0)})
+	}
+	return append(doc, bson.DocElem{Name: "ok", Value: 1.0}), nil
+}
+
+// listCollections the tables of a schema whose sources the user may use
+func (m *mongoHandler) listCollections(req *message) (bson.D, error) {
+
+	match, err := nameFilter(req.cmd)
+	if err != nil {
+		return nil, err
+	}
+	sch, err := m.l.schema(m.user, req.db)
+	if err != nil {
+		return nil, err
+	}
+	nameOnly := truthy(lookup(req.cmd, "nameOnly"))
+	names := sch.Tables()
+	sort.Strings(names)
+	colls := make([]bson.Raw, 0, len(names))
+	for _, name := range names {
+		if match != "" && name != match {
+			continue
+		}
+		if m.user != nil {
+			if ss, err := sch.SchemaForTable(name); err == nil && ss != nil && !m.user.AllowSource(ss.Name) {
+				continue
+			}
+		}
+		coll := bson.D{{Name: "name", Value: name}, {Name: "type", Value: "collection"}}
+		if !nameOnly {
+			coll = append(coll,
+				bson.DocElem{Name: "options", Value: bson.D{}},
+				bson.DocElem{Name: "info", Value: bson.D{{Name: "readOnly", Value: true}}},
+			)
+		}
+		b, err := bson.Marshal(coll)
+		if err != nil {
+			return nil, err
+		}
+		colls = append(colls, bson.Raw{Kind: 0x03, Data: b})
+	}
+	return cursorReply(0, req.db+".$cmd.listCollections", "firstBatch", colls), nil
+}
+
+// nameFilter the name a listDatabases or listCollections filter matches,
+// only filters by name are supported
+func nameFilter(cmd bson.D) (string, error) {
+	filter, ok := lookup(cmd, "filter").(bson.D)
+	if !ok || len(filter) == 0 {
+		return "", nil
+	}
+	if len(filter) == 1 && filter[0].Name == "name" {
+		if name, ok := filter[0].Value.(string); ok {
+			return name, nil
+		}
+	}
+	return "", newError(codeCommandNotSupported, "only filters of a name are supported")
+}
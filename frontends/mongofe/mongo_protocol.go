@@ -0,0 +1,253 @@
+package mongofe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+// opcodes of the wire protocol we speak
+//
+//	https://docs.mongodb.com/manual/reference/mongodb-wire-protocol/
+const (
+	opReply = 1
+	opQuery = 2004
+	opMsg   = 2013
+)
+
+const (
+	headerLen = 16
+
+	// maxMessageSize the largest message accepted, as advertised by hello
+	maxMessageSize = 48000000
+	// maxBsonObjectSize the largest document, as advertised by hello
+	maxBsonObjectSize = 16 * 1024 * 1024
+
+	// OP_MSG flagBits
+	msgChecksumPresent = 1 << 0
+	msgMoreToCome      = 1 << 1
+)
+
+var errMalformed = fmt.Errorf("malformed message")
+
+// message a command sent by a client, as an OP_MSG or the OP_QUERY of
+// a legacy handshake.  Document sequences of an OP_MSG are added to the
+// command as arrays named by their identifier.
+type message struct {
+	requestID  int32
+	opCode     int32
+	db         string // the database of the command
+	cmd        bson.D // the command, its name is the first element
+	moreToCome bool   // the client does not want a reply
+}
+
+// name the command name
+func (m *message) name() string {
+	if len(m.cmd) == 0 {
+		return ""
+	}
+	return m.cmd[0].Name
+}
+
+// readMessage the next message from r
+func readMessage(r io.Reader) (*message, error) {
+
+	hdr := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, err
+	}
+	length := int32(binary.LittleEndian.Uint32(hdr))
+	if length < headerLen || length > maxMessageSize {
+		return nil, fmt.Errorf("invalid message length %d", length)
+	}
+	body := make([]byte, length-headerLen)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	m := &message{
+		requestID: int32(binary.LittleEndian.Uint32(hdr[4:])),
+		opCode:    int32(binary.LittleEndian.Uint32(hdr[12:])),
+	}
+	var err error
+	switch m.opCode {
+	case opMsg:
+		err = m.parseMsg(body)
+	case opQuery:
+		err = m.parseQuery(body)
+	default:
+		err = fmt.Errorf("unsupported opcode %d", m.opCode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseMsg an OP_MSG: flagBits, sections, optional checksum
+func (m *message) parseMsg(b []byte) error {
+
+	if len(b) < 4 {
+		return errMalformed
+	}
+	flags := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	if flags&msgChecksumPresent != 0 {
+		if len(b) < 4 {
+			return errMalformed
+		}
+		b = b[:len(b)-4]
+	}
+	m.moreToCome = flags&msgMoreToCome != 0
+
+	var seqs bson.D
+	for len(b) > 0 {
+		kind := b[0]
+		b = b[1:]
+		switch kind {
+		case 0:
+			if m.cmd != nil {
+				return errMalformed
+			}
+			doc, rest, err := readDocument(b)
+			if err != nil {
+				return err
+			}
+			m.cmd, b = doc, rest
+		case 1:
+			if len(b) < 4 {
+				return errMalformed
+			}
+			size := int(int32(binary.LittleEndian.Uint32(b)))
+			if size < 4 || size > len(b) {
+				return errMalformed
+			}
+			sec := b[4:size]
+			b = b[size:]
+			i := bytes.IndexByte(sec, 0)
+			if i < 0 {
+				return errMalformed
+			}
+			id := string(sec[:i])
+			docs := make([]interface{}, 0)
+			for sec = sec[i+1:]; len(sec) > 0; {
+				doc, rest, err := readDocument(sec)
+				if err != nil {
+					return err
+				}
+				docs, sec = append(docs, doc), rest
+			}
+			seqs = append(seqs, bson.DocElem{Name: id, Value: docs})
+		default:
+			return fmt.Errorf("unknown OP_MSG section kind %d", kind)
+		}
+	}
+	if m.cmd == nil {
+		return errMalformed
+	}
+	m.cmd = append(m.cmd, seqs...)
+	m.db, _ = lookup(m.cmd, "$db").(string)
+	return nil
+}
+
+// parseQuery an OP_QUERY, supported only for commands of the legacy
+// handshake drivers start with ie isMaster on admin.$cmd
+func (m *message) parseQuery(b []byte) error {
+
+	if len(b) < 4 {
+		return errMalformed
+	}
+	b = b[4:]
+	i := bytes.IndexByte(b, 0)
+	if i < 0 || len(b) < i+9 {
+		return errMalformed
+	}
+	ns := string(b[:i])
+	// skip numberToSkip, numberToReturn
+	b = b[i+9:]
+	if !strings.HasSuffix(ns, ".$cmd") {
+		return fmt.Errorf("OP_QUERY of %q, only commands are supported", ns)
+	}
+	m.db = strings.TrimSuffix(ns, ".$cmd")
+
+	doc, _, err := readDocument(b)
+	if err != nil {
+		return err
+	}
+	// the mongo shell wraps commands {$query: {...}, $readPreference: {...}}
+	if len(doc) > 0 && doc[0].Name == "$query" {
+		if q, ok := doc[0].Value.(bson.D); ok {
+			doc = q
+		}
+	}
+	m.cmd = doc
+	return nil
+}
+
+// readDocument the bson document at the start of b, and the rest of b
+func readDocument(b []byte) (bson.D, []byte, error) {
+	if len(b) < 5 {
+		return nil, nil, errMalformed
+	}
+	size := int(int32(binary.LittleEndian.Uint32(b)))
+	if size < 5 || size > len(b) {
+		return nil, nil, errMalformed
+	}
+	doc := bson.D{}
+	if err := bson.Unmarshal(b[:size], &doc); err != nil {
+		return nil, nil, err
+	}
+	return doc, b[size:], nil
+}
+
+// writeReply the reply doc to req, an OP_REPLY to an OP_QUERY, else an
+// OP_MSG with the single body section.
+func writeReply(w io.Writer, requestID int32, req *message, doc bson.D) error {
+
+	body, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, headerLen, headerLen+20+len(body))
+	opCode := int32(opMsg)
+	if req.opCode == opQuery {
+		opCode = opReply
+		// responseFlags, int64 cursorID, startingFrom, numberReturned
+		buf = appendInt32(buf, 0)
+		buf = appendInt32(buf, 0)
+		buf = appendInt32(buf, 0)
+		buf = appendInt32(buf, 0)
+		buf = appendInt32(buf, 1)
+	} else {
+		// flagBits, section kind 0
+		buf = appendInt32(buf, 0)
+		buf = append(buf, 0)
+	}
+	buf = append(buf, body...)
+
+	binary.LittleEndian.PutUint32(buf, uint32(len(buf)))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(requestID))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(req.requestID))
+	binary.LittleEndian.PutUint32(buf[12:], uint32(opCode))
+	_, err = w.Write(buf)
+	return err
+}
+
+func appendInt32(b []byte, n int32) []byte {
+	return append(b, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+}
+
+// lookup the value of element name of doc, nil if there is none
+func lookup(doc bson.D, name string) interface{} {
+	for _, e := range doc {
+		if e.Name == name {
+			return e.Value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package mongofe
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadMessage(t *testing.T) {
+
+	body, err := bson.Marshal(bson.D{{Name: "find", Value: "article"}, {Name: "$db", Value: "datauxtest"}})
+	assert.Equal(t, nil, err)
+	doc, err := bson.Marshal(bson.D{{Name: "title", Value: "a"}})
+	assert.Equal(t, nil, err)
+
+	// a body section and a document sequence section of two documents
+	var msg []byte
+	msg = appendInt32(msg, 0)
+	msg = append(msg, 0)
+	msg = append(msg, body...)
+	msg = append(msg, 1)
+	msg = appendInt32(msg, int32(4+len("docs")+1+2*len(doc)))
+	msg = append(msg, "docs\x00"...)
+	msg = append(msg, doc...)
+	msg = append(msg, doc...)
+
+	hdr := appendInt32(nil, int32(headerLen+len(msg)))
+	hdr = appendInt32(hdr, 7)
+	hdr = appendInt32(hdr, 0)
+	hdr = appendInt32(hdr, opMsg)
+	req, err := readMessage(bytes.NewReader(append(hdr, msg...)))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int32(7), req.requestID)
+	assert.Equal(t, "find", req.name())
+	assert.Equal(t, "datauxtest", req.db)
+	docs, ok := lookup(req.cmd, "docs").([]interface{})
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(docs))
+
+	var out bytes.Buffer
+	assert.Equal(t, nil, writeReply(&out, 1, req, okReply()))
+	b := out.Bytes()
+	assert.Equal(t, len(b), int(binary.LittleEndian.Uint32(b)))
+	assert.Equal(t, int32(7), int32(binary.LittleEndian.Uint32(b[8:])))
+	assert.Equal(t, int32(opMsg), int32(binary.LittleEndian.Uint32(b[12:])))
+	reply, _, err := readDocument(b[headerLen+5:])
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1.0, lookup(reply, "ok"))
+
+	_, err = readMessage(bytes.NewReader(hdr[:8]))
+	assert.True(t, err != nil)
+}
+
+func TestRowDocument(t *testing.T) {
+	paths := [][]string{{"_id", "author"}, {"_id", "year"}, {"total"}, {"tags"}}
+	doc := rowDocument(paths, []driver.Value{[]byte("bob"), uint64(2017), int64(5), json.RawMessage(`["a"]`)})
+	assert.Equal(t, bson.D{
+		{Name: "_id", Value: bson.D{{Name: "author", Value: "bob"}, {Name: "year", Value: int64(2017)}}},
+		{Name: "total", Value: int64(5)},
+		{Name: "tags", Value: []interface{}{"a"}},
+	}, doc)
+}
+
+func TestCursor(t *testing.T) {
+	docs := make([]bson.Raw, 5)
+	cursors := newCursorRegistry()
+	id := cursors.add(&cursor{ns: "db.article", user: "bob", docs: docs})
+	assert.True(t, id > 0)
+
+	_, _, ok := cursors.next(id, "db.article", "alice", 2)
+	assert.True(t, !ok)
+	batch, next, ok := cursors.next(id, "db.article", "bob", 2)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(batch))
+	assert.Equal(t, id, next)
+	batch, next, _ = cursors.next(id, "db.article", "bob", -1)
+	assert.Equal(t, 3, len(batch))
+	assert.Equal(t, int64(0), next)
+	_, _, ok = cursors.next(id, "db.article", "bob", -1)
+	assert.True(t, !ok)
+}
+
+func TestCursorSize(t *testing.T) {
+	docs := []bson.Raw{{Data: make([]byte, 10)}, {Data: make([]byte, 20)}}
+	cursors := newCursorRegistry()
+	id := cursors.add(&cursor{ns: "db.article", user: "bob", docs: docs})
+	other := cursors.add(&cursor{ns: "db.article", user: "bob", docs: docs[:1]})
+	assert.NotEqual(t, id, other)
+	assert.Equal(t, 40, cursors.size)
+
+	cursors.next(id, "db.article", "bob", 1)
+	assert.Equal(t, 30, cursors.size)
+	assert.True(t, cursors.kill(other, "db.article", "bob"))
+	assert.Equal(t, 20, cursors.size)
+	cursors.next(id, "db.article", "bob", -1)
+	assert.Equal(t, 0, cursors.size)
+	assert.Equal(t, 0, len(cursors.cursors))
+}
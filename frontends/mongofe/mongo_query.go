@@ -0,0 +1,260 @@
+package mongofe
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+
+	u "github.com/araddon/gou"
+
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/araddon/qlbridge/datasource"
+	"github.com/araddon/qlbridge/expr"
+	"github.com/araddon/qlbridge/plan"
+	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/frontends/mysqlfe"
+	"github.com/dataux/dataux/frontends/results"
+)
+
+var fr = expr.NewFuncRegistry()
+
+// find the find command, as a select of its collection
+func (m *mongoHandler) find(req *message) (bson.D, error) {
+	from, err := collection(req.cmd)
+	if err != nil {
+		return nil, err
+	}
+	sql, err := findSql(req.cmd)
+	if err != nil {
+		return nil, err
+	}
+	n := defaultBatchSize
+	if v := lookup(req.cmd, "batchSize"); v != nil {
+		size, err := toInt(v)
+		if err != nil || size < 0 {
+			return nil, newError(codeBadValue, "batchSize value must be non-negative")
+		}
+		if size > 0 {
+			n = int(size)
+		}
+	}
+	// the rest of a single batch are not wanted, as of a negative limit
+	single, _ := lookup(req.cmd, "singleBatch").(bool)
+	if limit, err := toInt(lookup(req.cmd, "limit")); err == nil && limit < 0 {
+		single = true
+	}
+	return m.queryCursor(req, from, sql, n, single)
+}
+
+// aggregate the aggregate command, its pipeline as a select of its
+// collection
+func (m *mongoHandler) aggregate(req *message) (bson.D, error) {
+	from, err := collection(req.cmd)
+	if err != nil {
+		return nil, err
+	}
+	pipeline, ok := lookup(req.cmd, "pipeline").([]interface{})
+	if !ok {
+		return nil, newError(codeFailedToParse, "'pipeline' option must be specified as an array")
+	}
+	if truthy(lookup(req.cmd, "explain")) {
+		return nil, newError(codeCommandNotSupported, "explain is not supported")
+	}
+	sql, err := aggregateSql(from, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	n := -1
+	if c, ok := lookup(req.cmd, "cursor").(bson.D); ok {
+		if v := lookup(c, "batchSize"); v != nil {
+			size, err := toInt(v)
+			if err != nil || size < 0 {
+				return nil, newError(codeBadValue, "batchSize value must be non-negative")
+			}
+			n = int(size)
+		}
+	}
+	return m.queryCursor(req, from, sql, n, false)
+}
+
+// queryCursor runs sql replying with the first batch of at most n
+// documents, any number if n is negative.  Unless single, the rest are
+// kept in a cursor for getMore.
+func (m *mongoHandler) queryCursor(req *message, from, sql string, n int, single bool) (bson.D, error) {
+
+	var maxTime time.Duration
+	if v := lookup(req.cmd, "maxTimeMS"); v != nil {
+		ms, err := toInt(v)
+		if err != nil || ms < 0 {
+			return nil, newError(codeBadValue, "maxTimeMS must be a non-negative integer")
+		}
+		maxTime = time.Duration(ms) * time.Millisecond
+	}
+	docs, err := m.query(req.db, sql, maxTime)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &cursor{ns: req.db + "." + from, user: m.userName(), docs: docs}
+	batch := c.next(n)
+	var id int64
+	if len(c.docs) > 0 && !single {
+		id = m.l.cursors.add(c)
+	}
+	return cursorReply(id, c.ns, "firstBatch", batch), nil
+}
+
+// getMore the next batch of a cursor
+func (m *mongoHandler) getMore(req *message) (bson.D, error) {
+	id, err := toInt(req.cmd[0].Value)
+	if err != nil {
+		return nil, newError(codeBadValue, "cursor id must be a long")
+	}
+	from, _ := lookup(req.cmd, "collection").(string)
+	n := -1
+	if v := lookup(req.cmd, "batchSize"); v != nil {
+		size, err := toInt(v)
+		if err != nil || size < 0 {
+			return nil, newError(codeBadValue, "batchSize value must be non-negative")
+		}
+		if size > 0 {
+			n = int(size)
+		}
+	}
+	ns := req.db + "." + from
+	batch, nextID, ok := m.l.cursors.next(id, ns, m.userName(), n)
+	if !ok {
+		return nil, newError(codeCursorNotFound, "cursor id %d not found", id)
+	}
+	return cursorReply(nextID, ns, "nextBatch", batch), nil
+}
+
+// killCursors closes the cursors of a collection
+func (m *mongoHandler) killCursors(req *message) (bson.D, error) {
+	from, err := collection(req.cmd)
+	if err != nil {
+		return nil, err
+	}
+	ids, ok := lookup(req.cmd, "cursors").([]interface{})
+	if !ok {
+		return nil, newError(codeFailedToParse, "'cursors' must be an array")
+	}
+	ns := req.db + "." + from
+	killed, notFound := make([]int64, 0), make([]int64, 0)
+	for _, v := range ids {
+		id, err := toInt(v)
+		if err != nil {
+			return nil, newError(codeBadValue, "cursor id must be a long")
+		}
+		if m.l.cursors.kill(id, ns, m.userName()) {
+			killed = append(killed, id)
+		} else {
+			notFound = append(notFound, id)
+		}
+	}
+	return bson.D{
+		{Name: "cursorsKilled", Value: killed},
+		{Name: "cursorsNotFound", Value: notFound},
+		{Name: "cursorsAlive", Value: []int64{}},
+		{Name: "cursorsUnknown", Value: []int64{}},
+		{Name: "ok", Value: 1.0},
+	}, nil
+}
+
+func cursorReply(id int64, ns, batchName string, batch []bson.Raw) bson.D {
+	if batch == nil {
+		batch = make([]bson.Raw, 0)
+	}
+	return bson.D{
+		{Name: "cursor", Value: bson.D{
+			{Name: batchName, Value: batch},
+			{Name: "id", Value: id},
+			{Name: "ns", Value: ns},
+		}},
+		{Name: "ok", Value: 1.0},
+	}
+}
+
+// query runs a select in database db, returning its rows as documents.
+// It is cancelled if it runs longer than maxTime, or max_execution_time
+// if there is none.
+func (m *mongoHandler) query(db, sql string, maxTime time.Duration) ([]bson.Raw, error) {
+
+	sch, err := m.l.schema(m.user, db)
+	if err != nil {
+		return nil, err
+	}
+	u.Debugf("mongo %s: %s", db, sql)
+
+	sess := datasource.NewContextSimple()
+	sess.Data["@@database"] = value.NewStringValue(sch.Name)
+	if m.user != nil {
+		sess.Data["@@user"] = value.NewStringValue(m.user.Name)
+	}
+
+	ctx := plan.NewContext(sql)
+	ctx.DisableRecover = m.l.svr.Config.SupressRecover
+	ctx.Session = sess
+	ctx.Schema = sch
+	ctx.Funcs = fr
+	job, err := mysqlfe.BuildMySqlJob(m.l.svr, ctx, m.user)
+	if err != nil {
+		return nil, err
+	}
+	if m.user != nil {
+		if table := m.user.DeniedTable(job.Ctx); table != "" {
+			job.Close()
+			u.Warnf("user %q not allowed table=%s", m.user.Name, table)
+			return nil, newError(codeUnauthorized, "not authorized on %s to query %s", db, table)
+		}
+	}
+
+	if job.Ctx.Projection == nil || job.Ctx.Projection.Proj == nil {
+		job.Close()
+		return nil, newError(codeBadValue, "no projection for query")
+	}
+	paths := projPaths(job.Ctx.Projection.Proj)
+	var docs []bson.Raw
+	size := 0
+	rw := results.NewRowWriter(job.Ctx, func(vals []driver.Value) error {
+		doc, err := rowRaw(paths, vals)
+		if err != nil {
+			return err
+		}
+		if size += len(doc.Data); size > maxResultBytes {
+			return newError(codeExceededMemoryLimit, "query result exceeds %d bytes, add a filter or a limit", maxResultBytes)
+		}
+		docs = append(docs, doc)
+		return nil
+	})
+	if err := job.Finalize(rw); err != nil {
+		job.Close()
+		return nil, err
+	}
+
+	if maxTime == 0 && m.l.svr.Config.MaxExecTime > 0 {
+		maxTime = time.Duration(m.l.svr.Config.MaxExecTime) * time.Millisecond
+	}
+	m.setJob(job)
+	err = results.RunWithDeadline(job.GridTask, context.Background(), maxTime)
+	m.setJob(nil)
+
+	switch {
+	case err == results.ErrDeadlineExceeded:
+		err = newError(codeMaxTimeMSExpired, "operation exceeded time limit")
+	case err == results.ErrCancelled:
+		err = newError(codeInterrupted, "operation was interrupted")
+	case rw.Err != nil:
+		// the row writer stopped the job, ie the result is too large
+		err = rw.Err
+	}
+	if closeErr := job.Close(); closeErr != nil {
+		u.Errorf("could not close ? %v", closeErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
@@ -0,0 +1,99 @@
+package mongofe
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/araddon/qlbridge/rel"
+)
+
+// projPaths the field path of each column, dotted names are fields of
+// sub-documents ie the _id.author of a group by several fields.
+func projPaths(proj *rel.Projection) [][]string {
+	paths := make([][]string, len(proj.Columns))
+	for i, col := range proj.Columns {
+		name := col.Name
+		if col.Col != nil {
+			name = col.Col.As
+		}
+		paths[i] = strings.Split(name, ".")
+	}
+	return paths
+}
+
+// rowRaw the document of a row as raw bson
+func rowRaw(paths [][]string, vals []driver.Value) (bson.Raw, error) {
+	b, err := bson.Marshal(rowDocument(paths, vals))
+	if err != nil {
+		return bson.Raw{}, err
+	}
+	if len(b) > maxBsonObjectSize {
+		return bson.Raw{}, newError(codeBadValue, "document of %d bytes is larger than the max of %d", len(b), maxBsonObjectSize)
+	}
+	return bson.Raw{Kind: 0x03, Data: b}, nil
+}
+
+// rowDocument the document of a row whose columns have field paths
+func rowDocument(paths [][]string, vals []driver.Value) bson.D {
+	doc := make(bson.D, 0, len(paths))
+	for i, path := range paths {
+		var v interface{}
+		if i < len(vals) {
+			v = bsonValue(vals[i])
+		}
+		doc = setField(doc, path, v)
+	}
+	return doc
+}
+
+// setField set the field of doc at path to v, adding sub-documents
+func setField(doc bson.D, path []string, v interface{}) bson.D {
+	for i := range doc {
+		if doc[i].Name != path[0] {
+			continue
+		}
+		if sub, ok := doc[i].Value.(bson.D); ok && len(path) > 1 {
+			doc[i].Value = setField(sub, path[1:], v)
+		} else if len(path) > 1 {
+			doc[i].Value = setField(nil, path[1:], v)
+		} else {
+			doc[i].Value = v
+		}
+		return doc
+	}
+	if len(path) > 1 {
+		v = setField(nil, path[1:], v)
+	}
+	return append(doc, bson.DocElem{Name: path[0], Value: v})
+}
+
+// bsonValue a value of a row as bson: text as strings and json as
+// documents
+func bsonValue(v driver.Value) interface{} {
+	switch x := v.(type) {
+	case json.RawMessage:
+		var doc interface{}
+		if err := json.Unmarshal(x, &doc); err == nil {
+			return doc
+		}
+		return string(x)
+	case []byte:
+		if utf8.Valid(x) {
+			return string(x)
+		}
+		return x
+	case uint32:
+		return int64(x)
+	case uint64:
+		if x <= math.MaxInt64 {
+			return int64(x)
+		}
+		return float64(x)
+	}
+	return v
+}
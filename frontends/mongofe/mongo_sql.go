@@ -0,0 +1,798 @@
+package mongofe
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+// selectStmt a select statement built from a find command or the stages
+// of an aggregate pipeline
+type selectStmt struct {
+	from    string
+	outputs []output // the fields of the result documents, nil is all columns
+	where   []string
+	groupBy []string
+	having  []string
+	orderBy []string
+	limit   int64
+	offset  int64
+	grouped bool
+}
+
+// output a field of the result documents and the sql expression of its
+// value.  Names of fields of sub-documents are dotted ie _id.author
+type output struct {
+	name string
+	expr string
+}
+
+func (s *selectStmt) String() string {
+
+	var buf bytes.Buffer
+	buf.WriteString("SELECT ")
+	if len(s.outputs) == 0 {
+		buf.WriteString("*")
+	}
+	for i, o := range s.outputs {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(o.expr)
+		buf.WriteString(" AS ")
+		buf.WriteString(quoteIdent(o.name))
+	}
+	buf.WriteString(" FROM ")
+	buf.WriteString(quoteIdent(s.from))
+	if len(s.where) > 0 {
+		buf.WriteString(" WHERE ")
+		buf.WriteString(strings.Join(s.where, " AND "))
+	}
+	if len(s.groupBy) > 0 {
+		buf.WriteString(" GROUP BY ")
+		buf.WriteString(strings.Join(s.groupBy, ", "))
+	}
+	if len(s.having) > 0 {
+		buf.WriteString(" HAVING ")
+		buf.WriteString(strings.Join(s.having, " AND "))
+	}
+	if len(s.orderBy) > 0 {
+		buf.WriteString(" ORDER BY ")
+		buf.WriteString(strings.Join(s.orderBy, ", "))
+	}
+	if s.limit > 0 || s.offset > 0 {
+		limit := s.limit
+		if limit == 0 {
+			// an offset is only parsed after a limit
+			limit = math.MaxInt32
+		}
+		fmt.Fprintf(&buf, " LIMIT %d", limit)
+		if s.offset > 0 {
+			fmt.Fprintf(&buf, " OFFSET %d", s.offset)
+		}
+	}
+	return buf.String()
+}
+
+// findSql the select statement of a find command
+//
+//	{find: "article", filter: {author: "bob"}, projection: {title: 1}, sort: {count: -1}, limit: 10}
+func findSql(cmd bson.D) (string, error) {
+
+	from, err := collection(cmd)
+	if err != nil {
+		return "", err
+	}
+	s := &selectStmt{from: from}
+
+	// the filter and sort are of the documents before projection
+	var projection bson.D
+	for _, e := range cmd[1:] {
+		switch e.Name {
+		case "filter", "sort", "projection":
+			doc, ok := e.Value.(bson.D)
+			if !ok {
+				if e.Value == nil {
+					continue
+				}
+				return "", newError(codeBadValue, "%s must be an object", e.Name)
+			}
+			switch e.Name {
+			case "filter":
+				cond, err := s.filter(doc)
+				if err != nil {
+					return "", err
+				}
+				if cond != "" {
+					s.where = append(s.where, cond)
+				}
+			case "sort":
+				if err := s.sort(doc); err != nil {
+					return "", err
+				}
+			default:
+				projection = doc
+			}
+		case "limit":
+			n, err := toInt(e.Value)
+			if err != nil {
+				return "", err
+			}
+			// a negative limit only asks for a single batch
+			if n < 0 {
+				n = -n
+			}
+			s.limit = n
+		case "skip":
+			n, err := toInt(e.Value)
+			if err != nil {
+				return "", err
+			}
+			if n < 0 {
+				return "", newError(codeBadValue, "skip value must be non-negative")
+			}
+			s.offset = n
+		}
+	}
+	if len(projection) > 0 {
+		if err := s.project(projection); err != nil {
+			return "", err
+		}
+	}
+	return s.String(), nil
+}
+
+// aggregateSql the select statement of an aggregate pipeline.  The
+// pipeline must be one select so stages are limited to $match, $project,
+// one $group or $count, $sort, then $skip and $limit.
+//
+//	[{$match: {count: {$gt: 10}}}, {$group: {_id: "$author", total: {$sum: "$count"}}}, {$sort: {total: -1}}]
+func aggregateSql(from string, pipeline []interface{}) (string, error) {
+	s := &selectStmt{from: from}
+	for _, v := range pipeline {
+		stage, ok := v.(bson.D)
+		if !ok || len(stage) != 1 {
+			return "", newError(codeBadValue, "a pipeline stage specification object must contain exactly one field")
+		}
+		if err := s.stage(stage[0].Name, stage[0].Value); err != nil {
+			return "", err
+		}
+	}
+	return s.String(), nil
+}
+
+// stage add a pipeline stage to the statement
+func (s *selectStmt) stage(name string, spec interface{}) error {
+
+	switch name {
+	case "$match", "$project", "$group", "$sort", "$skip", "$limit", "$count":
+	default:
+		return newError(codeCommandNotSupported, "pipeline stage %s is not supported", name)
+	}
+	limited := s.limit > 0 || s.offset > 0
+	if limited && name != "$limit" && name != "$skip" && name != "$project" {
+		return newError(codeCommandNotSupported, "%s after $limit or $skip is not supported", name)
+	}
+
+	switch name {
+	case "$limit", "$skip":
+		n, err := toInt(spec)
+		if err != nil {
+			return err
+		}
+		if name == "$skip" {
+			if n < 0 {
+				return newError(codeBadValue, "invalid argument to $skip stage: cannot be negative")
+			}
+			if s.limit > 0 {
+				return newError(codeCommandNotSupported, "$skip after $limit is not supported")
+			}
+			s.offset += n
+			return nil
+		}
+		if n <= 0 {
+			return newError(codeBadValue, "the limit must be positive")
+		}
+		if s.limit == 0 || n < s.limit {
+			s.limit = n
+		}
+		return nil
+	case "$count":
+		field, ok := spec.(string)
+		if !ok || field == "" || strings.HasPrefix(field, "$") || strings.Contains(field, ".") {
+			return newError(codeBadValue, "the count field must be a non-empty string, not start with $ nor contain .")
+		}
+		if s.grouped {
+			return newError(codeCommandNotSupported, "$count after $group is not supported")
+		}
+		s.outputs = []output{{name: field, expr: "count(*)"}}
+		s.orderBy = nil
+		s.grouped = true
+		return nil
+	}
+
+	doc, ok := spec.(bson.D)
+	if !ok {
+		return newError(codeBadValue, "the %s stage specification must be an object", name)
+	}
+	switch name {
+	case "$match":
+		cond, err := s.filter(doc)
+		if err != nil || cond == "" {
+			return err
+		}
+		if s.grouped {
+			s.having = append(s.having, cond)
+		} else {
+			s.where = append(s.where, cond)
+		}
+		return nil
+	case "$project":
+		return s.project(doc)
+	case "$group":
+		if s.grouped {
+			return newError(codeCommandNotSupported, "only one $group stage is supported")
+		}
+		return s.group(doc)
+	default:
+		// $sort
+		return s.sort(doc)
+	}
+}
+
+// field the sql expression of a field of the documents at this point of
+// the statement, a column until fields are projected or grouped.
+func (s *selectStmt) field(name string) (string, error) {
+	if name == "" || strings.HasPrefix(name, "$") {
+		return "", newError(codeBadValue, "invalid field name %q", name)
+	}
+	if s.outputs == nil {
+		return quoteIdent(name), nil
+	}
+	for _, o := range s.outputs {
+		if o.name == name {
+			return o.expr, nil
+		}
+	}
+	return "", newError(codeBadValue, "unknown field %q, it is not in the projected or grouped fields", name)
+}
+
+// fields the outputs of an included field, one per field of it if it is
+// a sub-document ie the _id of a group by several fields.
+func (s *selectStmt) fields(name string) ([]output, error) {
+	if s.outputs == nil {
+		expr, err := s.field(name)
+		if err != nil {
+			return nil, err
+		}
+		return []output{{name: name, expr: expr}}, nil
+	}
+	var outputs []output
+	for _, o := range s.outputs {
+		if o.name == name || strings.HasPrefix(o.name, name+".") {
+			outputs = append(outputs, o)
+		}
+	}
+	if len(outputs) == 0 {
+		return nil, newError(codeBadValue, "unknown field %q, it is not in the projected or grouped fields", name)
+	}
+	return outputs, nil
+}
+
+// project a $project stage or find projection.  Fields are included with
+// 1 or true, renamed with "$field" or set to a literal.  Only exclusions
+// of fields already projected are supported, and as sources need not
+// have an _id it is only projected when asked for.
+//
+//	{title: 1, writer: "$author", _id: 0}
+func (s *selectStmt) project(doc bson.D) error {
+
+	var outputs []output
+	excluded := make(map[string]bool)
+	for _, e := range doc {
+		if e.Name == "" || strings.HasPrefix(e.Name, "$") {
+			return newError(codeBadValue, "invalid projection field %q", e.Name)
+		}
+		switch v := e.Value.(type) {
+		case string:
+			if strings.HasPrefix(v, "$") {
+				expr, err := s.field(v[1:])
+				if err != nil {
+					return err
+				}
+				outputs = append(outputs, output{name: e.Name, expr: expr})
+				continue
+			}
+			outputs = append(outputs, output{name: e.Name, expr: quoteLiteral(v)})
+		case bool, int, int64, float64:
+			if !truthy(v) {
+				excluded[e.Name] = true
+				continue
+			}
+			fields, err := s.fields(e.Name)
+			if err != nil {
+				return err
+			}
+			outputs = append(outputs, fields...)
+		default:
+			return newError(codeCommandNotSupported, "projection of %q by %T is not supported", e.Name, v)
+		}
+	}
+
+	if len(outputs) > 0 {
+		for name := range excluded {
+			if name != "_id" {
+				return newError(codeBadValue, "cannot do exclusion on field %s in inclusion projection", name)
+			}
+		}
+		s.outputs = outputs
+		return nil
+	}
+	if s.outputs == nil {
+		for name := range excluded {
+			if name != "_id" {
+				return newError(codeCommandNotSupported, "exclusion of %q is not supported, only of _id", name)
+			}
+		}
+		return nil
+	}
+	kept := make([]output, 0, len(s.outputs))
+	for _, o := range s.outputs {
+		root := strings.SplitN(o.name, ".", 2)[0]
+		if !excluded[o.name] && !excluded[root] {
+			kept = append(kept, o)
+		}
+	}
+	if len(kept) == 0 {
+		return newError(codeBadValue, "projection excludes all fields")
+	}
+	s.outputs = kept
+	return nil
+}
+
+// group a $group stage by a field, a document of fields or a constant
+// for one group of all documents.
+//
+//	{_id: "$author", count: {$sum: 1}, total: {$sum: "$count"}}
+func (s *selectStmt) group(doc bson.D) error {
+
+	var outputs []output
+	var groupBy []string
+	hasId := false
+	for _, e := range doc {
+		if e.Name != "_id" {
+			acc, ok := e.Value.(bson.D)
+			if !ok || len(acc) != 1 {
+				return newError(codeBadValue, "the field %q must be an accumulator object", e.Name)
+			}
+			expr, err := s.accumulator(acc[0].Name, acc[0].Value)
+			if err != nil {
+				return err
+			}
+			outputs = append(outputs, output{name: e.Name, expr: expr})
+			continue
+		}
+
+		hasId = true
+		switch id := e.Value.(type) {
+		case bson.D:
+			for _, k := range id {
+				ref, ok := k.Value.(string)
+				if !ok || !strings.HasPrefix(ref, "$") {
+					return newError(codeCommandNotSupported, "_id field %q must be a field path", k.Name)
+				}
+				expr, err := s.field(ref[1:])
+				if err != nil {
+					return err
+				}
+				groupBy = append(groupBy, expr)
+				outputs = append(outputs, output{name: "_id." + k.Name, expr: expr})
+			}
+		case string:
+			if strings.HasPrefix(id, "$") {
+				expr, err := s.field(id[1:])
+				if err != nil {
+					return err
+				}
+				groupBy = append(groupBy, expr)
+				outputs = append(outputs, output{name: "_id", expr: expr})
+				continue
+			}
+			outputs = append(outputs, output{name: "_id", expr: quoteLiteral(id)})
+		default:
+			lit, err := literal(id)
+			if err != nil {
+				return err
+			}
+			outputs = append(outputs, output{name: "_id", expr: lit})
+		}
+	}
+	if !hasId {
+		return newError(codeBadValue, "a group specification must include an _id")
+	}
+	s.outputs = outputs
+	s.groupBy = groupBy
+	// the order of documents is not kept by a group
+	s.orderBy = nil
+	s.grouped = true
+	return nil
+}
+
+// accumulatorFuncs the sql aggregate functions of $group accumulators
+var accumulatorFuncs = map[string]string{
+	"$sum": "sum",
+	"$avg": "avg",
+	"$min": "min",
+	"$max": "max",
+}
+
+// accumulator the sql aggregate of a $group accumulator of a field, or
+// a count by {$sum: 1} or {$count: {}}
+func (s *selectStmt) accumulator(op string, arg interface{}) (string, error) {
+
+	if op == "$count" {
+		return "count(*)", nil
+	}
+	fn, ok := accumulatorFuncs[op]
+	if !ok {
+		return "", newError(codeCommandNotSupported, "accumulator %s is not supported", op)
+	}
+	if ref, ok := arg.(string); ok && strings.HasPrefix(ref, "$") {
+		expr, err := s.field(ref[1:])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s(%s)", fn, expr), nil
+	}
+	if n, err := toInt(arg); err == nil && n == 1 && op == "$sum" {
+		return "count(*)", nil
+	}
+	return "", newError(codeCommandNotSupported, "%s of %v is not supported, only of a field", op, arg)
+}
+
+// sort a $sort stage or find sort
+//
+//	{count: -1, title: 1}
+func (s *selectStmt) sort(doc bson.D) error {
+	orderBy := make([]string, 0, len(doc))
+	for _, e := range doc {
+		expr, err := s.field(e.Name)
+		if err != nil {
+			return err
+		}
+		dir, err := toInt(e.Value)
+		switch {
+		case err == nil && dir == 1:
+			orderBy = append(orderBy, expr+" ASC")
+		case err == nil && dir == -1:
+			orderBy = append(orderBy, expr+" DESC")
+		default:
+			return newError(codeBadValue, "$sort key ordering must be 1 (for ascending) or -1 (for descending)")
+		}
+	}
+	s.orderBy = orderBy
+	return nil
+}
+
+// filter the sql condition of a query filter, "" if it matches all
+//
+//	{author: "bob", count: {$gte: 10}, $or: [{title: "a"}, {title: "b"}]}
+func (s *selectStmt) filter(doc bson.D) (string, error) {
+	conds := make([]string, 0, len(doc))
+	for _, e := range doc {
+		var cond string
+		var err error
+		switch {
+		case e.Name == "$and" || e.Name == "$or" || e.Name == "$nor":
+			cond, err = s.logical(e.Name, e.Value)
+		case strings.HasPrefix(e.Name, "$"):
+			err = newError(codeCommandNotSupported, "query operator %s is not supported", e.Name)
+		default:
+			cond, err = s.condition(e.Name, e.Value)
+		}
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, cond)
+	}
+	return strings.Join(conds, " AND "), nil
+}
+
+// logical the condition of $and, $or, $nor of an array of filters
+func (s *selectStmt) logical(op string, v interface{}) (string, error) {
+
+	list, ok := v.([]interface{})
+	if !ok || len(list) == 0 {
+		return "", newError(codeBadValue, "%s must be a nonempty array", op)
+	}
+	conds := make([]string, 0, len(list))
+	for _, item := range list {
+		doc, ok := item.(bson.D)
+		if !ok {
+			return "", newError(codeBadValue, "%s entries must be objects", op)
+		}
+		cond, err := s.filter(doc)
+		if err != nil {
+			return "", err
+		}
+		if cond == "" {
+			cond = "true"
+		}
+		conds = append(conds, "("+cond+")")
+	}
+	switch op {
+	case "$and":
+		return "(" + strings.Join(conds, " AND ") + ")", nil
+	case "$or":
+		return "(" + strings.Join(conds, " OR ") + ")", nil
+	}
+	return "NOT (" + strings.Join(conds, " OR ") + ")", nil
+}
+
+// condition the condition of a field of a filter, an equality match or
+// a document of operators ie {$gte: 10, $lt: 20}
+func (s *selectStmt) condition(name string, v interface{}) (string, error) {
+
+	expr, err := s.field(name)
+	if err != nil {
+		return "", err
+	}
+	switch x := v.(type) {
+	case bson.RegEx:
+		return regexCondition(expr, x.Pattern, x.Options)
+	case bson.D:
+		if len(x) == 0 || !strings.HasPrefix(x[0].Name, "$") {
+			break
+		}
+		conds := make([]string, 0, len(x))
+		for _, op := range x {
+			if op.Name == "$options" {
+				// of $regex
+				continue
+			}
+			cond, err := s.operator(name, expr, op.Name, op.Value, x)
+			if err != nil {
+				return "", err
+			}
+			conds = append(conds, cond)
+		}
+		return strings.Join(conds, " AND "), nil
+	}
+	return comparison(expr, "=", v)
+}
+
+// comparisonOps the sql operators of query comparison operators
+var comparisonOps = map[string]string{
+	"$eq":  "=",
+	"$ne":  "!=",
+	"$gt":  ">",
+	"$gte": ">=",
+	"$lt":  "<",
+	"$lte": "<=",
+}
+
+// operator the condition of a query operator on field name whose sql
+// expression is expr, ops are all the operators on the field.
+func (s *selectStmt) operator(name, expr, op string, v interface{}, ops bson.D) (string, error) {
+
+	if cmp, ok := comparisonOps[op]; ok {
+		return comparison(expr, cmp, v)
+	}
+	switch op {
+	case "$in", "$nin":
+		list, ok := v.([]interface{})
+		if !ok {
+			return "", newError(codeBadValue, "%s needs an array", op)
+		}
+		if len(list) == 0 {
+			return strconv.FormatBool(op == "$nin"), nil
+		}
+		lits := make([]string, 0, len(list))
+		matchNull := false
+		for _, item := range list {
+			if item == nil {
+				matchNull = true
+				continue
+			}
+			lit, err := literal(item)
+			if err != nil {
+				return "", err
+			}
+			lits = append(lits, lit)
+		}
+		in := "IN"
+		if op == "$nin" {
+			in = "NOT IN"
+		}
+		var conds []string
+		if len(lits) > 0 {
+			conds = append(conds, fmt.Sprintf("%s %s (%s)", expr, in, strings.Join(lits, ", ")))
+		}
+		switch {
+		case matchNull && op == "$in":
+			conds = append(conds, expr+" IS NULL")
+			return "(" + strings.Join(conds, " OR ") + ")", nil
+		case matchNull:
+			conds = append(conds, expr+" IS NOT NULL")
+		}
+		return strings.Join(conds, " AND "), nil
+	case "$exists":
+		if truthy(v) {
+			return expr + " IS NOT NULL", nil
+		}
+		return expr + " IS NULL", nil
+	case "$not":
+		cond, err := s.condition(name, v)
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + cond + ")", nil
+	case "$regex":
+		options, _ := lookup(ops, "$options").(string)
+		switch re := v.(type) {
+		case string:
+			return regexCondition(expr, re, options)
+		case bson.RegEx:
+			if options == "" {
+				options = re.Options
+			}
+			return regexCondition(expr, re.Pattern, options)
+		}
+		return "", newError(codeBadValue, "$regex has to be a string")
+	}
+	return "", newError(codeCommandNotSupported, "query operator %s is not supported", op)
+}
+
+// comparison the condition comparing expr to the value v
+func comparison(expr, op string, v interface{}) (string, error) {
+	if v == nil {
+		switch op {
+		case "=":
+			return expr + " IS NULL", nil
+		case "!=":
+			return expr + " IS NOT NULL", nil
+		}
+	}
+	lit, err := literal(v)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s %s", expr, op, lit), nil
+}
+
+// regexCondition the LIKE condition of a regex, which must be plain
+// characters optionally anchored by ^ and $ or with .* wildcards
+func regexCondition(expr, re, options string) (string, error) {
+	if options != "" {
+		return "", newError(codeCommandNotSupported, "$regex options %q are not supported", options)
+	}
+	pattern, ok := regexLike(re)
+	if !ok {
+		return "", newError(codeCommandNotSupported, "$regex /%s/ is not supported, only plain text with ^, $ and .*", re)
+	}
+	return fmt.Sprintf("%s LIKE %s", expr, quoteLiteral(pattern)), nil
+}
+
+// regexLike the LIKE pattern matching the same strings as regex re, if
+// there is one
+func regexLike(re string) (string, bool) {
+
+	prefix, suffix := "%", "%"
+	if strings.HasPrefix(re, "^") {
+		prefix, re = "", re[1:]
+	}
+	if strings.HasSuffix(re, "$") && !strings.HasSuffix(re, `\$`) {
+		suffix, re = "", re[:len(re)-1]
+	}
+
+	buf := bytes.NewBufferString(prefix)
+	for i := 0; i < len(re); i++ {
+		c := re[i]
+		switch {
+		case c == '.' && i+1 < len(re) && re[i+1] == '*':
+			buf.WriteByte('%')
+			i++
+			continue
+		case c == '\\' && i+1 < len(re) && strings.IndexByte(`\.^$*+?()[]{}|/`, re[i+1]) >= 0:
+			i++
+			c = re[i]
+		case strings.IndexByte(`\.^$*+?()[]{}|`, c) >= 0:
+			return "", false
+		}
+		if c == '%' || c == '_' {
+			// wildcards of LIKE
+			return "", false
+		}
+		buf.WriteByte(c)
+	}
+	like := buf.String() + suffix
+	for strings.Contains(like, "%%") {
+		like = strings.Replace(like, "%%", "%", -1)
+	}
+	return like, true
+}
+
+// literal the sql literal of a bson value
+func literal(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return quoteLiteral(x), nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	case int:
+		return strconv.Itoa(x), nil
+	case int64:
+		return strconv.FormatInt(x, 10), nil
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64), nil
+	case time.Time:
+		return quoteLiteral(x.UTC().Format(time.RFC3339Nano)), nil
+	case bson.ObjectId:
+		return quoteLiteral(x.Hex()), nil
+	}
+	return "", newError(codeCommandNotSupported, "value %v of type %T is not supported", v, v)
+}
+
+// collection the collection name of a command, its first value
+func collection(cmd bson.D) (string, error) {
+	name, ok := cmd[0].Value.(string)
+	if !ok {
+		return "", newError(codeBadValue, "collection name has invalid type %T", cmd[0].Value)
+	}
+	if name == "" {
+		return "", newError(codeBadValue, "invalid namespace specified")
+	}
+	return name, nil
+}
+
+func toInt(v interface{}) (int64, error) {
+	switch x := v.(type) {
+	case int:
+		return int64(x), nil
+	case int32:
+		return int64(x), nil
+	case int64:
+		return x, nil
+	case float64:
+		if x == math.Trunc(x) {
+			return int64(x), nil
+		}
+	}
+	return 0, newError(codeBadValue, "expected an integer, not %v", v)
+}
+
+// truthy bson values are true unless false, null or zero
+func truthy(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case int:
+		return x != 0
+	case int32:
+		return x != 0
+	case int64:
+		return x != 0
+	case float64:
+		return x != 0
+	}
+	return true
+}
+
+func quoteIdent(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func quoteLiteral(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `'`, `\'`, -1)
+	return "'" + s + "'"
+}
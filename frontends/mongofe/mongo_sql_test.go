@@ -0,0 +1,157 @@
+package mongofe
+
+import (
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindSql(t *testing.T) {
+
+	tests := []struct {
+		cmd bson.D
+		sql string
+	}{
+		{
+			bson.D{{Name: "find", Value: "article"}},
+			"SELECT * FROM `article`",
+		},
+		{
+			bson.D{
+				{Name: "find", Value: "article"},
+				{Name: "filter", Value: bson.D{{Name: "author", Value: "bob"}, {Name: "count", Value: bson.D{{Name: "$gte", Value: 10}, {Name: "$lt", Value: 20.5}}}}},
+				{Name: "projection", Value: bson.D{{Name: "title", Value: 1}, {Name: "_id", Value: 0}}},
+				{Name: "sort", Value: bson.D{{Name: "count", Value: -1}}},
+				{Name: "limit", Value: 10},
+				{Name: "skip", Value: int64(5)},
+			},
+			"SELECT `title` AS `title` FROM `article` WHERE `author` = 'bob' AND `count` >= 10 AND `count` < 20.5 ORDER BY `count` DESC LIMIT 10 OFFSET 5",
+		},
+		{
+			bson.D{
+				{Name: "find", Value: "article"},
+				{Name: "filter", Value: bson.D{
+					{Name: "$or", Value: []interface{}{
+						bson.D{{Name: "title", Value: bson.D{{Name: "$in", Value: []interface{}{"a", "b's"}}}}},
+						bson.D{{Name: "deleted", Value: nil}},
+					}},
+					{Name: "email", Value: bson.D{{Name: "$exists", Value: true}}},
+				}},
+				{Name: "skip", Value: 2},
+			},
+			"SELECT * FROM `article` WHERE ((`title` IN ('a', 'b\\'s')) OR (`deleted` IS NULL)) AND `email` IS NOT NULL LIMIT 2147483647 OFFSET 2",
+		},
+		{
+			bson.D{
+				{Name: "find", Value: "user"},
+				{Name: "filter", Value: bson.D{{Name: "name", Value: bson.D{{Name: "$regex", Value: "^bo.*"}}}, {Name: "age", Value: bson.D{{Name: "$not", Value: bson.D{{Name: "$gt", Value: 30}}}}}}},
+			},
+			"SELECT * FROM `user` WHERE `name` LIKE 'bo%' AND NOT (`age` > 30)",
+		},
+	}
+	for _, tt := range tests {
+		sql, err := findSql(tt.cmd)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, tt.sql, sql)
+	}
+
+	_, err := findSql(bson.D{{Name: "find", Value: "article"}, {Name: "filter", Value: bson.D{{Name: "$where", Value: "true"}}}})
+	assert.Equal(t, codeCommandNotSupported, toMongoError(err).code)
+	_, err = findSql(bson.D{{Name: "find", Value: "article"}, {Name: "projection", Value: bson.D{{Name: "title", Value: 1}, {Name: "body", Value: 0}}}})
+	assert.Equal(t, codeBadValue, toMongoError(err).code)
+}
+
+func TestAggregateSql(t *testing.T) {
+
+	tests := []struct {
+		pipeline []interface{}
+		sql      string
+	}{
+		{
+			[]interface{}{
+				bson.D{{Name: "$match", Value: bson.D{{Name: "deleted", Value: false}}}},
+				bson.D{{Name: "$group", Value: bson.D{
+					{Name: "_id", Value: "$author"},
+					{Name: "posts", Value: bson.D{{Name: "$sum", Value: 1}}},
+					{Name: "total", Value: bson.D{{Name: "$sum", Value: "$count"}}},
+				}}},
+				bson.D{{Name: "$match", Value: bson.D{{Name: "posts", Value: bson.D{{Name: "$gt", Value: 1}}}}}},
+				bson.D{{Name: "$sort", Value: bson.D{{Name: "total", Value: -1}}}},
+				bson.D{{Name: "$limit", Value: 5}},
+			},
+			"SELECT `author` AS `_id`, count(*) AS `posts`, sum(`count`) AS `total` FROM `article` WHERE `deleted` = false GROUP BY `author` HAVING count(*) > 1 ORDER BY sum(`count`) DESC LIMIT 5",
+		},
+		{
+			[]interface{}{
+				bson.D{{Name: "$group", Value: bson.D{
+					{Name: "_id", Value: bson.D{{Name: "author", Value: "$author"}, {Name: "year", Value: "$year"}}},
+					{Name: "avg", Value: bson.D{{Name: "$avg", Value: "$count"}}},
+				}}},
+				bson.D{{Name: "$project", Value: bson.D{{Name: "_id", Value: 1}, {Name: "average", Value: "$avg"}}}},
+			},
+			"SELECT `author` AS `_id.author`, `year` AS `_id.year`, avg(`count`) AS `average` FROM `article` GROUP BY `author`, `year`",
+		},
+		{
+			// the count of documents of countDocuments
+			[]interface{}{
+				bson.D{{Name: "$match", Value: bson.D{{Name: "author", Value: "bob"}}}},
+				bson.D{{Name: "$group", Value: bson.D{{Name: "_id", Value: 1}, {Name: "n", Value: bson.D{{Name: "$sum", Value: 1}}}}}},
+			},
+			"SELECT 1 AS `_id`, count(*) AS `n` FROM `article` WHERE `author` = 'bob'",
+		},
+		{
+			[]interface{}{
+				bson.D{{Name: "$project", Value: bson.D{{Name: "writer", Value: "$author"}, {Name: "title", Value: true}}}},
+				bson.D{{Name: "$match", Value: bson.D{{Name: "writer", Value: "bob"}}}},
+				bson.D{{Name: "$skip", Value: 10}},
+				bson.D{{Name: "$limit", Value: 10}},
+			},
+			"SELECT `author` AS `writer`, `title` AS `title` FROM `article` WHERE `author` = 'bob' LIMIT 10 OFFSET 10",
+		},
+		{
+			[]interface{}{
+				bson.D{{Name: "$count", Value: "total"}},
+			},
+			"SELECT count(*) AS `total` FROM `article`",
+		},
+	}
+	for _, tt := range tests {
+		sql, err := aggregateSql("article", tt.pipeline)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, tt.sql, sql)
+	}
+
+	_, err := aggregateSql("article", []interface{}{bson.D{{Name: "$unwind", Value: "$tags"}}})
+	assert.Equal(t, codeCommandNotSupported, toMongoError(err).code)
+	_, err = aggregateSql("article", []interface{}{
+		bson.D{{Name: "$limit", Value: 5}},
+		bson.D{{Name: "$group", Value: bson.D{{Name: "_id", Value: "$author"}}}},
+	})
+	assert.Equal(t, codeCommandNotSupported, toMongoError(err).code)
+	_, err = aggregateSql("article", []interface{}{
+		bson.D{{Name: "$group", Value: bson.D{{Name: "_id", Value: "$author"}}}},
+		bson.D{{Name: "$sort", Value: bson.D{{Name: "count", Value: 1}}}},
+	})
+	assert.Equal(t, codeBadValue, toMongoError(err).code)
+}
+
+func TestRegexLike(t *testing.T) {
+	tests := map[string]string{
+		"bob":      "%bob%",
+		"^bob":     "bob%",
+		"bob$":     "%bob",
+		"^b.*b$":   "b%b",
+		`^a\.b`:    "a.b%",
+		`^\$money`: "$money%",
+	}
+	for re, like := range tests {
+		pattern, ok := regexLike(re)
+		assert.True(t, ok, re)
+		assert.Equal(t, like, pattern, re)
+	}
+	for _, re := range []string{"b[ao]b", "bo+b", "a|b", "50%", "a_b"} {
+		_, ok := regexLike(re)
+		assert.True(t, !ok, re)
+	}
+}
@@ -22,31 +22,63 @@ var (
 // MySqlJob job that wraps the dataux distributed planner with a dialect specific one
 type MySqlJob struct {
 	*planner.GridTask
+	release func() // unbinds the user of the statement
 }
 
 // BuildMySqlJob Create a MySql job that wraps underlying distributed planner, and qlbridge generic implementation
 //   allowing per-method (VisitShow etc) to be replaced by a dialect specific handler.
 // - mysql `SHOW CREATE TABLE name` for example is dialect specific so needs to be replaced
 // - also wraps a distributed planner from dataux
-func BuildMySqlJob(svr *models.ServerCtx, ctx *plan.Context) (*MySqlJob, error) {
+// - user is the authenticated user of the connection, whose grants apply
+//   until the job is closed, nil if there is no authenticator
+func BuildMySqlJob(svr *models.ServerCtx, ctx *plan.Context, user *models.UserConfig) (*MySqlJob, error) {
 
-	// Ensure it parses, right now we can't handle multiple statement (ie with semi-colons separating)
-	// sql = strings.TrimRight(sql, ";")
+	release := models.BindUser(ctx, user)
+	job, err := buildMySqlJob(svr, ctx)
+	if err != nil || job == nil {
+		release()
+		return nil, err
+	}
+	job.release = release
+	return job, nil
+}
+
+func buildMySqlJob(svr *models.ServerCtx, ctx *plan.Context) (*MySqlJob, error) {
+
+	if show := parseDialectShow(ctx.Raw); show != nil {
+		return buildShowJob(svr, ctx, show)
+	}
+	if explain, err := parseExplain(ctx.Raw); err != nil {
+		return nil, err
+	} else if explain != nil {
+		return buildExplainJob(svr, ctx, explain)
+	}
+
+	// multiple statements (ie with semi-colons separating) are split
+	// by the handler, each gets its own job
 	jobPlanner := plan.NewPlanner(ctx)
 	baseJob := exec.NewExecutor(ctx, jobPlanner)
 
-	job := &planner.GridTask{JobExecutor: baseJob}
-	job.Executor = job
-	job.GridServer = svr.PlanGrid
-	job.Ctx = ctx
+	job := planner.NewGridTask(ctx, baseJob, svr.PlanGrid)
 	task, err := exec.BuildSqlJobPlanned(job.Planner, job.Executor, ctx)
 	if err != nil {
+		job.Close()
 		return nil, err
 	}
 	taskRunner, ok := task.(exec.TaskRunner)
 	if !ok {
+		job.Close()
 		return nil, fmt.Errorf("Expected TaskRunner but was %T", task)
 	}
 	job.RootTask = taskRunner
-	return &MySqlJob{job}, err
+	return &MySqlJob{GridTask: job}, err
+}
+
+// Close the job and unbind the user of its statement
+func (m *MySqlJob) Close() error {
+	err := m.GridTask.Close()
+	if m.release != nil {
+		m.release()
+	}
+	return err
 }
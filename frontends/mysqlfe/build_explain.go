@@ -0,0 +1,309 @@
+package mysqlfe
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	u "github.com/araddon/gou"
+
+	"github.com/araddon/qlbridge/plan"
+	"github.com/araddon/qlbridge/rel"
+	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/models"
+	"github.com/dataux/dataux/vendored/mixer/mysql"
+)
+
+// EXPLAIN of a select shows the task dag the planner builds for it, and
+// for each source the native request pushed down to it.  Only the planner
+// is walked, building exec tasks is what calls the backends.
+const (
+	explainTraditional = "traditional"
+	explainJson        = "json"
+)
+
+var (
+	// EXPLAIN [FORMAT = {TRADITIONAL | JSON}] select
+	explainRegex = regexp.MustCompile(`(?is)^\s*EXPLAIN\s+(?:FORMAT\s*=\s*['"]?(\w+)['"]?\s+)?(SELECT\b.*?)` + showEnd)
+
+	// the clauses of tasks the planner adds when a source can't run them
+	explainLocalClauses = map[string]string{
+		"Where":     "where",
+		"GroupBy":   "group by",
+		"Having":    "having",
+		"Order":     "order by",
+		"JoinMerge": "join",
+	}
+)
+
+// explainStmt an EXPLAIN of a select
+type explainStmt struct {
+	format string
+	sql    string
+}
+
+// parseExplain the EXPLAIN of sql, nil if it is not one
+func parseExplain(sql string) (*explainStmt, error) {
+	match := explainRegex.FindStringSubmatch(sql)
+	if match == nil {
+		return nil, nil
+	}
+	switch format := strings.ToLower(match[1]); format {
+	case "", explainTraditional:
+		return &explainStmt{format: explainTraditional, sql: match[2]}, nil
+	case explainJson:
+		return &explainStmt{format: explainJson, sql: match[2]}, nil
+	}
+	return nil, mysql.NewDefaultError(mysql.ER_UNKNOWN_EXPLAIN_FORMAT, match[1])
+}
+
+// explainTask a task of the planned dag
+type explainTask struct {
+	Task     string         `json:"task"`
+	Table    string         `json:"table,omitempty"`
+	Source   string         `json:"source,omitempty"`
+	Pushdown string         `json:"pushdown,omitempty"` // complete, partial or scan
+	Native   interface{}    `json:"native_query,omitempty"`
+	PolyFill []string       `json:"poly_fill,omitempty"`
+	Children []*explainTask `json:"children,omitempty"`
+}
+
+// explainPlan the EXPLAIN of a select
+type explainPlan struct {
+	Query       string       `json:"query"`
+	Distributed bool         `json:"distributed"`
+	PolyFill    []string     `json:"poly_fill"` // clauses run locally rather than by a source
+	Plan        *explainTask `json:"plan"`
+}
+
+// buildExplainJob plans the select of an EXPLAIN, the job sends the
+// planned dag.  The job's statement is the select so grants on its
+// tables are checked as if it were run.
+func buildExplainJob(svr *models.ServerCtx, ctx *plan.Context, explain *explainStmt) (*MySqlJob, error) {
+
+	if ctx.Schema == nil {
+		return nil, mysql.NewDefaultError(mysql.ER_NO_DB_ERROR)
+	}
+	stmt, err := rel.ParseSql(explain.sql)
+	if err != nil {
+		return nil, err
+	}
+	sel, ok := stmt.(*rel.SqlSelect)
+	if !ok {
+		return nil, mysql.NewDefaultError(mysql.ER_NOT_SUPPORTED_YET, fmt.Sprintf("EXPLAIN of %T", stmt))
+	}
+
+	planCtx := plan.NewContext(explain.sql)
+	planCtx.DisableRecover = ctx.DisableRecover
+	planCtx.Session = ctx.Session
+	planCtx.Schema = ctx.Schema
+	planCtx.Funcs = ctx.Funcs
+	planCtx.Stmt = sel
+	root, err := plan.WalkStmt(planCtx, sel, plan.NewPlanner(planCtx))
+	if root != nil {
+		defer closePlanConns(root)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ep, err := newExplainPlan(explain.sql, sel, root)
+	if err != nil {
+		return nil, err
+	}
+	cols, rows, err := ep.result(explain.format)
+	if err != nil {
+		return nil, err
+	}
+	ctx.Stmt = sel
+	return buildStaticJob(svr, ctx, cols, rows), nil
+}
+
+// newExplainPlan the EXPLAIN of the planned dag of sel
+func newExplainPlan(sql string, sel *rel.SqlSelect, root plan.Task) (*explainPlan, error) {
+	ep := &explainPlan{
+		Query:       sql,
+		Distributed: len(sel.With) > 0 && sel.With.Bool("distributed"),
+		PolyFill:    make([]string, 0),
+	}
+	task, err := ep.explainTask(root)
+	if err != nil {
+		return nil, err
+	}
+	ep.Plan = task
+	return ep, nil
+}
+
+// explainTask the EXPLAIN of t and its children, collecting the clauses
+// poly-filled locally
+func (m *explainPlan) explainTask(t plan.Task) (*explainTask, error) {
+
+	et := &explainTask{Task: taskName(t)}
+	if clause, ok := explainLocalClauses[et.Task]; ok {
+		m.addPolyFill(clause)
+	}
+
+	if p, ok := t.(*plan.Source); ok {
+		if p.Stmt != nil {
+			et.Table = p.Stmt.Name
+		}
+		if p.Tbl != nil && p.Tbl.Schema != nil && p.Tbl.Schema.Conf != nil {
+			et.Source = p.Tbl.Schema.Conf.SourceType
+		}
+		_, isPlanner := p.Conn.(plan.SourcePlanner)
+		switch {
+		case p.Complete:
+			et.Pushdown = "complete"
+		case isPlanner:
+			et.Pushdown = "partial"
+		default:
+			et.Pushdown = "scan"
+		}
+		if explainer, ok := p.Conn.(models.Explainer); ok {
+			native, polyFill, err := explainer.Explain()
+			if err != nil {
+				u.Warnf("could not explain source %s: %v", et.Table, err)
+				return nil, err
+			}
+			et.Native = native
+			et.PolyFill = polyFill
+			for _, clause := range polyFill {
+				m.addPolyFill(clause)
+			}
+		}
+	}
+
+	for _, child := range t.Children() {
+		ct, err := m.explainTask(child)
+		if err != nil {
+			return nil, err
+		}
+		et.Children = append(et.Children, ct)
+	}
+	return et, nil
+}
+
+func (m *explainPlan) addPolyFill(clause string) {
+	for _, c := range m.PolyFill {
+		if c == clause {
+			return
+		}
+	}
+	m.PolyFill = append(m.PolyFill, clause)
+}
+
+// result the columns and rows of the EXPLAIN in format.  Traditional is
+// a row per task in dag order, json a single row holding the plan.
+func (m *explainPlan) result(format string) ([]infoCol, [][]driver.Value, error) {
+
+	if format == explainJson {
+		by, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return nil, nil, err
+		}
+		return explainJsonCols, [][]driver.Value{{string(by)}}, nil
+	}
+
+	rows := make([][]driver.Value, 0)
+	var walk func(t *explainTask, parent driver.Value) error
+	walk = func(t *explainTask, parent driver.Value) error {
+		id := int64(len(rows) + 1)
+		native, err := nativeText(t.Native)
+		if err != nil {
+			return err
+		}
+		var distributed driver.Value
+		if parent == nil {
+			distributed = "NO"
+			if m.Distributed {
+				distributed = "YES"
+			}
+		}
+		rows = append(rows, []driver.Value{
+			id,
+			parent,
+			t.Task,
+			nullString(t.Table),
+			nullString(t.Source),
+			nullString(t.Pushdown),
+			native,
+			nullString(strings.Join(t.PolyFill, ",")),
+			distributed,
+		})
+		for _, child := range t.Children {
+			if err := walk(child, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(m.Plan, nil); err != nil {
+		return nil, nil, err
+	}
+	return explainCols, rows, nil
+}
+
+// taskName the type of a plan task, ie Source or Where
+func taskName(t plan.Task) string {
+	name := fmt.Sprintf("%T", t)
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// nativeText a native request as text, requests that are not already
+// text (cql, sql) are json
+func nativeText(native interface{}) (driver.Value, error) {
+	switch n := native.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return n, nil
+	}
+	by, err := json.Marshal(native)
+	if err != nil {
+		return nil, err
+	}
+	return string(by), nil
+}
+
+func nullString(s string) driver.Value {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// closePlanConns closes the source conns opened by the planner, as
+// the plan is never executed no task closes them
+func closePlanConns(t plan.Task) {
+	if p, ok := t.(*plan.Source); ok && p.Conn != nil {
+		if err := p.Conn.Close(); err != nil {
+			u.Debugf("could not close conn for %s: %v", p.Stmt, err)
+		}
+	}
+	for _, child := range t.Children() {
+		closePlanConns(child)
+	}
+}
+
+var (
+	explainCols = []infoCol{
+		{"id", value.IntType, 4},
+		{"parent_id", value.IntType, 4},
+		{"task", value.StringType, 32},
+		{"table", value.StringType, 64},
+		{"source", value.StringType, 32},
+		{"pushdown", value.StringType, 8},
+		{"native_query", value.StringType, 4096},
+		{"poly_fill", value.StringType, 64},
+		{"distributed", value.StringType, 3},
+	}
+	explainJsonCols = []infoCol{
+		{"EXPLAIN", value.StringType, 8192},
+	}
+)
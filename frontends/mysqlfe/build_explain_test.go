@@ -0,0 +1,66 @@
+package mysqlfe
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExplain(t *testing.T) {
+	tests := []struct {
+		sql    string
+		format string
+		query  string
+	}{
+		{"EXPLAIN SELECT * FROM article", explainTraditional, "SELECT * FROM article"},
+		{"explain format=json select title from article where id = 1;", explainJson, "select title from article where id = 1"},
+		{"EXPLAIN FORMAT = 'TRADITIONAL'\n SELECT 1", explainTraditional, "SELECT 1"},
+		{"EXPLAIN article", "", ""},
+		{"SELECT * FROM article", "", ""},
+	}
+	for _, tt := range tests {
+		explain, err := parseExplain(tt.sql)
+		assert.Equal(t, nil, err, tt.sql)
+		if tt.format == "" {
+			assert.True(t, explain == nil, tt.sql)
+			continue
+		}
+		assert.Equal(t, tt.format, explain.format, tt.sql)
+		assert.Equal(t, tt.query, explain.sql, tt.sql)
+	}
+
+	_, err := parseExplain("EXPLAIN FORMAT=TREE SELECT * FROM article")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestExplainResult(t *testing.T) {
+	ep := &explainPlan{
+		Query:    "select title from article where id = 1",
+		PolyFill: []string{},
+		Plan: &explainTask{Task: "Select", Children: []*explainTask{
+			{Task: "Source", Table: "article", Source: "elasticsearch", Pushdown: "complete",
+				Native: map[string]interface{}{"url": "http://localhost:9200/article/_search?size=1"}},
+			{Task: "Projection"},
+		}},
+	}
+
+	cols, rows, err := ep.result(explainTraditional)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, len(explainCols), len(cols))
+	assert.Equal(t, 3, len(rows))
+	assert.Equal(t, []driver.Value{int64(1), nil, "Select", nil, nil, nil, nil, nil, "NO"}, rows[0])
+	assert.Equal(t, []driver.Value{int64(2), int64(1), "Source", "article", "elasticsearch", "complete",
+		`{"url":"http://localhost:9200/article/_search?size=1"}`, nil, nil}, rows[1])
+	assert.Equal(t, int64(1), rows[2][1])
+
+	cols, rows, err = ep.result(explainJson)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(cols))
+	assert.Equal(t, 1, len(rows))
+	var out map[string]interface{}
+	assert.Equal(t, nil, json.Unmarshal([]byte(rows[0][0].(string)), &out))
+	assert.Equal(t, false, out["distributed"])
+	assert.Equal(t, "Select", out["plan"].(map[string]interface{})["task"])
+}
@@ -1,70 +1,392 @@
 package mysqlfe
 
-/*
-
 import (
 	"database/sql/driver"
-	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 
 	u "github.com/araddon/gou"
 
-	"github.com/araddon/qlbridge/datasource/membtree"
+	"github.com/araddon/qlbridge/datasource"
 	"github.com/araddon/qlbridge/exec"
 	"github.com/araddon/qlbridge/plan"
 	"github.com/araddon/qlbridge/rel"
+	"github.com/araddon/qlbridge/schema"
 	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/models"
+	"github.com/dataux/dataux/planner"
+	"github.com/dataux/dataux/vendored/mixer/mysql"
 )
 
 var (
 	_ = u.EMPTY
+
+	// ensure showRows is a task in the dag
+	_ exec.Task = (*showRows)(nil)
+)
+
+// Many of the SHOW statements are MySql dialect specific, rather than
+// rewriting them as a select against the qlbridge info schema they are
+// answered here from the schema.
+const (
+	showCreateTable = "create table"
+	showIndex       = "index"
+	showTableStatus = "table status"
+	showCollation   = "collation"
+	showEngines     = "engines"
 )
 
-// Many of the ShowMethods are MySql dialect specific so will be replaced here
-func (m *MySqlJob) VisitShow(sp *plan.Show) (plan.Task, plan.WalkStatus, error) {
+const (
+	// a table name, optionally qualified by schema, ie `db`.`table`
+	showIdent = "((?:`[^`]+`|[\\w$]+)(?:\\s*\\.\\s*(?:`[^`]+`|[\\w$]+))?)"
+	// a quoted LIKE pattern
+	showLike = `(?:\s+LIKE\s+('(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.|"")*"))?`
+	showEnd  = `\s*;?\s*$`
+)
+
+var (
+	// SHOW CREATE TABLE [db.]name
+	showCreateTableRegex = regexp.MustCompile(`(?i)^\s*SHOW\s+CREATE\s+TABLE\s+` + showIdent + showEnd)
+	// SHOW {INDEX | INDEXES | KEYS} {FROM | IN} [db.]name [{FROM | IN} db]
+	showIndexRegex = regexp.MustCompile(`(?i)^\s*SHOW\s+(?:INDEX|INDEXES|KEYS)\s+(?:FROM|IN)\s+` + showIdent +
+		`(?:\s+(?:FROM|IN)\s+` + showIdent + `)?` + showEnd)
+	// SHOW TABLE STATUS [{FROM | IN} db] [LIKE 'pattern']
+	showTableStatusRegex = regexp.MustCompile(`(?i)^\s*SHOW\s+TABLE\s+STATUS(?:\s+(?:FROM|IN)\s+` + showIdent + `)?` + showLike + showEnd)
+	// SHOW COLLATION [LIKE 'pattern']
+	showCollationRegex = regexp.MustCompile(`(?i)^\s*SHOW\s+COLLATION` + showLike + showEnd)
+	// SHOW [STORAGE] ENGINES
+	showEnginesRegex = regexp.MustCompile(`(?i)^\s*SHOW\s+(?:STORAGE\s+)?ENGINES` + showEnd)
+
+	qualifiedRegex = regexp.MustCompile("^(`[^`]+`|[^.`\\s]+)\\s*\\.\\s*(.+)$")
+)
+
+// dialectShow a MySql dialect SHOW statement
+type dialectShow struct {
+	what  string
+	db    string // schema named in the statement, else the session's
+	table string
+	like  *regexp.Regexp
+}
+
+// parseDialectShow the dialect SHOW statement of sql, nil if it is not one
+func parseDialectShow(sql string) *dialectShow {
+	if match := showCreateTableRegex.FindStringSubmatch(sql); match != nil {
+		db, table := splitQualified(match[1])
+		return &dialectShow{what: showCreateTable, db: db, table: table}
+	}
+	if match := showIndexRegex.FindStringSubmatch(sql); match != nil {
+		db, table := splitQualified(match[1])
+		if match[2] != "" {
+			_, db = splitQualified(match[2])
+		}
+		return &dialectShow{what: showIndex, db: db, table: table}
+	}
+	if match := showTableStatusRegex.FindStringSubmatch(sql); match != nil {
+		show := &dialectShow{what: showTableStatus}
+		if match[1] != "" {
+			_, show.db = splitQualified(match[1])
+		}
+		show.setLike(match[2])
+		return show
+	}
+	if match := showCollationRegex.FindStringSubmatch(sql); match != nil {
+		show := &dialectShow{what: showCollation}
+		show.setLike(match[1])
+		return show
+	}
+	if showEnginesRegex.MatchString(sql) {
+		return &dialectShow{what: showEngines}
+	}
+	return nil
+}
 
-	stmt := sp.Stmt
-	//u.Debugf("mysql.VisitShow create?%v  identity=%q  raw=%s", stmt.Create, stmt.Identity, stmt.Raw)
+// setLike the LIKE pattern of the statement.  Backslash escapes are left
+// for likeRegex as \% and \_ are a literal % and _.
+func (m *dialectShow) setLike(quoted string) {
+	if quoted == "" {
+		return
+	}
+	q := quoted[:1]
+	pattern := strings.Replace(quoted[1:len(quoted)-1], q+q, q, -1)
+	m.like = likeRegex(pattern)
+}
 
-	//raw := strings.ToLower(stmt.Raw)
-	switch {
-	case stmt.Create && strings.ToLower(stmt.CreateWhat) == "table":
-		// SHOW CREATE TABLE
+// splitQualified the schema and name of a possibly qualified identifier
+func splitQualified(ident string) (db, name string) {
+	parts := qualifiedRegex.FindStringSubmatch(strings.TrimSpace(ident))
+	if parts == nil {
+		return "", strings.Trim(ident, "`")
+	}
+	return strings.Trim(parts[1], "`"), strings.Trim(strings.TrimSpace(parts[2]), "`")
+}
 
-		// _, tableName, _ := expr.LeftRight(stmt.Identity)
-		// tableLower := strings.ToLower(tableName)
-		tbl, _ := m.Ctx.Schema.Table(stmt.Identity)
-		if tbl == nil {
-			u.Warnf("no table? %q", stmt.Identity)
-			return nil, rel.VisitError, fmt.Errorf("No table found for %q", stmt.Identity)
+// likeRegex the case insensitive regexp of a LIKE pattern, % matches any
+// characters, _ a single one and \ escapes them
+func likeRegex(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case c == '%':
+			b.WriteString(".*")
+		case c == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
 		}
-		// Get the create table statement
-		createStmt, err := TableCreate(tbl)
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// buildShowJob a job sending the result of a dialect SHOW statement, for
+// the grants of the authenticated user of ctx.
+func buildShowJob(svr *models.ServerCtx, ctx *plan.Context, show *dialectShow) (*MySqlJob, error) {
+
+	user, err := svr.StatementUser(ctx)
+	if err != nil {
+		return nil, mysql.NewDefaultError(mysql.ER_ACCESS_DENIED_NO_PASSWORD_ERROR, "", "%")
+	}
+	cols, rows, err := show.result(svr, ctx.Schema, user)
+	if err != nil {
+		return nil, err
+	}
+	ctx.Stmt = &rel.SqlShow{Raw: ctx.Raw, ShowType: show.what, Identity: show.table}
+	return buildStaticJob(svr, ctx, cols, rows), nil
+}
+
+// buildStaticJob a job sending rows already known, with a projection of
+// cols.  ctx.Stmt is set by the caller, it picks the result writer.
+func buildStaticJob(svr *models.ServerCtx, ctx *plan.Context, cols []infoCol, rows [][]driver.Value) *MySqlJob {
+
+	proj := rel.NewProjection()
+	names := make([]string, len(cols))
+	for i, col := range cols {
+		proj.AddColumnShort(col.name, col.typ)
+		names[i] = col.name
+	}
+	ctx.Projection = plan.NewProjectionStatic(proj)
+
+	baseJob := exec.NewExecutor(ctx, nil)
+	job := planner.NewGridTask(ctx, baseJob, svr.PlanGrid)
+	root := exec.NewTaskSequential(ctx)
+	root.Add(newShowRows(ctx, names, rows))
+	job.RootTask = root
+	return &MySqlJob{GridTask: job}
+}
+
+// result the columns and rows of the statement, sch is the schema in use.
+// A statement naming a schema or a table of a source user is not allowed
+// is denied, a nil user is allowed all.
+func (m *dialectShow) result(svr *models.ServerCtx, sch *schema.Schema, user *models.UserConfig) ([]infoCol, [][]driver.Value, error) {
+
+	if m.db != "" {
+		if user != nil && !user.AllowSchema(m.db) {
+			u.Warnf("user %q not allowed schema=%s", user.Name, m.db)
+			return nil, nil, mysql.NewDefaultError(mysql.ER_DBACCESS_DENIED_ERROR, user.Name, "%", m.db)
+		}
+		s, ok := svr.Schema(m.db)
+		if !ok || s == nil {
+			return nil, nil, mysql.NewDefaultError(mysql.ER_BAD_DB_ERROR, m.db)
+		}
+		sch = s
+	}
+
+	switch m.what {
+	case showCreateTable, showIndex:
+		tbl, err := showTable(sch, m.table)
 		if err != nil {
-			return nil, rel.VisitError, err
+			return nil, nil, err
 		}
-		rows := make([][]driver.Value, 1)
-		rows[0] = []driver.Value{tbl.Name, createStmt}
-		source := membtree.NewStaticDataSource("tables", 0, rows, []string{"Table", "Create Table"})
-		proj := rel.NewProjection()
-		proj.AddColumnShort("Table", value.StringType)
-		proj.AddColumnShort("Create Table", value.StringType)
-		m.Ctx.Projection = plan.NewProjectionStatic(proj)
+		if user != nil {
+			if ss, err := sch.SchemaForTable(tbl.Name); err == nil && ss != nil && !user.AllowSource(ss.Name) {
+				u.Warnf("user %q not allowed source=%s table=%s", user.Name, ss.Name, tbl.Name)
+				return nil, nil, mysql.NewDefaultError(mysql.ER_TABLEACCESS_DENIED_ERROR, "SHOW", user.Name, "%", tbl.Name)
+			}
+		}
+		if m.what == showCreateTable {
+			create, err := TableCreate(tbl)
+			if err != nil {
+				return nil, nil, err
+			}
+			return showCreateTableCols, [][]driver.Value{{tbl.Name, create}}, nil
+		}
+		rows := make([][]driver.Value, 0)
+		for _, row := range statisticRows(sch.Name, tbl) {
+			// the statistics columns from TABLE_NAME, less INDEX_SCHEMA
+			rows = append(rows, append(row[2:4:4], row[5:]...))
+		}
+		return showIndexCols, rows, nil
 
-		// tasks := make(exec.Tasks, 0)
-		// sourceTask := exec.NewSource(m.Ctx, nil, source)
-		// tasks.Add(sourceTask)
-		// return exec.NewSequential(m.Ctx, "show-tables", tasks), rel.VisitContinue, nil
+	case showTableStatus:
+		rows := make([][]driver.Value, 0)
+		if sch == nil {
+			return showTableStatusCols, rows, nil
+		}
+		for _, t := range schemaTables(sch, user) {
+			if m.like != nil && !m.like.MatchString(t.tbl.Name) {
+				continue
+			}
+			// the tables columns from TABLE_NAME, less TABLE_TYPE
+			row := tableRow(t)
+			rows = append(rows, append(row[2:3:3], row[4:]...))
+		}
+		return showTableStatusCols, rows, nil
 
-		u.Debugf("%p has sqlJob? %+v", m, m)
-		tasks := m.TaskMaker.Sequential("show-create-table")
+	case showCollation:
+		rows := make([][]driver.Value, 0, len(mysqlCollations))
+		for _, c := range mysqlCollations {
+			if m.like != nil && !m.like.MatchString(c.name) {
+				continue
+			}
+			dflt := ""
+			if c.dflt {
+				dflt = "Yes"
+			}
+			rows = append(rows, []driver.Value{c.name, c.charset, int64(c.id), dflt, "Yes", int64(1)})
+		}
+		return showCollationCols, rows, nil
 
-		sourcePlan := plan.NewSourceStaticPlan(m.Ctx)
-		sourceTask := exec.NewSource(sourcePlan, source)
-		tasks.Add(sourceTask)
-		return tasks, rel.VisitContinue, nil
+	case showEngines:
+		seen := make(map[string]bool)
+		engines := make([]string, 0)
+		for _, sc := range svr.Config.Sources {
+			if sc.SourceType != "" && !seen[sc.SourceType] {
+				seen[sc.SourceType] = true
+				engines = append(engines, sc.SourceType)
+			}
+		}
+		sort.Strings(engines)
+		rows := make([][]driver.Value, 0, len(engines))
+		for _, engine := range engines {
+			rows = append(rows, []driver.Value{engine, "YES", engine + " source", "NO", "NO", "NO"})
+		}
+		return showEnginesCols, rows, nil
+	}
+	return nil, nil, mysql.NewDefaultError(mysql.ER_NOT_SUPPORTED_YET, m.what)
+}
+
+// showTable the named table of sch
+func showTable(sch *schema.Schema, name string) (*schema.Table, error) {
+	if sch == nil {
+		return nil, mysql.NewDefaultError(mysql.ER_NO_DB_ERROR)
+	}
+	tbl, err := sch.Table(name)
+	if err != nil || tbl == nil {
+		u.Debugf("no table %s.%s: %v", sch.Name, name, err)
+		return nil, mysql.NewDefaultError(mysql.ER_NO_SUCH_TABLE, sch.Name, name)
+	}
+	return tbl, nil
+}
 
+var (
+	showCreateTableCols = []infoCol{
+		{"Table", value.StringType, 64},
+		{"Create Table", value.StringType, 1024},
+	}
+	showIndexCols = []infoCol{
+		{"Table", value.StringType, 64},
+		{"Non_unique", value.IntType, 1},
+		{"Key_name", value.StringType, 64},
+		{"Seq_in_index", value.IntType, 2},
+		{"Column_name", value.StringType, 64},
+		{"Collation", value.StringType, 1},
+		{"Cardinality", value.IntType, 21},
+		{"Sub_part", value.IntType, 3},
+		{"Packed", value.StringType, 10},
+		{"Null", value.StringType, 3},
+		{"Index_type", value.StringType, 16},
+		{"Comment", value.StringType, 16},
+		{"Index_comment", value.StringType, 1024},
+	}
+	showTableStatusCols = []infoCol{
+		{"Name", value.StringType, 64},
+		{"Engine", value.StringType, 64},
+		{"Version", value.IntType, 21},
+		{"Row_format", value.StringType, 10},
+		{"Rows", value.IntType, 21},
+		{"Avg_row_length", value.IntType, 21},
+		{"Data_length", value.IntType, 21},
+		{"Max_data_length", value.IntType, 21},
+		{"Index_length", value.IntType, 21},
+		{"Data_free", value.IntType, 21},
+		{"Auto_increment", value.IntType, 21},
+		{"Create_time", value.TimeType, 0},
+		{"Update_time", value.TimeType, 0},
+		{"Check_time", value.TimeType, 0},
+		{"Collation", value.StringType, 32},
+		{"Checksum", value.IntType, 21},
+		{"Create_options", value.StringType, 255},
+		{"Comment", value.StringType, 2048},
+	}
+	showCollationCols = []infoCol{
+		{"Collation", value.StringType, 32},
+		{"Charset", value.StringType, 32},
+		{"Id", value.IntType, 11},
+		{"Default", value.StringType, 3},
+		{"Compiled", value.StringType, 3},
+		{"Sortlen", value.IntType, 3},
+	}
+	showEnginesCols = []infoCol{
+		{"Engine", value.StringType, 64},
+		{"Support", value.StringType, 8},
+		{"Comment", value.StringType, 80},
+		{"Transactions", value.StringType, 3},
+		{"XA", value.StringType, 3},
+		{"Savepoints", value.StringType, 3},
+	}
+)
+
+// mysqlCollation a collation clients may ask for, results are utf8mb4
+// sent in the charset of the client
+type mysqlCollation struct {
+	name    string
+	charset string
+	id      uint8
+	dflt    bool // the default collation of its charset
+}
+
+var mysqlCollations = []mysqlCollation{
+	{"latin1_swedish_ci", "latin1", 8, true},
+	{"utf8_general_ci", "utf8", 33, true},
+	{"utf8mb4_general_ci", "utf8mb4", 45, true},
+	{"utf8mb4_bin", "utf8mb4", 46, false},
+	{"binary", "binary", 63, true},
+	{"utf8_bin", "utf8", 83, false},
+	{"utf8mb4_unicode_ci", "utf8mb4", 224, false},
+}
+
+// showRows task sending the static rows of a job, ie a dialect SHOW
+type showRows struct {
+	*exec.TaskBase
+	colIndex map[string]int
+	rows     [][]driver.Value
+}
+
+func newShowRows(ctx *plan.Context, cols []string, rows [][]driver.Value) *showRows {
+	colIndex := make(map[string]int, len(cols))
+	for i, col := range cols {
+		colIndex[col] = i
+	}
+	return &showRows{TaskBase: exec.NewTaskBase(ctx), colIndex: colIndex, rows: rows}
+}
+
+// Run send the rows then close
+func (m *showRows) Run() error {
+	defer m.Ctx.Recover()
+	outCh := m.MessageOut()
+	defer close(outCh)
+	for i, row := range m.rows {
+		select {
+		case <-m.SigChan():
+			return nil
+		case outCh <- datasource.NewSqlDriverMessageMap(uint64(i+1), row, m.colIndex):
+		}
 	}
-	return m.SqlJob.VisitShow(sp)
+	return nil
 }
-*/
@@ -0,0 +1,82 @@
+package mysqlfe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/araddon/qlbridge/datasource"
+	"github.com/araddon/qlbridge/plan"
+	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/models"
+	"github.com/dataux/dataux/vendored/mixer/mysql"
+)
+
+func TestParseDialectShow(t *testing.T) {
+	tests := []struct {
+		sql   string
+		what  string
+		db    string
+		table string
+	}{
+		{"SHOW CREATE TABLE article", showCreateTable, "", "article"},
+		{"show create table `datauxtest`.`user events`;", showCreateTable, "datauxtest", "user events"},
+		{"SHOW INDEX FROM article", showIndex, "", "article"},
+		{"SHOW KEYS IN article FROM datauxtest", showIndex, "datauxtest", "article"},
+		{"SHOW INDEXES FROM datauxtest.article", showIndex, "datauxtest", "article"},
+		{"SHOW TABLE STATUS", showTableStatus, "", ""},
+		{"SHOW TABLE STATUS FROM `datauxtest` LIKE 'art%'", showTableStatus, "datauxtest", ""},
+		{"SHOW COLLATION LIKE 'utf8%'", showCollation, "", ""},
+		{"SHOW STORAGE ENGINES", showEngines, "", ""},
+		{"SHOW TABLES", "", "", ""},
+		{"SHOW INDEX FROM article WHERE Key_name = 'PRIMARY'", "", "", ""},
+		{"SHOW CREATE DATABASE datauxtest", "", "", ""},
+	}
+	for _, tt := range tests {
+		show := parseDialectShow(tt.sql)
+		if tt.what == "" {
+			assert.True(t, show == nil, tt.sql)
+			continue
+		}
+		assert.True(t, show != nil, tt.sql)
+		assert.Equal(t, tt.what, show.what, tt.sql)
+		assert.Equal(t, tt.db, show.db, tt.sql)
+		assert.Equal(t, tt.table, show.table, tt.sql)
+	}
+
+	show := parseDialectShow("SHOW TABLE STATUS LIKE 'art\\_%'")
+	assert.True(t, show.like.MatchString("art_icle"))
+	assert.True(t, !show.like.MatchString("article"))
+	show = parseDialectShow("SHOW COLLATION LIKE 'UTF8MB4%'")
+	assert.True(t, show.like.MatchString("utf8mb4_bin"))
+	assert.True(t, !show.like.MatchString("utf8_bin"))
+}
+
+func TestDialectShowGrants(t *testing.T) {
+	user := &models.UserConfig{Name: "analyst", Schemas: []string{"datauxtest"}}
+	for _, sql := range []string{
+		"SHOW CREATE TABLE secret.article",
+		"SHOW INDEX FROM article FROM secret",
+		"SHOW TABLE STATUS FROM secret",
+	} {
+		_, _, err := parseDialectShow(sql).result(nil, nil, user)
+		assert.NotEqual(t, nil, err, sql)
+		assert.Equal(t, uint16(mysql.ER_DBACCESS_DENIED_ERROR), err.(*mysql.SqlError).Code, sql)
+	}
+
+	// grants are those of the authenticated user, not the session @@user
+	auth, err := models.NewConfigAuthenticator([]*models.UserConfig{user, {Name: "admin"}})
+	assert.Equal(t, nil, err)
+	svr := &models.ServerCtx{Auth: auth}
+	sess := datasource.NewContextSimple()
+	sess.Data["@@user"] = value.NewStringValue("admin")
+	ctx := plan.NewContext("SHOW TABLE STATUS FROM secret")
+	ctx.Session = sess
+	_, err = buildShowJob(svr, ctx, parseDialectShow(ctx.Raw))
+	assert.Equal(t, uint16(mysql.ER_ACCESS_DENIED_NO_PASSWORD_ERROR), err.(*mysql.SqlError).Code)
+	release := models.BindUser(ctx, user)
+	defer release()
+	_, err = buildShowJob(svr, ctx, parseDialectShow(ctx.Raw))
+	assert.Equal(t, uint16(mysql.ER_DBACCESS_DENIED_ERROR), err.(*mysql.SqlError).Code)
+}
@@ -0,0 +1,329 @@
+package mysqlfe
+
+import (
+	"database/sql/driver"
+	"sort"
+	"strings"
+
+	u "github.com/araddon/gou"
+
+	"github.com/araddon/qlbridge/schema"
+
+	"github.com/dataux/dataux/models"
+	"github.com/dataux/dataux/vendored/mixer/mysql"
+)
+
+// The information_schema catalog tables BI tools introspect, schemata,
+// tables, columns, statistics and key_column_usage.  They are built from
+// the schemas of the registry, indexes are the keys of fields.
+
+const (
+	catalogName = "def"
+	// results are in the charset the server advertises
+	catalogCharset   = mysql.DEFAULT_CHARSET
+	catalogCollation = mysql.DEFAULT_COLLATION_NAME
+	// catalogCharLen the max bytes of a character of catalogCharset
+	catalogCharLen = 4
+)
+
+// catalogTable a table of a schema with the source engine it is from
+type catalogTable struct {
+	schema string
+	engine string
+	tbl    *schema.Table
+}
+
+// catalogSchemas the names of the registry's schemas user may use, as
+// SHOW DATABASES lists them, sorted.  A nil user is allowed all.
+func catalogSchemas(svr *models.ServerCtx, user *models.UserConfig) []string {
+	names := make([]string, 0)
+	for _, name := range svr.Reg.Schemas() {
+		if user == nil || user.AllowSchema(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// catalogTables the tables of all schemas user may query, sorted by
+// schema then name
+func catalogTables(svr *models.ServerCtx, user *models.UserConfig) []catalogTable {
+	tables := make([]catalogTable, 0)
+	for _, name := range catalogSchemas(svr, user) {
+		sch, ok := svr.Schema(name)
+		if !ok || sch == nil {
+			continue
+		}
+		tables = append(tables, schemaTables(sch, user)...)
+	}
+	return tables
+}
+
+// schemaTables the tables of a schema sorted by name, those of sources
+// user may not query are left out
+func schemaTables(sch *schema.Schema, user *models.UserConfig) []catalogTable {
+	names := sch.Tables()
+	sort.Strings(names)
+	tables := make([]catalogTable, 0, len(names))
+	for _, tableName := range names {
+		if user != nil {
+			if ss, err := sch.SchemaForTable(tableName); err == nil && ss != nil && !user.AllowSource(ss.Name) {
+				continue
+			}
+		}
+		tbl, err := sch.Table(tableName)
+		if err != nil || tbl == nil {
+			u.Debugf("no table %s.%s: %v", sch.Name, tableName, err)
+			continue
+		}
+		tables = append(tables, catalogTable{schema: sch.Name, engine: tableEngine(sch, tableName), tbl: tbl})
+	}
+	return tables
+}
+
+// tableEngine the source type a table is from, its mysql engine
+func tableEngine(sch *schema.Schema, table string) string {
+	if sch.Name == infoSchemaName {
+		return "MEMORY"
+	}
+	if ss, err := sch.SchemaForTable(table); err == nil && ss != nil && ss.Conf != nil {
+		return ss.Conf.SourceType
+	}
+	return ""
+}
+
+func schemataRows(svr *models.ServerCtx, user *models.UserConfig) [][]driver.Value {
+	rows := make([][]driver.Value, 0)
+	for _, name := range catalogSchemas(svr, user) {
+		rows = append(rows, []driver.Value{catalogName, name, catalogCharset, catalogCollation, nil})
+	}
+	return rows
+}
+
+func tablesRows(svr *models.ServerCtx, user *models.UserConfig) [][]driver.Value {
+	rows := make([][]driver.Value, 0)
+	for _, t := range catalogTables(svr, user) {
+		rows = append(rows, tableRow(t))
+	}
+	return rows
+}
+
+// tableRow the information_schema.tables row of a table, sizes are not
+// known so are NULL
+func tableRow(t catalogTable) []driver.Value {
+	tableType := "BASE TABLE"
+	if t.schema == infoSchemaName {
+		tableType = "SYSTEM VIEW"
+	}
+	return []driver.Value{
+		catalogName,
+		t.schema,
+		t.tbl.Name,
+		tableType,
+		t.engine,
+		int64(10), // version
+		"Dynamic",
+		nil, // table_rows
+		nil, // avg_row_length
+		nil, // data_length
+		nil, // max_data_length
+		nil, // index_length
+		nil, // data_free
+		nil, // auto_increment
+		nil, // create_time
+		nil, // update_time
+		nil, // check_time
+		catalogCollation,
+		nil, // checksum
+		"",
+		"",
+	}
+}
+
+func columnsRows(svr *models.ServerCtx, user *models.UserConfig) [][]driver.Value {
+	rows := make([][]driver.Value, 0)
+	for _, t := range catalogTables(svr, user) {
+		rows = append(rows, columnRows(t.schema, t.tbl)...)
+	}
+	return rows
+}
+
+// columnRows the information_schema.columns rows of the fields of tbl,
+// column_type is as DESCRIBE shows it
+func columnRows(schemaName string, tbl *schema.Table) [][]driver.Value {
+	rows := make([][]driver.Value, 0, len(tbl.Fields))
+	for i, f := range tbl.Fields {
+		colType := typeToMysql(f)
+		dataType := colType
+		if paren := strings.IndexByte(dataType, '('); paren > 0 {
+			dataType = dataType[:paren]
+		}
+		var maxLen, octetLen, precision, scale, dtPrecision, charset, collation, dflt driver.Value
+		switch dataType {
+		case "varchar":
+			n := int64(f.Length)
+			if n == 0 {
+				n = 255
+			}
+			maxLen, octetLen = n, catalogCharLen*n
+		case "text":
+			maxLen, octetLen = int64(65535), int64(65535)
+		case "bigint":
+			precision, scale = int64(19), int64(0)
+		case "int":
+			precision, scale = int64(10), int64(0)
+		case "float":
+			precision = int64(12)
+		case "boolean":
+			dataType = "tinyint"
+			precision, scale = int64(3), int64(0)
+		case "datetime":
+			dtPrecision = int64(0)
+		}
+		if maxLen != nil {
+			charset, collation = catalogCharset, catalogCollation
+		}
+		if len(f.DefVal) > 0 {
+			dflt = string(f.DefVal)
+		}
+		nullable := "YES"
+		if f.NoNulls {
+			nullable = "NO"
+		}
+		rows = append(rows, []driver.Value{
+			catalogName,
+			schemaName,
+			tbl.Name,
+			f.Name,
+			int64(i + 1),
+			dflt,
+			nullable,
+			dataType,
+			maxLen,
+			octetLen,
+			precision,
+			scale,
+			dtPrecision,
+			charset,
+			collation,
+			colType,
+			f.Key,
+			f.Extra,
+			"select",
+			f.Description,
+		})
+	}
+	return rows
+}
+
+// catalogIndex an index of a table from the keys of its fields, PRI
+// fields are the PRIMARY index, UNI and MUL fields an index of their own
+type catalogIndex struct {
+	name   string
+	unique bool
+	fields []*schema.Field
+}
+
+func tableIndexes(tbl *schema.Table) []*catalogIndex {
+	var primary *catalogIndex
+	indexes := make([]*catalogIndex, 0)
+	for _, f := range tbl.Fields {
+		switch strings.ToUpper(f.Key) {
+		case "PRI":
+			if primary == nil {
+				primary = &catalogIndex{name: "PRIMARY", unique: true}
+			}
+			primary.fields = append(primary.fields, f)
+		case "UNI":
+			indexes = append(indexes, &catalogIndex{name: f.Name, unique: true, fields: []*schema.Field{f}})
+		case "MUL":
+			indexes = append(indexes, &catalogIndex{name: f.Name, fields: []*schema.Field{f}})
+		}
+	}
+	if primary != nil {
+		indexes = append([]*catalogIndex{primary}, indexes...)
+	}
+	return indexes
+}
+
+func statisticsRows(svr *models.ServerCtx, user *models.UserConfig) [][]driver.Value {
+	rows := make([][]driver.Value, 0)
+	for _, t := range catalogTables(svr, user) {
+		rows = append(rows, statisticRows(t.schema, t.tbl)...)
+	}
+	return rows
+}
+
+// statisticRows the information_schema.statistics rows of the indexes
+// of tbl, one per column of each index
+func statisticRows(schemaName string, tbl *schema.Table) [][]driver.Value {
+	rows := make([][]driver.Value, 0)
+	for _, idx := range tableIndexes(tbl) {
+		nonUnique := int64(1)
+		if idx.unique {
+			nonUnique = 0
+		}
+		for i, f := range idx.fields {
+			nullable := "YES"
+			if f.NoNulls {
+				nullable = ""
+			}
+			rows = append(rows, []driver.Value{
+				catalogName,
+				schemaName,
+				tbl.Name,
+				nonUnique,
+				schemaName,
+				idx.name,
+				int64(i + 1),
+				f.Name,
+				"A",
+				nil, // cardinality
+				nil, // sub_part
+				nil, // packed
+				nullable,
+				"BTREE",
+				"",
+				"",
+			})
+		}
+	}
+	return rows
+}
+
+func keyColumnUsageRows(svr *models.ServerCtx, user *models.UserConfig) [][]driver.Value {
+	rows := make([][]driver.Value, 0)
+	for _, t := range catalogTables(svr, user) {
+		rows = append(rows, keyColumnRows(t.schema, t.tbl)...)
+	}
+	return rows
+}
+
+// keyColumnRows the information_schema.key_column_usage rows of the
+// unique indexes of tbl, sources have no foreign keys
+func keyColumnRows(schemaName string, tbl *schema.Table) [][]driver.Value {
+	rows := make([][]driver.Value, 0)
+	for _, idx := range tableIndexes(tbl) {
+		if !idx.unique {
+			continue
+		}
+		for i, f := range idx.fields {
+			rows = append(rows, []driver.Value{
+				catalogName,
+				schemaName,
+				idx.name,
+				catalogName,
+				schemaName,
+				tbl.Name,
+				f.Name,
+				int64(i + 1),
+				nil, // position_in_unique_constraint
+				nil, // referenced_table_schema
+				nil, // referenced_table_name
+				nil, // referenced_column_name
+			})
+		}
+	}
+	return rows
+}
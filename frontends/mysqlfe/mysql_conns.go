@@ -0,0 +1,262 @@
+package mysqlfe
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	u "github.com/araddon/gou"
+
+	"github.com/dataux/dataux/vendored/mixer/mysql"
+)
+
+var (
+	// conns all open mysql client connections of this server by
+	// connection id, shared by all mysql listeners
+	conns = &connRegistry{handlers: make(map[uint32]*mySqlHandler)}
+
+	// KILL [QUERY | CONNECTION] processlist_id
+	killRegex = regexp.MustCompile(`(?i)^\s*KILL\s+(?:(QUERY|CONNECTION)\s+)?(\d+)\s*;?\s*$`)
+
+	// statements max_execution_time applies to
+	selectRegex = regexp.MustCompile(`(?i)^\s*SELECT\b`)
+
+	// SELECT /*+ ... MAX_EXECUTION_TIME(ms) ... */
+	execTimeHintRegex = regexp.MustCompile(`(?is)^\s*SELECT\s*/\*\+[^*]*?\bMAX_EXECUTION_TIME\s*\(\s*(\d+)\s*\)`)
+)
+
+// abortWriter result writers that can stop writing the result to the
+// client when the running query is killed
+type abortWriter interface {
+	Abort(err error) error
+}
+
+// connRegistry registry of the handlers of open client connections
+type connRegistry struct {
+	mu       sync.Mutex
+	handlers map[uint32]*mySqlHandler
+}
+
+func (m *connRegistry) add(h *mySqlHandler) {
+	m.mu.Lock()
+	m.handlers[h.connId] = h
+	m.mu.Unlock()
+}
+
+func (m *connRegistry) remove(h *mySqlHandler) {
+	m.mu.Lock()
+	if m.handlers[h.connId] == h {
+		delete(m.handlers, h.connId)
+	}
+	m.mu.Unlock()
+}
+
+func (m *connRegistry) get(id uint32) *mySqlHandler {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.handlers[id]
+}
+
+// list the open connections ordered by id
+func (m *connRegistry) list() []*mySqlHandler {
+	m.mu.Lock()
+	handlers := make([]*mySqlHandler, 0, len(m.handlers))
+	for _, h := range m.handlers {
+		handlers = append(handlers, h)
+	}
+	m.mu.Unlock()
+	sort.Slice(handlers, func(i, j int) bool { return handlers[i].connId < handlers[j].connId })
+	return handlers
+}
+
+// parseKill the connection id of a KILL statement and if only its
+// query is to be killed, ok is false if sql is not a KILL statement.
+func parseKill(sql string) (id uint32, query bool, ok bool) {
+	match := killRegex.FindStringSubmatch(sql)
+	if match == nil {
+		return 0, false, false
+	}
+	id64, err := strconv.ParseUint(match[2], 10, 32)
+	if err != nil {
+		return 0, false, false
+	}
+	return uint32(id64), strings.EqualFold(match[1], "query"), true
+}
+
+func errQueryInterrupted() error {
+	return mysql.NewDefaultError(mysql.ER_QUERY_INTERRUPTED)
+}
+
+func errQueryTimeout() error {
+	return mysql.NewDefaultError(mysql.ER_QUERY_TIMEOUT)
+}
+
+// parseExecTimeHint the ms of a SELECT /*+ MAX_EXECUTION_TIME(ms) */ hint
+func parseExecTimeHint(sql string) (int64, bool) {
+	match := execTimeHintRegex.FindStringSubmatch(sql)
+	if match == nil {
+		return 0, false
+	}
+	ms, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return ms, true
+}
+
+// handleKill the KILL statement, users may kill their own connections,
+// admins anyones.  Without user grants configured anyone may kill any
+// connection.
+func (m *mySqlHandler) handleKill(id uint32, query bool) error {
+
+	target := conns.get(id)
+	if target == nil {
+		return mysql.NewError(mysql.ER_NO_SUCH_THREAD, fmt.Sprintf("Unknown thread id: %d", id))
+	}
+	if user := m.conn.AuthUser(); user != nil && !user.Admin {
+		owner := target.conn.AuthUser()
+		if owner == nil || owner.Name != user.Name {
+			return mysql.NewError(mysql.ER_KILL_DENIED_ERROR, fmt.Sprintf("You are not owner of thread %d", id))
+		}
+	}
+
+	if target == m {
+		if query {
+			// the only query running is this KILL
+			return m.writeOK(nil)
+		}
+		m.conn.Kill()
+		return nil
+	}
+
+	target.kill(!query)
+	return m.writeOK(nil)
+}
+
+// kill the running query of this connection and if connection is true the
+// connection itself.  Called from the goroutine of the killing connection,
+// the killed query returns ER_QUERY_INTERRUPTED to its client.
+func (m *mySqlHandler) kill(connection bool) {
+	m.mu.Lock()
+	m.interrupt(errQueryInterrupted())
+	if connection {
+		m.killed = true
+	}
+	m.mu.Unlock()
+	if connection {
+		m.conn.Kill()
+	}
+}
+
+// timeout the running query if it still runs in stmtCtx, it returns
+// ER_QUERY_TIMEOUT to its client.
+func (m *mySqlHandler) timeout(stmtCtx context.Context) {
+	m.mu.Lock()
+	if m.stmtCtx == stmtCtx {
+		u.Warnf("%d query exceeded max execution time: %s", m.connId, m.sql)
+		m.interrupt(errQueryTimeout())
+	}
+	m.mu.Unlock()
+}
+
+// interrupt the running query, its job is cancelled and err is written to
+// the client in place of the rest of the result.  Caller must hold mu.
+func (m *mySqlHandler) interrupt(err error) {
+	if !m.running || m.interrupted != nil {
+		return
+	}
+	// if the result was already completely written it is too late
+	if m.rw == nil || m.rw.Abort(err) != nil {
+		m.interrupted = err
+		if m.cancel != nil {
+			// stops the backend requests of a query still being planned
+			m.cancel()
+		}
+		if m.job != nil {
+			m.job.Cancel()
+		}
+	}
+}
+
+// statementContext the context the job of sql runs in, cancelled when it
+// is killed and at the max execution time of a SELECT.  It is started
+// before the job is built so the deadline bounds planning too.
+func (m *mySqlHandler) statementContext(sql string) (context.Context, context.CancelFunc) {
+	var stmtCtx context.Context
+	var cancel context.CancelFunc
+	if timeout := m.execTimeout(sql); timeout > 0 {
+		stmtCtx, cancel = context.WithTimeout(context.Background(), timeout)
+		go func() {
+			<-stmtCtx.Done()
+			if stmtCtx.Err() == context.DeadlineExceeded {
+				m.timeout(stmtCtx)
+			}
+		}()
+	} else {
+		stmtCtx, cancel = context.WithCancel(context.Background())
+	}
+	m.mu.Lock()
+	m.stmtCtx, m.cancel = stmtCtx, cancel
+	m.mu.Unlock()
+	return stmtCtx, cancel
+}
+
+// execTimeout the max execution time of a SELECT, from its
+// MAX_EXECUTION_TIME hint or else the session max_execution_time, 0 for
+// other statements.
+func (m *mySqlHandler) execTimeout(sql string) time.Duration {
+	if !selectRegex.MatchString(sql) {
+		return 0
+	}
+	ms := m.sess.maxExecTime
+	if hint, ok := parseExecTimeHint(sql); ok {
+		ms = hint
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// startQuery marks sql as running so it may be killed and is shown
+// in the processlist
+func (m *mySqlHandler) startQuery(sql string) {
+	m.mu.Lock()
+	m.running = true
+	m.interrupted = nil
+	m.sql = sql
+	m.cmdAt = time.Now()
+	m.mu.Unlock()
+}
+
+// endQuery clears the state of the query started with startQuery
+func (m *mySqlHandler) endQuery() {
+	m.mu.Lock()
+	m.running = false
+	m.job = nil
+	m.stmtCtx, m.cancel = nil, nil
+	m.rw = nil
+	m.sql = ""
+	m.cmdAt = time.Now()
+	m.mu.Unlock()
+}
+
+// setJob sets the job of the running query, returning the error it was
+// interrupted with if it has already been killed.
+func (m *mySqlHandler) setJob(job *MySqlJob, rw abortWriter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.job = job
+	m.rw = rw
+	return m.interrupted
+}
+
+// interruptErr the error the running query was interrupted with, nil if
+// it was not killed or timed out
+func (m *mySqlHandler) interruptErr() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.interrupted
+}
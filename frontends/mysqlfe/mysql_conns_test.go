@@ -0,0 +1,79 @@
+package mysqlfe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKill(t *testing.T) {
+	tests := []struct {
+		sql   string
+		id    uint32
+		query bool
+		ok    bool
+	}{
+		{"KILL 12", 12, false, true},
+		{"kill connection 12;", 12, false, true},
+		{"KILL QUERY 7", 7, true, true},
+		{"  Kill Query   7 ", 7, true, true},
+		{"KILL QUERY", 0, false, false},
+		{"KILL 99999999999", 0, false, false},
+		{"SELECT * FROM kill", 0, false, false},
+	}
+	for _, tt := range tests {
+		id, query, ok := parseKill(tt.sql)
+		assert.Equal(t, tt.ok, ok, tt.sql)
+		assert.Equal(t, tt.id, id, tt.sql)
+		assert.Equal(t, tt.query, query, tt.sql)
+	}
+}
+
+func TestParseExecTimeHint(t *testing.T) {
+	tests := []struct {
+		sql string
+		ms  int64
+		ok  bool
+	}{
+		{"SELECT /*+ MAX_EXECUTION_TIME(1000) */ * FROM user", 1000, true},
+		{"select /*+ NO_INDEX(user) max_execution_time( 50 ) */ a FROM user", 50, true},
+		{"SELECT * FROM user /*+ MAX_EXECUTION_TIME(1000) */", 0, false},
+		{"SELECT /* MAX_EXECUTION_TIME(1000) */ * FROM user", 0, false},
+		{"UPDATE /*+ MAX_EXECUTION_TIME(1000) */ user SET a = 1", 0, false},
+	}
+	for _, tt := range tests {
+		ms, ok := parseExecTimeHint(tt.sql)
+		assert.Equal(t, tt.ok, ok, tt.sql)
+		assert.Equal(t, tt.ms, ms, tt.sql)
+	}
+}
+
+func TestStatementContext(t *testing.T) {
+	m := &mySqlHandler{sess: newMySqlSession("default", "bob", 1)}
+	m.sess.maxExecTime = 1000
+	assert.Equal(t, time.Second, m.execTimeout("SELECT * FROM user"))
+	assert.Equal(t, time.Duration(0), m.execTimeout("UPDATE user SET a = 1"))
+
+	// the deadline runs from before the job is built, none is needed to
+	// time the query out
+	m.startQuery("SELECT /*+ MAX_EXECUTION_TIME(10) */ * FROM user")
+	stmtCtx, cancel := m.statementContext("SELECT /*+ MAX_EXECUTION_TIME(10) */ * FROM user")
+	defer cancel()
+	<-stmtCtx.Done()
+	for i := 0; i < 100 && m.interruptErr() == nil; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, errQueryTimeout(), m.interruptErr())
+	m.endQuery()
+
+	// KILL cancels the context of a query that is still being planned
+	m.startQuery("SELECT * FROM user")
+	stmtCtx, cancel = m.statementContext("SELECT * FROM user")
+	defer cancel()
+	m.mu.Lock()
+	m.interrupt(errQueryInterrupted())
+	m.mu.Unlock()
+	assert.NotEqual(t, nil, stmtCtx.Err())
+	m.endQuery()
+}
@@ -0,0 +1,64 @@
+package mysqlfe
+
+import (
+	"database/sql/driver"
+
+	u "github.com/araddon/gou"
+
+	"github.com/araddon/qlbridge/plan"
+	"github.com/araddon/qlbridge/rel"
+
+	"github.com/dataux/dataux/vendored/mixer/mysql"
+)
+
+// checkSourceGrants ensures the connection's user is allowed to query the
+// sources of all tables in the statement.  Users without an allow list of
+// sources, or connections without an authenticator are allowed all, the
+// virtual information_schema shows each user only the rows they may see.
+func (m *mySqlHandler) checkSourceGrants(ctx *plan.Context) error {
+
+	user := m.conn.AuthUser()
+	if user == nil {
+		return nil
+	}
+	table := user.DeniedTable(ctx)
+	if table == "" {
+		return nil
+	}
+	u.Warnf("user %q not allowed table=%s", user.Name, table)
+	return mysql.NewDefaultError(mysql.ER_TABLEACCESS_DENIED_ERROR, grantCommand(ctx.Stmt), user.Name, m.conn.Host(), table)
+}
+
+// grantCommand the command of stmt as named in a denied error
+func grantCommand(stmt rel.SqlStatement) string {
+	switch stmt.(type) {
+	case *rel.SqlInsert, *rel.SqlUpsert:
+		return "INSERT"
+	case *rel.SqlUpdate:
+		return "UPDATE"
+	case *rel.SqlDelete:
+		return "DELETE"
+	}
+	return "SELECT"
+}
+
+// schemaGrantFilter a row filter for SHOW DATABASES, hiding the schemas
+// the connection's user is not allowed to use.
+func (m *mySqlHandler) schemaGrantFilter() func([]driver.Value) bool {
+	user := m.conn.AuthUser()
+	if user == nil || len(user.Schemas) == 0 {
+		return nil
+	}
+	return func(vals []driver.Value) bool {
+		if len(vals) == 0 {
+			return false
+		}
+		switch name := vals[0].(type) {
+		case string:
+			return user.AllowSchema(name)
+		case []byte:
+			return user.AllowSchema(string(name))
+		}
+		return false
+	}
+}
@@ -1,15 +1,17 @@
 package mysqlfe
 
 import (
+	"context"
+	"encoding/binary"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	u "github.com/araddon/gou"
 	"github.com/kr/pretty"
 
 	"github.com/araddon/qlbridge/exec"
-	"github.com/araddon/qlbridge/expr"
 	"github.com/araddon/qlbridge/lex"
 	"github.com/araddon/qlbridge/plan"
 	"github.com/araddon/qlbridge/rel"
@@ -17,13 +19,14 @@ import (
 	"github.com/araddon/qlbridge/value"
 
 	"github.com/dataux/dataux/models"
+	"github.com/dataux/dataux/planner"
 	"github.com/dataux/dataux/vendored/mixer/mysql"
 	mysqlproxy "github.com/dataux/dataux/vendored/mixer/proxy"
 )
 
 func init() {
 	// Register our Mysql Frontend Listener
-	models.ListenerRegister(mysqlproxy.ListenerType, &MySqlConnCreator{})
+	models.ListenerRegister(mysqlproxy.ListenerType, func() models.Listener { return &MySqlConnCreator{} })
 }
 
 const (
@@ -52,7 +55,15 @@ type MySqlConnCreator struct {
 
 // Init is part of frontend interface to accept config and global server context at start
 func (m *MySqlConnCreator) Init(conf *models.ListenerConfig, svr *models.ServerCtx) error {
-	l, err := mysqlproxy.ListenerInit(conf, svr.Config, m)
+	auth := svr.Auth
+	if len(conf.Users) > 0 {
+		if auth == nil {
+			u.Warnf("ignoring users of listener %s, there is no users config", conf.Addr)
+		} else {
+			auth = models.NewListenerAuthenticator(auth, conf.Users)
+		}
+	}
+	l, err := mysqlproxy.ListenerInit(conf, svr.Config, auth, m)
 	if err != nil {
 		u.Errorf("could not init mysql listener: %v", err)
 		return err
@@ -60,6 +71,9 @@ func (m *MySqlConnCreator) Init(conf *models.ListenerConfig, svr *models.ServerC
 	m.l = l
 	m.svr = svr
 	m.conf = conf
+	if svr.Config.MaxExecTime > 0 {
+		mysqlGlobalVars.Data["@@max_execution_time"] = value.NewIntValue(svr.Config.MaxExecTime)
+	}
 	return nil
 }
 
@@ -74,7 +88,11 @@ func (m *MySqlConnCreator) Open(connI interface{}) models.StatementHandler {
 		//u.Debugf("Cloning Mysql handler %v", conn)
 		handler.conn = conn
 		handler.connId = conn.ConnId()
-		handler.sess = NewMySqlSessionVars("default", conn.User(), conn.ConnId())
+		handler.sess = newMySqlSession("default", conn.User(), conn.ConnId())
+		handler.stmts = make(map[uint32]*preparedStmt)
+		handler.addr = conn.RemoteAddr()
+		handler.cmdAt = time.Now()
+		conns.add(&handler)
 		return &handler
 	}
 	panic(fmt.Sprintf("not proxy.Conn? %T", connI))
@@ -84,8 +102,11 @@ func (m *MySqlConnCreator) Run(stop chan bool) error {
 }
 
 func (m *MySqlConnCreator) Close() error {
-	// TODO Better close management
-	return nil
+	if m.l == nil {
+		return nil
+	}
+	// closing the listener removes a unix socket file
+	return m.l.Close()
 }
 
 func (m *MySqlConnCreator) String() string {
@@ -95,35 +116,73 @@ func (m *MySqlConnCreator) String() string {
 // MySql per connection, ie session specific
 type mySqlHandler struct {
 	svr    *models.ServerCtx
-	sess   expr.ContextReadWriter // session info
+	sess   *mySqlSession          // session info
 	conn   *mysqlproxy.Conn       // Connection to client, inbound mysql conn
 	schema *schema.Schema
 	connId uint32
+	addr   string                   // remote host:port of client
+	stmtId uint32                   // last prepared statement id
+	stmts  map[uint32]*preparedStmt // prepared statements of this connection
+	began  bool                     // has the session the charset of the handshake
+
+	// warnings of the last statement, kept for SHOW WARNINGS
+	warnings *models.Warnings
+
+	// state of the running query, guarded by mu as KILL and the
+	// processlist read it from the goroutine of another connection
+	mu          sync.Mutex
+	running     bool
+	interrupted error              // running query was killed or timed out
+	killed      bool               // connection was killed
+	job         *MySqlJob          // job of running query, nil until planned
+	stmtCtx     context.Context    // context the running query's job runs in
+	cancel      context.CancelFunc // cancels stmtCtx
+	rw          abortWriter        // result writer of running query
+	db          string             // schema in use
+	sql         string             // running query
+	cmdAt       time.Time          // start of running query, or of idling
 }
 
 func (m *mySqlHandler) Close() error {
-	if m.conn != nil {
-		err := m.conn.Close()
-		m.conn = nil
-		return err
+	conns.remove(m)
+	m.mu.Lock()
+	if m.cancel != nil {
+		// stops the backend requests of a running statement
+		m.cancel()
 	}
-	return nil
+	m.mu.Unlock()
+	m.stmts = make(map[uint32]*preparedStmt)
+	return m.conn.Close()
 }
 
 // Handle Implement the Handle interface for frontends that processes requests
 func (m *mySqlHandler) Handle(writer models.ResultWriter, req *models.Request) error {
+	if !m.began {
+		// the handler is opened before the handshake, which has the
+		// user and charset of the client
+		m.began = true
+		m.sess.setUser(m.conn.User())
+		m.sess.setNames(m.conn.Charset(), m.conn.Collation())
+	}
 	return m.chooseCommand(writer, req)
 }
 
 // Session level schema Use command of sql
 func (m *mySqlHandler) SchemaUse(db string) *schema.Schema {
+	if user := m.conn.AuthUser(); user != nil && !user.AllowSchema(db) {
+		u.Warnf("user %q not allowed to use db=%s", user.Name, db)
+		return nil
+	}
 	schema, ok := m.svr.Schema(db)
 	if schema == nil || !ok {
 		u.Warnf("Could not find schema for db=%s", db)
 		return nil
 	}
 	m.schema = schema
-	m.sess = NewMySqlSessionVars(db, m.conn.User(), m.connId)
+	m.sess.setDb(db, m.conn.User())
+	m.mu.Lock()
+	m.db = db
+	m.mu.Unlock()
 	return schema
 }
 
@@ -139,8 +198,31 @@ func (m *mySqlHandler) chooseCommand(writer models.ResultWriter, req *models.Req
 		// mysql is going to deprecate it, so we don't support it
 		msg := fmt.Sprintf("command %d:%s is deprecated", cmd, mysql.CommandString(cmd))
 		return mysql.NewError(mysql.ER_WARN_DEPRECATED_SYNTAX, msg)
-	case mysql.COM_QUERY, mysql.COM_STMT_PREPARE:
-		return m.handleQuery(writer, string(req.Raw))
+	case mysql.COM_QUERY:
+		return m.handleMultiQuery(writer, mysql.DecodeString(m.conn.Charset(), string(req.Raw)))
+	case mysql.COM_STMT_PREPARE:
+		return m.handleStmtPrepare(mysql.DecodeString(m.conn.Charset(), string(req.Raw)))
+	case mysql.COM_STMT_EXECUTE:
+		return m.handleStmtExecute(writer, req.Raw)
+	case mysql.COM_STMT_CLOSE:
+		return m.handleStmtClose(req.Raw)
+	case mysql.COM_STMT_SEND_LONG_DATA:
+		return m.handleStmtSendLongData(req.Raw)
+	case mysql.COM_STMT_RESET:
+		return m.handleStmtReset(req.Raw)
+	case mysql.COM_SET_OPTION:
+		if len(req.Raw) < 2 {
+			return mysql.ErrMalformPacket
+		}
+		switch binary.LittleEndian.Uint16(req.Raw) {
+		case mysql.MYSQL_OPTION_MULTI_STATEMENTS_ON:
+			m.conn.SetMultiStatements(true)
+		case mysql.MYSQL_OPTION_MULTI_STATEMENTS_OFF:
+			m.conn.SetMultiStatements(false)
+		default:
+			return mysql.NewDefaultError(mysql.ER_UNKNOWN_COM_ERROR)
+		}
+		return m.conn.WriteEOF(m.conn.Status)
 	case mysql.COM_PING:
 		return m.writeOK(nil)
 	case mysql.COM_QUIT:
@@ -148,15 +230,10 @@ func (m *mySqlHandler) chooseCommand(writer models.ResultWriter, req *models.Req
 		m.Close()
 		return nil
 	case mysql.COM_INIT_DB:
-		if s := m.SchemaUse(string(req.Raw)); s == nil {
-			return fmt.Errorf("Schema not found %s", string(req.Raw))
-		} else {
-			return m.writeOK(nil)
+		if err := m.conn.UseDb(string(req.Raw)); err != nil {
+			return err
 		}
-	// case mysql.COM_STMT_EXECUTE:
-	// case mysql.COM_STMT_CLOSE:
-	// case mysql.COM_STMT_SEND_LONG_DATA:
-	// case mysql.COM_STMT_RESET:
+		return m.writeOK(nil)
 	default:
 		msg := fmt.Sprintf("command %d:%s not yet supported", cmd, mysql.CommandString(cmd))
 		return mysql.NewError(mysql.ER_UNKNOWN_ERROR, msg)
@@ -165,9 +242,59 @@ func (m *mySqlHandler) chooseCommand(writer models.ResultWriter, req *models.Req
 	return nil
 }
 
-func (m *mySqlHandler) handleQuery(writer models.ResultWriter, sql string) (err error) {
+// handleMultiQuery runs each ; separated statement of sql if client has
+// enabled multi statements, writing a result for each flagged with
+// more results exists except the last.  Stops at the first error.
+func (m *mySqlHandler) handleMultiQuery(writer models.ResultWriter, sql string) error {
+
+	if !m.conn.MultiStatements() {
+		return m.handleQuery(writer, sql, false)
+	}
+	stmts := splitStatements(sql)
+	if len(stmts) <= 1 {
+		return m.handleQuery(writer, sql, false)
+	}
+
+	for i, stmt := range stmts {
+		if i < len(stmts)-1 {
+			m.conn.Status |= mysql.SERVER_MORE_RESULTS_EXISTS
+		}
+		err := m.handleQuery(writer, stmt, false)
+		m.conn.Status &^= mysql.SERVER_MORE_RESULTS_EXISTS
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleQuery runs sql writing results to client, binary is true for
+// prepared statements whose rows must be sent in binary protocol.
+func (m *mySqlHandler) handleQuery(writer models.ResultWriter, sql string, binary bool) (err error) {
 
 	u.Debugf("%d %p handleQuery: %v", m.connId, m, sql)
+	if show, ok := parseShowWarnings(sql); ok {
+		return m.handleShowWarnings(show, binary)
+	}
+	m.warnings = nil
+	m.conn.Warnings = nil
+	if id, query, ok := parseKill(sql); ok {
+		return m.handleKill(id, query)
+	}
+	if full, ok := parseShowProcesslist(sql); ok {
+		return m.handleShowProcesslist(full, binary)
+	}
+	m.startQuery(sql)
+	defer m.endQuery()
+
+	if isSet(sql) {
+		return m.handleSet(sql)
+	}
+	if isLoadData(sql) {
+		return m.handleLoadData(sql)
+	}
+	sql = m.sess.bindUserVars(sql)
+
 	if !m.svr.Config.SupressRecover {
 		defer func() {
 			if e := recover(); e != nil {
@@ -187,19 +314,39 @@ func (m *mySqlHandler) handleQuery(writer models.ResultWriter, sql string) (err
 		m.schema = s.InfoSchema
 	}
 
+	sch := m.schema
+	if isql, is, err := m.infoSchemaQuery(sql); err != nil {
+		return err
+	} else if is != nil {
+		sql, sch = isql, is
+	}
+
 	start := time.Now()
-	ctx := plan.NewContext(sql)
+	ctx := plan.NewContext(m.sess.withSelectLimit(sql))
 	ctx.DisableRecover = m.svr.Config.SupressRecover
-	ctx.Session = m.sess
-	ctx.Schema = m.schema
+	ctx.Session = m.sess.ctx
+	ctx.Schema = sch
 	ctx.Funcs = fr
 	if ctx.Schema == nil {
 		u.Warnf("no schema found in handler, this should not happen ")
 	}
+	// sources add warnings while the job is planned and run
+	m.warnings = models.TrackWarnings(ctx)
+	m.conn.Warnings = m.warnings
+	defer models.UntrackWarnings(ctx)
+	// the statement's deadline starts before it is planned, sources may
+	// query their backend while the job is built
+	stmtCtx, cancel := m.statementContext(sql)
+	defer cancel()
+	defer planner.BindContext(ctx, stmtCtx)()
 	//u.Debugf("handler job svr: %p  svr.Grid: %p", m.svr, m.svr.PlanGrid.Grid)
-	job, err := BuildMySqlJob(m.svr, ctx)
+	job, err := BuildMySqlJob(m.svr, ctx, m.conn.AuthUser())
 
 	if err != nil {
+		if ierr := m.interruptErr(); ierr != nil {
+			// killed or timed out while planning
+			return ierr
+		}
 		//u.Debugf("error? nilstmt?%v  err=%v", ctx.Stmt == nil, err)
 		if ctx.Stmt != nil {
 			switch ctx.Stmt.Keyword() {
@@ -229,15 +376,35 @@ func (m *mySqlHandler) handleQuery(writer models.ResultWriter, sql string) (err
 		return nil
 	}
 
+	if err = m.checkSourceGrants(job.Ctx); err != nil {
+		job.Close()
+		return err
+	}
+	if err = m.setJob(job, nil); err != nil {
+		job.Close()
+		return err
+	}
+
 	//u.Infof("job.Ctx %p   Session %p", job.Ctx, job.Ctx.Session)
 	//job.Ctx.Session = m.sess
 
 	var resultWriter exec.Task
 	switch stmt := job.Ctx.Stmt.(type) {
 	case *rel.SqlSelect:
-		resultWriter = NewMySqlResultWriter(writer, job.Ctx)
+		rw := NewMySqlResultWriter(writer, job.Ctx)
+		rw.binary = binary
+		rw.loc = m.sess.loc
+		rw.charset = m.conn.ResultsCharset()
+		resultWriter = rw
 	case *rel.SqlShow, *rel.SqlDescribe:
-		resultWriter = NewMySqlSchemaWriter(writer, job.Ctx)
+		rw := NewMySqlSchemaWriter(writer, job.Ctx)
+		rw.binary = binary
+		rw.loc = m.sess.loc
+		rw.charset = m.conn.ResultsCharset()
+		if show, ok := stmt.(*rel.SqlShow); ok && strings.ToLower(show.ShowType) == "databases" {
+			rw.filter = m.schemaGrantFilter()
+		}
+		resultWriter = rw
 	case *rel.SqlInsert, *rel.SqlUpsert, *rel.SqlUpdate, *rel.SqlDelete:
 		resultWriter = NewMySqlExecResultWriter(writer, job.Ctx)
 	case *rel.SqlCommand:
@@ -272,11 +439,23 @@ func (m *mySqlHandler) handleQuery(writer models.ResultWriter, sql string) (err
 		u.Errorf("error on finalize %v", err)
 		return err
 	}
+	if err = m.setJob(job, resultWriter.(abortWriter)); err != nil {
+		job.Close()
+		return err
+	}
 	//u.Infof("mysqlhandler %p task.Run() start", job.RootTask)
 	err = job.Run()
 	//u.Infof("mysqlhandler %p task.Run() complete", job.RootTask)
-	if err != nil {
+	if ierr := m.interruptErr(); ierr != nil {
+		// result writer was aborted by KILL or timeout, error is sent
+		// in place of the rest
+		err = ierr
+	} else if err != nil {
 		u.Errorf("error on Query.Run(): %v", err)
+		if rw, ok := resultWriter.(*MySqlResultWriter); ok {
+			// rows may already have been streamed to client
+			err = rw.Abort(err)
+		}
 	}
 	//u.Infof("mysqlhandler %p task.Close() start for %T", job.RootTask, job.RootTask)
 	closeErr := job.Close()
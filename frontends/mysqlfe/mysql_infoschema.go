@@ -0,0 +1,519 @@
+package mysqlfe
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	u "github.com/araddon/gou"
+
+	"github.com/araddon/qlbridge/datasource"
+	"github.com/araddon/qlbridge/exec"
+	"github.com/araddon/qlbridge/plan"
+	"github.com/araddon/qlbridge/schema"
+	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/models"
+	"github.com/dataux/dataux/vendored/mixer/mysql"
+)
+
+const (
+	// infoSchemaName the schema the virtual infoTables are registered as
+	infoSchemaName = "information_schema"
+)
+
+var (
+	// Ensure we implement source interface
+	_ schema.Source = (*infoSchemaSource)(nil)
+
+	// Ensure the rows are generated for the user of the statement
+	_ exec.ExecutorSource = (*infoRows)(nil)
+
+	infoSchemaOnce sync.Once
+
+	// infoTableNames the lower case names of the virtual infoTables
+	infoTableNames = make(map[string]bool)
+
+	// clauseWords end the table references of a FROM, they are not aliases
+	clauseWords = map[string]bool{
+		"where": true, "group": true, "having": true, "order": true, "limit": true,
+		"union": true, "join": true, "inner": true, "cross": true, "left": true,
+		"right": true, "natural": true, "straight_join": true, "on": true,
+		"using": true, "for": true, "lock": true, "into": true, "window": true,
+	}
+
+	// SHOW [FULL] PROCESSLIST
+	showProcesslistRegex = regexp.MustCompile(`(?i)^\s*SHOW\s+(FULL\s+)?PROCESSLIST\s*;?\s*$`)
+)
+
+// infoTables the virtual information_schema tables, their rows are
+// generated from server state each time they are queried.
+var infoTables = []*infoTable{
+	{
+		name: "processlist",
+		cols: []infoCol{
+			{"ID", value.IntType, 64},
+			{"USER", value.StringType, 32},
+			{"HOST", value.StringType, 261},
+			{"DB", value.StringType, 64},
+			{"COMMAND", value.StringType, 16},
+			{"TIME", value.IntType, 32},
+			{"STATE", value.StringType, 64},
+			{"INFO", value.StringType, 65535},
+		},
+		rows: func(_ *models.ServerCtx, user *models.UserConfig) [][]driver.Value {
+			return processlistRows(user, true)
+		},
+	},
+	{
+		name: "schemata",
+		cols: []infoCol{
+			{"CATALOG_NAME", value.StringType, 64},
+			{"SCHEMA_NAME", value.StringType, 64},
+			{"DEFAULT_CHARACTER_SET_NAME", value.StringType, 32},
+			{"DEFAULT_COLLATION_NAME", value.StringType, 32},
+			{"SQL_PATH", value.StringType, 512},
+		},
+		rows: schemataRows,
+	},
+	{
+		name: "tables",
+		cols: []infoCol{
+			{"TABLE_CATALOG", value.StringType, 64},
+			{"TABLE_SCHEMA", value.StringType, 64},
+			{"TABLE_NAME", value.StringType, 64},
+			{"TABLE_TYPE", value.StringType, 64},
+			{"ENGINE", value.StringType, 64},
+			{"VERSION", value.IntType, 21},
+			{"ROW_FORMAT", value.StringType, 10},
+			{"TABLE_ROWS", value.IntType, 21},
+			{"AVG_ROW_LENGTH", value.IntType, 21},
+			{"DATA_LENGTH", value.IntType, 21},
+			{"MAX_DATA_LENGTH", value.IntType, 21},
+			{"INDEX_LENGTH", value.IntType, 21},
+			{"DATA_FREE", value.IntType, 21},
+			{"AUTO_INCREMENT", value.IntType, 21},
+			{"CREATE_TIME", value.TimeType, 0},
+			{"UPDATE_TIME", value.TimeType, 0},
+			{"CHECK_TIME", value.TimeType, 0},
+			{"TABLE_COLLATION", value.StringType, 32},
+			{"CHECKSUM", value.IntType, 21},
+			{"CREATE_OPTIONS", value.StringType, 255},
+			{"TABLE_COMMENT", value.StringType, 2048},
+		},
+		rows: tablesRows,
+	},
+	{
+		name: "columns",
+		cols: []infoCol{
+			{"TABLE_CATALOG", value.StringType, 64},
+			{"TABLE_SCHEMA", value.StringType, 64},
+			{"TABLE_NAME", value.StringType, 64},
+			{"COLUMN_NAME", value.StringType, 64},
+			{"ORDINAL_POSITION", value.IntType, 21},
+			{"COLUMN_DEFAULT", value.StringType, 65535},
+			{"IS_NULLABLE", value.StringType, 3},
+			{"DATA_TYPE", value.StringType, 64},
+			{"CHARACTER_MAXIMUM_LENGTH", value.IntType, 21},
+			{"CHARACTER_OCTET_LENGTH", value.IntType, 21},
+			{"NUMERIC_PRECISION", value.IntType, 21},
+			{"NUMERIC_SCALE", value.IntType, 21},
+			{"DATETIME_PRECISION", value.IntType, 21},
+			{"CHARACTER_SET_NAME", value.StringType, 32},
+			{"COLLATION_NAME", value.StringType, 32},
+			{"COLUMN_TYPE", value.StringType, 65535},
+			{"COLUMN_KEY", value.StringType, 3},
+			{"EXTRA", value.StringType, 30},
+			{"PRIVILEGES", value.StringType, 80},
+			{"COLUMN_COMMENT", value.StringType, 1024},
+		},
+		rows: columnsRows,
+	},
+	{
+		name: "statistics",
+		cols: []infoCol{
+			{"TABLE_CATALOG", value.StringType, 64},
+			{"TABLE_SCHEMA", value.StringType, 64},
+			{"TABLE_NAME", value.StringType, 64},
+			{"NON_UNIQUE", value.IntType, 1},
+			{"INDEX_SCHEMA", value.StringType, 64},
+			{"INDEX_NAME", value.StringType, 64},
+			{"SEQ_IN_INDEX", value.IntType, 2},
+			{"COLUMN_NAME", value.StringType, 64},
+			{"COLLATION", value.StringType, 1},
+			{"CARDINALITY", value.IntType, 21},
+			{"SUB_PART", value.IntType, 3},
+			{"PACKED", value.StringType, 10},
+			{"NULLABLE", value.StringType, 3},
+			{"INDEX_TYPE", value.StringType, 16},
+			{"COMMENT", value.StringType, 16},
+			{"INDEX_COMMENT", value.StringType, 1024},
+		},
+		rows: statisticsRows,
+	},
+	{
+		name: "key_column_usage",
+		cols: []infoCol{
+			{"CONSTRAINT_CATALOG", value.StringType, 64},
+			{"CONSTRAINT_SCHEMA", value.StringType, 64},
+			{"CONSTRAINT_NAME", value.StringType, 64},
+			{"TABLE_CATALOG", value.StringType, 64},
+			{"TABLE_SCHEMA", value.StringType, 64},
+			{"TABLE_NAME", value.StringType, 64},
+			{"COLUMN_NAME", value.StringType, 64},
+			{"ORDINAL_POSITION", value.IntType, 10},
+			{"POSITION_IN_UNIQUE_CONSTRAINT", value.IntType, 10},
+			{"REFERENCED_TABLE_SCHEMA", value.StringType, 64},
+			{"REFERENCED_TABLE_NAME", value.StringType, 64},
+			{"REFERENCED_COLUMN_NAME", value.StringType, 64},
+		},
+		rows: keyColumnUsageRows,
+	},
+}
+
+func init() {
+	for _, t := range infoTables {
+		infoTableNames[t.name] = true
+	}
+}
+
+type infoCol struct {
+	name   string
+	typ    value.ValueType
+	length int
+}
+
+// infoTable a virtual information_schema table
+type infoTable struct {
+	name string
+	cols []infoCol
+	rows func(svr *models.ServerCtx, user *models.UserConfig) [][]driver.Value // user is nil for all
+}
+
+func (m *infoTable) table() *schema.Table {
+	tbl := schema.NewTable(m.name)
+	cols := make([]string, len(m.cols))
+	for i, col := range m.cols {
+		tbl.AddField(schema.NewFieldBase(col.name, col.typ, col.length, ""))
+		cols[i] = col.name
+	}
+	tbl.SetColumns(cols)
+	return tbl
+}
+
+// infoSchemaSource the qlbridge source of the virtual infoTables
+type infoSchemaSource struct {
+	svr    *models.ServerCtx
+	tables map[string]*infoTable
+	names  []string
+}
+
+func newInfoSchemaSource(svr *models.ServerCtx) *infoSchemaSource {
+	m := &infoSchemaSource{svr: svr, tables: make(map[string]*infoTable, len(infoTables))}
+	for _, t := range infoTables {
+		m.tables[t.name] = t
+		m.names = append(m.names, t.name)
+	}
+	return m
+}
+
+func (m *infoSchemaSource) Init()                         {}
+func (m *infoSchemaSource) Setup(ss *schema.Schema) error { return nil }
+func (m *infoSchemaSource) Close() error                  { return nil }
+func (m *infoSchemaSource) Tables() []string              { return m.names }
+
+// Table get single table schema.
+func (m *infoSchemaSource) Table(table string) (*schema.Table, error) {
+	t, ok := m.tables[strings.ToLower(table)]
+	if !ok {
+		return nil, schema.ErrNotFound
+	}
+	return t.table(), nil
+}
+
+// Open a scanner over a fresh snapshot of the table's rows, they are
+// generated once the statement and so the user it is run by is known.
+func (m *infoSchemaSource) Open(table string) (schema.Conn, error) {
+	t, ok := m.tables[strings.ToLower(table)]
+	if !ok {
+		return nil, schema.ErrNotFound
+	}
+	cols := make([]string, len(t.cols))
+	colIndex := make(map[string]int, len(t.cols))
+	for i, col := range t.cols {
+		cols[i] = col.name
+		colIndex[col.name] = i
+	}
+	return &infoRows{svr: m.svr, t: t, cols: cols, colIndex: colIndex}, nil
+}
+
+// infoRows scanner over the generated rows of an infoTable
+type infoRows struct {
+	svr      *models.ServerCtx
+	t        *infoTable
+	cols     []string
+	colIndex map[string]int
+	rows     [][]driver.Value
+	pos      int
+}
+
+// WalkExecSource generates the rows the authenticated user of the
+// statement may see, then scans them.
+func (m *infoRows) WalkExecSource(p *plan.Source) (exec.Task, error) {
+	user, err := m.svr.StatementUser(p.Context())
+	if err != nil {
+		return nil, err
+	}
+	m.rows = m.t.rows(m.svr, user)
+	return exec.NewSource(p.Context(), p)
+}
+
+func (m *infoRows) Columns() []string { return m.cols }
+func (m *infoRows) Close() error      { return nil }
+func (m *infoRows) Next() schema.Message {
+	if m.rows == nil && m.svr.Auth == nil {
+		// not walked, there is no user to hide rows from
+		m.rows = m.t.rows(m.svr, nil)
+	}
+	if m.pos >= len(m.rows) {
+		return nil
+	}
+	m.pos++
+	return datasource.NewSqlDriverMessageMap(uint64(m.pos), m.rows[m.pos-1], m.colIndex)
+}
+
+// loadInfoSchema registers the virtual information_schema on first use.
+func loadInfoSchema(svr *models.ServerCtx) (*schema.Schema, error) {
+	infoSchemaOnce.Do(func() {
+		schema.RegisterSourceAsSchema(infoSchemaName, newInfoSchemaSource(svr))
+	})
+	s, ok := svr.Schema(infoSchemaName)
+	if !ok || s == nil {
+		u.Errorf("could not load %s", infoSchemaName)
+		return nil, schema.ErrNotFound
+	}
+	return s, nil
+}
+
+// infoSchemaQuery rewrites information_schema.table references of sql to
+// be run against the virtual information_schema, nil schema if sql has
+// none.
+func (m *mySqlHandler) infoSchemaQuery(sql string) (string, *schema.Schema, error) {
+	isql, ok, err := rewriteInfoSchema(sql)
+	if err != nil || !ok {
+		return sql, nil, err
+	}
+	s, err := loadInfoSchema(m.svr)
+	if err != nil {
+		return sql, nil, err
+	}
+	return isql, s, nil
+}
+
+// rewriteInfoSchema replaces the information_schema.table references of
+// sql, outside of quoted text and comments, with the bare table name.
+// The virtual tables are a schema of their own so may not be queried
+// with tables of other schemas.
+func rewriteInfoSchema(sql string) (string, bool, error) {
+
+	toks := sqlTokens(sql)
+	// refs the index in toks of each information_schema.table reference
+	refs := make(map[int]bool)
+	for i := 0; i+2 < len(toks); i++ {
+		if toks[i].ident && strings.EqualFold(toks[i].s, infoSchemaName) && toks[i+1].s == "." &&
+			toks[i+2].ident && infoTableNames[strings.ToLower(toks[i+2].s)] &&
+			(i == 0 || toks[i-1].s != ".") {
+			refs[i] = true
+		}
+	}
+	if len(refs) == 0 {
+		return sql, false, nil
+	}
+	if infoSchemaMixed(toks, refs) {
+		return sql, false, mysql.NewDefaultError(mysql.ER_NOT_SUPPORTED_YET, "information_schema tables with tables of other schemas")
+	}
+
+	var buf bytes.Buffer
+	pos := 0
+	for i, tok := range toks {
+		if refs[i] {
+			buf.WriteString(sql[pos:tok.start])
+			buf.WriteString(toks[i+2].s)
+			pos = toks[i+2].end
+		}
+	}
+	buf.WriteString(sql[pos:])
+	return buf.String(), true, nil
+}
+
+// infoSchemaMixed true if a FROM or JOIN of toks references a table that
+// is not one of refs.  FROM inside a function call, ie EXTRACT(YEAR FROM
+// d), is not a table reference.
+func infoSchemaMixed(toks []sqlToken, refs map[int]bool) bool {
+
+	// funcs for each open paren, if it is a function call
+	var funcs []bool
+	for i := 0; i < len(toks); i++ {
+		switch kw := strings.ToLower(toks[i].s); {
+		case kw == "(":
+			funcs = append(funcs, i+1 < len(toks) && !strings.EqualFold(toks[i+1].s, "select") &&
+				i > 0 && toks[i-1].ident && !isFromKeyword(toks[i-1]))
+		case kw == ")":
+			if len(funcs) > 0 {
+				funcs = funcs[:len(funcs)-1]
+			}
+		case toks[i].ident && isFromKeyword(toks[i]):
+			if len(funcs) > 0 && funcs[len(funcs)-1] {
+				continue
+			}
+			for j := i + 1; j < len(toks); j++ {
+				switch {
+				case toks[j].s == "(":
+					// a derived table, its select is checked as we go
+				case refs[j]:
+					j += 3
+					// optional alias
+					if j < len(toks) && strings.EqualFold(toks[j].s, "as") {
+						j += 2
+					} else if j < len(toks) && toks[j].ident && !clauseWords[strings.ToLower(toks[j].s)] {
+						j++
+					}
+					if j < len(toks) && toks[j].s == "," && kw == "from" {
+						continue
+					}
+				case toks[j].ident:
+					return true
+				}
+				break
+			}
+		}
+	}
+	return false
+}
+
+func isFromKeyword(tok sqlToken) bool {
+	if !tok.ident || tok.quoted {
+		return false
+	}
+	switch strings.ToLower(tok.s) {
+	case "from", "join", "straight_join":
+		return true
+	}
+	return false
+}
+
+// processlistRows the processlist of connections user may see, as SHOW
+// PROCESSLIST does its own unless an admin, all if user is nil.  Info is
+// truncated to 100 characters unless full.
+func processlistRows(user *models.UserConfig, full bool) [][]driver.Value {
+	rows := make([][]driver.Value, 0)
+	for _, h := range conns.list() {
+		row := h.processRow(full)
+		if user != nil && !user.Admin && row[1] != user.Name {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// processRow this connection's processlist row
+//
+//	Id, User, Host, db, Command, Time, State, Info
+func (m *mySqlHandler) processRow(full bool) []driver.Value {
+	user := m.conn.User()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var db, state, info driver.Value
+	if m.db != "" {
+		db = m.db
+	}
+	command := "Sleep"
+	switch {
+	case user == "":
+		user = "unauthenticated user"
+		command = "Connect"
+	case m.killed:
+		command = "Killed"
+	case m.running:
+		command = "Query"
+		state = "executing"
+		sql := m.sql
+		if !full {
+			sql = truncateChars(sql, 100)
+		}
+		info = sql
+	}
+	return []driver.Value{
+		int64(m.connId),
+		user,
+		m.addr,
+		db,
+		command,
+		int64(time.Since(m.cmdAt) / time.Second),
+		state,
+		info,
+	}
+}
+
+// truncateChars s cut to its first n characters, not bytes, so a multi
+// byte character isn't split
+func truncateChars(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+func parseShowProcesslist(sql string) (full bool, ok bool) {
+	match := showProcesslistRegex.FindStringSubmatch(sql)
+	if match == nil {
+		return false, false
+	}
+	return match[1] != "", true
+}
+
+// handleShowProcesslist SHOW [FULL] PROCESSLIST, users see their own
+// connections, admins all.
+func (m *mySqlHandler) handleShowProcesslist(full, binary bool) error {
+
+	rs := mysql.NewResultSet()
+	rs.Fields = []*mysql.Field{
+		mysql.NewField("Id", "", "", 21, mysql.MYSQL_TYPE_LONGLONG),
+		mysql.NewField("User", "", "", 32, mysql.MYSQL_TYPE_VAR_STRING),
+		mysql.NewField("Host", "", "", 261, mysql.MYSQL_TYPE_VAR_STRING),
+		mysql.NewField("db", "", "", 64, mysql.MYSQL_TYPE_VAR_STRING),
+		mysql.NewField("Command", "", "", 16, mysql.MYSQL_TYPE_VAR_STRING),
+		mysql.NewField("Time", "", "", 7, mysql.MYSQL_TYPE_LONG),
+		mysql.NewField("State", "", "", 64, mysql.MYSQL_TYPE_VAR_STRING),
+		mysql.NewField("Info", "", "", 65535, mysql.MYSQL_TYPE_VAR_STRING),
+	}
+	for i, f := range rs.Fields {
+		rs.FieldNames[f.FieldName] = i
+	}
+
+	user := m.conn.AuthUser()
+	for _, row := range processlistRows(user, full) {
+		encodeValues(m.conn.ResultsCharset(), row)
+		var rd mysql.RowData
+		var err error
+		if binary {
+			rd, err = mysql.ValuesToBinaryRowData(row, rs.Fields)
+		} else {
+			rd, err = mysql.ValuesToRowData(row, rs.Fields)
+		}
+		if err != nil {
+			return err
+		}
+		rs.Values = append(rs.Values, row)
+		rs.RowDatas = append(rs.RowDatas, rd)
+	}
+	return m.conn.WriteResultset(m.conn.Status, rs)
+}
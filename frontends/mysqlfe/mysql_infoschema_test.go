@@ -0,0 +1,129 @@
+package mysqlfe
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/araddon/qlbridge/schema"
+	"github.com/araddon/qlbridge/value"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfoSchemaRewrite(t *testing.T) {
+	tests := []struct {
+		sql   string
+		out   string
+		mixed bool
+	}{
+		{"SELECT * FROM information_schema.processlist", "SELECT * FROM processlist", false},
+		{"SELECT ID FROM `INFORMATION_SCHEMA`.`PROCESSLIST` WHERE USER = 'bob'", "SELECT ID FROM PROCESSLIST WHERE USER = 'bob'", false},
+		{"SELECT * FROM information_schema . processlist AS p", "SELECT * FROM processlist AS p", false},
+		{"SELECT c.COLUMN_NAME FROM information_schema.tables t JOIN information_schema.columns c ON t.TABLE_NAME = c.TABLE_NAME",
+			"SELECT c.COLUMN_NAME FROM tables t JOIN columns c ON t.TABLE_NAME = c.TABLE_NAME", false},
+		{"SELECT * FROM information_schema.tables t, information_schema.columns AS c WHERE EXTRACT(YEAR FROM t.CREATE_TIME) = 2018",
+			"SELECT * FROM tables t, columns AS c WHERE EXTRACT(YEAR FROM t.CREATE_TIME) = 2018", false},
+		{"SELECT * FROM information_schema.KEY_COLUMN_USAGE", "SELECT * FROM KEY_COLUMN_USAGE", false},
+		{"SELECT * FROM information_schema.processlists", "", false},
+		{"SELECT * FROM information_schema.column_privileges", "", false},
+		{"SELECT * FROM processlist", "", false},
+		// quoted text and comments are not rewritten
+		{"SELECT * FROM users WHERE x = 'information_schema.tables'", "", false},
+		{"SELECT * FROM users -- information_schema.tables", "", false},
+		{"SELECT * FROM users /* information_schema.tables */", "", false},
+		{"SELECT * FROM information_schema.tables WHERE TABLE_NAME = 'information_schema.tables'",
+			"SELECT * FROM tables WHERE TABLE_NAME = 'information_schema.tables'", false},
+		// nor are tables of other schemas queried with them
+		{"SELECT * FROM information_schema.tables t JOIN users u ON t.TABLE_NAME = u.name", "", true},
+		{"SELECT * FROM users, information_schema.tables", "", true},
+		{"SELECT * FROM information_schema.tables t, users", "", true},
+		{"SELECT * FROM information_schema.tables WHERE TABLE_NAME IN (SELECT name FROM users)", "", true},
+	}
+	for _, tt := range tests {
+		out, ok, err := rewriteInfoSchema(tt.sql)
+		if tt.mixed {
+			assert.NotEqual(t, nil, err, tt.sql)
+			continue
+		}
+		assert.Equal(t, nil, err, tt.sql)
+		if tt.out == "" {
+			assert.False(t, ok, tt.sql)
+			assert.Equal(t, tt.sql, out)
+			continue
+		}
+		assert.True(t, ok, tt.sql)
+		assert.Equal(t, tt.out, out, tt.sql)
+	}
+}
+
+func TestParseShowProcesslist(t *testing.T) {
+	full, ok := parseShowProcesslist("SHOW PROCESSLIST")
+	assert.True(t, ok)
+	assert.False(t, full)
+	full, ok = parseShowProcesslist("show full processlist;")
+	assert.True(t, ok)
+	assert.True(t, full)
+	_, ok = parseShowProcesslist("SHOW TABLES")
+	assert.False(t, ok)
+}
+
+func catalogTestTable() *schema.Table {
+	tbl := schema.NewTable("users")
+	id := schema.NewFieldBase("id", value.IntType, 64, "")
+	id.Key = "PRI"
+	id.NoNulls = true
+	email := schema.NewFieldBase("email", value.StringType, 0, "")
+	email.Key = "UNI"
+	org := schema.NewFieldBase("org", value.StringType, 32, "")
+	org.Key = "MUL"
+	tbl.AddField(id)
+	tbl.AddField(email)
+	tbl.AddField(org)
+	tbl.AddField(schema.NewFieldBase("active", value.BoolType, 1, ""))
+	tbl.SetColumns([]string{"id", "email", "org", "active"})
+	return tbl
+}
+
+func TestCatalogColumns(t *testing.T) {
+	rows := columnRows("datauxtest", catalogTestTable())
+	assert.Equal(t, 4, len(rows))
+	// TABLE_SCHEMA, COLUMN_NAME, ORDINAL_POSITION, IS_NULLABLE, DATA_TYPE, COLUMN_TYPE, COLUMN_KEY
+	pick := func(row []driver.Value) []driver.Value {
+		return []driver.Value{row[1], row[3], row[4], row[6], row[7], row[15], row[16]}
+	}
+	assert.Equal(t, []driver.Value{"datauxtest", "id", int64(1), "NO", "bigint", "bigint", "PRI"}, pick(rows[0]))
+	assert.Equal(t, []driver.Value{"datauxtest", "email", int64(2), "YES", "varchar", "varchar(255)", "UNI"}, pick(rows[1]))
+	assert.Equal(t, int64(255), rows[1][8])
+	// utf8mb4 characters are up to 4 bytes
+	assert.Equal(t, int64(1020), rows[1][9])
+	assert.Equal(t, "utf8mb4", rows[1][13])
+	assert.Equal(t, "utf8mb4_general_ci", rows[1][14])
+	assert.Equal(t, []driver.Value{"datauxtest", "active", int64(4), "YES", "tinyint", "boolean", ""}, pick(rows[3]))
+	assert.Equal(t, nil, rows[3][13])
+	for _, row := range rows {
+		assert.Equal(t, len(infoTables[3].cols), len(row))
+	}
+}
+
+func TestCatalogIndexes(t *testing.T) {
+	tbl := catalogTestTable()
+	stats := statisticRows("datauxtest", tbl)
+	assert.Equal(t, 3, len(stats))
+	// NON_UNIQUE, INDEX_NAME, COLUMN_NAME
+	assert.Equal(t, []driver.Value{int64(0), "PRIMARY", "id"}, []driver.Value{stats[0][3], stats[0][5], stats[0][7]})
+	assert.Equal(t, []driver.Value{int64(0), "email", "email"}, []driver.Value{stats[1][3], stats[1][5], stats[1][7]})
+	assert.Equal(t, []driver.Value{int64(1), "org", "org"}, []driver.Value{stats[2][3], stats[2][5], stats[2][7]})
+
+	keys := keyColumnRows("datauxtest", tbl)
+	assert.Equal(t, 2, len(keys))
+	assert.Equal(t, "PRIMARY", keys[0][2])
+	assert.Equal(t, "email", keys[1][6])
+	assert.Equal(t, len(infoTables[5].cols), len(keys[0]))
+}
+
+func TestTruncateChars(t *testing.T) {
+	assert.Equal(t, "short", truncateChars("short", 100))
+	assert.Equal(t, "caf", truncateChars("café", 3))
+	assert.Equal(t, "café", truncateChars("café au lait", 4))
+	assert.Equal(t, "中文", truncateChars("中文字", 2))
+	assert.Equal(t, "", truncateChars("中文字", 0))
+}
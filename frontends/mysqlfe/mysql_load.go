@@ -0,0 +1,655 @@
+package mysqlfe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
+	u "github.com/araddon/gou"
+
+	"github.com/araddon/qlbridge/plan"
+	"github.com/araddon/qlbridge/rel"
+	"github.com/araddon/qlbridge/schema"
+	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/models"
+	"github.com/dataux/dataux/planner"
+	"github.com/dataux/dataux/vendored/mixer/mysql"
+)
+
+// LOAD DATA LOCAL INFILE streams a file from the client into a table of a
+// source that implements schema.ConnMutation, in batches of PutMulti.
+const loadBatchSize = 500
+
+var (
+	loadDataRegex = regexp.MustCompile(`(?i)^\s*LOAD\s+DATA\b`)
+)
+
+// loadData a LOAD DATA statement
+type loadData struct {
+	local   bool
+	file    string
+	db      string
+	table   string
+	columns []string // columns of the fields of a record, all if empty
+	charset string   // CHARACTER SET of the file, empty is that of the client
+
+	fieldsTerminated string
+	enclosed         string // single char or empty
+	optionally       bool   // OPTIONALLY ENCLOSED, read the same as ENCLOSED
+	escaped          string // single char or empty
+	linesStarting    string
+	linesTerminated  string
+	ignoreLines      int
+}
+
+func newLoadData() *loadData {
+	return &loadData{
+		fieldsTerminated: "\t",
+		escaped:          `\`,
+		linesTerminated:  "\n",
+	}
+}
+
+// isLoadData is sql a LOAD DATA statement
+func isLoadData(sql string) bool {
+	return loadDataRegex.MatchString(sql)
+}
+
+// parseLoadData the LOAD DATA statement of sql
+//
+//	LOAD DATA [LOW_PRIORITY | CONCURRENT] [LOCAL] INFILE 'file'
+//	    [REPLACE | IGNORE] INTO TABLE tbl [CHARACTER SET charset]
+//	    [{FIELDS | COLUMNS} [TERMINATED BY 's'] [[OPTIONALLY] ENCLOSED BY 'c'] [ESCAPED BY 'c']]
+//	    [LINES [STARTING BY 's'] [TERMINATED BY 's']]
+//	    [IGNORE n {LINES | ROWS}] [(col, ...)]
+func parseLoadData(sql string) (*loadData, error) {
+
+	p := &loadParser{toks: loadTokens(sql)}
+	ld := newLoadData()
+	if !p.accept("LOAD", "DATA") {
+		return nil, mysql.NewDefaultError(mysql.ER_SYNTAX_ERROR)
+	}
+	if !p.accept("LOW_PRIORITY") {
+		p.accept("CONCURRENT")
+	}
+	ld.local = p.accept("LOCAL")
+	if !p.accept("INFILE") {
+		return nil, mysql.NewDefaultError(mysql.ER_SYNTAX_ERROR)
+	}
+	var err error
+	if ld.file, err = p.str(); err != nil {
+		return nil, err
+	}
+	if !p.accept("REPLACE") {
+		// sources put rows by key, duplicates replace either way
+		p.accept("IGNORE")
+	}
+	if !p.accept("INTO", "TABLE") {
+		return nil, mysql.NewDefaultError(mysql.ER_SYNTAX_ERROR)
+	}
+	tbl := p.next()
+	if tbl == "" {
+		return nil, mysql.NewDefaultError(mysql.ER_SYNTAX_ERROR)
+	}
+	if p.accept(".") {
+		ld.db = unquoteSetValue(tbl)
+		tbl = p.next()
+	}
+	ld.table = unquoteSetValue(tbl)
+	if p.accept("CHARACTER", "SET") || p.accept("CHARSET") {
+		name := unquoteSetValue(p.next())
+		if ld.charset = mysql.CharsetName(name); ld.charset == "" {
+			return nil, mysql.NewDefaultError(mysql.ER_UNKNOWN_CHARACTER_SET, name)
+		}
+	}
+
+	if p.accept("FIELDS") || p.accept("COLUMNS") {
+		found := false
+	fields:
+		for {
+			switch {
+			case p.accept("TERMINATED", "BY"):
+				ld.fieldsTerminated, err = p.str()
+			case p.accept("OPTIONALLY", "ENCLOSED", "BY"):
+				ld.optionally = true
+				ld.enclosed, err = p.str()
+			case p.accept("ENCLOSED", "BY"):
+				ld.enclosed, err = p.str()
+			case p.accept("ESCAPED", "BY"):
+				ld.escaped, err = p.str()
+			default:
+				if !found {
+					return nil, mysql.NewDefaultError(mysql.ER_SYNTAX_ERROR)
+				}
+				break fields
+			}
+			if err != nil {
+				return nil, err
+			}
+			found = true
+		}
+	}
+	if p.accept("LINES") {
+		found := false
+	lines:
+		for {
+			switch {
+			case p.accept("STARTING", "BY"):
+				ld.linesStarting, err = p.str()
+			case p.accept("TERMINATED", "BY"):
+				ld.linesTerminated, err = p.str()
+			default:
+				if !found {
+					return nil, mysql.NewDefaultError(mysql.ER_SYNTAX_ERROR)
+				}
+				break lines
+			}
+			if err != nil {
+				return nil, err
+			}
+			found = true
+		}
+	}
+	if p.accept("IGNORE") {
+		n, err := strconv.Atoi(p.next())
+		if err != nil || !(p.accept("LINES") || p.accept("ROWS")) {
+			return nil, mysql.NewDefaultError(mysql.ER_SYNTAX_ERROR)
+		}
+		ld.ignoreLines = n
+	}
+	if p.accept("(") {
+		for {
+			col := p.next()
+			switch {
+			case col == "" || col == ")" || col == ",":
+				return nil, mysql.NewDefaultError(mysql.ER_SYNTAX_ERROR)
+			case strings.HasPrefix(col, "@"):
+				return nil, mysql.NewDefaultError(mysql.ER_NOT_SUPPORTED_YET, "LOAD DATA into user variables")
+			}
+			ld.columns = append(ld.columns, unquoteSetValue(col))
+			if p.accept(")") {
+				break
+			}
+			if !p.accept(",") {
+				return nil, mysql.NewDefaultError(mysql.ER_SYNTAX_ERROR)
+			}
+		}
+	}
+	if p.accept("SET") {
+		return nil, mysql.NewDefaultError(mysql.ER_NOT_SUPPORTED_YET, "LOAD DATA ... SET")
+	}
+	p.accept(";")
+	if p.peek() != "" {
+		return nil, mysql.NewDefaultError(mysql.ER_SYNTAX_ERROR)
+	}
+
+	if len(ld.enclosed) > 1 || len(ld.escaped) > 1 || ld.fieldsTerminated == "" || ld.linesTerminated == "" {
+		return nil, mysql.NewDefaultError(mysql.ER_WRONG_FIELD_TERMINATORS)
+	}
+	return ld, nil
+}
+
+// loadParser the tokens of a LOAD DATA statement
+type loadParser struct {
+	toks []string
+	pos  int
+}
+
+func (m *loadParser) peek() string {
+	if m.pos >= len(m.toks) {
+		return ""
+	}
+	return m.toks[m.pos]
+}
+
+func (m *loadParser) next() string {
+	tok := m.peek()
+	if tok != "" {
+		m.pos++
+	}
+	return tok
+}
+
+// accept the sequence of keywords, consumed only if all match
+func (m *loadParser) accept(words ...string) bool {
+	if m.pos+len(words) > len(m.toks) {
+		return false
+	}
+	for i, w := range words {
+		if !strings.EqualFold(m.toks[m.pos+i], w) {
+			return false
+		}
+	}
+	m.pos += len(words)
+	return true
+}
+
+// str a string literal
+func (m *loadParser) str() (string, error) {
+	s, ok := stringLiteral(m.next())
+	if !ok {
+		return "", mysql.NewDefaultError(mysql.ER_SYNTAX_ERROR)
+	}
+	return s, nil
+}
+
+// loadTokens splits sql into words, quoted strings and identifiers, and
+// the punctuation ( ) , . ;
+func loadTokens(sql string) []string {
+	var toks []string
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'' || c == '"' || c == '`':
+			start := i
+			for i++; i < len(sql); i++ {
+				if sql[i] == '\\' && c != '`' {
+					i++
+					continue
+				}
+				if sql[i] == c {
+					if i+1 < len(sql) && sql[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			if i < len(sql) {
+				i++
+			}
+			toks = append(toks, sql[start:i])
+		case strings.IndexByte("(),.;", c) >= 0:
+			toks = append(toks, sql[i:i+1])
+			i++
+		default:
+			start := i
+			for i < len(sql) && strings.IndexByte(" \t\n\r'\"`(),.;", sql[i]) < 0 {
+				i++
+			}
+			toks = append(toks, sql[start:i])
+		}
+	}
+	return toks
+}
+
+// loadReader reads the records of a LOAD DATA file, fields are strings
+// or nil for NULL.
+type loadReader struct {
+	r   *bufio.Reader
+	ld  *loadData
+	enc int // enclosed char, -1 for none
+	esc int // escape char, -1 for none
+}
+
+func newLoadReader(r io.Reader, ld *loadData) *loadReader {
+	m := &loadReader{r: bufio.NewReader(r), ld: ld, enc: -1, esc: -1}
+	if ld.enclosed != "" {
+		m.enc = int(ld.enclosed[0])
+	}
+	if ld.escaped != "" {
+		m.esc = int(ld.escaped[0])
+	}
+	return m
+}
+
+// Next the fields of the next record, io.EOF at the end of the file
+func (m *loadReader) Next() ([]driver.Value, error) {
+	if err := m.skipToStart(); err != nil {
+		return nil, err
+	}
+	var fields []driver.Value
+	for {
+		field, end, err := m.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+		if end {
+			return fields, nil
+		}
+	}
+}
+
+// skipToStart skips to the start of the next record, past LINES STARTING BY
+func (m *loadReader) skipToStart() error {
+	for {
+		if m.ld.linesStarting == "" {
+			_, err := m.r.Peek(1)
+			return err
+		}
+		ok, err := m.match(m.ld.linesStarting)
+		if ok || err != nil {
+			return err
+		}
+		if _, err := m.r.ReadByte(); err != nil {
+			return err
+		}
+	}
+}
+
+// field reads a field, end is true if it ends the record
+func (m *loadReader) field() (v driver.Value, end bool, err error) {
+
+	var buf bytes.Buffer
+	quoted, inQuotes, null := false, false, false
+	if m.enc >= 0 {
+		if b, _ := m.r.Peek(1); len(b) == 1 && int(b[0]) == m.enc {
+			m.r.Discard(1)
+			quoted, inQuotes = true, true
+		}
+	}
+
+	result := func() driver.Value {
+		s := buf.String()
+		switch {
+		case null && s == "N":
+			return nil
+		case m.enc >= 0 && !quoted && s == "NULL":
+			return nil
+		}
+		return s
+	}
+
+	for {
+		if !inQuotes {
+			if ok, err := m.match(m.ld.fieldsTerminated); ok || err != nil {
+				return result(), false, err
+			}
+			if ok, err := m.match(m.ld.linesTerminated); ok || err != nil {
+				return result(), true, err
+			}
+		}
+		c, err := m.r.ReadByte()
+		if err == io.EOF {
+			return result(), true, nil
+		} else if err != nil {
+			return nil, false, err
+		}
+		switch {
+		case int(c) == m.esc:
+			first := buf.Len() == 0 && !quoted
+			e, err := m.r.ReadByte()
+			if err == io.EOF {
+				buf.WriteByte(c)
+				continue
+			} else if err != nil {
+				return nil, false, err
+			}
+			null = first && e == 'N'
+			buf.WriteByte(unescapeLoad(e))
+		case inQuotes && int(c) == m.enc:
+			if b, _ := m.r.Peek(1); len(b) == 1 && b[0] == c {
+				// doubled enclosing char
+				m.r.Discard(1)
+				buf.WriteByte(c)
+				continue
+			}
+			inQuotes = false
+		default:
+			buf.WriteByte(c)
+		}
+	}
+}
+
+// match consumes s if it is next in the file
+func (m *loadReader) match(s string) (bool, error) {
+	b, err := m.r.Peek(len(s))
+	if len(b) < len(s) {
+		if err == io.EOF {
+			err = nil
+		}
+		return false, err
+	}
+	if string(b) != s {
+		return false, nil
+	}
+	m.r.Discard(len(s))
+	return true, nil
+}
+
+// unescapeLoad the char of the escape sequence of e
+func unescapeLoad(e byte) byte {
+	switch e {
+	case '0':
+		return 0
+	case 'b':
+		return '\b'
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'Z':
+		return 0x1a
+	}
+	return e
+}
+
+// loadRecord the row of the fields of a record for the columns fields,
+// coerced to the type of the field where it parses.  Missing fields are
+// NULL and extra fields dropped, with a warning as mysql does.  Strings are
+// decoded from the charset of the file.
+func loadRecord(fields []*schema.Field, record []driver.Value, line int64, loc *time.Location, charset string, warnings *models.Warnings) []driver.Value {
+	switch {
+	case len(record) < len(fields):
+		warnings.Add(models.WarnTooFewFields, "Row %d doesn't contain data for all columns", line)
+	case len(record) > len(fields):
+		warnings.Add(models.WarnTooManyFields, "Row %d was truncated; it contained more data than there were input columns", line)
+		record = record[:len(fields)]
+	}
+	row := make([]driver.Value, len(fields))
+	for i, f := range fields {
+		if i >= len(record) {
+			continue
+		}
+		s, ok := record[i].(string)
+		if !ok {
+			continue
+		}
+		s = mysql.DecodeString(charset, s)
+		row[i] = s
+		switch f.ValueType() {
+		case value.IntType:
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				row[i] = n
+			}
+		case value.BoolType:
+			if b, err := strconv.ParseBool(s); err == nil {
+				row[i] = b
+			}
+		case value.TimeType:
+			if loc == nil {
+				loc = time.Local
+			}
+			if t, err := dateparse.ParseIn(s, loc); err == nil {
+				row[i] = t
+			}
+		}
+	}
+	return row
+}
+
+// handleLoadData LOAD DATA LOCAL INFILE, asking client for the file and
+// putting its records in batches to the mutator of the table's source.
+func (m *mySqlHandler) handleLoadData(sql string) error {
+
+	ld, err := parseLoadData(sql)
+	if err != nil {
+		return err
+	}
+	if !ld.local {
+		return mysql.NewDefaultError(mysql.ER_NOT_SUPPORTED_YET, "LOAD DATA INFILE of a server file, use LOAD DATA LOCAL INFILE")
+	}
+	if !m.conn.LocalInfile() {
+		return mysql.NewDefaultError(mysql.ER_NOT_ALLOWED_COMMAND)
+	}
+
+	sch := m.schema
+	if ld.db != "" {
+		if user := m.conn.AuthUser(); user != nil && !user.AllowSchema(ld.db) {
+			return mysql.NewDefaultError(mysql.ER_DBACCESS_DENIED_ERROR, user.Name, m.conn.Host(), ld.db)
+		}
+		sch, _ = m.svr.Schema(ld.db)
+		if sch == nil {
+			return mysql.NewDefaultError(mysql.ER_BAD_DB_ERROR, ld.db)
+		}
+	}
+	if sch == nil || sch.Name == infoSchemaName {
+		return mysql.NewDefaultError(mysql.ER_NO_DB_ERROR)
+	}
+	tbl, err := sch.Table(ld.table)
+	if err != nil || tbl == nil {
+		return mysql.NewDefaultError(mysql.ER_NO_SUCH_TABLE, sch.Name, ld.table)
+	}
+
+	fields := tbl.Fields
+	if len(ld.columns) > 0 {
+		fields = make([]*schema.Field, len(ld.columns))
+		for i, col := range ld.columns {
+			f, ok := tbl.FieldMap[col]
+			if !ok {
+				return mysql.NewDefaultError(mysql.ER_BAD_FIELD_ERROR, col, ld.table)
+			}
+			fields[i] = f
+		}
+	}
+	cols := make([]string, len(fields))
+	vals := make([]string, len(fields))
+	for i, f := range fields {
+		cols[i] = loadIdent(f.Name)
+		vals[i] = "''"
+	}
+
+	// the mutators of sources take their columns from the insert
+	insertSql := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", loadIdent(ld.table), strings.Join(cols, ", "), strings.Join(vals, ", "))
+	stmt, err := rel.ParseSql(insertSql)
+	if err != nil {
+		u.Warnf("could not parse %s: %v", insertSql, err)
+		return err
+	}
+	ctx := plan.NewContext(insertSql)
+	ctx.DisableRecover = m.svr.Config.SupressRecover
+	ctx.Session = m.sess.ctx
+	ctx.Schema = sch
+	ctx.Funcs = fr
+	ctx.Stmt = stmt
+	if err := m.checkSourceGrants(ctx); err != nil {
+		return err
+	}
+	// KILL and closing the connection cancel the batch being put
+	stmtCtx, cancel := m.statementContext(sql)
+	defer cancel()
+	defer planner.BindContext(ctx, stmtCtx)()
+
+	conn, err := sch.OpenConn(ld.table)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	mutation, ok := conn.(schema.ConnMutation)
+	if !ok {
+		return mysql.NewDefaultError(mysql.ER_NOT_SUPPORTED_YET, fmt.Sprintf("LOAD DATA into read only source of %s", ld.table))
+	}
+	mutator, err := mutation.CreateMutator(ctx)
+	if err != nil {
+		return err
+	}
+
+	file, err := m.conn.RequestLocalFile(ld.file)
+	if err != nil {
+		return err
+	}
+	// client must finish sending the file before it reads our result
+	defer file.Close()
+
+	m.warnings = &models.Warnings{}
+	m.conn.Warnings = m.warnings
+	charset := ld.charset
+	if charset == "" {
+		charset = m.conn.Charset()
+	}
+	reader := newLoadReader(file, ld)
+	var line, records int64
+	batch := make([][]driver.Value, 0, loadBatchSize)
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		line++
+		if line <= int64(ld.ignoreLines) {
+			continue
+		}
+		batch = append(batch, loadRecord(fields, record, line, m.sess.loc, charset, m.warnings))
+		if len(batch) == loadBatchSize {
+			if err := m.putLoadBatch(stmtCtx, mutator, batch); err != nil {
+				return err
+			}
+			records += int64(len(batch))
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := m.putLoadBatch(stmtCtx, mutator, batch); err != nil {
+			return err
+		}
+		records += int64(len(batch))
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	u.Infof("loaded %d records from %q into %s.%s", records, ld.file, sch.Name, ld.table)
+	return m.writeOK(&mysql.Result{
+		AffectedRows: uint64(records),
+		Info:         fmt.Sprintf("Records: %d  Deleted: 0  Skipped: 0  Warnings: %d", records, m.warnings.Count()),
+	})
+}
+
+// putLoadBatch puts a batch of rows with PutMulti, row by row for sources
+// that don't implement it.  Puts are cancelled with goctx, the context of
+// the statement.
+func (m *mySqlHandler) putLoadBatch(goctx context.Context, mutator schema.ConnMutator, rows [][]driver.Value) error {
+	if err := m.interruptErr(); err != nil {
+		return err
+	}
+	_, err := mutator.PutMulti(goctx, nil, rows)
+	if err == schema.ErrNotImplemented {
+		err = nil
+		for _, row := range rows {
+			if _, err = mutator.Put(goctx, nil, row); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		if ierr := m.interruptErr(); ierr != nil {
+			// killed while the batch was put
+			return ierr
+		}
+	}
+	return err
+}
+
+// loadIdent an identifier for the insert of a LOAD DATA
+func loadIdent(name string) string {
+	if bareWordRegex.MatchString(name) {
+		return name
+	}
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
@@ -0,0 +1,144 @@
+package mysqlfe
+
+import (
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/araddon/qlbridge/schema"
+	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/models"
+)
+
+func TestParseLoadData(t *testing.T) {
+	assert.True(t, isLoadData("load data local infile 'x' into table t"))
+	assert.True(t, !isLoadData("SELECT * FROM loaded"))
+
+	ld, err := parseLoadData("LOAD DATA LOCAL INFILE '/tmp/users.csv' REPLACE INTO TABLE `db1`.users " +
+		`FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"' ESCAPED BY '\\' ` +
+		`LINES STARTING BY 'x' TERMINATED BY '\r\n' IGNORE 1 LINES (user_id, name, ` + "`created`);")
+	assert.Equal(t, nil, err)
+	assert.True(t, ld.local)
+	assert.Equal(t, "/tmp/users.csv", ld.file)
+	assert.Equal(t, "db1", ld.db)
+	assert.Equal(t, "users", ld.table)
+	assert.Equal(t, ",", ld.fieldsTerminated)
+	assert.Equal(t, `"`, ld.enclosed)
+	assert.True(t, ld.optionally)
+	assert.Equal(t, `\`, ld.escaped)
+	assert.Equal(t, "x", ld.linesStarting)
+	assert.Equal(t, "\r\n", ld.linesTerminated)
+	assert.Equal(t, 1, ld.ignoreLines)
+	assert.Equal(t, []string{"user_id", "name", "created"}, ld.columns)
+
+	ld, err = parseLoadData("LOAD DATA LOCAL INFILE 'u' INTO TABLE users CHARACTER SET 'latin1'")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "latin1", ld.charset)
+
+	ld, err = parseLoadData("load data infile 'users.tsv' into table users")
+	assert.Equal(t, nil, err)
+	assert.True(t, !ld.local)
+	assert.Equal(t, "\t", ld.fieldsTerminated)
+	assert.Equal(t, "\n", ld.linesTerminated)
+	assert.Equal(t, `\`, ld.escaped)
+	assert.Equal(t, "", ld.enclosed)
+
+	for _, sql := range []string{
+		"LOAD DATA LOCAL INFILE users INTO TABLE users",
+		"LOAD DATA LOCAL INFILE 'u' INTO users",
+		"LOAD DATA LOCAL INFILE 'u' INTO TABLE users FIELDS",
+		"LOAD DATA LOCAL INFILE 'u' INTO TABLE users FIELDS ENCLOSED BY '<>'",
+		"LOAD DATA LOCAL INFILE 'u' INTO TABLE users (a, @b)",
+		"LOAD DATA LOCAL INFILE 'u' INTO TABLE users (a) SET b = 1",
+		"LOAD DATA LOCAL INFILE 'u' INTO TABLE users extra",
+		"LOAD DATA LOCAL INFILE 'u' INTO TABLE users CHARSET klingon",
+	} {
+		_, err := parseLoadData(sql)
+		assert.NotEqual(t, nil, err, sql)
+	}
+}
+
+func readLoad(t *testing.T, file string, ld *loadData) [][]driver.Value {
+	r := newLoadReader(strings.NewReader(file), ld)
+	var records [][]driver.Value
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return records
+		}
+		assert.Equal(t, nil, err)
+		records = append(records, record)
+	}
+}
+
+func TestLoadReader(t *testing.T) {
+	// defaults, tab separated with backslash escapes
+	records := readLoad(t, "1\tbob\t\\N\n2\tline\\nbreak\\ttab\tx\n", newLoadData())
+	assert.Equal(t, [][]driver.Value{
+		{"1", "bob", nil},
+		{"2", "line\nbreak\ttab", "x"},
+	}, records)
+
+	// csv with quoted fields, doubled and escaped quotes, and no final
+	// line terminator
+	ld := newLoadData()
+	ld.fieldsTerminated = ","
+	ld.enclosed = `"`
+	ld.linesTerminated = "\r\n"
+	records = readLoad(t, "1,\"a, b\",\"say \"\"hi\"\"\"\r\n2,\"multi\r\nline\",NULL\r\n3,\"\\\"q\\\"\",\"NULL\"", ld)
+	assert.Equal(t, [][]driver.Value{
+		{"1", "a, b", `say "hi"`},
+		{"2", "multi\r\nline", nil},
+		{"3", `"q"`, "NULL"},
+	}, records)
+
+	// lines starting by skips the prefix, and lines without it
+	ld = newLoadData()
+	ld.fieldsTerminated = ","
+	ld.linesStarting = "xxx"
+	records = readLoad(t, "xxx1,a\nskipped\nyyyxxx2,b\n", ld)
+	assert.Equal(t, [][]driver.Value{{"1", "a"}, {"2", "b"}}, records)
+
+	assert.Equal(t, 0, len(readLoad(t, "", newLoadData())))
+}
+
+func TestLoadRecord(t *testing.T) {
+	fields := []*schema.Field{
+		schema.NewFieldBase("id", value.IntType, 64, "id"),
+		schema.NewFieldBase("name", value.StringType, 255, "name"),
+		schema.NewFieldBase("active", value.BoolType, 1, "active"),
+		schema.NewFieldBase("created", value.TimeType, 32, "created"),
+	}
+	warnings := &models.Warnings{}
+
+	row := loadRecord(fields, []driver.Value{"12", "bob", "true", "2016-10-01 12:00:00"}, 1, time.UTC, "utf8mb4", warnings)
+	assert.Equal(t, []driver.Value{int64(12), "bob", true, time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)}, row)
+	assert.Equal(t, uint16(0), warnings.Count())
+
+	// values that don't parse as the type are sent as is
+	row = loadRecord(fields, []driver.Value{"x", nil}, 2, time.UTC, "utf8mb4", warnings)
+	assert.Equal(t, []driver.Value{"x", nil, nil, nil}, row)
+	row = loadRecord(fields, []driver.Value{"1", "a", "false", "2016-10-01", "extra"}, 3, time.UTC, "utf8mb4", warnings)
+	assert.Equal(t, 4, len(row))
+	// latin1 files are decoded to utf8
+	row = loadRecord(fields[:2], []driver.Value{"1", "caf\xe9 \x80"}, 4, time.UTC, "latin1", warnings)
+	assert.Equal(t, "café €", row[1])
+
+	list := warnings.List()
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, models.WarnTooFewFields, list[0].Kind)
+	assert.Equal(t, "Row 2 doesn't contain data for all columns", list[0].Message)
+	assert.Equal(t, models.WarnTooManyFields, list[1].Kind)
+	assert.Equal(t, uint16(1262), warningCode(list[1]))
+}
+
+func TestLoadIdent(t *testing.T) {
+	assert.Equal(t, "article", loadIdent("article"))
+	assert.Equal(t, "`first name`", loadIdent("first name"))
+	assert.Equal(t, "`a``b`", loadIdent("a`b"))
+}
@@ -1,20 +1,129 @@
 package mysqlfe
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/araddon/qlbridge/datasource"
 	"github.com/araddon/qlbridge/expr"
+	"github.com/araddon/qlbridge/rel"
 	"github.com/araddon/qlbridge/value"
 
+	"github.com/dataux/dataux/vendored/mixer/mysql"
 	"github.com/dataux/dataux/version"
 )
 
 // http://dev.mysql.com/doc/refman/5.6/en/server-system-variables.html
 var mysqlGlobalVars *datasource.ContextSimple = NewMySqlGlobalVars()
 
+// maxSelectLimit the default and maximum sql_select_limit, no limit
+const maxSelectLimit = math.MaxUint64
+
+// time_zone offset such as +05:30
+var tzOffsetRegex = regexp.MustCompile(`^([+-])(\d{1,2}):(\d{2})$`)
+
+// sessionVars the system variables a session may SET, the rest of
+// mysql's are unknown.  Those we don't act on are only stored, as clients
+// and drivers set them when connecting.
+var sessionVars = map[string]bool{
+	"autocommit":                      true,
+	"auto_increment_increment":        true,
+	"auto_increment_offset":           true,
+	"big_tables":                      true,
+	"character_set_client":            true,
+	"character_set_connection":        true,
+	"character_set_database":          true,
+	"character_set_filesystem":        true,
+	"character_set_results":           true,
+	"character_set_server":            true,
+	"collation_connection":            true,
+	"collation_database":              true,
+	"collation_server":                true,
+	"completion_type":                 true,
+	"default_storage_engine":          true,
+	"default_week_format":             true,
+	"div_precision_increment":         true,
+	"explicit_defaults_for_timestamp": true,
+	"foreign_key_checks":              true,
+	"group_concat_max_len":            true,
+	"innodb_lock_wait_timeout":        true,
+	"interactive_timeout":             true,
+	"lc_time_names":                   true,
+	"lock_wait_timeout":               true,
+	"long_query_time":                 true,
+	"max_execution_time":              true,
+	"max_sort_length":                 true,
+	"net_read_timeout":                true,
+	"net_write_timeout":               true,
+	"profiling":                       true,
+	"query_cache_type":                true,
+	"session_track_schema":            true,
+	"session_track_state_change":      true,
+	"session_track_system_variables":  true,
+	"session_track_transaction_info":  true,
+	"sql_auto_is_null":                true,
+	"sql_big_selects":                 true,
+	"sql_buffer_result":               true,
+	"sql_mode":                        true,
+	"sql_notes":                       true,
+	"sql_quote_show_create":           true,
+	"sql_safe_updates":                true,
+	"sql_select_limit":                true,
+	"sql_warnings":                    true,
+	"time_zone":                       true,
+	"transaction_isolation":           true,
+	"transaction_read_only":           true,
+	"tx_isolation":                    true,
+	"tx_read_only":                    true,
+	"unique_checks":                   true,
+	"wait_timeout":                    true,
+}
+
+// readOnlyVars the system variables of the server and connection a session
+// may not SET, ie the user grants are resolved for
+var readOnlyVars = map[string]bool{
+	"character_set_system":   true,
+	"connection_id":          true,
+	"database":               true,
+	"dataux.dialect":         true,
+	"hostname":               true,
+	"license":                true,
+	"lower_case_table_names": true,
+	"max_allowed_packet":     true,
+	"max_allowed_packets":    true,
+	"net_buffer_length":      true,
+	"port":                   true,
+	"protocol_version":       true,
+	"system_time_zone":       true,
+	"user":                   true,
+	"version":                true,
+	"version_comment":        true,
+}
+
 func NewMySqlSessionVars(db, user string, connId uint32) expr.ContextReadWriter {
+	return newMySqlSession(db, user, connId).ctx
+}
+
+// mySqlSession the session of a connection, the @@system variables it has
+// SET, its @user variables and the behavior they change.
+type mySqlSession struct {
+	vars        *datasource.ContextSimple // session scope system variables
+	userVars    map[string]value.Value    // @user variables by lower case name
+	ctx         expr.ContextReadWriter    // session vars, falling back to globals
+	loc         *time.Location            // time_zone, nil is SYSTEM
+	selectLimit uint64                    // sql_select_limit, maxSelectLimit is no limit
+	maxExecTime int64                     // max_execution_time ms, 0 is no limit
+	charset     string                    // character_set_client, statements are decoded from it
+	results     string                    // character_set_results, empty sends results as is
+	collation   mysql.CollationId         // collation_connection
+}
+
+func newMySqlSession(db, user string, connId uint32) *mySqlSession {
 	ctx := datasource.NewContextSimple()
 	ctx.Data["@@dataux.dialect"] = value.NewStringValue("mysql")
 	ctx.Data["@@database"] = value.NewStringValue(db)
@@ -32,7 +141,351 @@ func NewMySqlSessionVars(db, user string, connId uint32) expr.ContextReadWriter
 		ctx,
 		mysqlGlobalVars,
 	}, ctx, time.Now())
-	return rw
+	return &mySqlSession{
+		vars:        ctx,
+		userVars:    make(map[string]value.Value),
+		ctx:         rw,
+		selectLimit: maxSelectLimit,
+		maxExecTime: globalInt("max_execution_time"),
+		charset:     mysql.DEFAULT_CHARSET,
+		results:     mysql.DEFAULT_CHARSET,
+		collation:   mysql.DEFAULT_COLLATION_ID,
+	}
+}
+
+// setNames the charsets of client, connection and results as SET NAMES
+// does, and the collation of the connection, 0 for the default of charset
+func (m *mySqlSession) setNames(charset string, collation mysql.CollationId) {
+	if collation == 0 {
+		collation = mysql.CharsetIds[charset]
+	}
+	m.charset, m.results, m.collation = charset, charset, collation
+	cs := value.NewStringValue(charset)
+	for _, name := range []string{"character_set_client", "character_set_connection", "character_set_results"} {
+		m.vars.Data["@@"+name] = cs
+		m.vars.Data["@@session."+name] = cs
+	}
+	coll := value.NewStringValue(mysql.Collations[collation])
+	m.vars.Data["@@collation_connection"] = coll
+	m.vars.Data["@@session.collation_connection"] = coll
+}
+
+// globalInt the value of an integer global variable, 0 if not set
+func globalInt(name string) int64 {
+	v, ok := mysqlGlobalVars.Data["@@"+name]
+	if !ok || v == nil || v.Nil() {
+		return 0
+	}
+	n, _ := strconv.ParseInt(v.ToString(), 10, 64)
+	return n
+}
+
+// setDb the schema in use by user
+func (m *mySqlSession) setDb(db, user string) {
+	m.vars.Data["@@database"] = value.NewStringValue(db)
+	m.vars.Data["@@user"] = value.NewStringValue(user)
+}
+
+// setUser the authenticated user of the connection
+func (m *mySqlSession) setUser(user string) {
+	m.vars.Data["@@user"] = value.NewStringValue(user)
+}
+
+// withSelectLimit sql with sql_select_limit as its LIMIT if it is a SELECT
+// without one, so sources push the limit down instead of reading rows the
+// client is not sent.  Sub-queries keep theirs as in mysql.  The LIMIT is
+// added to the sql as sent, which is otherwise unchanged.
+func (m *mySqlSession) withSelectLimit(sql string) string {
+	if m.selectLimit >= math.MaxInt64 || !selectRegex.MatchString(sql) {
+		// no source returns as many rows
+		return sql
+	}
+	stmt, err := rel.ParseSql(sql)
+	if err != nil {
+		// the planner reports it
+		return sql
+	}
+	if _, ok := stmt.(*rel.SqlSelect); !ok {
+		return sql
+	}
+	at, ok := selectLimitAt(sql)
+	if !ok {
+		return sql
+	}
+	return sql[:at] + " LIMIT " + strconv.FormatUint(m.selectLimit, 10) + sql[at:]
+}
+
+// selectLimitAt the position in select sql a LIMIT is added at, after its
+// last clause and before any FOR UPDATE or LOCK IN SHARE MODE, false if it
+// has a LIMIT of its own.  A LIMIT 0 is its own, as the parsed Limit of
+// the select can't tell it from none.
+func selectLimitAt(sql string) (int, bool) {
+	at, end, depth := -1, 0, 0
+	toks := sqlTokens(sql)
+	for i, tok := range toks {
+		switch {
+		case tok.s == "(":
+			depth++
+		case tok.s == ")":
+			depth--
+		case depth > 0 || !tok.ident || tok.quoted:
+		case strings.EqualFold(tok.s, "limit"):
+			return 0, false
+		case at < 0 && i+1 < len(toks) && isLockingClause(tok.s, toks[i+1].s):
+			at = end
+		}
+		if tok.s != ";" {
+			end = tok.end
+		}
+	}
+	if at < 0 {
+		at = end
+	}
+	return at, true
+}
+
+// isLockingClause FOR UPDATE, FOR SHARE or LOCK IN SHARE MODE
+func isLockingClause(word, next string) bool {
+	switch {
+	case strings.EqualFold(word, "for"):
+		return strings.EqualFold(next, "update") || strings.EqualFold(next, "share")
+	case strings.EqualFold(word, "lock"):
+		return strings.EqualFold(next, "in")
+	}
+	return false
+}
+
+// setUserVar SET @name = v, a nil v is NULL
+func (m *mySqlSession) setUserVar(name string, v value.Value) {
+	name = strings.ToLower(name)
+	if v == nil || v.Nil() {
+		delete(m.userVars, name)
+		return
+	}
+	m.userVars[name] = v
+}
+
+// setSystemVar SET [SESSION] name = v, dflt is true for SET name = DEFAULT
+// which reverts to the global value.  Variables changing behavior are
+// validated, other session variables are stored as given with NULL
+// reverting to global.
+func (m *mySqlSession) setSystemVar(name string, v value.Value, dflt bool) error {
+
+	name = strings.ToLower(name)
+	if err := checkSystemVar(name); err != nil {
+		return err
+	}
+	isNull := v == nil || v.Nil()
+
+	switch name {
+	case "time_zone":
+		loc := (*time.Location)(nil)
+		if isNull && !dflt {
+			return mysql.NewDefaultError(mysql.ER_WRONG_VALUE_FOR_VAR, name, "NULL")
+		}
+		if !dflt {
+			var err error
+			if loc, err = parseTimeZone(v.ToString()); err != nil {
+				return mysql.NewDefaultError(mysql.ER_UNKNOWN_TIME_ZONE, v.ToString())
+			}
+		}
+		m.loc = loc
+	case "sql_select_limit":
+		n := uint64(maxSelectLimit)
+		if isNull && !dflt {
+			return mysql.NewDefaultError(mysql.ER_WRONG_VALUE_FOR_VAR, name, "NULL")
+		}
+		if !dflt {
+			var err error
+			if n, err = parseUintVar(name, v); err != nil {
+				return err
+			}
+		}
+		m.selectLimit = n
+	case "max_execution_time":
+		n := globalInt(name)
+		if isNull && !dflt {
+			return mysql.NewDefaultError(mysql.ER_WRONG_VALUE_FOR_VAR, name, "NULL")
+		}
+		if !dflt {
+			var err error
+			if n, err = strconv.ParseInt(v.ToString(), 10, 64); err != nil {
+				return mysql.NewDefaultError(mysql.ER_WRONG_TYPE_FOR_VAR, name)
+			}
+			if n < 0 {
+				return mysql.NewDefaultError(mysql.ER_WRONG_VALUE_FOR_VAR, name, v.ToString())
+			}
+		}
+		m.maxExecTime = n
+	case "character_set_client", "character_set_connection", "character_set_results":
+		charset := mysql.DEFAULT_CHARSET
+		switch {
+		case isNull && name == "character_set_results" && !dflt:
+			// results are sent as they are
+			charset = ""
+			v = value.NilValueVal
+			isNull = false
+		case isNull && !dflt:
+			return mysql.NewDefaultError(mysql.ER_WRONG_VALUE_FOR_VAR, name, "NULL")
+		case !dflt:
+			if charset = mysql.CharsetName(v.ToString()); charset == "" {
+				return mysql.NewDefaultError(mysql.ER_UNKNOWN_CHARACTER_SET, v.ToString())
+			}
+			v = value.NewStringValue(charset)
+		}
+		switch name {
+		case "character_set_client":
+			m.charset = charset
+		case "character_set_results":
+			m.results = charset
+		default:
+			m.collation = mysql.CharsetIds[charset]
+		}
+	case "collation_connection":
+		collation := mysql.DEFAULT_COLLATION_ID
+		if isNull && !dflt {
+			return mysql.NewDefaultError(mysql.ER_WRONG_VALUE_FOR_VAR, name, "NULL")
+		}
+		if !dflt {
+			id, ok := mysql.CollationNames[strings.ToLower(v.ToString())]
+			if !ok {
+				return mysql.NewDefaultError(mysql.ER_UNKNOWN_COLLATION, v.ToString())
+			}
+			collation = id
+			v = value.NewStringValue(mysql.Collations[id])
+		}
+		m.collation = collation
+	}
+
+	if dflt || isNull {
+		delete(m.vars.Data, "@@"+name)
+		delete(m.vars.Data, "@@session."+name)
+		return nil
+	}
+	m.vars.Data["@@"+name] = v
+	m.vars.Data["@@session."+name] = v
+	return nil
+}
+
+// parseUintVar the value of an unsigned system variable, those above its
+// maximum are the maximum as in mysql.
+func parseUintVar(name string, v value.Value) (uint64, error) {
+	s := strings.TrimSpace(v.ToString())
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err == nil {
+		return n, nil
+	}
+	if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+		return math.MaxUint64, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	switch {
+	case err != nil:
+		return 0, mysql.NewDefaultError(mysql.ER_WRONG_TYPE_FOR_VAR, name)
+	case f < 0:
+		return 0, mysql.NewDefaultError(mysql.ER_WRONG_VALUE_FOR_VAR, name, s)
+	case f >= math.MaxUint64:
+		return math.MaxUint64, nil
+	}
+	return uint64(f), nil
+}
+
+// checkSystemVar an error unless the lower case name is a session system
+// variable that may be SET.  Read only variables, such as the user of the
+// connection, are errors as mysql's are.
+func checkSystemVar(name string) error {
+	switch {
+	case readOnlyVars[name]:
+		return mysql.NewDefaultError(mysql.ER_INCORRECT_GLOBAL_LOCAL_VAR, name, "read only")
+	case !sessionVars[name]:
+		return mysql.NewDefaultError(mysql.ER_UNKNOWN_SYSTEM_VARIABLE, name)
+	}
+	return nil
+}
+
+// parseTimeZone a mysql time_zone value, SYSTEM, an offset such as
+// +05:30 or a named zone.  Nil location is SYSTEM.
+func parseTimeZone(tz string) (*time.Location, error) {
+	if strings.EqualFold(tz, "SYSTEM") {
+		return nil, nil
+	}
+	if match := tzOffsetRegex.FindStringSubmatch(tz); match != nil {
+		h, _ := strconv.Atoi(match[2])
+		mi, _ := strconv.Atoi(match[3])
+		offset := h*3600 + mi*60
+		if match[1] == "-" {
+			offset = -offset
+		}
+		if mi > 59 || offset > 14*3600 || offset < -(13*3600+59*60) {
+			return nil, fmt.Errorf("invalid time zone %q", tz)
+		}
+		return time.FixedZone(tz, offset), nil
+	}
+	if tz == "" || strings.EqualFold(tz, "local") {
+		return nil, fmt.Errorf("invalid time zone %q", tz)
+	}
+	return time.LoadLocation(tz)
+}
+
+// bindUserVars replaces @user variable references in sql with the literal
+// of their value, NULL if not set.
+func (m *mySqlSession) bindUserVars(sql string) string {
+	if !strings.Contains(sql, "@") {
+		return sql
+	}
+	var buf bytes.Buffer
+	last, skip := 0, 0
+	walkSql(sql, func(i int) bool {
+		if i < skip || sql[i] != '@' {
+			return true
+		}
+		end := i + 1
+		for end < len(sql) && sql[end] == '@' {
+			end++
+		}
+		for end < len(sql) && isVarChar(sql[end]) {
+			end++
+		}
+		skip = end
+		if strings.HasPrefix(sql[i:], "@@") || end == i+1 || (i > 0 && isVarChar(sql[i-1])) {
+			// system variable, or not a variable
+			return true
+		}
+		buf.WriteString(sql[last:i])
+		buf.WriteString(m.userVarLiteral(sql[i+1 : end]))
+		last = end
+		return true
+	})
+	if last == 0 {
+		return sql
+	}
+	buf.WriteString(sql[last:])
+	return buf.String()
+}
+
+func (m *mySqlSession) userVarLiteral(name string) string {
+	v, ok := m.userVars[strings.ToLower(name)]
+	if !ok {
+		return "NULL"
+	}
+	switch val := v.Value().(type) {
+	case bool:
+		if val {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return quoteLiteral(val.Format("2006-01-02 15:04:05"))
+	default:
+		if lit, err := paramLiteral(val, 0); err == nil {
+			return lit
+		}
+	}
+	return quoteLiteral(v.ToString())
+}
+
+func isVarChar(c byte) bool {
+	return c == '_' || c == '$' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
 }
 
 /*
@@ -62,14 +515,19 @@ func NewMySqlGlobalVars() *datasource.ContextSimple {
 	ctx.Data["@@lower_case_table_names"] = value.NewIntValue(0)
 	ctx.Data["@@max_allowed_packet"] = value.NewIntValue(MaxAllowedPacket)
 	ctx.Data["@@max_allowed_packets"] = value.NewIntValue(MaxAllowedPacket)
+	ctx.Data["@@max_execution_time"] = value.NewIntValue(0)
 	ctx.Data["@@net_buffer_length"] = value.NewIntValue(16384)
 	ctx.Data["@@net_write_timeout"] = value.NewIntValue(600)
 	ctx.Data["@@query_cache_size"] = value.NewIntValue(1048576)
 	ctx.Data["@@wait_timeout"] = value.NewIntValue(28800)
-	ctx.Data["@@character_set_client"] = value.NewStringValue("utf8")
-	ctx.Data["@@character_set_connection"] = value.NewStringValue("utf8")
-	ctx.Data["@@character_set_results"] = value.NewStringValue("utf8")
-	ctx.Data["@@character_set_server"] = value.NewStringValue("utf8")
+	ctx.Data["@@character_set_client"] = value.NewStringValue(mysql.DEFAULT_CHARSET)
+	ctx.Data["@@character_set_connection"] = value.NewStringValue(mysql.DEFAULT_CHARSET)
+	ctx.Data["@@character_set_database"] = value.NewStringValue(mysql.DEFAULT_CHARSET)
+	ctx.Data["@@character_set_results"] = value.NewStringValue(mysql.DEFAULT_CHARSET)
+	ctx.Data["@@character_set_server"] = value.NewStringValue(mysql.DEFAULT_CHARSET)
+	ctx.Data["@@collation_connection"] = value.NewStringValue(mysql.DEFAULT_COLLATION_NAME)
+	ctx.Data["@@collation_database"] = value.NewStringValue(mysql.DEFAULT_COLLATION_NAME)
+	ctx.Data["@@collation_server"] = value.NewStringValue(mysql.DEFAULT_COLLATION_NAME)
 	ctx.Data["@@init_connect"] = value.NewStringValue("")
 	ctx.Data["@@license"] = value.NewStringValue("MIT")
 	ctx.Data["@@query_cache_type"] = value.NewStringValue("OFF")
@@ -78,6 +536,5 @@ func NewMySqlGlobalVars() *datasource.ContextSimple {
 	ctx.Data["@@time_zone"] = value.NewStringValue("SYSTEM")
 	ctx.Data["@@tx_isolation"] = value.NewStringValue("REPEATABLE-READ")
 	ctx.Data["@@version_comment"] = value.NewStringValue(fmt.Sprintf("DataUX (MIT), Release .%s", version.Version))
-	ctx.Data["@@character_set_server"] = value.NewStringValue("utf8")
 	return ctx
 }
@@ -0,0 +1,334 @@
+package mysqlfe
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	u "github.com/araddon/gou"
+
+	"github.com/araddon/qlbridge/datasource"
+	"github.com/araddon/qlbridge/expr"
+	"github.com/araddon/qlbridge/value"
+	"github.com/araddon/qlbridge/vm"
+
+	"github.com/dataux/dataux/vendored/mixer/mysql"
+)
+
+var (
+	setRegex = regexp.MustCompile(`(?is)^\s*SET\s+(.*?)\s*;?\s*$`)
+	// SET NAMES charset [COLLATE collation]
+	setNamesRegex = regexp.MustCompile(`(?is)^NAMES\s+(\S+)(?:\s+COLLATE\s+(\S+))?$`)
+	// SET CHARACTER SET charset
+	setCharsetRegex = regexp.MustCompile(`(?is)^(?:CHARACTER\s+SET|CHARSET)\s+(\S+)$`)
+	// SET [GLOBAL | SESSION] TRANSACTION ...
+	setTransactionRegex = regexp.MustCompile(`(?is)^(?:(?:GLOBAL|SESSION|LOCAL)\s+)?TRANSACTION\s`)
+	// scope keyword of an assignment
+	setScopeRegex = regexp.MustCompile(`(?i)^(GLOBAL|SESSION|LOCAL|PERSIST|PERSIST_ONLY)\s+`)
+	bareWordRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// setAssignment a single name = value of a SET statement
+type setAssignment struct {
+	name    string
+	userVar bool // @name, else a system variable
+	global  bool
+	value   string
+}
+
+// isSet is sql a SET statement
+func isSet(sql string) bool {
+	return setRegex.MatchString(sql)
+}
+
+// handleSet SET statements, assigning @user variables and session system
+// variables.  All assignments are validated before any is applied.
+func (m *mySqlHandler) handleSet(sql string) error {
+
+	match := setRegex.FindStringSubmatch(sql)
+	if match == nil {
+		return mysql.NewDefaultError(mysql.ER_SYNTAX_ERROR)
+	}
+	body := match[1]
+
+	switch {
+	case setTransactionRegex.MatchString(body):
+		// we don't currently support transactions
+		return m.writeOK(nil)
+	case setNamesRegex.MatchString(body):
+		names := setNamesRegex.FindStringSubmatch(body)
+		charset, collation, err := parseSetNames(names[1], names[2])
+		if err != nil {
+			return err
+		}
+		m.sess.setNames(charset, collation)
+		m.applyCharsets()
+		return m.writeOK(nil)
+	case setCharsetRegex.MatchString(body):
+		charset, _, err := parseSetNames(setCharsetRegex.FindStringSubmatch(body)[1], "")
+		if err != nil {
+			return err
+		}
+		m.sess.setNames(charset, 0)
+		// the connection charset is that of the database
+		m.sess.setSystemVar("character_set_connection", nil, true)
+		m.sess.setSystemVar("collation_connection", nil, true)
+		m.applyCharsets()
+		return m.writeOK(nil)
+	}
+
+	assignments, err := parseSetAssignments(body)
+	if err != nil {
+		return err
+	}
+
+	type setValue struct {
+		a    setAssignment
+		v    value.Value
+		dflt bool
+	}
+	values := make([]setValue, 0, len(assignments))
+	for _, a := range assignments {
+		if a.global {
+			return mysql.NewDefaultError(mysql.ER_NOT_SUPPORTED_YET, "SET GLOBAL")
+		}
+		if !a.userVar {
+			if err := checkSystemVar(strings.ToLower(a.name)); err != nil {
+				return err
+			}
+		}
+		v, dflt, err := m.evalSetValue(a.value)
+		if err != nil {
+			if a.userVar {
+				return err
+			}
+			// as before SET was supported, clients setting variables
+			// we can't evaluate are not failed
+			u.Warnf("ignoring SET %s = %s: %v", a.name, a.value, err)
+			continue
+		}
+		if dflt && a.userVar {
+			return mysql.NewDefaultError(mysql.ER_SYNTAX_ERROR)
+		}
+		values = append(values, setValue{a, v, dflt})
+	}
+
+	// system variables are validated on a copy so a bad assignment
+	// leaves the session unchanged
+	check := &mySqlSession{vars: datasource.NewContextSimple()}
+	for _, sv := range values {
+		if sv.a.userVar {
+			continue
+		}
+		if err := check.setSystemVar(sv.a.name, sv.v, sv.dflt); err != nil {
+			return err
+		}
+	}
+
+	for _, sv := range values {
+		if sv.a.userVar {
+			m.sess.setUserVar(sv.a.name, sv.v)
+			continue
+		}
+		if err := m.sess.setSystemVar(sv.a.name, sv.v, sv.dflt); err != nil {
+			return err
+		}
+	}
+	m.applyCharsets()
+	return m.writeOK(nil)
+}
+
+// parseSetNames the charset and collation of SET NAMES charset [COLLATE
+// collation], collation is 0 if not given.  DEFAULT is our charset.
+func parseSetNames(charsetName, collationName string) (string, mysql.CollationId, error) {
+	charsetName = unquoteSetValue(charsetName)
+	charset := mysql.DEFAULT_CHARSET
+	if !strings.EqualFold(charsetName, "DEFAULT") {
+		if charset = mysql.CharsetName(charsetName); charset == "" {
+			return "", 0, mysql.NewDefaultError(mysql.ER_UNKNOWN_CHARACTER_SET, charsetName)
+		}
+	}
+	if collationName == "" {
+		return charset, 0, nil
+	}
+	collationName = unquoteSetValue(collationName)
+	collation, ok := mysql.CollationNames[strings.ToLower(collationName)]
+	if !ok {
+		return "", 0, mysql.NewDefaultError(mysql.ER_UNKNOWN_COLLATION, collationName)
+	}
+	if mysql.CollationCharset(collation) != charset {
+		return "", 0, mysql.NewDefaultError(mysql.ER_COLLATION_CHARSET_MISMATCH, collationName, charset)
+	}
+	return charset, collation, nil
+}
+
+// applyCharsets the charsets of the session to the connection, which
+// decodes statements and encodes results with them
+func (m *mySqlHandler) applyCharsets() {
+	m.conn.SetCharsets(m.sess.charset, m.sess.results, m.sess.collation)
+}
+
+// parseSetAssignments the comma separated name = value assignments of a
+// SET statement
+//
+//	SET @x = 1, SESSION time_zone = '+00:00', @@session.sql_select_limit := 10
+func parseSetAssignments(body string) ([]setAssignment, error) {
+
+	// split on commas outside of quotes and parens
+	var parts []string
+	depth, start := 0, 0
+	walkSql(body, func(i int) bool {
+		switch body[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, body[start:i])
+				start = i + 1
+			}
+		}
+		return true
+	})
+	parts = append(parts, body[start:])
+
+	assignments := make([]setAssignment, 0, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		eq := -1
+		walkSql(part, func(i int) bool {
+			if part[i] == '=' {
+				eq = i
+				return false
+			}
+			return true
+		})
+		if eq <= 0 {
+			return nil, mysql.NewDefaultError(mysql.ER_SYNTAX_ERROR)
+		}
+		a := setAssignment{value: strings.TrimSpace(part[eq+1:])}
+		name := part[:eq]
+		name = strings.TrimSpace(strings.TrimSuffix(name, ":"))
+		if scope := setScopeRegex.FindStringSubmatch(name); scope != nil {
+			a.global = !strings.EqualFold(scope[1], "SESSION") && !strings.EqualFold(scope[1], "LOCAL")
+			name = strings.TrimSpace(name[len(scope[0]):])
+		}
+		switch {
+		case strings.HasPrefix(name, "@@"):
+			name = name[2:]
+			lower := strings.ToLower(name)
+			switch {
+			case strings.HasPrefix(lower, "global."):
+				a.global = true
+				name = name[len("global."):]
+			case strings.HasPrefix(lower, "session."):
+				name = name[len("session."):]
+			case strings.HasPrefix(lower, "local."):
+				name = name[len("local."):]
+			}
+		case strings.HasPrefix(name, "@"):
+			a.userVar = true
+			name = name[1:]
+		}
+		name = strings.Trim(name, "`")
+		if name == "" || a.value == "" {
+			return nil, mysql.NewDefaultError(mysql.ER_SYNTAX_ERROR)
+		}
+		a.name = name
+		assignments = append(assignments, a)
+	}
+	return assignments, nil
+}
+
+// evalSetValue the value of the right hand side of a SET assignment, dflt
+// is true for DEFAULT.  Bare words such as ON or SYSTEM are strings.
+func (m *mySqlHandler) evalSetValue(s string) (v value.Value, dflt bool, err error) {
+
+	s = m.sess.bindUserVars(s)
+	upper := strings.ToUpper(s)
+	switch {
+	case upper == "DEFAULT":
+		return nil, true, nil
+	case upper == "NULL":
+		return nil, false, nil
+	case upper == "ON" || upper == "TRUE":
+		return value.NewIntValue(1), false, nil
+	case upper == "OFF" || upper == "FALSE":
+		return value.NewIntValue(0), false, nil
+	case bareWordRegex.MatchString(s):
+		return value.NewStringValue(s), false, nil
+	}
+	if lit, ok := stringLiteral(s); ok {
+		return value.NewStringValue(lit), false, nil
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return value.NewIntValue(i), false, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return value.NewNumberValue(f), false, nil
+	}
+
+	node, err := expr.ParseExpression(s)
+	if err != nil {
+		u.Debugf("could not parse set value %q: %v", s, err)
+		return nil, false, mysql.NewDefaultError(mysql.ER_SYNTAX_ERROR)
+	}
+	v, ok := vm.Eval(m.sess.ctx, node)
+	if !ok {
+		return nil, false, nil
+	}
+	return v, false, nil
+}
+
+// stringLiteral the unescaped contents of s if it is a single quoted
+// string literal
+func stringLiteral(s string) (string, bool) {
+	if len(s) < 2 || (s[0] != '\'' && s[0] != '"') || s[len(s)-1] != s[0] {
+		return "", false
+	}
+	literal := true
+	walkSql(s, func(i int) bool {
+		// any syntax outside the quotes means s is an expression
+		literal = false
+		return false
+	})
+	if !literal {
+		return "", false
+	}
+	q := s[0]
+	var buf bytes.Buffer
+	for i := 1; i < len(s)-1; i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s)-1:
+			i++
+			switch s[i] {
+			case 'n':
+				buf.WriteByte('\n')
+			case 't':
+				buf.WriteByte('\t')
+			case 'r':
+				buf.WriteByte('\r')
+			case '0':
+				buf.WriteByte(0)
+			default:
+				buf.WriteByte(s[i])
+			}
+		case s[i] == q && i+1 < len(s)-1 && s[i+1] == q:
+			buf.WriteByte(q)
+			i++
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+	return buf.String(), true
+}
+
+// unquoteSetValue strips quotes of a quoted charset or collation name
+func unquoteSetValue(s string) string {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"' || s[0] == '`') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
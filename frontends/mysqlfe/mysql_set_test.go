@@ -0,0 +1,142 @@
+package mysqlfe
+
+import (
+	"testing"
+
+	"github.com/araddon/qlbridge/rel"
+	"github.com/araddon/qlbridge/value"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dataux/dataux/vendored/mixer/mysql"
+)
+
+func TestParseSetAssignments(t *testing.T) {
+	a, err := parseSetAssignments("@x = 5, SESSION time_zone = '+00:00', @@session.sql_select_limit := 10")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []setAssignment{
+		{name: "x", userVar: true, value: "5"},
+		{name: "time_zone", value: "'+00:00'"},
+		{name: "sql_select_limit", value: "10"},
+	}, a)
+
+	a, err = parseSetAssignments("@a = CONCAT('a,b', 'c'), @@global.max_connections=10")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []setAssignment{
+		{name: "a", userVar: true, value: "CONCAT('a,b', 'c')"},
+		{name: "max_connections", global: true, value: "10"},
+	}, a)
+
+	_, err = parseSetAssignments("autocommit")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestSetValues(t *testing.T) {
+	s, ok := stringLiteral(`'it''s'`)
+	assert.True(t, ok)
+	assert.Equal(t, "it's", s)
+	_, ok = stringLiteral(`'a' + 'b'`)
+	assert.False(t, ok)
+
+	loc, err := parseTimeZone("SYSTEM")
+	assert.Equal(t, nil, err)
+	assert.True(t, loc == nil)
+	loc, err = parseTimeZone("-05:30")
+	assert.Equal(t, nil, err)
+	_, offset := loc.Zone()
+	assert.Equal(t, -(5*3600 + 30*60), offset)
+	_, err = parseTimeZone("+14:30")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestSessionVars(t *testing.T) {
+	sess := newMySqlSession("default", "bob", 1)
+	sess.setUserVar("X", value.NewIntValue(5))
+	sess.setUserVar("name", value.NewStringValue("bob's"))
+	assert.Equal(t, `SELECT 5, @@version, 'bob\'s', NULL FROM t WHERE a = '@x'`,
+		sess.bindUserVars("SELECT @x, @@version, @name, @missing FROM t WHERE a = '@x'"))
+
+	assert.Equal(t, "SELECT a FROM t", sess.withSelectLimit("SELECT a FROM t"))
+	assert.Equal(t, nil, sess.setSystemVar("sql_select_limit", value.NewIntValue(10), false))
+	assert.Equal(t, uint64(10), sess.selectLimit)
+	limited, err := rel.ParseSql(sess.withSelectLimit("SELECT a FROM t WHERE b > 1"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 10, limited.(*rel.SqlSelect).Limit)
+	assert.Equal(t, "SELECT a FROM t WHERE b = 'x' LIMIT 10 -- all", sess.withSelectLimit("SELECT a FROM t WHERE b = 'x' -- all"))
+	assert.Equal(t, "SELECT a FROM t LIMIT 10 FOR UPDATE", sess.withSelectLimit("SELECT a FROM t FOR UPDATE"))
+	assert.Equal(t, "SELECT a FROM t LIMIT 5", sess.withSelectLimit("SELECT a FROM t LIMIT 5"))
+	assert.Equal(t, "SELECT a FROM t LIMIT 0", sess.withSelectLimit("SELECT a FROM t LIMIT 0"))
+	assert.Equal(t, "SELECT a FROM t WHERE b IN (SELECT b FROM u LIMIT 1) LIMIT 10",
+		sess.withSelectLimit("SELECT a FROM t WHERE b IN (SELECT b FROM u LIMIT 1)"))
+	assert.Equal(t, "UPDATE t SET a = 1", sess.withSelectLimit("UPDATE t SET a = 1"))
+	assert.NotEqual(t, nil, sess.setSystemVar("sql_select_limit", value.NewStringValue("ten"), false))
+	assert.NotEqual(t, nil, sess.setSystemVar("sql_select_limit", value.NewIntValue(-1), false))
+	assert.Equal(t, nil, sess.setSystemVar("sql_select_limit", nil, true))
+	assert.Equal(t, uint64(maxSelectLimit), sess.selectLimit)
+	// the maximum is the default, larger values are clamped to it
+	assert.Equal(t, nil, sess.setSystemVar("sql_select_limit", value.NewStringValue("18446744073709551615"), false))
+	assert.Equal(t, uint64(maxSelectLimit), sess.selectLimit)
+	assert.Equal(t, nil, sess.setSystemVar("sql_select_limit", value.NewNumberValue(1e20), false))
+	assert.Equal(t, uint64(maxSelectLimit), sess.selectLimit)
+	assert.Equal(t, "SELECT a FROM t", sess.withSelectLimit("SELECT a FROM t"))
+
+	assert.NotEqual(t, nil, sess.setSystemVar("time_zone", value.NewStringValue("nowhere"), false))
+	assert.Equal(t, nil, sess.setSystemVar("time_zone", value.NewStringValue("+02:00"), false))
+	v, ok := sess.ctx.Get("@@session.time_zone")
+	assert.True(t, ok)
+	assert.Equal(t, "+02:00", v.ToString())
+
+	// the connection's user and id may not be changed
+	err = sess.setSystemVar("USER", value.NewStringValue("admin"), false)
+	assert.Equal(t, uint16(mysql.ER_INCORRECT_GLOBAL_LOCAL_VAR), err.(*mysql.SqlError).Code)
+	err = sess.setSystemVar("connection_id", value.NewIntValue(2), false)
+	assert.Equal(t, uint16(mysql.ER_INCORRECT_GLOBAL_LOCAL_VAR), err.(*mysql.SqlError).Code)
+	err = sess.setSystemVar("no_such_var", value.NewIntValue(2), false)
+	assert.Equal(t, uint16(mysql.ER_UNKNOWN_SYSTEM_VARIABLE), err.(*mysql.SqlError).Code)
+	v, _ = sess.ctx.Get("@@user")
+	assert.Equal(t, "bob", v.ToString())
+	assert.Equal(t, nil, sess.setSystemVar("sql_mode", value.NewStringValue("ANSI_QUOTES"), false))
+}
+
+func TestSetNames(t *testing.T) {
+	charset, collation, err := parseSetNames("'latin1'", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "latin1", charset)
+	assert.Equal(t, mysql.CollationId(0), collation)
+
+	charset, collation, err = parseSetNames("utf8mb4", "utf8mb4_unicode_ci")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "utf8mb4", charset)
+	assert.Equal(t, mysql.CollationId(224), collation)
+
+	charset, _, err = parseSetNames("utf8mb3", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "utf8", charset)
+	charset, _, err = parseSetNames("DEFAULT", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "utf8mb4", charset)
+
+	_, _, err = parseSetNames("klingon", "")
+	assert.Equal(t, uint16(mysql.ER_UNKNOWN_CHARACTER_SET), err.(*mysql.SqlError).Code)
+	_, _, err = parseSetNames("utf8", "nope_ci")
+	assert.Equal(t, uint16(mysql.ER_UNKNOWN_COLLATION), err.(*mysql.SqlError).Code)
+	_, _, err = parseSetNames("latin1", "utf8mb4_bin")
+	assert.Equal(t, uint16(mysql.ER_COLLATION_CHARSET_MISMATCH), err.(*mysql.SqlError).Code)
+
+	sess := newMySqlSession("default", "bob", 1)
+	assert.Equal(t, "utf8mb4", sess.charset)
+	sess.setNames("latin1", 0)
+	assert.Equal(t, "latin1", sess.results)
+	assert.Equal(t, mysql.CollationId(8), sess.collation)
+	v, ok := sess.ctx.Get("@@collation_connection")
+	assert.True(t, ok)
+	assert.Equal(t, "latin1_swedish_ci", v.ToString())
+
+	assert.NotEqual(t, nil, sess.setSystemVar("character_set_client", value.NewStringValue("klingon"), false))
+	assert.NotEqual(t, nil, sess.setSystemVar("character_set_client", nil, false))
+	assert.Equal(t, nil, sess.setSystemVar("character_set_results", nil, false))
+	assert.Equal(t, "", sess.results)
+	assert.Equal(t, nil, sess.setSystemVar("character_set_client", nil, true))
+	assert.Equal(t, "utf8mb4", sess.charset)
+	assert.Equal(t, nil, sess.setSystemVar("collation_connection", value.NewStringValue("UTF8_BIN"), false))
+	assert.Equal(t, mysql.CollationId(83), sess.collation)
+}
@@ -0,0 +1,497 @@
+package mysqlfe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	u "github.com/araddon/gou"
+
+	"github.com/araddon/qlbridge/plan"
+	"github.com/araddon/qlbridge/rel"
+
+	"github.com/dataux/dataux/models"
+	"github.com/dataux/dataux/planner"
+	"github.com/dataux/dataux/vendored/mixer/mysql"
+	mysqlproxy "github.com/dataux/dataux/vendored/mixer/proxy"
+)
+
+// preparedStmt is a server side prepared statement, registered per connection
+// from COM_STMT_PREPARE until COM_STMT_CLOSE.  Params are bound as literals
+// into the sql at execute time so the statement is parsed and planned with
+// actual values, allowing them to be pushed down to backends.
+type preparedStmt struct {
+	id         uint32
+	sql        string
+	params     int
+	paramTypes []byte        // param types sent on first (or re-bound) execute
+	args       []interface{} // current bound args, including long data
+}
+
+func (s *preparedStmt) resetParams() {
+	s.args = make([]interface{}, s.params)
+}
+
+// handleStmtPrepare COM_STMT_PREPARE.  The columns of a select are those
+// it is planned with, other statements report 0 columns.  The definitions
+// are also sent with each result.
+func (m *mySqlHandler) handleStmtPrepare(sql string) error {
+
+	sql = strings.TrimRight(strings.TrimSpace(sql), ";")
+	if len(sql) == 0 {
+		return mysql.NewDefaultError(mysql.ER_EMPTY_QUERY)
+	}
+
+	m.stmtId++
+	s := &preparedStmt{id: m.stmtId, sql: sql, params: countParams(sql)}
+	s.resetParams()
+
+	fields, err := m.describeStmt(s)
+	if err != nil {
+		return err
+	}
+	if err := m.conn.WriteStmtPrepareFields(s.id, s.params, fields); err != nil {
+		return err
+	}
+	m.stmts[s.id] = s
+	return nil
+}
+
+// describeStmt the column definitions of the result of a prepared select,
+// planned with each param bound to 0.  nil if it is not a select or could
+// not be planned without its params.  It is planned as the statement is
+// run, within its deadline and only of tables the user may query, as
+// sources may query their backend while it is planned.
+func (m *mySqlHandler) describeStmt(s *preparedStmt) ([]*mysql.Field, error) {
+
+	if !selectRegex.MatchString(s.sql) {
+		return nil, nil
+	}
+	args := make([]interface{}, s.params)
+	for i := range args {
+		args[i] = int64(0)
+	}
+	sql, err := bindParams(s.sql, args, nil)
+	if err != nil {
+		return nil, nil
+	}
+	sql = m.sess.bindUserVars(sql)
+
+	sch := m.schema
+	if isql, is, err := m.infoSchemaQuery(sql); err != nil {
+		return nil, nil
+	} else if is != nil {
+		sql, sch = isql, is
+	}
+	if sch == nil {
+		return nil, nil
+	}
+
+	m.startQuery(s.sql)
+	defer m.endQuery()
+
+	ctx := plan.NewContext(m.sess.withSelectLimit(sql))
+	ctx.DisableRecover = m.svr.Config.SupressRecover
+	ctx.Session = m.sess.ctx
+	ctx.Schema = sch
+	ctx.Funcs = fr
+	stmtCtx, cancel := m.statementContext(sql)
+	defer cancel()
+	defer planner.BindContext(ctx, stmtCtx)()
+	job, err := BuildMySqlJob(m.svr, ctx, m.conn.AuthUser())
+	if err != nil {
+		if ierr := m.interruptErr(); ierr != nil {
+			// killed or timed out while planning
+			return nil, ierr
+		}
+		u.Debugf("%d could not plan stmt %d: %v", m.connId, s.id, err)
+		return nil, nil
+	}
+	if job == nil {
+		return nil, nil
+	}
+	defer job.Close()
+	if err := m.checkSourceGrants(job.Ctx); err != nil {
+		return nil, err
+	}
+	if _, ok := job.Ctx.Stmt.(*rel.SqlSelect); !ok || job.Ctx.Projection == nil || job.Ctx.Projection.Proj == nil {
+		return nil, nil
+	}
+	rs := mysql.NewResultSet()
+	addFields(rs, sch.Name, job.Ctx.Projection.Proj.Columns, true)
+	return rs.Fields, nil
+}
+
+// handleStmtExecute COM_STMT_EXECUTE, packet is stmt-id[4] flags[1]
+// iteration-count[4] and if params > 0: null-bitmap, new-params-bound-flag[1],
+// [param types], param values
+func (m *mySqlHandler) handleStmtExecute(writer models.ResultWriter, data []byte) error {
+	if len(data) < 9 {
+		return mysql.ErrMalformPacket
+	}
+
+	pos := 0
+	id := binary.LittleEndian.Uint32(data[0:4])
+	pos += 4
+
+	s, ok := m.stmts[id]
+	if !ok {
+		return mysql.NewDefaultError(mysql.ER_UNKNOWN_STMT_HANDLER,
+			strconv.FormatUint(uint64(id), 10), "stmt_execute")
+	}
+	defer s.resetParams()
+
+	flag := data[pos]
+	pos++
+	// we only support CURSOR_TYPE_NO_CURSOR flag
+	if flag != 0 {
+		return mysql.NewError(mysql.ER_UNKNOWN_ERROR, fmt.Sprintf("unsupported flag %d", flag))
+	}
+
+	// skip iteration-count, always 1
+	pos += 4
+
+	if s.params > 0 {
+		nullBitmapLen := (s.params + 7) >> 3
+		if len(data) < (pos + nullBitmapLen + 1) {
+			return mysql.ErrMalformPacket
+		}
+		nullBitmap := data[pos : pos+nullBitmapLen]
+		pos += nullBitmapLen
+
+		// new-params-bound flag, types are only sent on first execute
+		// or if they have changed
+		if data[pos] == 1 {
+			pos++
+			if len(data) < (pos + (s.params << 1)) {
+				return mysql.ErrMalformPacket
+			}
+			s.paramTypes = append(s.paramTypes[:0], data[pos:pos+(s.params<<1)]...)
+			pos += (s.params << 1)
+		} else {
+			pos++
+		}
+		if len(s.paramTypes) == 0 {
+			return mysql.ErrMalformPacket
+		}
+
+		if err := mysqlproxy.BindStmtArgs(s.args, nullBitmap, s.paramTypes, data[pos:]); err != nil {
+			return err
+		}
+	}
+
+	sql, err := bindParams(s.sql, decodeParams(m.conn.Charset(), s.args, s.paramTypes), s.paramTypes)
+	if err != nil {
+		return err
+	}
+	//u.Debugf("%d stmt %d execute: %s", m.connId, s.id, sql)
+	return m.handleQuery(writer, sql, true)
+}
+
+// handleStmtSendLongData COM_STMT_SEND_LONG_DATA, packet is stmt-id[4]
+// param-id[2] data, there is no response
+func (m *mySqlHandler) handleStmtSendLongData(data []byte) error {
+	if len(data) < 6 {
+		return mysql.ErrMalformPacket
+	}
+
+	id := binary.LittleEndian.Uint32(data[0:4])
+
+	s, ok := m.stmts[id]
+	if !ok {
+		u.Warnf("unknown stmt %d for long data", id)
+		return nil
+	}
+
+	paramId := binary.LittleEndian.Uint16(data[4:6])
+	if paramId >= uint16(s.params) {
+		u.Warnf("invalid param %d for long data stmt %d", paramId, id)
+		return nil
+	}
+
+	if b, ok := s.args[paramId].([]byte); ok {
+		s.args[paramId] = append(b, data[6:]...)
+	} else {
+		s.args[paramId] = append([]byte{}, data[6:]...)
+	}
+	return nil
+}
+
+// handleStmtReset COM_STMT_RESET clears long data of a statement
+func (m *mySqlHandler) handleStmtReset(data []byte) error {
+	if len(data) < 4 {
+		return mysql.ErrMalformPacket
+	}
+
+	id := binary.LittleEndian.Uint32(data[0:4])
+
+	s, ok := m.stmts[id]
+	if !ok {
+		return mysql.NewDefaultError(mysql.ER_UNKNOWN_STMT_HANDLER,
+			strconv.FormatUint(uint64(id), 10), "stmt_reset")
+	}
+
+	s.resetParams()
+
+	return m.writeOK(nil)
+}
+
+// handleStmtClose COM_STMT_CLOSE, there is no response
+func (m *mySqlHandler) handleStmtClose(data []byte) error {
+	if len(data) < 4 {
+		return nil
+	}
+
+	id := binary.LittleEndian.Uint32(data[0:4])
+
+	delete(m.stmts, id)
+
+	return nil
+}
+
+// walkSql walks over sql text calling visit with the position of each
+// byte that is statement syntax, ie skipping quoted strings, quoted
+// identifiers and comments.  Stops if visit returns false.
+func walkSql(sql string, visit func(i int) bool) {
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; c {
+		case '\'', '"', '`':
+			// quoted, find the closing quote
+			for i++; i < len(sql); i++ {
+				if sql[i] == '\\' && c != '`' {
+					i++
+					continue
+				}
+				if sql[i] == c {
+					// doubled quote is an escaped quote
+					if i+1 < len(sql) && sql[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+		case '#':
+			for ; i < len(sql) && sql[i] != '\n'; i++ {
+			}
+		case '-':
+			if strings.HasPrefix(sql[i:], "-- ") || strings.HasPrefix(sql[i:], "--\t") || sql[i:] == "--" {
+				for ; i < len(sql) && sql[i] != '\n'; i++ {
+				}
+			} else if !visit(i) {
+				return
+			}
+		case '/':
+			if strings.HasPrefix(sql[i:], "/*") {
+				end := strings.Index(sql[i+2:], "*/")
+				if end < 0 {
+					return
+				}
+				i += end + 3
+			} else if !visit(i) {
+				return
+			}
+		default:
+			if !visit(i) {
+				return
+			}
+		}
+	}
+}
+
+// sqlToken an identifier, a quoted string, or a single punctuation
+// character of sql, from start up to end
+type sqlToken struct {
+	s          string
+	start, end int
+	ident      bool
+	quoted     bool
+}
+
+// sqlTokens the identifiers, quoted strings and punctuation of sql,
+// skipping comments and whitespace as walkSql does.  Backtick quoted
+// identifiers are unquoted, strings are as written.
+func sqlTokens(sql string) []sqlToken {
+	var toks []sqlToken
+	next := 0
+	// quoted adds the text walkSql skipped before i if it is quoted,
+	// rather than a comment
+	quoted := func(i int) {
+		if i-next < 2 || sql[i-1] != sql[next] {
+			return
+		}
+		switch sql[next] {
+		case '`':
+			name := strings.Replace(sql[next+1:i-1], "``", "`", -1)
+			toks = append(toks, sqlToken{s: name, start: next, end: i, ident: true, quoted: true})
+		case '\'', '"':
+			toks = append(toks, sqlToken{s: sql[next:i], start: next, end: i, quoted: true})
+		}
+	}
+	walkSql(sql, func(i int) bool {
+		quoted(i)
+		next = i + 1
+		switch c := sql[i]; {
+		case c == '_' || c == '$' || c >= 0x80 || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9':
+			if n := len(toks); n > 0 && toks[n-1].ident && !toks[n-1].quoted && toks[n-1].end == i {
+				toks[n-1].s = sql[toks[n-1].start : i+1]
+				toks[n-1].end = i + 1
+				return true
+			}
+			toks = append(toks, sqlToken{s: sql[i : i+1], start: i, end: i + 1, ident: true})
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		default:
+			toks = append(toks, sqlToken{s: sql[i : i+1], start: i, end: i + 1})
+		}
+		return true
+	})
+	quoted(len(sql))
+	return toks
+}
+
+// splitStatements splits sql on ; statement separators, dropping
+// statements that are empty or only comments.
+func splitStatements(sql string) []string {
+	var stmts []string
+	start, empty := 0, true
+	walkSql(sql, func(i int) bool {
+		switch c := sql[i]; {
+		case c == ';':
+			if !empty {
+				stmts = append(stmts, strings.TrimSpace(sql[start:i]))
+			}
+			start, empty = i+1, true
+		case c != ' ' && c != '\t' && c != '\n' && c != '\r':
+			empty = false
+		}
+		return true
+	})
+	if !empty {
+		stmts = append(stmts, strings.TrimSpace(sql[start:]))
+	}
+	return stmts
+}
+
+// countParams the number of ? placeholders in sql
+func countParams(sql string) int {
+	ct := 0
+	walkSql(sql, func(i int) bool {
+		if sql[i] == '?' {
+			ct++
+		}
+		return true
+	})
+	return ct
+}
+
+// bindParams replaces each ? placeholder in sql with the sql literal
+// of its arg.
+func bindParams(sql string, args []interface{}, paramTypes []byte) (string, error) {
+	if len(args) == 0 {
+		return sql, nil
+	}
+	var positions []int
+	walkSql(sql, func(i int) bool {
+		if sql[i] == '?' {
+			positions = append(positions, i)
+		}
+		return true
+	})
+	if len(positions) != len(args) {
+		return "", mysql.NewDefaultError(mysql.ER_WRONG_ARGUMENTS, "stmt_execute")
+	}
+
+	buf := make([]byte, 0, len(sql)+len(args)*8)
+	last := 0
+	for i, pos := range positions {
+		var typ byte
+		if len(paramTypes) > i<<1 {
+			typ = paramTypes[i<<1]
+		}
+		lit, err := paramLiteral(args[i], typ)
+		if err != nil {
+			return "", err
+		}
+		buf = append(buf, sql[last:pos]...)
+		buf = append(buf, lit...)
+		last = pos + 1
+	}
+	buf = append(buf, sql[last:]...)
+	return string(buf), nil
+}
+
+// decodeParams the text args sent by a client in charset, as utf8
+func decodeParams(charset string, args []interface{}, paramTypes []byte) []interface{} {
+	decoded := make([]interface{}, len(args))
+	for i, arg := range args {
+		decoded[i] = arg
+		if by, ok := arg.([]byte); ok && len(paramTypes) > i<<1 && mysql.IsTextType(paramTypes[i<<1]) {
+			decoded[i] = mysql.DecodeString(charset, string(by))
+		}
+	}
+	return decoded
+}
+
+// paramLiteral converts a bound param value into a sql literal
+func paramLiteral(arg interface{}, typ byte) (string, error) {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL", nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []byte:
+		switch typ {
+		case mysql.MYSQL_TYPE_DATE, mysql.MYSQL_TYPE_NEWDATE:
+			by, err := mysql.FormatBinaryDate(len(v), v)
+			if err != nil {
+				return "", err
+			}
+			return quoteLiteral(string(by)), nil
+		case mysql.MYSQL_TYPE_DATETIME, mysql.MYSQL_TYPE_TIMESTAMP:
+			by, err := mysql.FormatBinaryDateTime(len(v), v)
+			if err != nil {
+				return "", err
+			}
+			return quoteLiteral(string(by)), nil
+		case mysql.MYSQL_TYPE_TIME:
+			by, err := mysql.FormatBinaryTime(len(v), v)
+			if err != nil {
+				return "", err
+			}
+			return quoteLiteral(string(by)), nil
+		case mysql.MYSQL_TYPE_DECIMAL, mysql.MYSQL_TYPE_NEWDECIMAL:
+			if _, err := strconv.ParseFloat(string(v), 64); err == nil {
+				return string(v), nil
+			}
+		}
+		return quoteLiteral(string(v)), nil
+	case string:
+		return quoteLiteral(v), nil
+	}
+	return "", fmt.Errorf("unsupported param type %T", arg)
+}
+
+func quoteLiteral(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `'`, `\'`, -1)
+	return "'" + s + "'"
+}
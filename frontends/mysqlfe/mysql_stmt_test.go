@@ -0,0 +1,74 @@
+package mysqlfe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dataux/dataux/vendored/mixer/mysql"
+	mysqlproxy "github.com/dataux/dataux/vendored/mixer/proxy"
+)
+
+func TestStmtCountParams(t *testing.T) {
+	tests := []struct {
+		sql string
+		ct  int
+	}{
+		{"SELECT * FROM user", 0},
+		{"SELECT * FROM user WHERE id = ?", 1},
+		{"SELECT * FROM user WHERE id = ? AND name = ?", 2},
+		{"SELECT * FROM user WHERE name = '?' AND id = ?", 1},
+		{`SELECT * FROM user WHERE name = "it\"s?" AND id = ?`, 1},
+		{"SELECT `?` FROM user WHERE name = 'it''s?' AND id = ?", 1},
+		{"SELECT /* ? */ a FROM user -- ?\nWHERE id = ? # ?", 1},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.ct, countParams(tt.sql), tt.sql)
+	}
+}
+
+func TestStmtBindParams(t *testing.T) {
+	sql, err := bindParams("SELECT * FROM user WHERE id = ? AND name = ? AND x = '?'",
+		[]interface{}{int64(10), "bob's"}, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `SELECT * FROM user WHERE id = 10 AND name = 'bob\'s' AND x = '?'`, sql)
+
+	sql, err = bindParams("SELECT * FROM user WHERE created > ? AND deleted = ? AND score > ?",
+		[]interface{}{[]byte{0xe0, 0x07, 1, 2}, nil, 1.5},
+		[]byte{mysql.MYSQL_TYPE_DATE, 0, mysql.MYSQL_TYPE_NULL, 0, mysql.MYSQL_TYPE_DOUBLE, 0})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `SELECT * FROM user WHERE created > '2016-01-02' AND deleted = NULL AND score > 1.5`, sql)
+
+	_, err = bindParams("SELECT * FROM user WHERE id = ?", []interface{}{int64(1), int64(2)}, nil)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestStmtBindJSON(t *testing.T) {
+	// json params are length encoded text
+	args := make([]interface{}, 2)
+	err := mysqlproxy.BindStmtArgs(args, []byte{0},
+		[]byte{mysql.MYSQL_TYPE_JSON, 0, mysql.MYSQL_TYPE_LONGLONG, 0},
+		append([]byte("\x0c{\"a\":\"it's\"}"), 1, 0, 0, 0, 0, 0, 0, 0))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []interface{}{[]byte(`{"a":"it's"}`), int64(1)}, args)
+
+	sql, err := bindParams("SELECT * FROM user WHERE doc = ? AND id = ?", args, []byte{mysql.MYSQL_TYPE_JSON, 0, mysql.MYSQL_TYPE_LONGLONG, 0})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `SELECT * FROM user WHERE doc = '{"a":"it\'s"}' AND id = 1`, sql)
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		sql   string
+		stmts []string
+	}{
+		{"SELECT 1", []string{"SELECT 1"}},
+		{"SELECT 1;", []string{"SELECT 1"}},
+		{"SET NAMES utf8; SELECT * FROM user", []string{"SET NAMES utf8", "SELECT * FROM user"}},
+		{"SELECT ';' FROM user;\n SELECT `a;b` FROM user", []string{"SELECT ';' FROM user", "SELECT `a;b` FROM user"}},
+		{"SELECT 1; /* ; */ ;; -- ;\n", []string{"SELECT 1"}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.stmts, splitStatements(tt.sql), tt.sql)
+	}
+}
@@ -0,0 +1,107 @@
+package mysqlfe
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"strconv"
+
+	"github.com/dataux/dataux/models"
+	"github.com/dataux/dataux/vendored/mixer/mysql"
+)
+
+var (
+	// SHOW WARNINGS [LIMIT [offset,] row_count] | SHOW COUNT(*) WARNINGS
+	showWarningsRegex = regexp.MustCompile(`(?i)^\s*SHOW\s+(?:(COUNT\s*\(\s*\*\s*\)\s+)WARNINGS|WARNINGS(?:\s+LIMIT\s+(?:(\d+)\s*,\s*)?(\d+))?)\s*;?\s*$`)
+)
+
+// showWarnings a SHOW WARNINGS of the warnings of the previous statement
+type showWarnings struct {
+	count  bool // SHOW COUNT(*) WARNINGS
+	offset int
+	limit  int // -1 for no limit
+}
+
+func parseShowWarnings(sql string) (*showWarnings, bool) {
+	match := showWarningsRegex.FindStringSubmatch(sql)
+	if match == nil {
+		return nil, false
+	}
+	show := &showWarnings{count: match[1] != "", limit: -1}
+	if match[2] != "" {
+		show.offset, _ = strconv.Atoi(match[2])
+	}
+	if match[3] != "" {
+		show.limit, _ = strconv.Atoi(match[3])
+	}
+	return show, true
+}
+
+// rows the Level, Code, Message rows of warnings
+func (m *showWarnings) rows(warnings []models.Warning) [][]driver.Value {
+	if m.offset >= len(warnings) {
+		return [][]driver.Value{}
+	}
+	warnings = warnings[m.offset:]
+	if m.limit >= 0 && m.limit < len(warnings) {
+		warnings = warnings[:m.limit]
+	}
+	rows := make([][]driver.Value, 0, len(warnings))
+	for _, w := range warnings {
+		rows = append(rows, []driver.Value{w.Level(), int64(warningCode(w)), w.Message})
+	}
+	return rows
+}
+
+// warningCode the mysql code of a warning
+func warningCode(w models.Warning) uint16 {
+	switch w.Kind {
+	case models.WarnTruncated:
+		return mysql.WARN_DATA_TRUNCATED
+	case models.WarnTooFewFields:
+		return mysql.ER_WARN_TOO_FEW_RECORDS
+	case models.WarnTooManyFields:
+		return mysql.ER_WARN_TOO_MANY_RECORDS
+	}
+	return mysql.ER_NOT_SUPPORTED_YET
+}
+
+// handleShowWarnings SHOW WARNINGS, the warnings of the previous statement
+// which are kept for it.
+func (m *mySqlHandler) handleShowWarnings(show *showWarnings, binary bool) error {
+
+	rs := mysql.NewResultSet()
+	var rows [][]driver.Value
+	if show.count {
+		rs.Fields = []*mysql.Field{
+			mysql.NewField("@@session.warning_count", "", "", 21, mysql.MYSQL_TYPE_LONGLONG),
+		}
+		rows = [][]driver.Value{{int64(m.warnings.Count())}}
+	} else {
+		rs.Fields = []*mysql.Field{
+			mysql.NewField("Level", "", "", 7, mysql.MYSQL_TYPE_VAR_STRING),
+			mysql.NewField("Code", "", "", 4, mysql.MYSQL_TYPE_LONG),
+			mysql.NewField("Message", "", "", 512, mysql.MYSQL_TYPE_VAR_STRING),
+		}
+		rows = show.rows(m.warnings.List())
+	}
+	for i, f := range rs.Fields {
+		rs.FieldNames[f.FieldName] = i
+	}
+
+	for _, row := range rows {
+		encodeValues(m.conn.ResultsCharset(), row)
+		var rd mysql.RowData
+		var err error
+		if binary {
+			rd, err = mysql.ValuesToBinaryRowData(row, rs.Fields)
+		} else {
+			rd, err = mysql.ValuesToRowData(row, rs.Fields)
+		}
+		if err != nil {
+			return err
+		}
+		rs.Values = append(rs.Values, row)
+		rs.RowDatas = append(rs.RowDatas, rd)
+	}
+	return m.conn.WriteResultset(m.conn.Status, rs)
+}
@@ -0,0 +1,44 @@
+package mysqlfe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dataux/dataux/models"
+)
+
+func TestParseShowWarnings(t *testing.T) {
+	show, ok := parseShowWarnings("SHOW WARNINGS")
+	assert.True(t, ok)
+	assert.Equal(t, &showWarnings{limit: -1}, show)
+
+	show, ok = parseShowWarnings("show warnings limit 1, 2;")
+	assert.True(t, ok)
+	assert.Equal(t, &showWarnings{offset: 1, limit: 2}, show)
+
+	show, ok = parseShowWarnings("SHOW COUNT(*) WARNINGS")
+	assert.True(t, ok)
+	assert.True(t, show.count)
+
+	_, ok = parseShowWarnings("SHOW ERRORS")
+	assert.True(t, !ok)
+
+	warnings := []models.Warning{
+		{Kind: models.WarnTruncated, Message: "a"},
+		{Kind: models.WarnPolyFill, Message: "b"},
+		{Kind: models.WarnIgnored, Message: "c"},
+	}
+	show, _ = parseShowWarnings("SHOW WARNINGS LIMIT 1,1")
+	rows := show.rows(warnings)
+	assert.Equal(t, 1, len(rows))
+	assert.Equal(t, "Note", rows[0][0])
+	assert.Equal(t, int64(1235), rows[0][1])
+	assert.Equal(t, "b", rows[0][2])
+
+	show, _ = parseShowWarnings("SHOW WARNINGS LIMIT 5,1")
+	assert.Equal(t, 0, len(show.rows(warnings)))
+	show, _ = parseShowWarnings("SHOW WARNINGS")
+	assert.Equal(t, 3, len(show.rows(warnings)))
+	assert.Equal(t, int64(1265), show.rows(warnings)[0][1])
+}
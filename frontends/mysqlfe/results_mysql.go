@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	u "github.com/araddon/gou"
@@ -15,6 +16,7 @@ import (
 	"github.com/araddon/qlbridge/schema"
 	"github.com/araddon/qlbridge/value"
 
+	"github.com/dataux/dataux/frontends/results"
 	"github.com/dataux/dataux/models"
 	"github.com/dataux/dataux/vendored/mixer/mysql"
 )
@@ -24,28 +26,53 @@ var (
 	_ exec.TaskRunner = (*MySqlExecResultWriter)(nil)
 )
 
+const (
+	// RowBatchSize is the max number of rows buffered before being
+	// written to the client
+	RowBatchSize = 200
+	// RowBatchBytes is the max number of row bytes buffered before
+	// being written to the client
+	RowBatchBytes = 64 * 1024
+)
+
+// MySqlResultWriter streams a mysql Resultset to the client as rows
+// arrive: column definitions first, then row packets in batches of
+// at most RowBatchSize rows/RowBatchBytes bytes and finally the EOF.
 type MySqlResultWriter struct {
 	*exec.TaskBase
+	mu           sync.Mutex
 	closed       bool
 	flushed      bool
 	writer       models.ResultWriter
 	msghandler   exec.MessageHandler
 	schema       *schema.Schema
 	proj         *rel.Projection
-	Rs           *mysql.Resultset
+	Rs           *mysql.Resultset // holds the fields only, rows are not retained
+	batch        []mysql.RowData
+	batchBytes   int
+	rowCt        int64
 	complete     chan bool
 	isComplete   bool
-	wroteHeaders bool
+	wroteHeaders bool                      // have fields been built from projection
+	sentHeaders  bool                      // have fields been written to client
+	sentEnd      bool                      // has the terminating EOF been written
+	binary       bool                      // write rows in binary protocol (prepared statements)
+	filter       func([]driver.Value) bool // optional, rows are only written if true
+	loc          *time.Location            // optional time zone times are written in
+	charset      string                    // optional charset strings are written in, ie latin1
+	err          error
 }
 
 type MySqlExecResultWriter struct {
 	*exec.TaskBase
-	closed bool
-	writer models.ResultWriter
-	schema *schema.Schema
-	Rs     *mysql.Result
-	ct     int64
-	err    error
+	mu      sync.Mutex
+	closed  bool
+	aborted bool // result is not written on close
+	writer  models.ResultWriter
+	schema  *schema.Schema
+	Rs      *mysql.Result
+	ct      int64
+	err     error
 }
 
 func NewMySqlResultWriter(writer models.ResultWriter, ctx *plan.Context) *MySqlResultWriter {
@@ -59,6 +86,7 @@ func NewMySqlResultWriter(writer models.ResultWriter, ctx *plan.Context) *MySqlR
 
 	m.TaskBase = exec.NewTaskBase(ctx)
 	m.Rs = mysql.NewResultSet()
+	m.batch = make([]mysql.RowData, 0, RowBatchSize)
 	m.msghandler = resultWrite(m)
 	return m
 }
@@ -70,6 +98,7 @@ func NewMySqlSchemaWriter(writer models.ResultWriter, ctx *plan.Context) *MySqlR
 
 	m.TaskBase = exec.NewTaskBase(ctx)
 	m.Rs = mysql.NewResultSet()
+	m.batch = make([]mysql.RowData, 0, RowBatchSize)
 
 	m.msghandler = resultWrite(m)
 	return m
@@ -88,12 +117,30 @@ func (m *MySqlResultWriter) Close() error {
 	return m.TaskBase.Close()
 }
 
+// Abort is called when the job failed, if the resultset has already been
+// completely written the error can no longer be sent so it is dropped,
+// otherwise the error is returned to be written in place of the
+// remaining rows/EOF.
+func (m *MySqlResultWriter) Abort(err error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sentEnd {
+		u.Warnf("error after resultset was written, can't send to client: %v", err)
+		return nil
+	}
+	m.flushed = true
+	m.batch = m.batch[:0]
+	return err
+}
+
 func (m *MySqlResultWriter) flushResults() error {
 	//u.Infof("%p mysql flushResults() already flushed?%v", m, m.flushed)
-	if m.flushed {
+	m.mu.Lock()
+	flushed := m.flushed
+	m.mu.Unlock()
+	if flushed {
 		return nil
 	}
-	m.flushed = true
 
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
@@ -105,14 +152,108 @@ func (m *MySqlResultWriter) flushResults() error {
 	case <-m.complete:
 		//u.Debugf("%p got mysql result complete", m)
 	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.flushed {
+		return nil
+	}
+	m.flushed = true
+
+	if err := m.writeHeader(); err != nil {
+		return err
+	}
+	if err := m.writeBatch(); err != nil {
+		return err
+	}
+	m.sentEnd = true
+	return m.writer.WriteResult(&mysql.ResultsetEnd{})
+}
+
+// writeHeader sends the column definitions if not already sent, caller
+// must hold the lock.
+func (m *MySqlResultWriter) writeHeader() error {
+	if m.sentHeaders {
+		return nil
+	}
 	if !m.wroteHeaders {
 		m.WriteHeaders()
 	}
-	if m.Rs == nil || len(m.Rs.Fields) == 0 {
+	if len(m.Rs.Fields) == 0 {
 		m.Rs = NewEmptyResultset(m.Ctx.Projection)
 	}
-	m.writer.WriteResult(m.Rs)
-	return nil
+	m.sentHeaders = true
+	return m.writer.WriteResult(&mysql.ResultsetHeader{Fields: m.Rs.Fields})
+}
+
+// writeBatch sends buffered rows, caller must hold the lock.
+func (m *MySqlResultWriter) writeBatch() error {
+	if len(m.batch) == 0 {
+		return nil
+	}
+	err := m.writer.WriteResult(&mysql.RowBatch{RowDatas: m.batch})
+	m.batch = m.batch[:0]
+	m.batchBytes = 0
+	return err
+}
+
+// addRow serializes a row and buffers it, sending the batch once
+// it is full.
+func (m *MySqlResultWriter) addRow(vals []driver.Value) bool {
+	if m.filter != nil && !m.filter(vals) {
+		return true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.flushed || m.err != nil {
+		return false
+	}
+	if m.loc != nil {
+		for i, v := range vals {
+			if t, ok := v.(time.Time); ok {
+				vals[i] = t.In(m.loc)
+			}
+		}
+	}
+	encodeValues(m.charset, vals)
+	if err := m.writeHeader(); err != nil {
+		m.err = err
+		return false
+	}
+	var rowData mysql.RowData
+	var err error
+	if m.binary {
+		rowData, err = mysql.ValuesToBinaryRowData(vals, m.Rs.Fields)
+	} else {
+		rowData, err = mysql.ValuesToRowData(vals, m.Rs.Fields)
+	}
+	if err != nil {
+		m.err = err
+		return false
+	}
+	m.batch = append(m.batch, rowData)
+	m.batchBytes += len(rowData)
+	m.rowCt++
+	if len(m.batch) >= RowBatchSize || m.batchBytes >= RowBatchBytes {
+		if err := m.writeBatch(); err != nil {
+			m.err = err
+			return false
+		}
+	}
+	return true
+}
+
+// encodeValues the strings of row in charset, the charset of results of
+// the client.  Results are utf8mb4 so those are written as is.
+func encodeValues(charset string, row []driver.Value) {
+	if charset == "" || charset == mysql.DEFAULT_CHARSET {
+		return
+	}
+	for i, v := range row {
+		if s, ok := v.(string); ok {
+			row[i] = mysql.EncodeString(charset, s)
+		}
+	}
 }
 
 func (m *MySqlResultWriter) Run() error {
@@ -137,6 +278,14 @@ func (m *MySqlResultWriter) Run() error {
 			}
 
 			if ok := m.msghandler(nil, msg); !ok {
+				// addRow sets err under the lock
+				m.mu.Lock()
+				err := m.err
+				m.mu.Unlock()
+				if err != nil {
+					u.Warnf("could not write to client %v", err)
+					return err
+				}
 				u.Warnf("wat, not ok? %v", msg)
 			}
 		}
@@ -151,10 +300,6 @@ func resultWrite(m *MySqlResultWriter) exec.MessageHandler {
 			return false
 		}
 
-		if !m.wroteHeaders {
-			m.WriteHeaders()
-		}
-
 		// Watch for shutdown
 		select {
 		case <-m.SigChan():
@@ -165,15 +310,13 @@ func resultWrite(m *MySqlResultWriter) exec.MessageHandler {
 		switch mt := msg.Body().(type) {
 		case *schema.Field:
 			// Got a single field, one field = row
-			m.Rs.AddRowValues(fieldDescribe(m.proj, mt))
-			return true
+			return m.addRow(results.FieldDescribe(m.proj, mt, typeToMysql(mt)))
 
 		case *datasource.SqlDriverMessageMap:
 
 			// If we don't need to zero-fill missing columns
 			if len(mt.Vals) == len(m.proj.Columns) {
-				m.Rs.AddRowValues(mt.Values())
-				return true
+				return m.addRow(mt.Values())
 			}
 
 			// We need to create a sparse array
@@ -184,8 +327,7 @@ func resultWrite(m *MySqlResultWriter) exec.MessageHandler {
 					vals[col.ColPos] = mt.Vals[idx]
 				}
 			}
-			m.Rs.AddRowValues(vals)
-			return true
+			return m.addRow(vals)
 
 		case map[string]driver.Value:
 			vals := make([]driver.Value, len(m.proj.Columns))
@@ -194,11 +336,9 @@ func resultWrite(m *MySqlResultWriter) exec.MessageHandler {
 					vals[col.ColPos] = val
 				}
 			}
-			m.Rs.AddRowValues(vals)
-			return true
+			return m.addRow(vals)
 		case []driver.Value:
-			m.Rs.AddRowValues(mt)
-			return true
+			return m.addRow(mt)
 		}
 
 		return false
@@ -220,6 +360,21 @@ func (m *MySqlResultWriter) WriteHeaders() error {
 	}
 
 	m.wroteHeaders = true
+	addFields(m.Rs, s.Name, cols, m.binary)
+	return nil
+}
+
+// addFields adds the column definitions of cols to rs, the first of any
+// with the same name.
+func addFields(rs *mysql.Resultset, db string, cols rel.ResultColumns, binary bool) {
+
+	// binary protocol values are fixed width per type so use the
+	// widest types to avoid truncation
+	intType, floatType := mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_FLOAT
+	if binary {
+		intType, floatType = mysql.MYSQL_TYPE_LONGLONG, mysql.MYSQL_TYPE_DOUBLE
+	}
+
 	wasWriten := make(map[string]struct{}, len(cols))
 	for i, col := range cols {
 		as := col.Name
@@ -230,29 +385,28 @@ func (m *MySqlResultWriter) WriteHeaders() error {
 			continue
 		}
 		wasWriten[col.Name] = struct{}{}
-		m.Rs.FieldNames[col.Name] = i
+		rs.FieldNames[col.Name] = i
 
 		switch col.Type {
 		case value.IntType:
-			m.Rs.Fields = append(m.Rs.Fields, mysql.NewField(as, s.Name, s.Name, 8, mysql.MYSQL_TYPE_LONG))
+			rs.Fields = append(rs.Fields, mysql.NewField(as, db, db, 8, intType))
 		case value.StringType:
-			m.Rs.Fields = append(m.Rs.Fields, mysql.NewField(as, s.Name, s.Name, 200, mysql.MYSQL_TYPE_STRING))
+			rs.Fields = append(rs.Fields, mysql.NewField(as, db, db, 200, mysql.MYSQL_TYPE_STRING))
 		case value.NumberType:
-			m.Rs.Fields = append(m.Rs.Fields, mysql.NewField(as, s.Name, s.Name, 8, mysql.MYSQL_TYPE_FLOAT))
+			rs.Fields = append(rs.Fields, mysql.NewField(as, db, db, 8, floatType))
 		case value.BoolType:
-			m.Rs.Fields = append(m.Rs.Fields, mysql.NewField(as, s.Name, s.Name, 1, mysql.MYSQL_TYPE_TINY))
+			rs.Fields = append(rs.Fields, mysql.NewField(as, db, db, 1, mysql.MYSQL_TYPE_TINY))
 		case value.TimeType:
-			m.Rs.Fields = append(m.Rs.Fields, mysql.NewField(as, s.Name, s.Name, 8, mysql.MYSQL_TYPE_DATETIME))
+			rs.Fields = append(rs.Fields, mysql.NewField(as, db, db, 8, mysql.MYSQL_TYPE_DATETIME))
 		case value.ByteSliceType:
-			m.Rs.Fields = append(m.Rs.Fields, mysql.NewField(as, s.Name, s.Name, 32, mysql.MYSQL_TYPE_BLOB))
+			rs.Fields = append(rs.Fields, mysql.NewField(as, db, db, 32, mysql.MYSQL_TYPE_BLOB))
 		case value.JsonType:
-			m.Rs.Fields = append(m.Rs.Fields, mysql.NewField(as, s.Name, s.Name, 256, mysql.MYSQL_TYPE_JSON))
+			rs.Fields = append(rs.Fields, mysql.NewField(as, db, db, 256, mysql.MYSQL_TYPE_JSON))
 		default:
 			u.Debugf("Field type not known explicitly mapped type=%v so use json %#v", col.Type.String(), col)
-			m.Rs.Fields = append(m.Rs.Fields, mysql.NewField(as, s.Name, s.Name, 32, mysql.MYSQL_TYPE_BLOB))
+			rs.Fields = append(rs.Fields, mysql.NewField(as, db, db, 32, mysql.MYSQL_TYPE_BLOB))
 		}
 	}
-	return nil
 }
 
 func (m *MySqlResultWriter) Finalize() error {
@@ -301,7 +455,9 @@ func NewMySqlExecResultWriter(writer models.ResultWriter, ctx *plan.Context) *My
 	return m
 }
 func (m *MySqlExecResultWriter) Close() error {
+	m.mu.Lock()
 	if m.closed {
+		m.mu.Unlock()
 		return nil
 	}
 	m.closed = true
@@ -313,9 +469,25 @@ func (m *MySqlExecResultWriter) Close() error {
 	} else {
 		m.Rs.AffectedRows = uint64(m.ct)
 	}
-	m.writer.WriteResult(m.Rs)
+	if !m.aborted {
+		m.writer.WriteResult(m.Rs)
+	}
+	m.mu.Unlock()
 	return m.TaskBase.Close()
 }
+
+// Abort is called when the job is killed, if the result has already been
+// written the error is dropped, otherwise the error is returned to be
+// written instead of the result.
+func (m *MySqlExecResultWriter) Abort(err error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.aborted = true
+	return err
+}
 func (m *MySqlExecResultWriter) Finalize() error {
 	return nil
 }
@@ -335,7 +507,9 @@ func (m *MySqlExecResultWriter) ResultWriter() exec.MessageHandler {
 		if len(vals) == 2 {
 			switch rt := vals[0].(type) {
 			case string: // error
+				m.mu.Lock()
 				m.err = errors.New(rt)
+				m.mu.Unlock()
 			default:
 				if affectedCt, isInt := vals[1].(int64); isInt {
 					m.ct = affectedCt
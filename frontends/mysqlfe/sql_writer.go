@@ -2,14 +2,11 @@ package mysqlfe
 
 import (
 	"bytes"
-	"database/sql/driver"
 	"fmt"
-	"strings"
 
 	u "github.com/araddon/gou"
 
 	"github.com/araddon/qlbridge/expr"
-	"github.com/araddon/qlbridge/rel"
 	"github.com/araddon/qlbridge/schema"
 	"github.com/araddon/qlbridge/value"
 )
@@ -118,43 +115,6 @@ func typeToMysql(f *schema.Field) string {
 	}
 	return "text"
 }
-func fieldDescribe(proj *rel.Projection, f *schema.Field) []driver.Value {
-
-	null := "YES"
-	if f.NoNulls {
-		null = "NO"
-	}
-	if len(proj.Columns) == 6 {
-		//[]string{"Field", "Type",  "Null", "Key", "Default", "Extra"}
-		if f.Name == "_id" {
-			u.Debugf("nulls? %v", f.NoNulls)
-		}
-		return []driver.Value{
-			f.Name,
-			typeToMysql(f),
-			null,
-			f.Key,
-			string(f.DefVal),
-			f.Description,
-		}
-	}
-	privileges := ""
-	if len(f.Roles) > 0 {
-		privileges = fmt.Sprintf("{%s}", strings.Join(f.Roles, ", "))
-	}
-	//[]string{"Field", "Type", "Collation", "Null", "Key", "Default", "Extra", "Privileges", "Comment"}
-	return []driver.Value{
-		f.Name,
-		typeToMysql(f),
-		"", // collation
-		null,
-		f.Key,
-		string(f.DefVal),
-		f.Extra,
-		privileges,
-		f.Description,
-	}
-}
 
 // Implement Dialect Specific Writers
 //     ie, mysql, postgres, cassandra all have different dialects
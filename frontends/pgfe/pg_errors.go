@@ -0,0 +1,105 @@
+package pgfe
+
+import (
+	"fmt"
+
+	"github.com/dataux/dataux/models"
+)
+
+// SQLSTATE codes of the errors we send
+//
+//	https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	codeFeatureNotSupported = "0A000"
+	codeInvalidAuthSpec     = "28000"
+	codeInvalidPassword     = "28P01"
+	codeInvalidCatalog      = "3D000"
+	codeConnectionFailure   = "08006"
+	codeProtocolViolation   = "08P01"
+	codeSyntaxError         = "42601"
+	codeUndefinedTable      = "42P01"
+	codeUndefinedColumn     = "42703"
+	codeUndefinedObject     = "42704"
+	codeInsufficientPriv    = "42501"
+	codeInvalidParamValue   = "22023"
+	codeInvalidTextRep      = "22P02"
+	codeQueryCanceled       = "57014"
+	codeInFailedTx          = "25P02"
+	codeInvalidStatement    = "26000"
+	codeInvalidCursor       = "34000"
+	codeDuplicateStatement  = "42P05"
+	codeCantChangeParam     = "55P02"
+	codeInternalError       = "XX000"
+)
+
+var errMalformed = newError(codeProtocolViolation, "invalid message format")
+
+// pgError an ErrorResponse, fatal errors end the connection
+type pgError struct {
+	code    string
+	message string
+	fatal   bool
+}
+
+func newError(code, format string, args ...interface{}) *pgError {
+	return &pgError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+func newFatal(code, format string, args ...interface{}) *pgError {
+	return &pgError{code: code, message: fmt.Sprintf(format, args...), fatal: true}
+}
+
+func (m *pgError) Error() string {
+	return m.message
+}
+
+func (m *pgError) severity() string {
+	if m.fatal {
+		return "FATAL"
+	}
+	return "ERROR"
+}
+
+// toPgError the ErrorResponse of err, errors of the planner and backends
+// are mapped to a SQLSTATE where known.
+func toPgError(err error) *pgError {
+	if e, ok := err.(*pgError); ok {
+		return e
+	}
+	switch models.ErrorKindOf(err) {
+	case models.ErrNotFound:
+		switch models.ErrorObjectOf(err) {
+		case models.ObjectSchema:
+			return newError(codeInvalidCatalog, "%v", err)
+		case models.ObjectColumn:
+			return newError(codeUndefinedColumn, "%v", err)
+		}
+		return newError(codeUndefinedTable, "%v", err)
+	case models.ErrUnavailable:
+		return newError(codeConnectionFailure, "%v", err)
+	case models.ErrTimeout:
+		return newError(codeQueryCanceled, "%v", err)
+	case models.ErrUnsupported:
+		return newError(codeFeatureNotSupported, "%v", err)
+	case models.ErrDenied:
+		return newError(codeInsufficientPriv, "%v", err)
+	case models.ErrSyntax:
+		return newError(codeSyntaxError, "%v", err)
+	}
+	return newError(codeInternalError, "%v", err)
+}
+
+// writeError sends err as an ErrorResponse
+func (m *pgConn) writeError(err *pgError) error {
+	m.startMessage(msgErrorResponse)
+	m.wb = append(m.wb, 'S')
+	m.string(err.severity())
+	m.wb = append(m.wb, 'V')
+	m.string(err.severity())
+	m.wb = append(m.wb, 'C')
+	m.string(err.code)
+	m.wb = append(m.wb, 'M')
+	m.string(err.message)
+	m.wb = append(m.wb, 0)
+	return m.endMessage()
+}
@@ -0,0 +1,21 @@
+package pgfe
+
+import (
+	u "github.com/araddon/gou"
+
+	"github.com/araddon/qlbridge/plan"
+)
+
+// checkSourceGrants ensures the connection's user is allowed to query the
+// sources of all tables in the statement, the same grants the mysql
+// frontend checks.
+func (m *pgHandler) checkSourceGrants(ctx *plan.Context) error {
+	if m.authUser == nil {
+		return nil
+	}
+	if table := m.authUser.DeniedTable(ctx); table != "" {
+		u.Warnf("user %q not allowed table=%s", m.authUser.Name, table)
+		return newError(codeInsufficientPriv, "permission denied for table %s", table)
+	}
+	return nil
+}
@@ -0,0 +1,657 @@
+package pgfe
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	u "github.com/araddon/gou"
+
+	"github.com/araddon/qlbridge/datasource"
+	"github.com/araddon/qlbridge/exec"
+	"github.com/araddon/qlbridge/expr"
+	"github.com/araddon/qlbridge/plan"
+	"github.com/araddon/qlbridge/rel"
+	"github.com/araddon/qlbridge/schema"
+	"github.com/araddon/qlbridge/value"
+
+	"github.com/dataux/dataux/frontends/results"
+	"github.com/dataux/dataux/models"
+	"github.com/dataux/dataux/planner"
+)
+
+var (
+	// Ensure we meet our interfaces
+	_ models.StatementHandler = (*pgHandler)(nil)
+	_ models.ResultWriter     = (*pgConn)(nil)
+
+	fr = expr.NewFuncRegistry()
+)
+
+// pgHandler a single postgres client connection and its session, not
+// threadsafe except for cancel.
+type pgHandler struct {
+	l        *PgListener
+	svr      *models.ServerCtx
+	conn     *pgConn
+	pid      uint32
+	secret   uint32
+	user     string
+	authUser *models.UserConfig // authenticated account, nil if listener has no authenticator
+	schema   *schema.Schema
+	sess     *datasource.ContextSimple
+	params   map[string]string        // session parameters by lower case name
+	stmts    map[string]*preparedStmt // prepared statements by name, "" is unnamed
+	portals  map[string]*portal       // bound statements by name, "" is unnamed
+	txStatus byte                     // transaction status sent in ReadyForQuery
+	syncing  bool                     // after an error messages are skipped until Sync
+	closed   bool
+
+	// job of the running query, guarded by mu as a CancelRequest
+	// arrives on the goroutine of another connection
+	mu  sync.Mutex
+	job *planner.GridTask
+}
+
+// preparedStmt a statement of the extended protocol Parse message
+type preparedStmt struct {
+	sql     string
+	oids    []int // param types, 0 if the client did not specify one
+	nparams int
+}
+
+// portal a prepared statement with its params bound, ready to execute.
+// Executes limited to a max number of rows buffer the result to return
+// it over several executes.
+type portal struct {
+	sql     string
+	formats []int // result column formats
+	cols    []pgColumn
+	rows    [][]driver.Value
+	tag     string
+	pos     int
+	started bool
+}
+
+func newPgHandler(l *PgListener, c net.Conn) *pgHandler {
+	m := &pgHandler{
+		l:        l,
+		svr:      l.svr,
+		conn:     newPgConn(c),
+		sess:     datasource.NewContextSimple(),
+		params:   make(map[string]string),
+		stmts:    make(map[string]*preparedStmt),
+		portals:  make(map[string]*portal),
+		txStatus: txIdle,
+	}
+	m.pid, m.secret = newBackendKey()
+	m.sess.Data["@@dataux.dialect"] = value.NewStringValue("postgres")
+	m.sess.Data["@@connection_id"] = value.NewIntValue(int64(m.pid))
+	return m
+}
+
+// run reads and handles messages until the client terminates
+func (m *pgHandler) run() {
+	for !m.closed {
+		typ, body, err := m.conn.readMessage()
+		if err != nil {
+			if err != io.EOF {
+				u.Debugf("%d read error: %v", m.pid, err)
+			}
+			return
+		}
+		if typ == msgTerminate {
+			return
+		}
+		if err := m.Handle(m.conn, &models.Request{Raw: append([]byte{typ}, body...)}); err != nil {
+			u.Warnf("%d closing connection: %v", m.pid, err)
+			return
+		}
+	}
+}
+
+// Handle a frontend message, errors of statements are sent to the client
+// as an ErrorResponse, only errors of the connection itself are returned.
+func (m *pgHandler) Handle(writer models.ResultWriter, req *models.Request) error {
+
+	typ, body := req.Raw[0], req.Raw[1:]
+	if m.syncing && typ != msgSync {
+		return nil
+	}
+
+	var err error
+	switch typ {
+	case msgQuery:
+		return m.handleSimpleQuery(strings.TrimRight(string(body), "\x00"))
+	case msgParse:
+		err = m.handleParse(body)
+	case msgBind:
+		err = m.handleBind(body)
+	case msgDescribe:
+		err = m.handleDescribe(body)
+	case msgExecute:
+		err = m.handleExecute(body)
+	case msgClose:
+		err = m.handleClose(body)
+	case msgSync:
+		m.syncing = false
+		if m.txStatus == txIdle {
+			// the implicit transaction ends, and with it its portals
+			m.portals = make(map[string]*portal)
+		}
+		return m.writeReady()
+	case msgFlush:
+		return m.conn.Flush()
+	default:
+		err = newError(codeProtocolViolation, "invalid frontend message type %q", typ)
+	}
+	if err != nil {
+		m.syncing = true
+		return m.writeError(err)
+	}
+	return nil
+}
+
+// SchemaUse the schema of database db
+func (m *pgHandler) SchemaUse(db string) *schema.Schema {
+	if m.authUser != nil && !m.authUser.AllowSchema(db) {
+		u.Warnf("user %q not allowed to use db=%s", m.user, db)
+		return nil
+	}
+	s, ok := m.svr.Schema(db)
+	if s == nil || !ok {
+		u.Debugf("Could not find schema for db=%s", db)
+		return nil
+	}
+	m.schema = s
+	m.sess.Data["@@database"] = value.NewStringValue(db)
+	m.sess.Data["@@user"] = value.NewStringValue(m.user)
+	return s
+}
+
+func (m *pgHandler) Close() error {
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	backends.remove(m)
+	m.conn.Flush()
+	return m.conn.Close()
+}
+
+// cancel the running query, from the goroutine of a CancelRequest
+func (m *pgHandler) cancel() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.job != nil {
+		u.Infof("%d cancelling query", m.pid)
+		m.job.Cancel()
+	}
+}
+
+func (m *pgHandler) setJob(job *planner.GridTask) {
+	m.mu.Lock()
+	m.job = job
+	m.mu.Unlock()
+}
+
+// handleSimpleQuery a Query message of one or more ; separated statements,
+// results are sent as text.  Stops at the first error.
+func (m *pgHandler) handleSimpleQuery(sql string) error {
+
+	stmts := splitStatements(sql)
+	if len(stmts) == 0 {
+		m.conn.startMessage(msgEmptyQuery)
+		if err := m.conn.endMessage(); err != nil {
+			return err
+		}
+		return m.writeReady()
+	}
+
+	for _, stmt := range stmts {
+		tag, err := m.simpleQuery(stmt)
+		if err != nil {
+			if werr := m.writeError(err); werr != nil {
+				return werr
+			}
+			break
+		}
+		if err := m.writeCommandComplete(tag); err != nil {
+			return err
+		}
+	}
+	return m.writeReady()
+}
+
+func (m *pgHandler) simpleQuery(sql string) (string, error) {
+	sql, err := translateSql(sql, nil)
+	if err != nil {
+		return "", err
+	}
+	var cols []pgColumn
+	return m.query(sql, func(c []pgColumn) error {
+		cols = c
+		return m.conn.writeRowDescription(cols, nil)
+	}, func(vals []driver.Value) error {
+		return m.conn.writeDataRow(cols, nil, vals)
+	})
+}
+
+// handleParse the Parse message, creating a prepared statement
+//
+//	name, query, param count, param type oids
+func (m *pgHandler) handleParse(body []byte) error {
+	r := &msgReader{b: body}
+	name := r.string()
+	sql := r.string()
+	oids := make([]int, r.int16())
+	for i := range oids {
+		oids[i] = r.int32()
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if _, exists := m.stmts[name]; exists && name != "" {
+		return newError(codeDuplicateStatement, "prepared statement %q already exists", name)
+	}
+	stmt := &preparedStmt{sql: strings.TrimSpace(sql), oids: oids, nparams: countParams(sql)}
+	if len(oids) > stmt.nparams {
+		stmt.nparams = len(oids)
+	}
+	// untyped params of a LIMIT or OFFSET are integers, others are text
+	for n := range limitParams(stmt.sql) {
+		for len(stmt.oids) < n {
+			stmt.oids = append(stmt.oids, oidUnknown)
+		}
+		if stmt.oids[n-1] == oidUnknown {
+			stmt.oids[n-1] = oidInt8
+		}
+	}
+	m.stmts[name] = stmt
+	m.conn.startMessage(msgParseComplete)
+	return m.conn.endMessage()
+}
+
+// handleBind the Bind message, binding params to a prepared statement to
+// create a portal
+//
+//	portal, statement, param formats, params, result formats
+func (m *pgHandler) handleBind(body []byte) error {
+	r := &msgReader{b: body}
+	name := r.string()
+	stmtName := r.string()
+	paramFormats := make([]int, r.int16())
+	for i := range paramFormats {
+		paramFormats[i] = r.int16()
+	}
+	params := make([][]byte, r.int16())
+	for i := range params {
+		params[i] = r.bytes(r.int32())
+	}
+	formats := make([]int, r.int16())
+	for i := range formats {
+		formats[i] = r.int16()
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	stmt, ok := m.stmts[stmtName]
+	if !ok {
+		return newError(codeInvalidStatement, "prepared statement %q does not exist", stmtName)
+	}
+	if len(params) != stmt.nparams {
+		return newError(codeProtocolViolation, "bind message supplies %d parameters, but prepared statement %q requires %d",
+			len(params), stmtName, stmt.nparams)
+	}
+
+	literals := make([]string, len(params))
+	for i, data := range params {
+		oid := oidUnknown
+		if i < len(stmt.oids) {
+			oid = stmt.oids[i]
+		}
+		lit, err := paramLiteral(oid, columnFormat(paramFormats, i), data)
+		if err != nil {
+			return err
+		}
+		literals[i] = lit
+	}
+	sql, err := translateSql(stmt.sql, literals)
+	if err != nil {
+		return err
+	}
+	m.portals[name] = &portal{sql: sql, formats: formats}
+	m.conn.startMessage(msgBindComplete)
+	return m.conn.endMessage()
+}
+
+// handleDescribe the Describe message of a statement or portal, sending
+// the columns its result will have.
+func (m *pgHandler) handleDescribe(body []byte) error {
+	r := &msgReader{b: body}
+	kind := r.byte()
+	name := r.string()
+	if r.err != nil {
+		return r.err
+	}
+
+	switch kind {
+	case describeStatement:
+		stmt, ok := m.stmts[name]
+		if !ok {
+			return newError(codeInvalidStatement, "prepared statement %q does not exist", name)
+		}
+		// params we were not told the type of are text
+		m.conn.startMessage(msgParamDesc)
+		m.conn.int16(stmt.nparams)
+		for i := 0; i < stmt.nparams; i++ {
+			oid := oidUnknown
+			if i < len(stmt.oids) {
+				oid = stmt.oids[i]
+			}
+			if oid == oidUnknown {
+				oid = oidText
+			}
+			m.conn.int32(oid)
+		}
+		if err := m.conn.endMessage(); err != nil {
+			return err
+		}
+		sql, err := translateSql(stmt.sql, describeParams(stmt))
+		if err != nil {
+			return err
+		}
+		cols, err := m.describe(sql)
+		if err != nil {
+			return err
+		}
+		return m.conn.writeRowDescription(cols, nil)
+	case describePortal:
+		p, ok := m.portals[name]
+		if !ok {
+			return newError(codeInvalidCursor, "portal %q does not exist", name)
+		}
+		cols, err := m.describe(p.sql)
+		if err != nil {
+			return err
+		}
+		return m.conn.writeRowDescription(cols, p.formats)
+	}
+	return newError(codeProtocolViolation, "invalid DESCRIBE message subtype %d", kind)
+}
+
+// describeParams placeholder literals for planning a statement before its
+// params are bound, of the param types so the statement still parses.
+func describeParams(stmt *preparedStmt) []string {
+	params := make([]string, stmt.nparams)
+	for i := range params {
+		oid := oidUnknown
+		if i < len(stmt.oids) {
+			oid = stmt.oids[i]
+		}
+		switch oid {
+		case oidText, oidVarchar, oidJson, oidBytea, oidDate, oidTimestamp, oidTimestamptz:
+			params[i] = "''"
+		case oidBool:
+			params[i] = "false"
+		default:
+			params[i] = "0"
+		}
+	}
+	return params
+}
+
+// handleExecute the Execute message, running a portal returning at most
+// max rows, 0 is all.  A portal with rows remaining is suspended.
+func (m *pgHandler) handleExecute(body []byte) error {
+	r := &msgReader{b: body}
+	name := r.string()
+	max := r.int32()
+	if r.err != nil {
+		return r.err
+	}
+	p, ok := m.portals[name]
+	if !ok {
+		return newError(codeInvalidCursor, "portal %q does not exist", name)
+	}
+	if p.sql == "" {
+		m.conn.startMessage(msgEmptyQuery)
+		return m.conn.endMessage()
+	}
+
+	if !p.started {
+		p.started = true
+		start := func(cols []pgColumn) error {
+			p.cols = cols
+			return nil
+		}
+		if max <= 0 {
+			tag, err := m.query(p.sql, start, func(vals []driver.Value) error {
+				return m.conn.writeDataRow(p.cols, p.formats, vals)
+			})
+			if err != nil {
+				return err
+			}
+			p.tag = tag
+			return m.writeCommandComplete(tag)
+		}
+		tag, err := m.query(p.sql, start, func(vals []driver.Value) error {
+			p.rows = append(p.rows, vals)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		p.tag = tag
+	}
+
+	end := len(p.rows)
+	if max > 0 && p.pos+max < end {
+		end = p.pos + max
+	}
+	for ; p.pos < end; p.pos++ {
+		if err := m.conn.writeDataRow(p.cols, p.formats, p.rows[p.pos]); err != nil {
+			return err
+		}
+	}
+	if p.pos < len(p.rows) {
+		m.conn.startMessage(msgPortalSuspended)
+		return m.conn.endMessage()
+	}
+	p.rows = nil
+	return m.writeCommandComplete(p.tag)
+}
+
+// handleClose the Close message of a statement or portal
+func (m *pgHandler) handleClose(body []byte) error {
+	r := &msgReader{b: body}
+	kind := r.byte()
+	name := r.string()
+	if r.err != nil {
+		return r.err
+	}
+	switch kind {
+	case describeStatement:
+		delete(m.stmts, name)
+	case describePortal:
+		delete(m.portals, name)
+	default:
+		return newError(codeProtocolViolation, "invalid CLOSE message subtype %d", kind)
+	}
+	m.conn.startMessage(msgCloseComplete)
+	return m.conn.endMessage()
+}
+
+// query runs a single statement, sql has been translated and had its
+// params bound.  start is called with the result columns of statements
+// returning rows, then row with each row.  Returns the command tag.
+func (m *pgHandler) query(sql string, start func([]pgColumn) error, row func([]driver.Value) error) (string, error) {
+
+	u.Debugf("%d query: %v", m.pid, sql)
+	cmd := m.parseLocal(sql)
+	if m.txStatus == txFailed && (cmd == nil || !cmd.endsTx()) {
+		return "", newError(codeInFailedTx, "current transaction is aborted, commands ignored until end of transaction block")
+	}
+	if cmd != nil {
+		return m.runLocal(cmd, start, row)
+	}
+
+	queryStart := time.Now()
+	job, err := m.plan(sql)
+	if err != nil {
+		return "", err
+	}
+
+	var tag string
+	switch stmt := job.Ctx.Stmt.(type) {
+	case *rel.SqlSelect, *rel.SqlShow, *rel.SqlDescribe:
+		cols := projColumns(job.Ctx)
+		if err := start(cols); err != nil {
+			job.Close()
+			return "", err
+		}
+		rw := results.NewRowWriter(job.Ctx, row)
+		rw.TypeName = pgTypeName
+		if err := m.runJob(job, rw); err != nil {
+			return "", err
+		}
+		if rw.Err != nil {
+			return "", rw.Err
+		}
+		tag = fmt.Sprintf("SELECT %d", rw.Rows)
+	case *rel.SqlInsert, *rel.SqlUpsert, *rel.SqlUpdate, *rel.SqlDelete:
+		rw := results.NewExecWriter(job.Ctx)
+		if err := m.runJob(job, rw); err != nil {
+			return "", err
+		}
+		if rw.Err != nil {
+			return "", rw.Err
+		}
+		switch stmt.(type) {
+		case *rel.SqlUpdate:
+			tag = fmt.Sprintf("UPDATE %d", rw.Affected)
+		case *rel.SqlDelete:
+			tag = fmt.Sprintf("DELETE %d", rw.Affected)
+		default:
+			tag = fmt.Sprintf("INSERT 0 %d", rw.Affected)
+		}
+	case *rel.SqlCommand, *rel.SqlCreate, *rel.SqlDrop, *rel.SqlAlter:
+		err := job.Run()
+		job.Close()
+		if err != nil {
+			return "", err
+		}
+		tag = strings.Join(firstWords(sql, 2), " ")
+		if _, ok := stmt.(*rel.SqlCommand); ok {
+			tag = strings.Join(firstWords(sql, 1), " ")
+		}
+	default:
+		job.Close()
+		u.Warnf("sql not supported?  %v  %T", stmt, stmt)
+		return "", newError(codeFeatureNotSupported, "statement type %T not supported", stmt)
+	}
+	u.Infof("%d completed in %v", m.pid, time.Since(queryStart))
+	return tag, nil
+}
+
+// plan sql into a job on the same distributed planner as the mysql
+// frontend, checking the user may query its sources.
+func (m *pgHandler) plan(sql string) (*planner.GridTask, error) {
+
+	sch := m.schema
+	if sch == nil {
+		s, err := m.svr.InfoSchema()
+		if err != nil {
+			u.Warnf("no infoschema? %v", err)
+			return nil, err
+		}
+		sch = s.InfoSchema
+	}
+
+	ctx := plan.NewContext(sql)
+	ctx.DisableRecover = m.svr.Config.SupressRecover
+	ctx.Session = m.sess
+	ctx.Schema = sch
+	ctx.Funcs = fr
+	job, err := planner.BuildSqlJob(ctx, m.svr.PlanGrid)
+	if err != nil {
+		u.Debugf("error on parse sql statement: %v", err)
+		return nil, err
+	}
+	if err := m.checkSourceGrants(job.Ctx); err != nil {
+		job.Close()
+		return nil, err
+	}
+	return job, nil
+}
+
+// runJob runs job writing its results with resultWriter, a query that
+// was cancelled returns query_canceled.
+func (m *pgHandler) runJob(job *planner.GridTask, resultWriter exec.Task) error {
+	if err := job.Finalize(resultWriter); err != nil {
+		job.Close()
+		return err
+	}
+	m.setJob(job)
+	err := results.RunWithDeadline(job, context.Background(), 0)
+	m.setJob(nil)
+	if err == results.ErrCancelled {
+		err = newError(codeQueryCanceled, "canceling statement due to user request")
+	}
+	if closeErr := job.Close(); closeErr != nil {
+		u.Errorf("could not close ? %v", closeErr)
+	}
+	return err
+}
+
+// describe the result columns of sql without running it, nil if it
+// returns no rows.
+func (m *pgHandler) describe(sql string) ([]pgColumn, error) {
+	if cmd := m.parseLocal(sql); cmd != nil {
+		return cmd.columns(), nil
+	}
+	job, err := m.plan(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+	switch job.Ctx.Stmt.(type) {
+	case *rel.SqlSelect, *rel.SqlShow, *rel.SqlDescribe:
+		return projColumns(job.Ctx), nil
+	}
+	return nil, nil
+}
+
+// writeError sends err as an ErrorResponse, an error in a transaction
+// block fails the transaction.
+func (m *pgHandler) writeError(err error) error {
+	pe := toPgError(err)
+	u.Debugf("%d error: %v", m.pid, pe)
+	if m.txStatus == txInBlock {
+		m.txStatus = txFailed
+	}
+	return m.conn.writeError(pe)
+}
+
+func (m *pgHandler) writeCommandComplete(tag string) error {
+	m.conn.startMessage(msgCommandComplete)
+	m.conn.string(tag)
+	return m.conn.endMessage()
+}
+
+// writeReady sends ReadyForQuery and flushes, the client may then send
+// its next query.
+func (m *pgHandler) writeReady() error {
+	m.conn.startMessage(msgReadyForQuery)
+	m.conn.wb = append(m.conn.wb, m.txStatus)
+	if err := m.conn.endMessage(); err != nil {
+		return err
+	}
+	return m.conn.Flush()
+}
@@ -0,0 +1,283 @@
+package pgfe
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/araddon/qlbridge/exec"
+	"github.com/araddon/qlbridge/plan"
+
+	"github.com/dataux/dataux/models"
+	"github.com/dataux/dataux/planner"
+)
+
+// testClient the client end of a net.Pipe to a pgHandler, messages are
+// framed by a pgConn as both directions share the format.
+type testClient struct {
+	t *testing.T
+	*pgConn
+}
+
+func newTestListener() *PgListener {
+	return &PgListener{
+		svr:  models.NewServerCtx(&models.Config{SupressRecover: true}),
+		conf: &models.ListenerConfig{Password: "secret"},
+	}
+}
+
+// connect a client to a new handler of l, done gets the error its
+// startup ended with
+func connect(t *testing.T, l *PgListener) (*testClient, *pgHandler, chan error) {
+	server, client := net.Pipe()
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	h := newPgHandler(l, server)
+	done := make(chan error, 1)
+	go func() {
+		err := h.startup()
+		if err == nil {
+			h.run()
+		}
+		h.Close()
+		done <- err
+	}()
+	return &testClient{t: t, pgConn: newPgConn(client)}, h, done
+}
+
+// startup sends a startup packet of code and body
+func (m *testClient) startup(code uint32, body []byte) {
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	binary.BigEndian.PutUint32(b[4:], code)
+	_, err := m.c.Write(append(b, body...))
+	assert.Equal(m.t, nil, err)
+}
+
+// login sends a startup packet with params, answering the md5 password
+// request, and reads the reply up to ReadyForQuery.  Returns the
+// ParameterStatus sent and the backend key.
+func (m *testClient) login(params ...string) (map[string]string, [8]byte) {
+	var body []byte
+	for _, s := range append([]string{"user", "analyst"}, params...) {
+		body = append(append(body, s...), 0)
+	}
+	m.startup(protocolVersion, append(body, 0))
+
+	r := m.expect(msgAuth)
+	assert.Equal(m.t, authMD5, r.int32())
+	salt := r.bytes(4)
+	m.startMessage(msgPassword)
+	m.string(md5Password("analyst", "secret", salt))
+	m.send()
+
+	r = m.expect(msgAuth)
+	assert.Equal(m.t, authOk, r.int32())
+	status := make(map[string]string)
+	var key [8]byte
+	for {
+		typ, body, err := m.readMessage()
+		assert.Equal(m.t, nil, err)
+		r := &msgReader{b: body}
+		switch typ {
+		case msgParameterStatus:
+			status[r.string()] = r.string()
+		case msgBackendKeyData:
+			copy(key[:], body)
+		case msgReadyForQuery:
+			assert.Equal(m.t, byte(txIdle), r.byte())
+			return status, key
+		default:
+			m.t.Fatalf("unexpected message %q during startup", typ)
+		}
+	}
+}
+
+func (m *testClient) send() {
+	assert.Equal(m.t, nil, m.endMessage())
+	assert.Equal(m.t, nil, m.Flush())
+}
+
+// expect reads a message which must be of type typ
+func (m *testClient) expect(typ byte) *msgReader {
+	got, body, err := m.readMessage()
+	if err != nil {
+		m.t.Fatalf("expected message %q: %v", typ, err)
+	}
+	if got != typ {
+		m.t.Fatalf("expected message %q got %q %q", typ, got, body)
+	}
+	return &msgReader{b: body}
+}
+
+// errorCode the SQLSTATE of an ErrorResponse
+func errorCode(r *msgReader) string {
+	for {
+		field := r.byte()
+		if field == 0 || r.err != nil {
+			return ""
+		}
+		if s := r.string(); field == 'C' {
+			return s
+		}
+	}
+}
+
+func TestStartup(t *testing.T) {
+
+	c, h, done := connect(t, newTestListener())
+	status, key := c.login("application_name", "test", "client_encoding", "utf-8")
+	assert.Equal(t, len(reportedParams), len(status))
+	assert.Equal(t, "test", status["application_name"])
+	assert.Equal(t, "UTF8", status["client_encoding"])
+	assert.Equal(t, "analyst", status["session_authorization"])
+	assert.Equal(t, h.pid, binary.BigEndian.Uint32(key[:4]))
+
+	c.startMessage(msgTerminate)
+	c.send()
+	assert.Equal(t, nil, <-done)
+
+	c, _, done = connect(t, newTestListener())
+	c.startup(protocolVersion, []byte("user\x00analyst\x00\x00"))
+	c.expect(msgAuth)
+	c.startMessage(msgPassword)
+	c.string("wrong")
+	c.send()
+	assert.Equal(t, codeInvalidPassword, errorCode(c.expect(msgErrorResponse)))
+	assert.NotEqual(t, nil, <-done)
+
+	// startup params are checked as a SET of them is
+	c, _, done = connect(t, newTestListener())
+	c.startup(protocolVersion, []byte("user\x00analyst\x00client_encoding\x00LATIN1\x00\x00"))
+	r := c.expect(msgAuth)
+	r.int32()
+	c.startMessage(msgPassword)
+	c.string(md5Password("analyst", "secret", r.bytes(4)))
+	c.send()
+	assert.Equal(t, codeFeatureNotSupported, errorCode(c.expect(msgErrorResponse)))
+	assert.NotEqual(t, nil, <-done)
+}
+
+func TestExtendedQuery(t *testing.T) {
+
+	c, h, done := connect(t, newTestListener())
+	c.login()
+
+	// an untyped param, bound as text
+	c.startMessage(msgParse)
+	c.string("")
+	c.string("SET application_name = $1")
+	c.int16(0)
+	assert.Equal(t, nil, c.endMessage())
+	c.startMessage(msgBind)
+	c.string("")
+	c.string("")
+	c.int16(0)
+	c.int16(1)
+	c.int32(4)
+	c.bytes([]byte("psql"))
+	c.int16(0)
+	assert.Equal(t, nil, c.endMessage())
+	c.startMessage(msgExecute)
+	c.string("")
+	c.int32(0)
+	assert.Equal(t, nil, c.endMessage())
+	c.startMessage(msgSync)
+	c.send()
+
+	c.expect(msgParseComplete)
+	c.expect(msgBindComplete)
+	r := c.expect(msgParameterStatus)
+	assert.Equal(t, "application_name", r.string())
+	assert.Equal(t, "psql", r.string())
+	assert.Equal(t, "SET", c.expect(msgCommandComplete).string())
+	c.expect(msgReadyForQuery)
+
+	// a portal executed 2 rows at a time is suspended until exhausted
+	c.startMessage(msgParse)
+	c.string("s1")
+	c.string("SHOW ALL")
+	c.int16(0)
+	assert.Equal(t, nil, c.endMessage())
+	c.startMessage(msgBind)
+	c.string("p1")
+	c.string("s1")
+	c.int16(0)
+	c.int16(0)
+	c.int16(0)
+	assert.Equal(t, nil, c.endMessage())
+	c.startMessage(msgDescribe)
+	c.wb = append(c.wb, describePortal)
+	c.string("p1")
+	assert.Equal(t, nil, c.endMessage())
+	c.startMessage(msgExecute)
+	c.string("p1")
+	c.int32(2)
+	assert.Equal(t, nil, c.endMessage())
+	c.startMessage(msgExecute)
+	c.string("p1")
+	c.int32(0)
+	assert.Equal(t, nil, c.endMessage())
+	c.startMessage(msgSync)
+	c.send()
+
+	c.expect(msgParseComplete)
+	c.expect(msgBindComplete)
+	assert.Equal(t, 3, c.expect(msgRowDescription).int16())
+	c.expect(msgDataRow)
+	c.expect(msgDataRow)
+	c.expect(msgPortalSuspended)
+	for i := 2; i < len(paramNames); i++ {
+		c.expect(msgDataRow)
+	}
+	assert.Equal(t, "SHOW", c.expect(msgCommandComplete).string())
+	c.expect(msgReadyForQuery)
+
+	// portals end with the implicit transaction of the Sync
+	c.startMessage(msgExecute)
+	c.string("p1")
+	c.int32(0)
+	assert.Equal(t, nil, c.endMessage())
+	c.startMessage(msgSync)
+	c.send()
+	assert.Equal(t, codeInvalidCursor, errorCode(c.expect(msgErrorResponse)))
+	c.expect(msgReadyForQuery)
+
+	assert.Equal(t, "psql", h.param("application_name"))
+	c.startMessage(msgTerminate)
+	c.send()
+	assert.Equal(t, nil, <-done)
+}
+
+func TestCancelRequest(t *testing.T) {
+
+	l := newTestListener()
+	c, h, done := connect(t, l)
+	_, key := c.login()
+
+	ctx := plan.NewContext("SELECT 1")
+	job := planner.NewGridTask(ctx, exec.NewExecutor(ctx, nil), nil)
+	defer job.Close()
+	h.setJob(job)
+
+	cancel := func(secret uint32) {
+		body := make([]byte, 8)
+		copy(body, key[:4])
+		binary.BigEndian.PutUint32(body[4:], secret)
+		cc, _, cdone := connect(t, l)
+		cc.startup(cancelRequestCode, body)
+		assert.Equal(t, errCancelRequest, <-cdone)
+	}
+
+	// a wrong secret key is ignored
+	cancel(binary.BigEndian.Uint32(key[4:]) + 1)
+	assert.True(t, !job.Cancelled())
+	cancel(binary.BigEndian.Uint32(key[4:]))
+	assert.True(t, job.Cancelled())
+
+	c.startMessage(msgTerminate)
+	c.send()
+	assert.Equal(t, nil, <-done)
+}
@@ -0,0 +1,385 @@
+package pgfe
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	u "github.com/araddon/gou"
+
+	"github.com/dataux/dataux/models"
+)
+
+// ListenerType the frontend config type of the postgres listener
+const ListenerType = "postgres"
+
+var (
+	// Ensure we meet our interfaces
+	_ models.Listener = (*PgListener)(nil)
+
+	// backendPid each connection gets a process id, which along with
+	// its secret key identifies it to CancelRequests
+	backendPid uint32 = 10000
+
+	// backends the open connections of all postgres listeners by pid
+	backends = &backendRegistry{handlers: make(map[uint32]*pgHandler)}
+)
+
+func init() {
+	// Register our Postgres Frontend Listener
+	models.ListenerRegister(ListenerType, func() models.Listener { return &PgListener{} })
+}
+
+// PgListener a frontend speaking the postgres v3 wire protocol
+type PgListener struct {
+	svr     *models.ServerCtx
+	conf    *models.ListenerConfig
+	auth    models.Authenticator
+	tlsConf *tls.Config // nil if tls is not enabled
+	l       net.Listener
+	closed  int32
+}
+
+// Init is part of frontend interface to accept config and global server context at start
+func (m *PgListener) Init(conf *models.ListenerConfig, svr *models.ServerCtx) error {
+	m.svr = svr
+	m.conf = conf
+	m.auth = svr.Auth
+	if len(conf.Users) > 0 {
+		if m.auth == nil {
+			u.Warnf("ignoring users of listener %s, there is no users config", conf.Addr)
+		} else {
+			m.auth = models.NewListenerAuthenticator(m.auth, conf.Users)
+		}
+	}
+
+	var err error
+	if m.tlsConf, err = conf.TLSConfig(); err != nil {
+		return err
+	}
+	m.l, err = net.Listen("tcp", conf.Addr)
+	if err != nil {
+		u.Errorf("could not init postgres listener: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (m *PgListener) Run(stop chan bool) error {
+	for {
+		c, err := m.l.Accept()
+		if err != nil {
+			if atomic.LoadInt32(&m.closed) == 1 {
+				return nil
+			}
+			u.Errorf("accept error %v", err)
+			continue
+		}
+		go m.onConn(c)
+	}
+}
+
+func (m *PgListener) Close() error {
+	if m.l == nil || !atomic.CompareAndSwapInt32(&m.closed, 0, 1) {
+		return nil
+	}
+	return m.l.Close()
+}
+
+func (m *PgListener) String() string {
+	return fmt.Sprintf("Postgres Frontend address:%v", m.conf.Addr)
+}
+
+// onConn for each new client connection
+func (m *PgListener) onConn(c net.Conn) {
+
+	h := newPgHandler(m, c)
+	defer func() {
+		if !m.svr.Config.SupressRecover {
+			if err := recover(); err != nil {
+				buf := make([]byte, 4096)
+				buf = buf[:runtime.Stack(buf, false)]
+				u.Errorf("onConn panic %v: %v\n%s", c.RemoteAddr(), err, buf)
+			}
+		}
+		h.Close()
+	}()
+
+	if err := h.startup(); err != nil {
+		if err != errCancelRequest {
+			u.Warnf("postgres startup error %s: %v", c.RemoteAddr(), err)
+		}
+		return
+	}
+	h.run()
+}
+
+// errCancelRequest ends a connection that only sent a CancelRequest
+var errCancelRequest = fmt.Errorf("cancel request")
+
+// startup the startup phase of a connection: optional tls negotiation,
+// then the startup packet with user and database, then authentication.
+func (m *pgHandler) startup() error {
+
+	var body []byte
+	for body == nil {
+		code, data, err := m.conn.readStartup()
+		if err != nil {
+			return err
+		}
+		switch code {
+		case sslRequestCode:
+			if m.l.tlsConf == nil || m.isTLS() {
+				if err := m.writeByte('N'); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := m.writeByte('S'); err != nil {
+				return err
+			}
+			tlsConn := tls.Server(m.conn.c, m.l.tlsConf)
+			if err := tlsConn.Handshake(); err != nil {
+				return err
+			}
+			m.conn = newPgConn(tlsConn)
+		case gssEncRequestCode:
+			if err := m.writeByte('N'); err != nil {
+				return err
+			}
+		case cancelRequestCode:
+			if len(data) == 8 {
+				backends.cancel(binary.BigEndian.Uint32(data[:4]), binary.BigEndian.Uint32(data[4:]))
+			}
+			return errCancelRequest
+		default:
+			if code>>16 != protocolVersion>>16 {
+				return m.fatal(newFatal(codeFeatureNotSupported, "unsupported frontend protocol %d.%d", code>>16, code&0xffff))
+			}
+			body = data
+		}
+	}
+
+	params, err := parseStartupParams(body)
+	if err != nil {
+		return m.fatal(newFatal(codeProtocolViolation, "invalid startup packet"))
+	}
+	m.user = params["user"]
+	if m.user == "" {
+		return m.fatal(newFatal(codeInvalidAuthSpec, "no PostgreSQL user name specified in startup packet"))
+	}
+	if m.l.conf.TLSRequire && !m.isTLS() {
+		return m.fatal(newFatal(codeInvalidAuthSpec, "SSL connection is required"))
+	}
+	if err := m.authenticate(); err != nil {
+		return m.fatal(toPgError(err))
+	}
+
+	db := params["database"]
+	if db == "" {
+		db = m.user
+	}
+	if m.SchemaUse(db) == nil && db != m.user {
+		// clients default database to the user name, which need not exist
+		return m.fatal(newFatal(codeInvalidCatalog, "database %q does not exist", db))
+	}
+	for name, value := range params {
+		switch name {
+		case "user", "database", "options", "replication":
+		default:
+			// reported params are all sent once authenticated
+			if err := m.storeParam(strings.ToLower(name), value); err != nil {
+				return m.fatal(toPgError(err))
+			}
+		}
+	}
+
+	m.conn.startMessage(msgAuth)
+	m.conn.int32(authOk)
+	if err := m.conn.endMessage(); err != nil {
+		return err
+	}
+	for _, name := range reportedParams {
+		if err := m.writeParameterStatus(name); err != nil {
+			return err
+		}
+	}
+	m.conn.startMessage(msgBackendKeyData)
+	m.conn.int32(int(m.pid))
+	m.conn.int32(int(m.secret))
+	if err := m.conn.endMessage(); err != nil {
+		return err
+	}
+	backends.add(m)
+	return m.writeReady()
+}
+
+// authenticate the connecting user with an md5 password if we know
+// their plain text password, else a cleartext password checked against
+// the native password hash.  Users are found with the listener's
+// authenticator, or if there is none any user may connect with the
+// listener password.
+func (m *pgHandler) authenticate() error {
+
+	var user *models.UserConfig
+	if m.l.auth == nil {
+		user = &models.UserConfig{Name: m.user, Password: m.l.conf.Password}
+	} else {
+		var err error
+		if user, err = m.l.auth.User(m.user); err != nil && err != models.ErrUserNotFound {
+			u.Warnf("could not find user %q: %v", m.user, err)
+		}
+	}
+	denied := newFatal(codeInvalidPassword, "password authentication failed for user %q", m.user)
+
+	var hash []byte
+	if user != nil {
+		var err error
+		if hash, err = user.NativePasswordHash(); err != nil {
+			u.Warnf("%v", err)
+			return denied
+		}
+		if len(hash) == 0 {
+			m.setAuthUser(user)
+			return nil
+		}
+	}
+
+	// unknown users are asked for a password too so as not to reveal
+	// which users exist
+	if user != nil && user.Password != "" {
+		salt := make([]byte, 4)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		m.conn.startMessage(msgAuth)
+		m.conn.int32(authMD5)
+		m.conn.bytes(salt)
+		password, err := m.readPassword()
+		if err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare([]byte(password), []byte(md5Password(m.user, user.Password, salt))) != 1 {
+			return denied
+		}
+	} else {
+		m.conn.startMessage(msgAuth)
+		m.conn.int32(authCleartext)
+		password, err := m.readPassword()
+		if err != nil {
+			return err
+		}
+		if user == nil || !user.CheckPassword(password) {
+			return denied
+		}
+	}
+	m.setAuthUser(user)
+	return nil
+}
+
+// readPassword sends the authentication request being built and reads
+// the PasswordMessage reply.
+func (m *pgHandler) readPassword() (string, error) {
+	if err := m.conn.endMessage(); err != nil {
+		return "", err
+	}
+	if err := m.conn.Flush(); err != nil {
+		return "", err
+	}
+	typ, body, err := m.conn.readMessage()
+	if err != nil {
+		return "", err
+	}
+	if typ != msgPassword {
+		return "", newFatal(codeProtocolViolation, "expected password response, got message type %q", typ)
+	}
+	r := &msgReader{b: body}
+	password := r.string()
+	if r.err != nil {
+		return "", r.err
+	}
+	return password, nil
+}
+
+func (m *pgHandler) setAuthUser(user *models.UserConfig) {
+	// without an authenticator there are no grants
+	if m.l.auth != nil {
+		m.authUser = user
+	}
+}
+
+// md5Password the md5 password response "md5" + md5(md5(password + user) + salt)
+func md5Password(user, password string, salt []byte) string {
+	inner := md5.Sum([]byte(password + user))
+	outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), salt...))
+	return "md5" + hex.EncodeToString(outer[:])
+}
+
+func (m *pgHandler) isTLS() bool {
+	_, ok := m.conn.c.(*tls.Conn)
+	return ok
+}
+
+// writeByte the single byte replies to SSLRequest, GSSENCRequest
+func (m *pgHandler) writeByte(c byte) error {
+	if _, err := m.conn.c.Write([]byte{c}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// fatal sends a fatal ErrorResponse, the connection is then closed
+func (m *pgHandler) fatal(err *pgError) error {
+	err.fatal = true
+	m.conn.writeError(err)
+	m.conn.Flush()
+	return err
+}
+
+// backendRegistry the open connections by pid, for CancelRequests
+type backendRegistry struct {
+	mu       sync.Mutex
+	handlers map[uint32]*pgHandler
+}
+
+func (m *backendRegistry) add(h *pgHandler) {
+	m.mu.Lock()
+	m.handlers[h.pid] = h
+	m.mu.Unlock()
+}
+
+func (m *backendRegistry) remove(h *pgHandler) {
+	m.mu.Lock()
+	if m.handlers[h.pid] == h {
+		delete(m.handlers, h.pid)
+	}
+	m.mu.Unlock()
+}
+
+// cancel the running query of connection pid if secret is its key
+func (m *backendRegistry) cancel(pid, secret uint32) {
+	m.mu.Lock()
+	h := m.handlers[pid]
+	m.mu.Unlock()
+	if h == nil || subtle.ConstantTimeEq(int32(h.secret), int32(secret)) != 1 {
+		u.Warnf("ignoring cancel request for unknown backend %d", pid)
+		return
+	}
+	h.cancel()
+}
+
+// newBackendKey the pid and secret key of a new connection
+func newBackendKey() (uint32, uint32) {
+	key := make([]byte, 4)
+	rand.Read(key)
+	return atomic.AddUint32(&backendPid, 1), binary.BigEndian.Uint32(key)
+}
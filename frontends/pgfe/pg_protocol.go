@@ -0,0 +1,241 @@
+package pgfe
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/dataux/dataux/models"
+)
+
+// Postgres v3 wire protocol messages
+//
+//	https://www.postgresql.org/docs/current/protocol-message-formats.html
+const (
+	protocolVersion    = 196608   // 3.0
+	sslRequestCode     = 80877103 // startup packet asking for tls
+	cancelRequestCode  = 80877102 // startup packet cancelling a query
+	gssEncRequestCode  = 80877104 // startup packet asking for gss encryption
+	maxStartupLength   = 10000
+	maxMessageLength   = 1 << 30
+	authOk             = 0
+	authCleartext      = 3
+	authMD5            = 5
+	txIdle             = 'I'
+	txInBlock          = 'T'
+	txFailed           = 'E'
+	formatText         = 0
+	formatBinary       = 1
+	describeStatement  = 'S'
+	describePortal     = 'P'
+	msgQuery           = 'Q'
+	msgParse           = 'P'
+	msgBind            = 'B'
+	msgDescribe        = 'D'
+	msgExecute         = 'E'
+	msgSync            = 'S'
+	msgFlush           = 'H'
+	msgClose           = 'C'
+	msgTerminate       = 'X'
+	msgPassword        = 'p'
+	msgAuth            = 'R'
+	msgParameterStatus = 'S'
+	msgBackendKeyData  = 'K'
+	msgReadyForQuery   = 'Z'
+	msgRowDescription  = 'T'
+	msgDataRow         = 'D'
+	msgCommandComplete = 'C'
+	msgEmptyQuery      = 'I'
+	msgErrorResponse   = 'E'
+	msgNoticeResponse  = 'N'
+	msgParseComplete   = '1'
+	msgBindComplete    = '2'
+	msgCloseComplete   = '3'
+	msgNoData          = 'n'
+	msgParamDesc       = 't'
+	msgPortalSuspended = 's'
+)
+
+// pgConn the framing of postgres messages over a client connection,
+// writes are buffered until Flush.
+type pgConn struct {
+	c  net.Conn
+	r  *bufio.Reader
+	w  *bufio.Writer
+	wb []byte // message being built
+}
+
+func newPgConn(c net.Conn) *pgConn {
+	return &pgConn{c: c, r: bufio.NewReaderSize(c, 8192), w: bufio.NewWriterSize(c, 8192)}
+}
+
+// readStartup reads the length prefixed startup packet, which has no
+// message type, returning its code and body.
+func (m *pgConn) readStartup() (uint32, []byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(m.r, header); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 8 || length > maxStartupLength {
+		return 0, nil, fmt.Errorf("invalid startup packet length %d", length)
+	}
+	body := make([]byte, length-8)
+	if _, err := io.ReadFull(m.r, body); err != nil {
+		return 0, nil, err
+	}
+	return binary.BigEndian.Uint32(header[4:]), body, nil
+}
+
+// readMessage reads a message returning its type and body
+func (m *pgConn) readMessage() (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(m.r, header); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length < 4 || length > maxMessageLength {
+		return 0, nil, fmt.Errorf("invalid message length %d", length)
+	}
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(m.r, body); err != nil {
+		return 0, nil, err
+	}
+	return header[0], body, nil
+}
+
+// startMessage begins building a message of type typ
+func (m *pgConn) startMessage(typ byte) {
+	m.wb = append(m.wb[:0], typ, 0, 0, 0, 0)
+}
+
+func (m *pgConn) int16(n int) {
+	m.wb = append(m.wb, byte(n>>8), byte(n))
+}
+
+func (m *pgConn) int32(n int) {
+	m.wb = append(m.wb, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func (m *pgConn) bytes(b []byte) {
+	m.wb = append(m.wb, b...)
+}
+
+// string a null terminated string
+func (m *pgConn) string(s string) {
+	m.wb = append(m.wb, s...)
+	m.wb = append(m.wb, 0)
+}
+
+// endMessage fills in the length of the message built and buffers it
+func (m *pgConn) endMessage() error {
+	binary.BigEndian.PutUint32(m.wb[1:5], uint32(len(m.wb)-1))
+	_, err := m.w.Write(m.wb)
+	return err
+}
+
+// writeMessage a message of type typ with body
+func (m *pgConn) writeMessage(typ byte, body []byte) error {
+	m.startMessage(typ)
+	m.bytes(body)
+	return m.endMessage()
+}
+
+// WriteResult writes an already encoded message, implementing
+// models.ResultWriter.
+func (m *pgConn) WriteResult(r models.Result) error {
+	msg, ok := r.([]byte)
+	if !ok {
+		return fmt.Errorf("expected encoded message but got %T", r)
+	}
+	_, err := m.w.Write(msg)
+	return err
+}
+
+func (m *pgConn) Flush() error {
+	return m.w.Flush()
+}
+
+func (m *pgConn) Close() error {
+	return m.c.Close()
+}
+
+// msgReader reads the fields of a message body
+type msgReader struct {
+	b   []byte
+	err error
+}
+
+func (m *msgReader) int16() int {
+	if len(m.b) < 2 {
+		m.err = errMalformed
+		return 0
+	}
+	n := int(int16(binary.BigEndian.Uint16(m.b)))
+	m.b = m.b[2:]
+	return n
+}
+
+func (m *msgReader) int32() int {
+	if len(m.b) < 4 {
+		m.err = errMalformed
+		return 0
+	}
+	n := int(int32(binary.BigEndian.Uint32(m.b)))
+	m.b = m.b[4:]
+	return n
+}
+
+func (m *msgReader) byte() byte {
+	if len(m.b) < 1 {
+		m.err = errMalformed
+		return 0
+	}
+	c := m.b[0]
+	m.b = m.b[1:]
+	return c
+}
+
+// string a null terminated string
+func (m *msgReader) string() string {
+	i := bytes.IndexByte(m.b, 0)
+	if i < 0 {
+		m.err = errMalformed
+		return ""
+	}
+	s := string(m.b[:i])
+	m.b = m.b[i+1:]
+	return s
+}
+
+// bytes n bytes, nil for a length of -1 ie NULL
+func (m *msgReader) bytes(n int) []byte {
+	if n < 0 {
+		return nil
+	}
+	if len(m.b) < n {
+		m.err = errMalformed
+		return nil
+	}
+	b := m.b[:n]
+	m.b = m.b[n:]
+	return b
+}
+
+// parseStartupParams the key value pairs of a startup packet
+func parseStartupParams(body []byte) (map[string]string, error) {
+	params := make(map[string]string)
+	r := &msgReader{b: body}
+	for len(r.b) > 0 && r.b[0] != 0 {
+		k := r.string()
+		v := r.string()
+		if r.err != nil {
+			return nil, r.err
+		}
+		params[k] = v
+	}
+	return params, nil
+}
@@ -0,0 +1,93 @@
+package pgfe
+
+import (
+	"database/sql/driver"
+
+	"github.com/araddon/qlbridge/plan"
+)
+
+// pgColumn a column of a RowDescription
+type pgColumn struct {
+	name string
+	typ  pgType
+}
+
+// projColumns the result columns of a planned statement
+func projColumns(ctx *plan.Context) []pgColumn {
+	cols := make([]pgColumn, 0)
+	if ctx.Projection == nil || ctx.Projection.Proj == nil {
+		return cols
+	}
+	for _, col := range ctx.Projection.Proj.Columns {
+		name := col.Name
+		if col.Col != nil {
+			name = col.Col.As
+		}
+		cols = append(cols, pgColumn{name: name, typ: valueTypeToPg(col.Type)})
+	}
+	return cols
+}
+
+// columnFormat the format of column or param i of formats, no formats is
+// all text and a single format applies to all.
+func columnFormat(formats []int, i int) int {
+	switch {
+	case len(formats) == 0:
+		return formatText
+	case len(formats) == 1:
+		return formats[0]
+	case i < len(formats):
+		return formats[i]
+	}
+	return formatText
+}
+
+// writeRowDescription sends the columns of a result, or NoData if the
+// statement returns no rows.
+func (m *pgConn) writeRowDescription(cols []pgColumn, formats []int) error {
+	if cols == nil {
+		m.startMessage(msgNoData)
+		return m.endMessage()
+	}
+	m.startMessage(msgRowDescription)
+	m.int16(len(cols))
+	for i, col := range cols {
+		m.string(col.name)
+		m.int32(0) // table oid
+		m.int16(0) // column attribute number
+		m.int32(col.typ.oid)
+		m.int16(col.typ.size)
+		m.int32(-1) // type modifier
+		m.int16(columnFormat(formats, i))
+	}
+	return m.endMessage()
+}
+
+// writeDataRow sends a row of vals encoded per the formats of cols
+func (m *pgConn) writeDataRow(cols []pgColumn, formats []int, vals []driver.Value) error {
+	m.startMessage(msgDataRow)
+	m.int16(len(cols))
+	for i, col := range cols {
+		var v driver.Value
+		if i < len(vals) {
+			v = vals[i]
+		}
+		if v == nil {
+			m.int32(-1)
+			continue
+		}
+		var b []byte
+		var err error
+		if columnFormat(formats, i) == formatBinary {
+			b, err = encodeBinary(col.typ, v)
+		} else {
+			b, err = encodeText(v)
+		}
+		if err != nil {
+			return newError(codeInvalidTextRep, "column %q: %v", col.name, err)
+		}
+		m.int32(len(b))
+		m.bytes(b)
+	}
+	return m.endMessage()
+}
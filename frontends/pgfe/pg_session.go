@@ -0,0 +1,347 @@
+package pgfe
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// SET [SESSION | LOCAL] name { TO | = } value
+	setRegex = regexp.MustCompile(`(?is)^SET\s+(?:(?:SESSION|LOCAL)\s+)?([A-Za-z_][\w.]*)\s*(?:=|\s+TO\s)\s*(.*?)$`)
+	// SET [SESSION | LOCAL] TIME ZONE value
+	setTimeZoneRegex = regexp.MustCompile(`(?is)^SET\s+(?:(?:SESSION|LOCAL)\s+)?TIME\s+ZONE\s+(.*?)$`)
+	// SET TRANSACTION ..., SET SESSION CHARACTERISTICS AS TRANSACTION ...
+	setTransactionRegex = regexp.MustCompile(`(?is)^SET\s+(?:TRANSACTION|SESSION\s+CHARACTERISTICS)\s`)
+	showRegex           = regexp.MustCompile(`(?is)^SHOW\s+([A-Za-z_][\w.]*)$`)
+	resetRegex          = regexp.MustCompile(`(?is)^RESET\s+([A-Za-z_][\w.]*)$`)
+	deallocateRegex     = regexp.MustCompile(`(?is)^DEALLOCATE\s+(?:PREPARE\s+)?(\S+)$`)
+
+	// reportedParams parameters sent to the client with ParameterStatus at
+	// startup and whenever they are SET
+	reportedParams = []string{
+		"application_name", "client_encoding", "DateStyle", "integer_datetimes", "IntervalStyle",
+		"is_superuser", "server_encoding", "server_version", "session_authorization",
+		"standard_conforming_strings", "TimeZone",
+	}
+
+	// defaultParams values of parameters the client has not SET
+	defaultParams = map[string]string{
+		"application_name":            "",
+		"client_encoding":             "UTF8",
+		"DateStyle":                   "ISO, MDY",
+		"extra_float_digits":          "1",
+		"integer_datetimes":           "on",
+		"IntervalStyle":               "postgres",
+		"max_identifier_length":       "63",
+		"search_path":                 `"$user", public`,
+		"server_encoding":             "UTF8",
+		"server_version":              "9.6.0",
+		"standard_conforming_strings": "on",
+		"TimeZone":                    "UTC",
+		"transaction_isolation":       "read committed",
+	}
+
+	// paramNames the canonical case of parameter names by lower case name
+	paramNames = make(map[string]string)
+)
+
+func init() {
+	for name := range defaultParams {
+		paramNames[strings.ToLower(name)] = name
+	}
+	for _, name := range reportedParams {
+		paramNames[strings.ToLower(name)] = name
+	}
+}
+
+// localCmd a statement answered by the session itself rather than the
+// planner: transaction control and session parameters.
+type localCmd struct {
+	kind  string // BEGIN, COMMIT, ROLLBACK, SET, RESET, SHOW, DISCARD, DEALLOCATE
+	name  string // lower case parameter name, or prepared statement name
+	value string // value of SET, "" is DEFAULT
+}
+
+// parseLocal the local command of sql, nil if the planner runs it
+func (m *pgHandler) parseLocal(sql string) *localCmd {
+
+	sql = strings.TrimSpace(strings.TrimRight(strings.TrimSpace(sql), ";"))
+	words := firstWords(sql, 2)
+	if len(words) == 0 {
+		return nil
+	}
+	switch words[0] {
+	case "BEGIN":
+		return &localCmd{kind: "BEGIN"}
+	case "START":
+		if len(words) > 1 && words[1] == "TRANSACTION" {
+			return &localCmd{kind: "BEGIN"}
+		}
+	case "COMMIT", "END":
+		return &localCmd{kind: "COMMIT"}
+	case "ROLLBACK", "ABORT":
+		return &localCmd{kind: "ROLLBACK"}
+	case "SET":
+		switch {
+		case setTransactionRegex.MatchString(sql):
+			// we don't currently support transactions
+			return &localCmd{kind: "SET"}
+		case setTimeZoneRegex.MatchString(sql):
+			value := setTimeZoneRegex.FindStringSubmatch(sql)[1]
+			if strings.EqualFold(value, "LOCAL") {
+				value = "DEFAULT"
+			}
+			return &localCmd{kind: "SET", name: "timezone", value: parseSetValue(value)}
+		case setRegex.MatchString(sql):
+			match := setRegex.FindStringSubmatch(sql)
+			return &localCmd{kind: "SET", name: strings.ToLower(match[1]), value: parseSetValue(match[2])}
+		}
+	case "RESET":
+		if match := resetRegex.FindStringSubmatch(sql); match != nil {
+			return &localCmd{kind: "RESET", name: strings.ToLower(match[1])}
+		}
+	case "SHOW":
+		if match := showRegex.FindStringSubmatch(sql); match != nil {
+			name := strings.ToLower(match[1])
+			_, known := paramNames[name]
+			_, set := m.params[name]
+			if known || set || name == "all" {
+				return &localCmd{kind: "SHOW", name: name}
+			}
+		}
+	case "DISCARD":
+		return &localCmd{kind: "DISCARD"}
+	case "DEALLOCATE":
+		if match := deallocateRegex.FindStringSubmatch(sql); match != nil {
+			return &localCmd{kind: "DEALLOCATE", name: strings.Trim(match[1], "`")}
+		}
+	}
+	return nil
+}
+
+// endsTx may the command run in a failed transaction
+func (m *localCmd) endsTx() bool {
+	return m.kind == "COMMIT" || m.kind == "ROLLBACK"
+}
+
+// columns the result columns of the command, nil if it returns no rows
+func (m *localCmd) columns() []pgColumn {
+	if m.kind != "SHOW" {
+		return nil
+	}
+	if m.name == "all" {
+		return []pgColumn{{"name", typeText}, {"setting", typeText}, {"description", typeText}}
+	}
+	return []pgColumn{{paramName(m.name), typeText}}
+}
+
+// parseSetValue the value of a SET, a comma separated list of literals
+// which have been translated to backslash escaped strings and `quoted`
+// identifiers.  DEFAULT is "".
+func parseSetValue(s string) string {
+	if strings.EqualFold(strings.TrimSpace(s), "DEFAULT") {
+		return ""
+	}
+	var vals []string
+	for _, part := range splitList(s) {
+		part = strings.TrimSpace(part)
+		switch {
+		case len(part) >= 2 && part[0] == '\'' && part[len(part)-1] == '\'':
+			part = unescapeLiteral(part[1 : len(part)-1])
+		case len(part) >= 2 && part[0] == '`' && part[len(part)-1] == '`':
+			part = strings.Replace(part[1:len(part)-1], "``", "`", -1)
+		}
+		vals = append(vals, part)
+	}
+	return strings.Join(vals, ", ")
+}
+
+// splitList splits s on commas outside of quotes
+func splitList(s string) []string {
+	var parts []string
+	start := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '\'' || c == '`'):
+			quote = c
+		case quote == 0 && c == ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescapeLiteral the inverse of quoteLiteral without the quotes
+func unescapeLiteral(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
+
+// paramName the canonical name of a lower case parameter name
+func paramName(name string) string {
+	if canonical, ok := paramNames[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// param the session value of parameter name
+func (m *pgHandler) param(name string) string {
+	name = strings.ToLower(name)
+	if v, ok := m.params[name]; ok {
+		return v
+	}
+	switch name {
+	case "session_authorization":
+		return m.user
+	case "is_superuser":
+		if m.authUser == nil || m.authUser.Admin {
+			return "on"
+		}
+		return "off"
+	}
+	return defaultParams[paramName(name)]
+}
+
+// writeParameterStatus sends the value of parameter name
+func (m *pgHandler) writeParameterStatus(name string) error {
+	m.conn.startMessage(msgParameterStatus)
+	m.conn.string(paramName(strings.ToLower(name)))
+	m.conn.string(m.param(name))
+	return m.conn.endMessage()
+}
+
+func isReported(name string) bool {
+	for _, reported := range reportedParams {
+		if strings.EqualFold(reported, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// runLocal runs a local command, returning its command tag
+func (m *pgHandler) runLocal(cmd *localCmd, start func([]pgColumn) error, row func([]driver.Value) error) (string, error) {
+
+	switch cmd.kind {
+	case "BEGIN":
+		// there are no transactions, only their status is tracked
+		if m.txStatus == txIdle {
+			m.txStatus = txInBlock
+		}
+		return "BEGIN", nil
+	case "COMMIT":
+		failed := m.txStatus == txFailed
+		m.txStatus = txIdle
+		if failed {
+			return "ROLLBACK", nil
+		}
+		return "COMMIT", nil
+	case "ROLLBACK":
+		m.txStatus = txIdle
+		return "ROLLBACK", nil
+	case "SET":
+		if cmd.name == "" {
+			return "SET", nil
+		}
+		if err := m.setParam(cmd.name, cmd.value); err != nil {
+			return "", err
+		}
+		return "SET", nil
+	case "RESET":
+		if cmd.name != "all" {
+			return "RESET", m.setParam(cmd.name, "")
+		}
+		for name := range m.params {
+			if err := m.setParam(name, ""); err != nil {
+				return "", err
+			}
+		}
+		return "RESET", nil
+	case "SHOW":
+		if err := start(cmd.columns()); err != nil {
+			return "", err
+		}
+		if cmd.name != "all" {
+			return "SHOW", row([]driver.Value{m.param(cmd.name)})
+		}
+		names := make([]string, 0, len(paramNames))
+		for name := range paramNames {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := row([]driver.Value{paramName(name), m.param(name), ""}); err != nil {
+				return "", err
+			}
+		}
+		return "SHOW", nil
+	case "DISCARD":
+		m.stmts = make(map[string]*preparedStmt)
+		m.txStatus = txIdle
+		return "DISCARD ALL", nil
+	case "DEALLOCATE":
+		if strings.EqualFold(cmd.name, "ALL") {
+			m.stmts = make(map[string]*preparedStmt)
+			return "DEALLOCATE ALL", nil
+		}
+		if _, ok := m.stmts[cmd.name]; !ok {
+			return "", newError(codeInvalidStatement, "prepared statement %q does not exist", cmd.name)
+		}
+		delete(m.stmts, cmd.name)
+		return "DEALLOCATE", nil
+	}
+	return "", newError(codeFeatureNotSupported, "%s is not supported", cmd.kind)
+}
+
+// setParam sets session parameter name, "" reverts it to its default.
+// Changes of reported parameters are sent to the client.
+func (m *pgHandler) setParam(name, value string) error {
+	if err := m.storeParam(name, value); err != nil {
+		return err
+	}
+	if isReported(name) {
+		return m.writeParameterStatus(name)
+	}
+	return nil
+}
+
+// storeParam checks and stores session parameter name, as set by SET or
+// the startup packet.
+func (m *pgHandler) storeParam(name, value string) error {
+	switch name {
+	case "client_encoding":
+		switch strings.ToUpper(strings.Replace(value, "-", "", -1)) {
+		case "", "UTF8", "UNICODE":
+			value = ""
+		default:
+			return newError(codeFeatureNotSupported, "conversion between %s and UTF8 is not supported", value)
+		}
+	case "server_encoding", "server_version", "integer_datetimes", "is_superuser", "max_identifier_length":
+		return newError(codeCantChangeParam, "parameter %q cannot be changed", name)
+	}
+	if value == "" {
+		delete(m.params, name)
+	} else {
+		m.params[name] = value
+	}
+	return nil
+}
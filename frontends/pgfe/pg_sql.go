@@ -0,0 +1,210 @@
+package pgfe
+
+import (
+	"bytes"
+	"strings"
+)
+
+// walkSql walks over postgres sql text calling visit with the position of
+// each byte that is statement syntax, ie skipping string literals, quoted
+// identifiers and comments.  Stops if visit returns false.
+func walkSql(sql string, visit func(i int) bool) {
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == '\'' || c == '"':
+			i = quoteEnd(sql, i)
+		case strings.HasPrefix(sql[i:], "--"):
+			for ; i < len(sql) && sql[i] != '\n'; i++ {
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return
+			}
+			i += end + 3
+		default:
+			if !visit(i) {
+				return
+			}
+		}
+	}
+}
+
+// quoteEnd the position of the quote closing the string or identifier
+// starting at start, a doubled quote is an escaped quote.  Backslash
+// escapes apply only to E'...' strings as standard_conforming_strings is on.
+func quoteEnd(sql string, start int) int {
+	q := sql[start]
+	escapes := q == '\'' && isEString(sql, start)
+	for i := start + 1; i < len(sql); i++ {
+		switch {
+		case escapes && sql[i] == '\\':
+			i++
+		case sql[i] == q:
+			if i+1 < len(sql) && sql[i+1] == q {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(sql)
+}
+
+// isEString is the string literal starting at i an E'...' escape string
+func isEString(sql string, i int) bool {
+	return i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e') && (i == 1 || !isIdentChar(sql[i-2]))
+}
+
+// splitStatements splits sql on ; statement separators, dropping
+// statements that are empty or only comments.
+func splitStatements(sql string) []string {
+	var stmts []string
+	start, empty := 0, true
+	walkSql(sql, func(i int) bool {
+		switch c := sql[i]; {
+		case c == ';':
+			if !empty {
+				stmts = append(stmts, strings.TrimSpace(sql[start:i]))
+			}
+			start, empty = i+1, true
+		case c != ' ' && c != '\t' && c != '\n' && c != '\r':
+			empty = false
+		}
+		return true
+	})
+	if !empty {
+		stmts = append(stmts, strings.TrimSpace(sql[start:]))
+	}
+	return stmts
+}
+
+// countParams the highest $n parameter placeholder in sql
+func countParams(sql string) int {
+	max := 0
+	walkSql(sql, func(i int) bool {
+		if n, _ := paramAt(sql, i); n > max {
+			max = n
+		}
+		return true
+	})
+	return max
+}
+
+// paramAt the number and length of a $n placeholder at position i, 0 if
+// there is none.
+func paramAt(sql string, i int) (int, int) {
+	if sql[i] != '$' || (i > 0 && isIdentChar(sql[i-1])) {
+		return 0, 0
+	}
+	n, j := 0, i+1
+	for ; j < len(sql) && sql[j] >= '0' && sql[j] <= '9' && n < 1<<16; j++ {
+		n = n*10 + int(sql[j]-'0')
+	}
+	if j == i+1 {
+		return 0, 0
+	}
+	return n, j - i
+}
+
+// limitParams the numbers of the $n placeholders that are the count of a
+// LIMIT or OFFSET
+func limitParams(sql string) map[int]bool {
+	params := make(map[int]bool)
+	walkSql(sql, func(i int) bool {
+		n, _ := paramAt(sql, i)
+		if n == 0 {
+			return true
+		}
+		before := strings.TrimRight(sql[:i], " \t\r\n")
+		j := len(before)
+		for j > 0 && isIdentChar(before[j-1]) {
+			j--
+		}
+		switch strings.ToUpper(before[j:]) {
+		case "LIMIT", "OFFSET":
+			params[n] = true
+		}
+		return true
+	})
+	return params
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// translateSql rewrites postgres sql into the dialect of the qlbridge
+// parser: "identifiers" are `quoted`, string literals are backslash
+// escaped and $n placeholders are replaced by the literal params[n-1].
+func translateSql(sql string, params []string) (string, error) {
+	var buf bytes.Buffer
+	buf.Grow(len(sql))
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == '\'':
+			end := quoteEnd(sql, i)
+			if end >= len(sql) {
+				return "", newError(codeSyntaxError, "unterminated quoted string")
+			}
+			if isEString(sql, i) {
+				// E'' strings are already backslash escaped, drop the E
+				buf.Truncate(buf.Len() - 1)
+				buf.WriteByte('\'')
+				buf.WriteString(strings.Replace(sql[i+1:end], "''", `\'`, -1))
+				buf.WriteByte('\'')
+			} else {
+				buf.WriteString(quoteLiteral(strings.Replace(sql[i+1:end], "''", "'", -1)))
+			}
+			i = end
+		case c == '"':
+			end := quoteEnd(sql, i)
+			if end >= len(sql) {
+				return "", newError(codeSyntaxError, "unterminated quoted identifier")
+			}
+			ident := strings.Replace(sql[i+1:end], `""`, `"`, -1)
+			buf.WriteByte('`')
+			buf.WriteString(strings.Replace(ident, "`", "``", -1))
+			buf.WriteByte('`')
+			i = end
+		case strings.HasPrefix(sql[i:], "--"):
+			for ; i < len(sql) && sql[i] != '\n'; i++ {
+				buf.WriteByte(sql[i])
+			}
+			if i < len(sql) {
+				buf.WriteByte('\n')
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return "", newError(codeSyntaxError, "unterminated /* comment")
+			}
+			buf.WriteString(sql[i : i+end+4])
+			i += end + 3
+		default:
+			n, l := paramAt(sql, i)
+			if n == 0 {
+				buf.WriteByte(c)
+				continue
+			}
+			if n > len(params) {
+				return "", newError(codeInvalidParamValue, "there is no parameter $%d", n)
+			}
+			buf.WriteString(params[n-1])
+			i += l - 1
+		}
+	}
+	return buf.String(), nil
+}
+
+// firstWords the first n upper cased words of sql
+func firstWords(sql string, n int) []string {
+	words := strings.Fields(strings.TrimRight(strings.TrimSpace(sql), ";"))
+	if len(words) > n {
+		words = words[:n]
+	}
+	for i, w := range words {
+		words[i] = strings.ToUpper(w)
+	}
+	return words
+}
@@ -0,0 +1,95 @@
+package pgfe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitStatements(t *testing.T) {
+
+	tests := []struct {
+		sql   string
+		stmts []string
+	}{
+		{"", nil},
+		{" ; ;", nil},
+		{"-- just a comment", nil},
+		{"SELECT 1", []string{"SELECT 1"}},
+		{"SELECT 1; SELECT 2;", []string{"SELECT 1", "SELECT 2"}},
+		{"SELECT 'a;b'; SELECT \"x;y\" FROM t", []string{"SELECT 'a;b'", "SELECT \"x;y\" FROM t"}},
+		{"SELECT 'it''s;' -- c;\n; /* ; */ SELECT 2", []string{"SELECT 'it''s;' -- c;", "/* ; */ SELECT 2"}},
+		{`SELECT E'a\';b'; SELECT 3`, []string{`SELECT E'a\';b'`, "SELECT 3"}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.stmts, splitStatements(tt.sql), tt.sql)
+	}
+}
+
+func TestCountParams(t *testing.T) {
+	assert.Equal(t, 0, countParams("SELECT 1"))
+	assert.Equal(t, 2, countParams("SELECT * FROM t WHERE a = $2 AND b = $1"))
+	assert.Equal(t, 1, countParams("SELECT '$3', \"$4\", a$5 FROM t WHERE a = $1 -- $6"))
+}
+
+func TestLimitParams(t *testing.T) {
+	assert.Equal(t, map[int]bool{}, limitParams("SELECT * FROM t WHERE a = $1"))
+	assert.Equal(t, map[int]bool{2: true, 3: true},
+		limitParams("SELECT * FROM t WHERE a = $1 limit $2\n OFFSET $3"))
+	assert.Equal(t, map[int]bool{}, limitParams("SELECT 'LIMIT $1' FROM t"))
+}
+
+func TestTranslateSql(t *testing.T) {
+
+	tests := []struct {
+		sql    string
+		params []string
+		out    string
+	}{
+		{`SELECT "Name" FROM "my""table"`, nil, "SELECT `Name` FROM `my\"table`"},
+		{`SELECT 'it''s' FROM t`, nil, `SELECT 'it\'s' FROM t`},
+		{`SELECT 'c:\dir'`, nil, `SELECT 'c:\\dir'`},
+		{`SELECT E'a\nb', E'', e'x''y'`, nil, `SELECT 'a\nb', '', 'x\'y'`},
+		{`SELECT a FROM t WHERE a = $1 AND b = $2 LIMIT $1`, []string{"1", "'x'"}, `SELECT a FROM t WHERE a = 1 AND b = 'x' LIMIT 1`},
+		{`SELECT '$1' /* $1 */`, []string{"2"}, `SELECT '$1' /* $1 */`},
+	}
+	for _, tt := range tests {
+		out, err := translateSql(tt.sql, tt.params)
+		assert.Equal(t, nil, err, tt.sql)
+		assert.Equal(t, tt.out, out, tt.sql)
+	}
+
+	_, err := translateSql(`SELECT 'abc`, nil)
+	assert.NotEqual(t, nil, err)
+	_, err = translateSql(`SELECT $2`, []string{"1"})
+	assert.NotEqual(t, nil, err)
+}
+
+func TestParseLocal(t *testing.T) {
+
+	m := &pgHandler{params: map[string]string{"myapp.mode": "x"}}
+
+	tests := []struct {
+		sql string
+		cmd *localCmd
+	}{
+		{"BEGIN", &localCmd{kind: "BEGIN"}},
+		{"start transaction read only", &localCmd{kind: "BEGIN"}},
+		{"END;", &localCmd{kind: "COMMIT"}},
+		{"ABORT", &localCmd{kind: "ROLLBACK"}},
+		{"SET application_name = 'psql'", &localCmd{kind: "SET", name: "application_name", value: "psql"}},
+		{"SET SESSION search_path TO `my schema`, public", &localCmd{kind: "SET", name: "search_path", value: "my schema, public"}},
+		{"SET TIME ZONE 'Europe/Paris'", &localCmd{kind: "SET", name: "timezone", value: "Europe/Paris"}},
+		{"set DateStyle to DEFAULT", &localCmd{kind: "SET", name: "datestyle", value: ""}},
+		{"SET TRANSACTION ISOLATION LEVEL SERIALIZABLE", &localCmd{kind: "SET"}},
+		{"RESET ALL", &localCmd{kind: "RESET", name: "all"}},
+		{"SHOW server_version", &localCmd{kind: "SHOW", name: "server_version"}},
+		{"SHOW myapp.mode", &localCmd{kind: "SHOW", name: "myapp.mode"}},
+		{"DEALLOCATE PREPARE s1", &localCmd{kind: "DEALLOCATE", name: "s1"}},
+		{"SHOW TABLES", nil},
+		{"SELECT 1", nil},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.cmd, m.parseLocal(tt.sql), tt.sql)
+	}
+}
@@ -0,0 +1,337 @@
+package pgfe
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/qlbridge/schema"
+	"github.com/araddon/qlbridge/value"
+)
+
+// type oids of pg_catalog.pg_type
+const (
+	oidUnknown     = 0
+	oidBool        = 16
+	oidBytea       = 17
+	oidInt8        = 20
+	oidInt2        = 21
+	oidInt4        = 23
+	oidText        = 25
+	oidJson        = 114
+	oidFloat4      = 700
+	oidFloat8      = 701
+	oidVarchar     = 1043
+	oidDate        = 1082
+	oidTimestamp   = 1114
+	oidTimestamptz = 1184
+	oidNumeric     = 1700
+)
+
+// microseconds between the unix and postgres (2000-01-01) epochs
+const pgEpochMicros = 946684800 * 1000000
+
+// pgType the oid, size and name of a postgres type
+type pgType struct {
+	oid  int
+	size int // -1 is variable length
+	name string
+}
+
+var (
+	typeBool        = pgType{oidBool, 1, "boolean"}
+	typeBytea       = pgType{oidBytea, -1, "bytea"}
+	typeInt8        = pgType{oidInt8, 8, "bigint"}
+	typeText        = pgType{oidText, -1, "text"}
+	typeJson        = pgType{oidJson, -1, "json"}
+	typeFloat8      = pgType{oidFloat8, 8, "double precision"}
+	typeTimestamptz = pgType{oidTimestamptz, 8, "timestamp with time zone"}
+)
+
+// valueTypeToPg the postgres type qlbridge values of typ are sent as
+func valueTypeToPg(typ value.ValueType) pgType {
+	switch typ {
+	case value.IntType:
+		return typeInt8
+	case value.NumberType:
+		return typeFloat8
+	case value.BoolType:
+		return typeBool
+	case value.TimeType:
+		return typeTimestamptz
+	case value.ByteSliceType:
+		return typeBytea
+	case value.JsonType, value.MapValueType, value.MapStringType, value.MapIntType,
+		value.MapNumberType, value.MapBoolType, value.MapTimeType, value.SliceValueType,
+		value.StringsType:
+		return typeJson
+	}
+	return typeText
+}
+
+// pgTypeName the postgres type name of a field, of DESCRIBE rows
+func pgTypeName(f *schema.Field) string {
+	return valueTypeToPg(f.ValueType()).name
+}
+
+// encodeText the text format of v
+func encodeText(v driver.Value) ([]byte, error) {
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(x), nil
+	case []byte:
+		return x, nil
+	case bool:
+		if x {
+			return []byte("t"), nil
+		}
+		return []byte("f"), nil
+	case int:
+		return []byte(strconv.Itoa(x)), nil
+	case int32:
+		return []byte(strconv.FormatInt(int64(x), 10)), nil
+	case int64:
+		return []byte(strconv.FormatInt(x, 10)), nil
+	case uint64:
+		return []byte(strconv.FormatUint(x, 10)), nil
+	case float32:
+		return []byte(strconv.FormatFloat(float64(x), 'g', -1, 32)), nil
+	case float64:
+		return []byte(formatFloat(x)), nil
+	case time.Time:
+		return []byte(x.UTC().Format("2006-01-02 15:04:05.999999") + "+00"), nil
+	case fmt.Stringer:
+		return []byte(x.String()), nil
+	}
+	return json.Marshal(v)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// encodeBinary the binary format of v as type typ
+func encodeBinary(typ pgType, v driver.Value) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch typ.oid {
+	case oidBool:
+		b, err := toBool(v)
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case oidInt8:
+		n, err := toInt(v)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(n))
+		return buf, nil
+	case oidFloat8:
+		f, err := toFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, math.Float64bits(f))
+		return buf, nil
+	case oidTimestamptz:
+		t, ok := v.(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("expected time for %s but got %T", typ.name, v)
+		}
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(t.UnixNano()/1000-pgEpochMicros))
+		return buf, nil
+	}
+	// bytea, text and json are the same as their text format
+	return encodeText(v)
+}
+
+func toBool(v driver.Value) (bool, error) {
+	switch x := v.(type) {
+	case bool:
+		return x, nil
+	case int64:
+		return x != 0, nil
+	case string:
+		return strconv.ParseBool(x)
+	case []byte:
+		return strconv.ParseBool(string(x))
+	}
+	return false, fmt.Errorf("could not convert %T to boolean", v)
+}
+
+func toInt(v driver.Value) (int64, error) {
+	switch x := v.(type) {
+	case int64:
+		return x, nil
+	case int:
+		return int64(x), nil
+	case int32:
+		return int64(x), nil
+	case uint64:
+		return int64(x), nil
+	case float64:
+		return int64(x), nil
+	case bool:
+		if x {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		return strconv.ParseInt(x, 10, 64)
+	case []byte:
+		return strconv.ParseInt(string(x), 10, 64)
+	}
+	return 0, fmt.Errorf("could not convert %T to bigint", v)
+}
+
+func toFloat(v driver.Value) (float64, error) {
+	switch x := v.(type) {
+	case float64:
+		return x, nil
+	case float32:
+		return float64(x), nil
+	case int64:
+		return float64(x), nil
+	case int:
+		return float64(x), nil
+	case string:
+		return strconv.ParseFloat(x, 64)
+	case []byte:
+		return strconv.ParseFloat(string(x), 64)
+	}
+	return 0, fmt.Errorf("could not convert %T to double precision", v)
+}
+
+// paramLiteral the sql literal of a bound parameter in format of type
+// oid, nil data is NULL.
+func paramLiteral(oid int, format int, data []byte) (string, error) {
+	if data == nil {
+		return "NULL", nil
+	}
+	if format == formatBinary {
+		return binaryParamLiteral(oid, data)
+	}
+	s := string(data)
+	switch oid {
+	case oidInt2, oidInt4, oidInt8:
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			return "", newError(codeInvalidTextRep, "invalid input syntax for type integer: %q", s)
+		}
+		return s, nil
+	case oidFloat4, oidFloat8, oidNumeric:
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return "", newError(codeInvalidTextRep, "invalid input syntax for type double precision: %q", s)
+		}
+		return s, nil
+	case oidBool:
+		b, err := parseBool(s)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(b), nil
+	case oidBytea:
+		if strings.HasPrefix(s, `\x`) {
+			b, err := hex.DecodeString(s[2:])
+			if err != nil {
+				return "", newError(codeInvalidTextRep, "invalid input syntax for type bytea")
+			}
+			return quoteLiteral(string(b)), nil
+		}
+	}
+	return quoteLiteral(s), nil
+}
+
+func binaryParamLiteral(oid int, data []byte) (string, error) {
+	switch oid {
+	case oidBool:
+		if len(data) != 1 {
+			return "", errMalformed
+		}
+		return strconv.FormatBool(data[0] != 0), nil
+	case oidInt2:
+		if len(data) != 2 {
+			return "", errMalformed
+		}
+		return strconv.FormatInt(int64(int16(binary.BigEndian.Uint16(data))), 10), nil
+	case oidInt4:
+		if len(data) != 4 {
+			return "", errMalformed
+		}
+		return strconv.FormatInt(int64(int32(binary.BigEndian.Uint32(data))), 10), nil
+	case oidInt8:
+		if len(data) != 8 {
+			return "", errMalformed
+		}
+		return strconv.FormatInt(int64(binary.BigEndian.Uint64(data)), 10), nil
+	case oidFloat4:
+		if len(data) != 4 {
+			return "", errMalformed
+		}
+		return strconv.FormatFloat(float64(math.Float32frombits(binary.BigEndian.Uint32(data))), 'g', -1, 32), nil
+	case oidFloat8:
+		if len(data) != 8 {
+			return "", errMalformed
+		}
+		return strconv.FormatFloat(math.Float64frombits(binary.BigEndian.Uint64(data)), 'g', -1, 64), nil
+	case oidTimestamp, oidTimestamptz:
+		if len(data) != 8 {
+			return "", errMalformed
+		}
+		micros := int64(binary.BigEndian.Uint64(data)) + pgEpochMicros
+		t := time.Unix(micros/1000000, (micros%1000000)*1000).UTC()
+		return quoteLiteral(t.Format("2006-01-02 15:04:05.999999")), nil
+	case oidDate:
+		if len(data) != 4 {
+			return "", errMalformed
+		}
+		days := int64(int32(binary.BigEndian.Uint32(data)))
+		t := time.Unix(pgEpochMicros/1000000+days*86400, 0).UTC()
+		return quoteLiteral(t.Format("2006-01-02")), nil
+	case oidText, oidVarchar, oidJson, oidBytea, oidUnknown:
+		return quoteLiteral(string(data)), nil
+	}
+	return "", newError(codeFeatureNotSupported, "binary format of parameter type %d is not supported", oid)
+}
+
+// parseBool the postgres boolean input forms
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "t", "true", "y", "yes", "on", "1":
+		return true, nil
+	case "f", "false", "n", "no", "off", "0":
+		return false, nil
+	}
+	return false, newError(codeInvalidTextRep, "invalid input syntax for type boolean: %q", s)
+}
+
+// quoteLiteral a string literal as the qlbridge parser expects it
+func quoteLiteral(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `'`, `\'`, -1)
+	return "'" + s + "'"
+}
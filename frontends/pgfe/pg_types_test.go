@@ -0,0 +1,62 @@
+package pgfe
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParamLiteral(t *testing.T) {
+
+	tests := []struct {
+		oid    int
+		format int
+		data   []byte
+		lit    string
+	}{
+		{oidText, formatText, nil, "NULL"},
+		{oidText, formatText, []byte("it's"), `'it\'s'`},
+		{oidInt4, formatText, []byte("42"), "42"},
+		{oidBool, formatText, []byte("t"), "true"},
+		{oidUnknown, formatText, []byte("-1.5"), "'-1.5'"},
+		{oidUnknown, formatText, []byte("01234"), "'01234'"},
+		{oidUnknown, formatText, []byte("NaN"), "'NaN'"},
+		{oidBytea, formatText, []byte(`\x6869`), "'hi'"},
+		{oidInt4, formatBinary, []byte{0xff, 0xff, 0xff, 0xfe}, "-2"},
+		{oidBool, formatBinary, []byte{1}, "true"},
+		{oidTimestamptz, formatBinary, []byte{0, 0, 0, 0, 0, 0, 0, 0}, "'2000-01-01 00:00:00'"},
+	}
+	for _, tt := range tests {
+		lit, err := paramLiteral(tt.oid, tt.format, tt.data)
+		assert.Equal(t, nil, err, string(tt.data))
+		assert.Equal(t, tt.lit, lit, string(tt.data))
+	}
+
+	_, err := paramLiteral(oidInt8, formatText, []byte("abc"))
+	assert.NotEqual(t, nil, err)
+	_, err = paramLiteral(oidInt8, formatBinary, []byte{1, 2})
+	assert.Equal(t, errMalformed, err)
+}
+
+func TestEncode(t *testing.T) {
+
+	ts := time.Date(2017, 3, 4, 5, 6, 7, 8000, time.FixedZone("x", 3600))
+	b, _ := encodeText(ts)
+	assert.Equal(t, "2017-03-04 04:06:07.000008+00", string(b))
+	b, _ = encodeText(true)
+	assert.Equal(t, "t", string(b))
+	b, _ = encodeText(1.5)
+	assert.Equal(t, "1.5", string(b))
+	b, _ = encodeText(map[string]interface{}{"a": 1})
+	assert.Equal(t, `{"a":1}`, string(b))
+
+	b, err := encodeBinary(typeInt8, int64(-2))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(-2), int64(binary.BigEndian.Uint64(b)))
+	b, _ = encodeBinary(typeTimestamptz, time.Date(2000, 1, 1, 0, 0, 1, 0, time.UTC))
+	assert.Equal(t, uint64(1000000), binary.BigEndian.Uint64(b))
+	b, _ = encodeBinary(typeText, "abc")
+	assert.Equal(t, "abc", string(b))
+}
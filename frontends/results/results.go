@@ -0,0 +1,179 @@
+// Package results holds the final tasks and the run loop of jobs shared
+// by the frontends, which each write the rows in their own protocol.
+package results
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+
+	u "github.com/araddon/gou"
+
+	"github.com/araddon/qlbridge/datasource"
+	"github.com/araddon/qlbridge/exec"
+	"github.com/araddon/qlbridge/plan"
+	"github.com/araddon/qlbridge/rel"
+	"github.com/araddon/qlbridge/schema"
+)
+
+var (
+	_ exec.TaskRunner = (*RowWriter)(nil)
+	_ exec.TaskRunner = (*ExecWriter)(nil)
+)
+
+// RowWriter the final task of a job returning rows, each row is passed
+// to the row func as it arrives.
+type RowWriter struct {
+	*exec.TaskBase
+	// TypeName the type of a field in the rows of a DESCRIBE, its
+	// qlbridge value type if nil
+	TypeName func(f *schema.Field) string
+	Rows     int64 // rows written
+	Err      error // error of the row func, that stopped the job
+	proj     *rel.Projection
+	row      func([]driver.Value) error
+}
+
+func NewRowWriter(ctx *plan.Context, row func([]driver.Value) error) *RowWriter {
+	m := &RowWriter{row: row}
+	if ctx.Projection != nil {
+		m.proj = ctx.Projection.Proj
+	}
+	m.TaskBase = exec.NewTaskBase(ctx)
+	return m
+}
+
+func (m *RowWriter) Run() error {
+	defer m.Ctx.Recover()
+	inCh := m.MessageIn()
+
+	for {
+		select {
+		case <-m.SigChan():
+			return nil
+		case msg, ok := <-inCh:
+			if !ok || msg == nil {
+				return nil
+			}
+			if err := m.write(msg); err != nil {
+				u.Warnf("could not write to client %v", err)
+				m.Err = err
+				return err
+			}
+		}
+	}
+}
+
+func (m *RowWriter) write(msg schema.Message) error {
+
+	var vals []driver.Value
+	switch mt := msg.Body().(type) {
+	case *schema.Field:
+		// Got a single field, one field = row
+		typ := mt.ValueType().String()
+		if m.TypeName != nil {
+			typ = m.TypeName(mt)
+		}
+		vals = FieldDescribe(m.proj, mt, typ)
+	case *datasource.SqlDriverMessageMap:
+		if m.proj == nil || len(mt.Vals) == len(m.proj.Columns) {
+			vals = mt.Values()
+			break
+		}
+		// sparse rows are zero filled
+		vals = make([]driver.Value, len(m.proj.Columns))
+		for _, col := range m.proj.Columns {
+			idx, ok := mt.ColIndex[col.As]
+			if ok && len(mt.Vals) > idx {
+				vals[col.ColPos] = mt.Vals[idx]
+			}
+		}
+	case map[string]driver.Value:
+		if m.proj == nil {
+			return fmt.Errorf("no projection for row")
+		}
+		vals = make([]driver.Value, len(m.proj.Columns))
+		for _, col := range m.proj.Columns {
+			vals[col.ColPos] = mt[col.As]
+		}
+	case []driver.Value:
+		vals = mt
+	default:
+		u.Warnf("%T not supported", mt)
+		return nil
+	}
+	m.Rows++
+	return m.row(vals)
+}
+
+func (m *RowWriter) Finalize() error {
+	return nil
+}
+
+// FieldDescribe the DESCRIBE row of field f, whose type is typ in the
+// dialect of the frontend.
+func FieldDescribe(proj *rel.Projection, f *schema.Field, typ string) []driver.Value {
+
+	null := "YES"
+	if f.NoNulls {
+		null = "NO"
+	}
+	if proj != nil && len(proj.Columns) == 6 {
+		//[]string{"Field", "Type",  "Null", "Key", "Default", "Extra"}
+		return []driver.Value{f.Name, typ, null, f.Key, string(f.DefVal), f.Description}
+	}
+	privileges := ""
+	if len(f.Roles) > 0 {
+		privileges = fmt.Sprintf("{%s}", strings.Join(f.Roles, ", "))
+	}
+	//[]string{"Field", "Type", "Collation", "Null", "Key", "Default", "Extra", "Privileges", "Comment"}
+	return []driver.Value{f.Name, typ, "", null, f.Key, string(f.DefVal), f.Extra, privileges, f.Description}
+}
+
+// ExecWriter the final task of an insert, update or delete job, counts
+// the affected rows.
+type ExecWriter struct {
+	*exec.TaskBase
+	Affected int64
+	Err      error // error the source reported instead of a count
+}
+
+func NewExecWriter(ctx *plan.Context) *ExecWriter {
+	m := &ExecWriter{}
+	m.TaskBase = exec.NewTaskBase(ctx)
+	m.Handler = m.resultWriter()
+	return m
+}
+
+func (m *ExecWriter) Finalize() error {
+	return nil
+}
+
+func (m *ExecWriter) resultWriter() exec.MessageHandler {
+	return func(_ *plan.Context, msg schema.Message) bool {
+
+		var vals []driver.Value
+		switch mt := msg.Body().(type) {
+		case *datasource.SqlDriverMessageMap:
+			vals = mt.Values()
+		case []driver.Value:
+			vals = mt
+		default:
+			u.Warnf("%T not supported", mt)
+			return false
+		}
+		if len(vals) == 2 {
+			switch rt := vals[0].(type) {
+			case string: // error
+				m.Err = errors.New(rt)
+			default:
+				if affectedCt, isInt := vals[1].(int64); isInt {
+					m.Affected = affectedCt
+				}
+			}
+			return true
+		}
+		return false
+	}
+}
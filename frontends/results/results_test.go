@@ -0,0 +1,53 @@
+package results
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/araddon/qlbridge/datasource"
+	"github.com/araddon/qlbridge/plan"
+	"github.com/araddon/qlbridge/rel"
+	"github.com/araddon/qlbridge/schema"
+	"github.com/araddon/qlbridge/value"
+)
+
+func TestFieldDescribe(t *testing.T) {
+	f := schema.NewFieldBase("name", value.StringType, 255, "user name")
+	f.NoNulls = true
+
+	proj := rel.NewProjection()
+	for _, col := range []string{"Field", "Type", "Null", "Key", "Default", "Extra"} {
+		proj.AddColumnShort(col, value.StringType)
+	}
+	vals := FieldDescribe(proj, f, "varchar(255)")
+	assert.Equal(t, []driver.Value{"name", "varchar(255)", "NO", "", "", "user name"}, vals)
+
+	// full columns, ie SHOW FULL COLUMNS
+	f.Roles = []string{"select", "insert"}
+	vals = FieldDescribe(nil, f, "varchar(255)")
+	assert.Equal(t, 9, len(vals))
+	assert.Equal(t, "{select, insert}", vals[7])
+}
+
+func TestRowWriterSparse(t *testing.T) {
+	ctx := plan.NewContext("SELECT a, b FROM t")
+	proj := rel.NewProjection()
+	proj.AddColumnShort("a", value.IntType)
+	proj.AddColumnShort("b", value.StringType)
+	ctx.Projection = plan.NewProjectionStatic(proj)
+
+	var rows [][]driver.Value
+	rw := NewRowWriter(ctx, func(vals []driver.Value) error {
+		rows = append(rows, vals)
+		return nil
+	})
+
+	// b is missing from the row, it is zero filled
+	msg := datasource.NewSqlDriverMessageMap(1, []driver.Value{int64(1)}, map[string]int{"a": 0})
+	assert.Equal(t, nil, rw.write(msg))
+	assert.Equal(t, nil, rw.write(datasource.NewSqlDriverMessageMap(2, []driver.Value{int64(2), "x"}, map[string]int{"a": 0, "b": 1})))
+	assert.Equal(t, int64(2), rw.Rows)
+	assert.Equal(t, [][]driver.Value{{int64(1), nil}, {int64(2), "x"}}, rows)
+}
@@ -0,0 +1,51 @@
+package results
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dataux/dataux/planner"
+)
+
+var (
+	// ErrDeadlineExceeded a job ran longer than its timeout
+	ErrDeadlineExceeded = errors.New("query exceeded max_execution_time")
+	// ErrCancelled a job was cancelled, by its context or a kill
+	ErrCancelled = errors.New("query was cancelled")
+)
+
+// RunWithDeadline runs a finalized job, cancelling it when ctx is done
+// ie the client went away, or after timeout if it is not 0.  A cancelled
+// job returns ErrDeadlineExceeded or ErrCancelled which frontends report
+// in their protocol.  The job is not closed.
+func RunWithDeadline(job *planner.GridTask, ctx context.Context, timeout time.Duration) error {
+
+	var runCtx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		runCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+		case <-runCtx.Done():
+			job.Cancel()
+		}
+	}()
+
+	err := job.Run()
+	close(done)
+	if job.Cancelled() {
+		if runCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			return ErrDeadlineExceeded
+		}
+		return ErrCancelled
+	}
+	return err
+}
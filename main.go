@@ -28,7 +28,11 @@ import (
 	_ "google.golang.org/grpc"
 
 	// Frontend's side-effect imports
+	_ "github.com/dataux/dataux/frontends/flightfe"
+	_ "github.com/dataux/dataux/frontends/httpfe"
+	_ "github.com/dataux/dataux/frontends/mongofe"
 	_ "github.com/dataux/dataux/frontends/mysqlfe"
+	_ "github.com/dataux/dataux/frontends/pgfe"
 
 	u "github.com/araddon/gou"
 	"github.com/dataux/dataux/proxy"
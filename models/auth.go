@@ -0,0 +1,134 @@
+package models
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrUserNotFound is returned by an Authenticator for unknown users
+	ErrUserNotFound = errors.New("user not found")
+
+	// Ensure we meet our interfaces
+	_ Authenticator = (*configAuthenticator)(nil)
+	_ Authenticator = (*listenerAuthenticator)(nil)
+)
+
+// Authenticator looks up the accounts allowed to connect to frontends.
+// The default is built from the users block of config, to load accounts
+// from elsewhere assign ServerCtx.Auth before listeners are started.
+type Authenticator interface {
+	// User finds the account for name, ErrUserNotFound if there is none
+	User(name string) (*UserConfig, error)
+}
+
+// configAuthenticator is an Authenticator of the users in config
+type configAuthenticator struct {
+	users map[string]*UserConfig
+}
+
+// NewConfigAuthenticator create an Authenticator for a list of users,
+// validating names are unique and password hashes are well formed.
+func NewConfigAuthenticator(users []*UserConfig) (Authenticator, error) {
+	m := &configAuthenticator{users: make(map[string]*UserConfig, len(users))}
+	for _, user := range users {
+		if user.Name == "" {
+			return nil, fmt.Errorf("user must have a name")
+		}
+		if _, exists := m.users[user.Name]; exists {
+			return nil, fmt.Errorf("duplicate user %q", user.Name)
+		}
+		if _, err := user.NativePasswordHash(); err != nil {
+			return nil, err
+		}
+		m.users[user.Name] = user
+	}
+	return m, nil
+}
+
+func (m *configAuthenticator) User(name string) (*UserConfig, error) {
+	if user, ok := m.users[name]; ok {
+		return user, nil
+	}
+	return nil, ErrUserNotFound
+}
+
+// listenerAuthenticator limits an Authenticator to the users allowed to
+// connect to a single listener
+type listenerAuthenticator struct {
+	auth  Authenticator
+	users []string
+}
+
+// NewListenerAuthenticator an Authenticator of only the named users of
+// auth, for listeners with their own users allow list.
+func NewListenerAuthenticator(auth Authenticator, users []string) Authenticator {
+	return &listenerAuthenticator{auth: auth, users: users}
+}
+
+func (m *listenerAuthenticator) User(name string) (*UserConfig, error) {
+	if !allowed(m.users, name) {
+		return nil, ErrUserNotFound
+	}
+	return m.auth.User(name)
+}
+
+// NativePasswordHash the mysql_native_password hash SHA1(SHA1(password))
+// of this users password, nil if user has no password.
+func (m *UserConfig) NativePasswordHash() ([]byte, error) {
+	if m.PasswordHash != "" {
+		h := strings.TrimPrefix(m.PasswordHash, "*")
+		hash, err := hex.DecodeString(h)
+		if err != nil || len(hash) != sha1.Size {
+			return nil, fmt.Errorf("invalid password_hash for user %q, expected \"*\" followed by 40 hex chars", m.Name)
+		}
+		return hash, nil
+	}
+	if m.Password == "" {
+		return nil, nil
+	}
+	stage1 := sha1.Sum([]byte(m.Password))
+	hash := sha1.Sum(stage1[:])
+	return hash[:], nil
+}
+
+// CheckPassword is password, sent in clear text by protocols without a
+// challenge, this users password.  Users without one accept any.
+func (m *UserConfig) CheckPassword(password string) bool {
+	hash, err := m.NativePasswordHash()
+	if err != nil {
+		return false
+	}
+	if len(hash) == 0 {
+		return true
+	}
+	stage1 := sha1.Sum([]byte(password))
+	check := sha1.Sum(stage1[:])
+	return subtle.ConstantTimeCompare(check[:], hash) == 1
+}
+
+// AllowSchema is this user allowed to use the named schema
+func (m *UserConfig) AllowSchema(name string) bool {
+	return allowed(m.Schemas, name)
+}
+
+// AllowSource is this user allowed to query the named source
+func (m *UserConfig) AllowSource(name string) bool {
+	return allowed(m.Sources, name)
+}
+
+func allowed(allow []string, name string) bool {
+	if len(allow) == 0 {
+		return true
+	}
+	for _, n := range allow {
+		if n == "*" || strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
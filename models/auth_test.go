@@ -0,0 +1,127 @@
+package models
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/araddon/qlbridge/datasource"
+	"github.com/araddon/qlbridge/plan"
+	"github.com/araddon/qlbridge/value"
+)
+
+func TestConfigAuthenticator(t *testing.T) {
+
+	var configData = `
+users : [
+  {
+    name     : analyst
+    password : "secret"
+    schemas  : [ "datauxtest" ]
+  },
+  {
+    # SELECT PASSWORD('secret')
+    name          : service
+    password_hash : "*14E65567ABDB5135D0CFD9A70B3032C179A49EE7"
+    sources       : [ "es_test" ]
+  },
+  {
+    name    : admin
+  }
+]
+`
+	conf, err := LoadConfig(configData)
+	assert.True(t, err == nil && conf != nil, "Must not error on parse of config: %v", err)
+	assert.Equal(t, 3, len(conf.Users))
+
+	auth, err := NewConfigAuthenticator(conf.Users)
+	assert.Equal(t, nil, err)
+
+	analyst, err := auth.User("analyst")
+	assert.Equal(t, nil, err)
+	service, err := auth.User("service")
+	assert.Equal(t, nil, err)
+	admin, err := auth.User("admin")
+	assert.Equal(t, nil, err)
+	_, err = auth.User("nobody")
+	assert.Equal(t, ErrUserNotFound, err)
+
+	// the plain text and hashed password are the same
+	h1, err := analyst.NativePasswordHash()
+	assert.Equal(t, nil, err)
+	h2, err := service.NativePasswordHash()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, h1, h2)
+	assert.Equal(t, "14E65567ABDB5135D0CFD9A70B3032C179A49EE7", strings.ToUpper(hex.EncodeToString(h1)))
+	h3, err := admin.NativePasswordHash()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(h3))
+
+	assert.True(t, analyst.CheckPassword("secret"))
+	assert.True(t, service.CheckPassword("secret"))
+	assert.True(t, !service.CheckPassword("Secret"))
+	assert.True(t, admin.CheckPassword("anything"))
+
+	assert.True(t, analyst.AllowSchema("datauxtest"))
+	assert.True(t, !analyst.AllowSchema("other"))
+	assert.True(t, analyst.AllowSource("anything"))
+	assert.True(t, service.AllowSchema("anything"))
+	assert.True(t, service.AllowSource("ES_TEST"))
+	assert.True(t, !service.AllowSource("mgo_datauxtest"))
+
+	_, err = NewConfigAuthenticator([]*UserConfig{{Name: "bad", PasswordHash: "*abc"}})
+	assert.NotEqual(t, nil, err)
+	_, err = NewConfigAuthenticator([]*UserConfig{{Name: "dupe"}, {Name: "dupe"}})
+	assert.NotEqual(t, nil, err)
+}
+
+func TestListenerAuthenticator(t *testing.T) {
+	auth, err := NewConfigAuthenticator([]*UserConfig{{Name: "analyst"}, {Name: "service"}})
+	assert.Equal(t, nil, err)
+
+	public := NewListenerAuthenticator(auth, []string{"analyst"})
+	user, err := public.User("analyst")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "analyst", user.Name)
+	_, err = public.User("service")
+	assert.Equal(t, ErrUserNotFound, err)
+
+	internal := NewListenerAuthenticator(auth, []string{"*"})
+	_, err = internal.User("service")
+	assert.Equal(t, nil, err)
+	_, err = internal.User("nobody")
+	assert.Equal(t, ErrUserNotFound, err)
+}
+
+func TestStatementUser(t *testing.T) {
+	svr := &ServerCtx{}
+	ctx := &plan.Context{}
+	user, err := svr.StatementUser(ctx)
+	assert.Equal(t, nil, err)
+	assert.True(t, user == nil, "no authenticator allows all")
+
+	auth, err := NewConfigAuthenticator([]*UserConfig{{Name: "analyst", Schemas: []string{"datauxtest"}}})
+	assert.Equal(t, nil, err)
+	svr.Auth = auth
+	_, err = svr.StatementUser(ctx)
+	assert.Equal(t, ErrUserNotFound, err)
+
+	analyst, err := auth.User("analyst")
+	assert.Equal(t, nil, err)
+	release := BindUser(ctx, analyst)
+	// the session can't change whose grants apply
+	sess := datasource.NewContextSimple()
+	sess.Data["@@user"] = value.NewStringValue("admin")
+	ctx.Session = sess
+	user, err = svr.StatementUser(ctx)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "analyst", user.Name)
+	assert.False(t, user.AllowSchema("mysql"))
+
+	release()
+	release()
+	_, err = svr.StatementUser(ctx)
+	assert.Equal(t, ErrUserNotFound, err)
+}
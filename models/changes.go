@@ -0,0 +1,12 @@
+package models
+
+// ChangeNotifier is implemented by the schema.Source of a backend that
+// knows when its data changes, ie from a change stream or binlog.
+// Changefeed frontends re-run a query when one of its tables changes
+// rather than only on their polling interval.
+type ChangeNotifier interface {
+	// NotifyChanges sends on ch each time table may have changed, until
+	// stop is closed.  Sends must not block, a pending notification
+	// covers later changes.
+	NotifyChanges(table string, ch chan<- struct{}, stop <-chan struct{}) error
+}
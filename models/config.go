@@ -38,22 +38,41 @@ type (
 	// 3) Schemas:  n number of sources can create a "Virtual Schema"
 	// 4) etcd coordinators hosts
 	Config struct {
-		SupressRecover bool                   `json:"supress_recover"` // do we recover?
-		WorkerCt       int                    `json:"worker_ct"`       // 4 how many worker nodes on this instance
-		LogLevel       string                 `json:"log_level"`       // [debug,info,error,]
-		Etcd           []string               `json:"etcd"`            // list of etcd servers http://127.0.0.1:2379,http://127.0.0.1:2380
-		Frontends      []*ListenerConfig      `json:"frontends"`       // tcp listener configs
-		Sources        []*schema.ConfigSource `json:"sources"`         // backend servers/sources (es, mysql etc)
-		Schemas        []*schema.ConfigSchema `json:"schemas"`         // Schemas, each backend has 1 schema
-		Rules          *RulesConfig           `json:"rules"`           // rules for routing
+		SupressRecover bool                   `json:"supress_recover"`    // do we recover?
+		WorkerCt       int                    `json:"worker_ct"`          // 4 how many worker nodes on this instance
+		LogLevel       string                 `json:"log_level"`          // [debug,info,error,]
+		Etcd           []string               `json:"etcd"`               // list of etcd servers http://127.0.0.1:2379,http://127.0.0.1:2380
+		Frontends      []*ListenerConfig      `json:"frontends"`          // tcp listener configs
+		Sources        []*schema.ConfigSource `json:"sources"`            // backend servers/sources (es, mysql etc)
+		Schemas        []*schema.ConfigSchema `json:"schemas"`            // Schemas, each backend has 1 schema
+		Rules          *RulesConfig           `json:"rules"`              // rules for routing
+		Users          []*UserConfig          `json:"users"`              // accounts allowed to connect to frontends
+		MaxExecTime    int64                  `json:"max_execution_time"` // default max ms a SELECT may run, 0 is no limit
 	}
 	// ListenerConfig Frontend Listener to listen for inbound
 	// traffic on specific protocol aka transport (mysql)
 	ListenerConfig struct {
-		Type     string `json:"type"`     // named protocol type [mysql,mongo,mc,postgres,etc]
-		Addr     string `json:"address"`  // net.Conn compatible ip/dns address
-		User     string `json:"user"`     // user to talk to backend with
-		Password string `json:"password"` // optional pwd for backend
+		Type          string   `json:"type"`            // named protocol type [mysql,mongo,mc,postgres,etc]
+		Addr          string   `json:"address"`         // net.Conn compatible ip/dns address, or unix socket path
+		SocketMode    string   `json:"socket_mode"`     // octal permissions of a unix socket, default 0666
+		Users         []string `json:"users"`           // users allowed to connect to this listener, empty or "*" is all
+		User          string   `json:"user"`            // user to talk to backend with
+		Password      string   `json:"password"`        // optional pwd for backend
+		TLSCert       string   `json:"tls_cert"`        // pem cert file, enables tls
+		TLSKey        string   `json:"tls_key"`         // pem key file of tls_cert
+		TLSCA         string   `json:"tls_ca"`          // optional pem CA file to verify client certs
+		TLSRequire    bool     `json:"tls_require"`     // reject clients that don't use tls or a unix socket
+		TLSClientCert bool     `json:"tls_client_cert"` // require a client cert signed by tls_ca
+	}
+	// UserConfig an account allowed to connect to frontends, with
+	// optional allow lists of the schemas and sources it may use
+	UserConfig struct {
+		Name         string   `json:"name"`          // user name
+		Password     string   `json:"password"`      // plain text password, or
+		PasswordHash string   `json:"password_hash"` // mysql native hash ie SELECT PASSWORD('pwd') "*2470C0C0..."
+		Schemas      []string `json:"schemas"`       // schemas user may use, empty or "*" is all
+		Sources      []string `json:"sources"`       // sources user may query, empty or "*" is all
+		Admin        bool     `json:"admin"`         // may see and kill other users connections
 	}
 	// RulesConfig
 	RulesConfig struct {
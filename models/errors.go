@@ -0,0 +1,175 @@
+package models
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/araddon/qlbridge/rel"
+	"github.com/araddon/qlbridge/schema"
+)
+
+// ErrorKind the kind of failure of a statement, frontends map it to an
+// error of their protocol, ie a mysql error number and sqlstate.
+type ErrorKind uint8
+
+const (
+	// ErrUnknown an error of no known kind
+	ErrUnknown ErrorKind = iota
+	// ErrNotFound a table, schema or column does not exist
+	ErrNotFound
+	// ErrUnavailable the backend could not be reached
+	ErrUnavailable
+	// ErrTimeout the backend did not answer in time
+	ErrTimeout
+	// ErrUnsupported the statement uses a feature the backend can't run
+	ErrUnsupported
+	// ErrDenied the backend refused the operation or our credentials
+	ErrDenied
+	// ErrSyntax the statement could not be parsed or translated
+	ErrSyntax
+)
+
+var errorKindNames = map[ErrorKind]string{
+	ErrUnknown:     "unknown",
+	ErrNotFound:    "not found",
+	ErrUnavailable: "unavailable",
+	ErrTimeout:     "timeout",
+	ErrUnsupported: "unsupported",
+	ErrDenied:      "denied",
+	ErrSyntax:      "syntax",
+}
+
+func (m ErrorKind) String() string {
+	return errorKindNames[m]
+}
+
+// ErrorObject the kind of object an ErrNotFound error is missing
+type ErrorObject uint8
+
+const (
+	// ObjectUnknown a missing object of unknown kind, reported as a table
+	ObjectUnknown ErrorObject = iota
+	// ObjectSchema a missing schema (database)
+	ObjectSchema
+	// ObjectTable a missing table
+	ObjectTable
+	// ObjectColumn a missing column
+	ObjectColumn
+)
+
+// Error an error of a known kind, returned by backends so frontends can
+// tell a missing table from an unreachable backend.
+type Error struct {
+	Kind   ErrorKind
+	Object ErrorObject // of ErrNotFound, the kind of object missing
+	Msg    string
+	Err    error // cause, may be nil
+}
+
+// NewError an error of kind
+func NewError(kind ErrorKind, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+// NotFoundError an ErrNotFound error of a missing object
+func NotFoundError(object ErrorObject, format string, args ...interface{}) error {
+	return &Error{Kind: ErrNotFound, Object: object, Msg: fmt.Sprintf(format, args...)}
+}
+
+// WrapNotFound err as an ErrNotFound error of a missing object, nil if
+// err is nil.  Errors that already have a kind keep it.
+func WrapNotFound(object ErrorObject, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	return &Error{Kind: ErrNotFound, Object: object, Err: err}
+}
+
+// WrapError err as an error of kind, nil if err is nil.  Errors that
+// already have a kind keep it.
+func WrapError(kind ErrorKind, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// NetError the error of a request to a backend that failed in transport,
+// of kind ErrTimeout for timeouts else ErrUnavailable.  Other errors are
+// returned as is.
+func NetError(err error) error {
+	ne, ok := err.(net.Error)
+	if !ok {
+		return err
+	}
+	if ne.Timeout() {
+		return &Error{Kind: ErrTimeout, Err: err}
+	}
+	return &Error{Kind: ErrUnavailable, Err: err}
+}
+
+func (m *Error) Error() string {
+	switch {
+	case m.Msg != "":
+		return m.Msg
+	case m.Err != nil:
+		return m.Err.Error()
+	}
+	return m.Kind.String()
+}
+
+// Unwrap the cause of the error
+func (m *Error) Unwrap() error {
+	return m.Err
+}
+
+// ErrorKindOf the kind of err.  Parse errors of the planner are
+// ErrSyntax and schema.ErrNotFound is ErrNotFound.
+func ErrorKindOf(err error) ErrorKind {
+	for err != nil {
+		switch e := err.(type) {
+		case *Error:
+			return e.Kind
+		case *rel.ParseError:
+			return ErrSyntax
+		}
+		if err == schema.ErrNotFound {
+			return ErrNotFound
+		}
+		wrapped, ok := err.(interface {
+			Unwrap() error
+		})
+		if !ok {
+			break
+		}
+		err = wrapped.Unwrap()
+	}
+	return ErrUnknown
+}
+
+// ErrorObjectOf the kind of object a not found err is missing,
+// ObjectUnknown if it is not an ErrNotFound error or doesn't say.
+func ErrorObjectOf(err error) ErrorObject {
+	for err != nil {
+		if e, ok := err.(*Error); ok {
+			if e.Kind != ErrNotFound {
+				return ObjectUnknown
+			}
+			return e.Object
+		}
+		wrapped, ok := err.(interface {
+			Unwrap() error
+		})
+		if !ok {
+			break
+		}
+		err = wrapped.Unwrap()
+	}
+	return ObjectUnknown
+}
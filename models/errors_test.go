@@ -0,0 +1,81 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/araddon/qlbridge/schema"
+)
+
+type testNetError struct {
+	timeout bool
+}
+
+func (m *testNetError) Error() string   { return "dial tcp: connection refused" }
+func (m *testNetError) Timeout() bool   { return m.timeout }
+func (m *testNetError) Temporary() bool { return false }
+
+type testWrapped struct {
+	err error
+}
+
+func (m *testWrapped) Error() string { return "wrapped: " + m.err.Error() }
+func (m *testWrapped) Unwrap() error { return m.err }
+
+func TestErrorKindOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind ErrorKind
+	}{
+		{nil, ErrUnknown},
+		{fmt.Errorf("nope"), ErrUnknown},
+		{NewError(ErrNotFound, "Could not find '%v'.'%v' schema", "db", "tbl"), ErrNotFound},
+		{schema.ErrNotFound, ErrNotFound},
+		{&testWrapped{NewError(ErrDenied, "no")}, ErrDenied},
+		{&testWrapped{schema.ErrNotFound}, ErrNotFound},
+		{NetError(&testNetError{}), ErrUnavailable},
+		{NetError(&testNetError{timeout: true}), ErrTimeout},
+	}
+	for i, tt := range tests {
+		assert.Equal(t, tt.kind, ErrorKindOf(tt.err), "test %d %v", i, tt.err)
+	}
+}
+
+func TestWrapError(t *testing.T) {
+	assert.Equal(t, nil, WrapError(ErrTimeout, nil))
+
+	cause := fmt.Errorf("backend went away")
+	err := WrapError(ErrUnavailable, cause)
+	assert.Equal(t, "backend went away", err.Error())
+	assert.Equal(t, cause, err.(*Error).Unwrap())
+
+	// keeps the kind it already has
+	err = WrapError(ErrTimeout, NewError(ErrSyntax, "bad"))
+	assert.Equal(t, ErrSyntax, ErrorKindOf(err))
+	assert.Equal(t, "bad", err.Error())
+
+	// not a net error, returned as is
+	assert.Equal(t, cause, NetError(cause))
+
+	assert.Equal(t, "timeout", (&Error{Kind: ErrTimeout}).Error())
+}
+
+func TestErrorObjectOf(t *testing.T) {
+	err := NotFoundError(ObjectSchema, "Unknown database '%s'", "db")
+	assert.Equal(t, ErrNotFound, ErrorKindOf(err))
+	assert.Equal(t, ObjectSchema, ErrorObjectOf(err))
+	assert.Equal(t, "Unknown database 'db'", err.Error())
+
+	cause := fmt.Errorf("Undefined column name x")
+	err = WrapNotFound(ObjectColumn, cause)
+	assert.Equal(t, ObjectColumn, ErrorObjectOf(&testWrapped{err}))
+	assert.Equal(t, cause, err.(*Error).Unwrap())
+	assert.Equal(t, nil, WrapNotFound(ObjectTable, nil))
+
+	assert.Equal(t, ObjectUnknown, ErrorObjectOf(schema.ErrNotFound))
+	assert.Equal(t, ObjectUnknown, ErrorObjectOf(NewError(ErrNotFound, "gone")))
+	assert.Equal(t, ObjectUnknown, ErrorObjectOf(&Error{Kind: ErrDenied, Object: ObjectTable}))
+	assert.Equal(t, ObjectUnknown, ErrorObjectOf(nil))
+}
@@ -0,0 +1,11 @@
+package models
+
+// Explainer is implemented by the schema.Conn of a backend that pushes
+// down a select as a native request.  After the conn has planned its
+// source it describes that request for EXPLAIN, it must not call the
+// backend.
+type Explainer interface {
+	// Explain the native request, ie an elasticsearch json body or cql
+	// text, and the clauses the conn poly-fills locally on its result.
+	Explain() (native interface{}, polyFill []string, err error)
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"github.com/araddon/qlbridge/plan"
+	"github.com/araddon/qlbridge/rel"
+)
+
+// DeniedTable the first table of a planned statement whose source this
+// user is not allowed to query, "" if all are allowed.  Users without an
+// allow list of sources are allowed all, as is the virtual
+// information_schema.
+func (m *UserConfig) DeniedTable(ctx *plan.Context) string {
+
+	if len(m.Sources) == 0 || ctx.Schema == nil || ctx.Schema.Name == "information_schema" {
+		return ""
+	}
+
+	var tables []string
+	switch stmt := ctx.Stmt.(type) {
+	case *rel.SqlSelect:
+		tables = SelectTables(stmt, nil)
+	case *rel.SqlInsert:
+		tables = []string{stmt.Table}
+	case *rel.SqlUpsert:
+		tables = []string{stmt.Table}
+	case *rel.SqlUpdate:
+		tables = []string{stmt.Table}
+	case *rel.SqlDelete:
+		tables = []string{stmt.Table}
+	}
+
+	for _, table := range tables {
+		ss, err := ctx.Schema.SchemaForTable(table)
+		if err != nil || ss == nil {
+			// unknown tables are an error for the planner, not us
+			continue
+		}
+		if !m.AllowSource(ss.Name) {
+			return table
+		}
+	}
+	return ""
+}
+
+// SelectTables the names of tables of stmt, those of its from clause and
+// joins and of every sub-query, in FROM or as the WHERE x IN (SELECT ..)
+// source.  The parser has no sub-query expression so the select list,
+// JOIN ON and HAVING can't hold one.
+func SelectTables(stmt *rel.SqlSelect, tables []string) []string {
+	for _, from := range stmt.From {
+		if from.SubQuery != nil {
+			tables = SelectTables(from.SubQuery, tables)
+			continue
+		}
+		if from.Name != "" {
+			tables = append(tables, from.Name)
+		}
+	}
+	if stmt.Where != nil && stmt.Where.Source != nil {
+		tables = SelectTables(stmt.Where.Source, tables)
+	}
+	return tables
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/araddon/qlbridge/rel"
+)
+
+func TestSelectTables(t *testing.T) {
+	tests := []struct {
+		sql    string
+		tables []string
+	}{
+		{"SELECT a FROM article", []string{"article"}},
+		{"SELECT a.title, u.name FROM article AS a INNER JOIN users AS u ON a.author = u.name", []string{"article", "users"}},
+		{"SELECT title FROM article WHERE author IN (SELECT name FROM users WHERE org = 'x')", []string{"article", "users"}},
+	}
+	for _, tt := range tests {
+		stmt, err := rel.ParseSql(tt.sql)
+		assert.Equal(t, nil, err, tt.sql)
+		sel, ok := stmt.(*rel.SqlSelect)
+		assert.True(t, ok, tt.sql)
+		assert.Equal(t, tt.tables, SelectTables(sel, nil), tt.sql)
+	}
+}
@@ -10,7 +10,7 @@ import (
 
 var (
 	listenerMu sync.Mutex
-	listeners  = make(map[string]Listener)
+	listeners  = make(map[string]ListenerFactory)
 )
 
 type ResultWriter interface {
@@ -31,6 +31,11 @@ type Listener interface {
 	Close() error
 }
 
+// ListenerFactory creates a new Listener of a protocol, one is created
+// for each frontend config of that type so several may run on different
+// addresses each with its own config.
+type ListenerFactory func() Listener
+
 // A statement handler fulfills a frontend network client request.
 // Examples of handlers are mysql, mongo, etc
 type StatementHandler interface {
@@ -48,16 +53,32 @@ type Request struct {
 	Session expr.ContextReader
 }
 
-func ListenerRegister(name string, l Listener) {
+// ListenerRegister the factory of the named listener protocol type
+func ListenerRegister(name string, factory ListenerFactory) {
 	listenerMu.Lock()
 	defer listenerMu.Unlock()
-	listeners[strings.ToLower(name)] = l
+	listeners[strings.ToLower(name)] = factory
 }
 
-func Listeners() map[string]Listener {
-	return listeners
+// ListenerTypes the registered listener protocol types
+func ListenerTypes() []string {
+	listenerMu.Lock()
+	defer listenerMu.Unlock()
+	names := make([]string, 0, len(listeners))
+	for name := range listeners {
+		names = append(names, name)
+	}
+	return names
 }
 
-func ListenerGet(name string) Listener {
-	return listeners[strings.ToLower(name)]
+// NewListener creates a listener of the named protocol type, nil if
+// no such type is registered.
+func NewListener(name string) Listener {
+	listenerMu.Lock()
+	factory, ok := listeners[strings.ToLower(name)]
+	listenerMu.Unlock()
+	if !ok {
+		return nil
+	}
+	return factory()
 }
@@ -3,6 +3,7 @@ package models
 import (
 	"database/sql/driver"
 	"fmt"
+	"sync"
 
 	u "github.com/araddon/gou"
 
@@ -20,6 +21,9 @@ type ServerCtx struct {
 	Config *Config
 	// The underlying qlbridge registry holds info about the available datasource providers
 	Reg *schema.Registry
+	// Auth looks up the user accounts allowed to connect to frontends,
+	// if nil the frontend listener password applies to any user
+	Auth Authenticator
 	// PlanGrid is swapping out the qlbridge planner
 	// with a distributed version that uses Grid lib to split
 	// tasks across nodes
@@ -41,6 +45,14 @@ func NewServerCtx(conf *Config) *ServerCtx {
 // grid/messaging/coordination systems
 func (m *ServerCtx) Init() error {
 
+	if m.Auth == nil && len(m.Config.Users) > 0 {
+		auth, err := NewConfigAuthenticator(m.Config.Users)
+		if err != nil {
+			return err
+		}
+		m.Auth = auth
+	}
+
 	m.loadInternalSchema()
 
 	if err := m.loadConfig(); err != nil {
@@ -107,6 +119,46 @@ func (m *ServerCtx) JobMaker(ctx *plan.Context) (*planner.GridTask, error) {
 	return planner.BuildExecutorUnPlanned(ctx, m.PlanGrid)
 }
 
+var (
+	usersMu sync.Mutex
+	// users the authenticated users of the statements being run, by
+	// their plan context
+	users = make(map[*plan.Context]*UserConfig)
+)
+
+// BindUser the authenticated user of the connection running the
+// statement of ctx, whose grants StatementUser resolves.  The returned
+// func unbinds it.
+func BindUser(ctx *plan.Context, user *UserConfig) func() {
+	usersMu.Lock()
+	users[ctx] = user
+	usersMu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			usersMu.Lock()
+			delete(users, ctx)
+			usersMu.Unlock()
+		})
+	}
+}
+
+// StatementUser the authenticated user bound to ctx with BindUser, nil if
+// there is no Authenticator so all is allowed.  Session variables such as
+// @@user may be SET by the client so grants are never resolved from them.
+func (m *ServerCtx) StatementUser(ctx *plan.Context) (*UserConfig, error) {
+	if m.Auth == nil {
+		return nil, nil
+	}
+	usersMu.Lock()
+	user := users[ctx]
+	usersMu.Unlock()
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
 // Table Get by schema, name
 func (m *ServerCtx) Table(schemaName, tableName string) (*schema.Table, error) {
 	s, ok := m.schemas[schemaName]
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSConfig the tls config for this listener from its cert/key/CA files,
+// nil if tls is not enabled.
+func (m *ListenerConfig) TLSConfig() (*tls.Config, error) {
+
+	if m.TLSCert == "" && m.TLSKey == "" {
+		if m.TLSRequire || m.TLSClientCert {
+			return nil, fmt.Errorf("%s listener %s requires tls but has no tls_cert, tls_key", m.Type, m.Addr)
+		}
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(m.TLSCert, m.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not load tls_cert, tls_key: %v", err)
+	}
+	conf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if m.TLSCA != "" {
+		caPem, err := ioutil.ReadFile(m.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("could not read tls_ca: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPem) {
+			return nil, fmt.Errorf("no certificates found in tls_ca %s", m.TLSCA)
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	if m.TLSClientCert {
+		if conf.ClientCAs == nil {
+			return nil, fmt.Errorf("tls_client_cert requires tls_ca")
+		}
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCert writes a self signed cert, key pem files to dir
+func writeTestCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, nil, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "dataux test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.Equal(t, nil, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Equal(t, nil, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	assert.Equal(t, nil, err)
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	assert.Equal(t, nil, err)
+	return certFile, keyFile
+}
+
+func TestListenerTLSConfig(t *testing.T) {
+
+	conf, err := (&ListenerConfig{Type: "mysql"}).TLSConfig()
+	assert.Equal(t, nil, err)
+	assert.True(t, conf == nil, "no tls without cert")
+
+	_, err = (&ListenerConfig{Type: "mysql", TLSRequire: true}).TLSConfig()
+	assert.NotEqual(t, nil, err)
+
+	dir, err := ioutil.TempDir("", "dataux_tls")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCert(t, dir)
+
+	conf, err = (&ListenerConfig{TLSCert: certFile, TLSKey: keyFile}).TLSConfig()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(conf.Certificates))
+	assert.Equal(t, tls.NoClientCert, conf.ClientAuth)
+
+	_, err = (&ListenerConfig{TLSCert: certFile, TLSKey: keyFile, TLSClientCert: true}).TLSConfig()
+	assert.NotEqual(t, nil, err)
+
+	conf, err = (&ListenerConfig{TLSCert: certFile, TLSKey: keyFile, TLSCA: certFile, TLSClientCert: true}).TLSConfig()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, conf.ClientAuth)
+
+	_, err = (&ListenerConfig{TLSCert: certFile, TLSKey: filepath.Join(dir, "missing.pem")}).TLSConfig()
+	assert.NotEqual(t, nil, err)
+}
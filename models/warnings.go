@@ -0,0 +1,128 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+
+	u "github.com/araddon/gou"
+
+	"github.com/araddon/qlbridge/plan"
+)
+
+// WarningKind what a warning says about the result of a statement
+type WarningKind uint8
+
+const (
+	// WarnTruncated the result was cut at a default limit of the source
+	WarnTruncated WarningKind = iota
+	// WarnPolyFill a clause was evaluated locally, not pushed down
+	WarnPolyFill
+	// WarnIgnored a clause the source could not run was not applied
+	WarnIgnored
+	// WarnTooFewFields a loaded record had fewer fields than columns
+	WarnTooFewFields
+	// WarnTooManyFields a loaded record had more fields than columns
+	WarnTooManyFields
+)
+
+// MaxWarnings the most warnings kept for a statement, as max_error_count
+const MaxWarnings = 64
+
+// Warning a note that the result of a statement may not be what was
+// asked for, ie truncated at a limit or with a clause evaluated locally.
+type Warning struct {
+	Kind    WarningKind
+	Message string
+}
+
+// Level the mysql level of the warning, Note or Warning
+func (m Warning) Level() string {
+	if m.Kind == WarnPolyFill {
+		return "Note"
+	}
+	return "Warning"
+}
+
+// Warnings collects the warnings of a statement.  It is safe to add to
+// from the tasks of its job, and nil is an empty list.
+type Warnings struct {
+	mu       sync.Mutex
+	count    int
+	warnings []Warning
+}
+
+// Add a warning, repeats of one already added are ignored as sources add
+// them per partition.
+func (m *Warnings) Add(kind WarningKind, format string, args ...interface{}) {
+	w := Warning{Kind: kind, Message: fmt.Sprintf(format, args...)}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.warnings {
+		if existing == w {
+			return
+		}
+	}
+	m.count++
+	if len(m.warnings) < MaxWarnings {
+		m.warnings = append(m.warnings, w)
+	}
+}
+
+// Count the warnings added, including those over MaxWarnings
+func (m *Warnings) Count() uint16 {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.count > 0xffff {
+		return 0xffff
+	}
+	return uint16(m.count)
+}
+
+// List the warnings kept, in the order added
+func (m *Warnings) List() []Warning {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Warning(nil), m.warnings...)
+}
+
+var (
+	warningsMu sync.Mutex
+	// warnings of the statements frontends are running, by their context
+	warningsByCtx = make(map[*plan.Context]*Warnings)
+)
+
+// TrackWarnings collects the warnings sources add for the statement of
+// ctx until UntrackWarnings.
+func TrackWarnings(ctx *plan.Context) *Warnings {
+	w := &Warnings{}
+	warningsMu.Lock()
+	warningsByCtx[ctx] = w
+	warningsMu.Unlock()
+	return w
+}
+
+// UntrackWarnings stops collecting warnings for ctx
+func UntrackWarnings(ctx *plan.Context) {
+	warningsMu.Lock()
+	delete(warningsByCtx, ctx)
+	warningsMu.Unlock()
+}
+
+// Warnf adds a warning to the statement of ctx.  It is only logged if
+// the frontend running the statement does not track them.
+func Warnf(ctx *plan.Context, kind WarningKind, format string, args ...interface{}) {
+	warningsMu.Lock()
+	w := warningsByCtx[ctx]
+	warningsMu.Unlock()
+	if w == nil {
+		u.Debugf("untracked warning: %s", fmt.Sprintf(format, args...))
+		return
+	}
+	w.Add(kind, format, args...)
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarnings(t *testing.T) {
+	var none *Warnings
+	assert.Equal(t, uint16(0), none.Count())
+	assert.Equal(t, 0, len(none.List()))
+
+	w := &Warnings{}
+	w.Add(WarnTruncated, "result of %s truncated at %d rows", "article", 1000)
+	w.Add(WarnTruncated, "result of %s truncated at %d rows", "article", 1000)
+	w.Add(WarnPolyFill, "WHERE %s evaluated locally", "title LIKE 'a%'")
+	assert.Equal(t, uint16(2), w.Count())
+	list := w.List()
+	assert.Equal(t, "result of article truncated at 1000 rows", list[0].Message)
+	assert.Equal(t, "Warning", list[0].Level())
+	assert.Equal(t, "Note", list[1].Level())
+
+	for i := 0; i < MaxWarnings; i++ {
+		w.Add(WarnIgnored, "warning %d", i)
+	}
+	assert.Equal(t, uint16(MaxWarnings+2), w.Count())
+	assert.Equal(t, MaxWarnings, len(w.List()))
+}
@@ -0,0 +1,47 @@
+package planner
+
+import (
+	"context"
+	"sync"
+
+	"github.com/araddon/qlbridge/plan"
+)
+
+var (
+	contextsMu sync.Mutex
+	// contexts of the statements being run, by their plan context
+	contexts = make(map[*plan.Context]context.Context)
+)
+
+// Context the context of the job running the statement of ctx, sources
+// pass it to their backend requests and cursors so a cancelled job stops
+// them.  Background if no job is running ctx, ie a distributed task.
+func Context(ctx *plan.Context) context.Context {
+	contextsMu.Lock()
+	c, ok := contexts[ctx]
+	contextsMu.Unlock()
+	if !ok {
+		return context.Background()
+	}
+	return c
+}
+
+// BindContext runs the statement of ctx within c, ie a deadline started
+// before its job is built, as sources may query their backend while it is
+// planned.  Jobs built for ctx are cancelled with c.  The returned func
+// restores the context it replaces.
+func BindContext(ctx *plan.Context, c context.Context) func() {
+	contextsMu.Lock()
+	prev, hadPrev := contexts[ctx]
+	contexts[ctx] = c
+	contextsMu.Unlock()
+	return func() {
+		contextsMu.Lock()
+		if hadPrev {
+			contexts[ctx] = prev
+		} else {
+			delete(contexts, ctx)
+		}
+		contextsMu.Unlock()
+	}
+}
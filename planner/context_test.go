@@ -0,0 +1,30 @@
+package planner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/araddon/qlbridge/exec"
+	"github.com/araddon/qlbridge/plan"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGridTaskContext(t *testing.T) {
+	ctx := plan.NewContext("SELECT 1")
+	assert.Equal(t, context.Background(), Context(ctx))
+
+	job := NewGridTask(ctx, exec.NewExecutor(ctx, nil), nil)
+	c := Context(ctx)
+	assert.Equal(t, nil, c.Err())
+
+	job.Cancel()
+	assert.True(t, job.Cancelled())
+	assert.Equal(t, context.Canceled, c.Err())
+
+	// safe to close again, from another goroutine than Run
+	done := make(chan error)
+	go func() { done <- job.Close() }()
+	assert.Equal(t, nil, <-done)
+	assert.Equal(t, nil, job.Close())
+	assert.Equal(t, context.Background(), Context(ctx))
+}
@@ -1,7 +1,10 @@
 package planner
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	u "github.com/araddon/gou"
@@ -21,10 +24,7 @@ func BuildSqlJob(ctx *plan.Context, pg *PlannerGrid) (*GridTask, error) {
 	sqlPlanner := plan.NewPlanner(ctx)
 	baseJob := exec.NewExecutor(ctx, sqlPlanner)
 
-	job := &GridTask{JobExecutor: baseJob}
-	baseJob.Executor = job
-	job.GridServer = pg
-	job.Ctx = ctx
+	job := NewGridTask(ctx, baseJob, pg)
 	u.Debugf("buildsqljob: %T p:%p  %T p:%p", job, job, job.Executor, job.JobExecutor)
 	if pg == nil {
 		u.Warnf("Grid Server Doesn't exist %v", pg)
@@ -34,10 +34,12 @@ func BuildSqlJob(ctx *plan.Context, pg *PlannerGrid) (*GridTask, error) {
 	//u.Debugf("buildsqljob2: %T  %T", baseJob, baseJob.Executor)
 	task, err := exec.BuildSqlJobPlanned(job.Planner, job, ctx)
 	if err != nil {
+		job.Close()
 		return nil, err
 	}
 	taskRunner, ok := task.(exec.TaskRunner)
 	if !ok {
+		job.Close()
 		return nil, fmt.Errorf("Expected TaskRunner but was %T", task)
 	}
 	job.RootTask = taskRunner
@@ -49,14 +51,11 @@ func BuildExecutorUnPlanned(ctx *plan.Context, pg *PlannerGrid) (*GridTask, erro
 
 	baseJob := exec.NewExecutor(ctx, nil)
 
-	job := &GridTask{JobExecutor: baseJob}
-	baseJob.Executor = job
-	job.GridServer = pg
+	job := NewGridTask(ctx, baseJob, pg)
 	if pg == nil {
 		u.Warnf("nope, need a grid server ")
 		//return nil, fmt.Errorf("no grid server")
 	}
-	job.Ctx = ctx
 	//u.Infof("Grid Actor Executor: %T p:%p  %T p:%p", job, job, job.Executor, job.JobExecutor)
 	return job, nil
 }
@@ -68,6 +67,57 @@ type GridTask struct {
 	distributed bool
 	sp          *plan.Select
 	GridServer  *PlannerGrid
+	cancel      context.CancelFunc // cancels the context sources run requests in
+	release     func()             // unbinds the context from the statement
+	closeOnce   sync.Once
+	cancelled   int32
+}
+
+// NewGridTask a job of baseJob running the statement of ctx.  Its sources
+// get the context of the job from Context(ctx), it is cancelled by Cancel
+// or Close.
+func NewGridTask(ctx *plan.Context, baseJob *exec.JobExecutor, pg *PlannerGrid) *GridTask {
+	job := &GridTask{JobExecutor: baseJob}
+	baseJob.Executor = job
+	job.GridServer = pg
+	job.Ctx = ctx
+	c, cancel := context.WithCancel(Context(ctx))
+	job.cancel = cancel
+	job.release = BindContext(ctx, c)
+	return job
+}
+
+// Cancel a running job from another goroutine.  Cancels the context of
+// the job so sources stop their backend requests and cursors and Run
+// returns, callers should check Cancelled() to know the results are
+// incomplete.
+func (m *GridTask) Cancel() {
+	atomic.StoreInt32(&m.cancelled, 1)
+	if m.cancel != nil {
+		m.cancel()
+	}
+}
+
+// Close the tasks of the job and cancel its context.  It is safe to call
+// more than once and from another goroutine than Run, only the first
+// closes.
+func (m *GridTask) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		if m.cancel != nil {
+			m.cancel()
+			m.release()
+		}
+		if m.RootTask != nil {
+			err = m.JobExecutor.Close()
+		}
+	})
+	return err
+}
+
+// Cancelled has this job been cancelled
+func (m *GridTask) Cancelled() bool {
+	return atomic.LoadInt32(&m.cancelled) == 1
 }
 
 // Finalize is after the Dag of Relational-algebra tasks have been assembled
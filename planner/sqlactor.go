@@ -132,11 +132,13 @@ func (m *SqlActor) runTask(t *SqlTask) error {
 	//sqlTask, err := executor.WalkPlan(p)
 	if err != nil {
 		u.Errorf("Could not create select task %v", err)
+		executor.Close()
 		return err
 	}
 	tr, ok := sqlTask.(exec.TaskRunner)
 	if !ok {
 		u.Errorf("Expected exec.TaskRunner but got %T", sqlTask)
+		executor.Close()
 		return fmt.Errorf("task was not TaskRunner")
 	}
 
@@ -156,6 +158,8 @@ func (m *SqlActor) runTask(t *SqlTask) error {
 		if err != nil {
 			u.Errorf("error on Query.Run(): %v", err)
 		}
+		// the dag is run by tr, closing the executor releases its context
+		executor.Close()
 	}()
 	return nil
 }
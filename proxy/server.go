@@ -185,23 +185,25 @@ func (m *Server) RunListeners() {
 	}
 }
 
+// loadFrontends creates a listener for each frontend config
 func (m *Server) loadFrontends() error {
 
-	for name, listener := range models.Listeners() {
-		//u.Debugf("looking for frontend for %v", name)
-		for _, listenConf := range m.conf.Frontends {
-
-			if listenConf.Type == name {
-				//u.Debugf("found listener conf:  %#v", listenConf)
-				err := listener.Init(listenConf, m.ctx)
-				if err != nil {
-					u.Errorf("Could not get frontend", err)
-					return err
-				}
-				m.listeners = append(m.listeners, listener)
-				//u.Infof("Loaded listener %s ", name)
+	for _, listenConf := range m.conf.Frontends {
+		listener := models.NewListener(listenConf.Type)
+		if listener == nil {
+			u.Errorf("unknown frontend type %q, expected one of %v", listenConf.Type, models.ListenerTypes())
+			return fmt.Errorf("unknown frontend type %q", listenConf.Type)
+		}
+		//u.Debugf("found listener conf:  %#v", listenConf)
+		if err := listener.Init(listenConf, m.ctx); err != nil {
+			u.Errorf("Could not get frontend %s: %v", listenConf.Addr, err)
+			// release addresses already bound
+			for _, l := range m.listeners {
+				l.Close()
 			}
+			return err
 		}
+		m.listeners = append(m.listeners, listener)
 	}
 	return nil
 }
@@ -1,5 +1,9 @@
 package mysql
 
+import (
+	"strings"
+)
+
 type CollationId uint8
 
 //charset key is charset name and value is default collation id
@@ -535,7 +539,131 @@ var CollationNames = map[string]CollationId{
 }
 
 const (
-	DEFAULT_CHARSET                    = "utf8"
-	DEFAULT_COLLATION_ID   CollationId = 33
-	DEFAULT_COLLATION_NAME string      = "utf8_general_ci"
+	DEFAULT_CHARSET                    = "utf8mb4"
+	DEFAULT_COLLATION_ID   CollationId = 45
+	DEFAULT_COLLATION_NAME string      = "utf8mb4_general_ci"
+	BINARY_COLLATION_ID    CollationId = 63
 )
+
+// CollationCharset the charset of a collation, empty if it is unknown
+func CollationCharset(id CollationId) string {
+	name, ok := Collations[id]
+	if !ok {
+		return ""
+	}
+	if i := strings.IndexByte(name, '_'); i > 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// CharsetName the name of a charset as it is known, ie utf8mb3 is utf8,
+// empty if it is unknown
+func CharsetName(charset string) string {
+	charset = strings.ToLower(charset)
+	if charset == "utf8mb3" {
+		charset = "utf8"
+	}
+	if _, ok := CharsetIds[charset]; !ok {
+		return ""
+	}
+	return charset
+}
+
+// IsTextType is typ a column type whose values are text in a charset,
+// others are binary
+func IsTextType(typ uint8) bool {
+	switch typ {
+	case MYSQL_TYPE_VARCHAR, MYSQL_TYPE_JSON, MYSQL_TYPE_ENUM, MYSQL_TYPE_SET,
+		MYSQL_TYPE_TINY_BLOB, MYSQL_TYPE_MEDIUM_BLOB, MYSQL_TYPE_LONG_BLOB,
+		MYSQL_TYPE_BLOB, MYSQL_TYPE_VAR_STRING, MYSQL_TYPE_STRING:
+		return true
+	}
+	return false
+}
+
+// cp1252 the runes of bytes 0x80-0x9f in latin1, which mysql takes to be
+// windows-1252, others are the rune of the same value
+var cp1252 = [32]rune{
+	0x20ac, 0x0081, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008d, 0x017d, 0x008f,
+	0x0090, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0x009d, 0x017e, 0x0178,
+}
+
+var cp1252Bytes = make(map[rune]byte, len(cp1252))
+
+func init() {
+	for i, r := range cp1252 {
+		cp1252Bytes[r] = byte(0x80 + i)
+	}
+}
+
+// EncodeString s, utf8 as results are, in charset.  Runes charset can't
+// hold are sent as ?, as mysql does.  Charsets we have no encoder for
+// are sent as utf8.
+func EncodeString(charset, s string) string {
+	switch charset {
+	case "utf8":
+		// 3 byte utf8 has no runes outside the basic plane, ie emoji
+		return mapRunes(s, func(r rune) bool { return r <= 0xffff })
+	case "ascii":
+		return mapRunes(s, func(r rune) bool { return r < 0x80 })
+	case "latin1":
+		if isAscii(s) {
+			return s
+		}
+		buf := make([]byte, 0, len(s))
+		for _, r := range s {
+			switch b, ok := cp1252Bytes[r]; {
+			case ok:
+				buf = append(buf, b)
+			case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+				buf = append(buf, byte(r))
+			default:
+				buf = append(buf, '?')
+			}
+		}
+		return string(buf)
+	}
+	return s
+}
+
+// DecodeString s, sent by a client in charset, to utf8
+func DecodeString(charset, s string) string {
+	if charset != "latin1" || isAscii(s) {
+		return s
+	}
+	buf := make([]rune, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if b >= 0x80 && b < 0xa0 {
+			buf = append(buf, cp1252[b-0x80])
+		} else {
+			buf = append(buf, rune(b))
+		}
+	}
+	return string(buf)
+}
+
+// mapRunes s with runes keep is false for replaced with ?
+func mapRunes(s string, keep func(r rune) bool) string {
+	if isAscii(s) {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		if keep(r) {
+			return r
+		}
+		return '?'
+	}, s)
+}
+
+func isAscii(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
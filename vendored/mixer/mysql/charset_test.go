@@ -0,0 +1,46 @@
+package mysql
+
+import (
+	"testing"
+)
+
+func TestCollationCharset(t *testing.T) {
+	for id, charset := range map[CollationId]string{
+		8:   "latin1",
+		33:  "utf8",
+		45:  "utf8mb4",
+		63:  "binary",
+		255: "",
+	} {
+		if got := CollationCharset(id); got != charset {
+			t.Fatalf("collation %d expected %q got %q", id, charset, got)
+		}
+	}
+	if CharsetName("UTF8MB3") != "utf8" || CharsetName("latin1") != "latin1" || CharsetName("klingon") != "" {
+		t.Fatal("expected charset names to be normalized")
+	}
+}
+
+func TestEncodeString(t *testing.T) {
+	tests := []struct {
+		charset, in, out string
+	}{
+		{"utf8mb4", "café \U0001f600", "café \U0001f600"},
+		{"utf8", "café \U0001f600", "café ?"},
+		{"ascii", "café", "caf?"},
+		{"latin1", "plain", "plain"},
+		{"latin1", "café €5 中", "caf\xe9 \x805 ?"},
+	}
+	for _, tt := range tests {
+		if got := EncodeString(tt.charset, tt.in); got != tt.out {
+			t.Fatalf("%s: expected %q got %q", tt.charset, tt.out, got)
+		}
+	}
+
+	if got := DecodeString("latin1", "caf\xe9 \x805"); got != "café €5" {
+		t.Fatalf("expected latin1 decoded got %q", got)
+	}
+	if got := DecodeString("utf8mb4", "café"); got != "café" {
+		t.Fatalf("expected utf8 as is got %q", got)
+	}
+}
@@ -0,0 +1,156 @@
+package mysql
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+
+	u "github.com/araddon/gou"
+)
+
+const (
+	// payloads shorter than this are sent uncompressed, as mysql does
+	minCompressLength = 50
+	// buffered writes are flushed once this large
+	compressFlushLength = 64 * 1024
+)
+
+// compressIO the compressed protocol framing, each frame is
+//
+//	3 bytes   length of the compressed payload
+//	1 byte    compressed sequence
+//	3 bytes   length of the uncompressed payload, 0 if not compressed
+//	payload   zlib compressed packets, each with its own 4 byte header
+//
+// Packets written are buffered so many small ones (rows) are compressed
+// together.
+type compressIO struct {
+	rb       io.Reader
+	wb       io.Writer
+	sequence uint8
+	rbuf     []byte // uncompressed bytes of the frame being read
+	wbuf     bytes.Buffer
+	zbuf     bytes.Buffer
+	zw       *zlib.Writer
+}
+
+func newCompressIO(rb io.Reader, wb io.Writer) *compressIO {
+	m := &compressIO{rb: rb, wb: wb}
+	m.zw = zlib.NewWriter(&m.zbuf)
+	return m
+}
+
+// Read the uncompressed packet stream, reading frames as needed
+func (m *compressIO) Read(b []byte) (int, error) {
+	for len(m.rbuf) == 0 {
+		if err := m.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, m.rbuf)
+	m.rbuf = m.rbuf[n:]
+	return n, nil
+}
+
+func (m *compressIO) readFrame() error {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(m.rb, header); err != nil {
+		if err == io.EOF {
+			return err
+		}
+		return ErrBadConn
+	}
+	length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+	sequence := header[3]
+	ulength := int(uint32(header[4]) | uint32(header[5])<<8 | uint32(header[6])<<16)
+
+	if sequence != m.sequence {
+		return fmt.Errorf("invalid compressed sequence %d != %d", sequence, m.sequence)
+	}
+	m.sequence++
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(m.rb, data); err != nil {
+		return ErrBadConn
+	}
+	if ulength == 0 {
+		m.rbuf = data
+		return nil
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		u.Warnf("invalid compressed packet: %v", err)
+		return ErrMalformPacket
+	}
+	defer zr.Close()
+	m.rbuf = make([]byte, ulength)
+	if _, err := io.ReadFull(zr, m.rbuf); err != nil {
+		u.Warnf("invalid compressed packet: %v", err)
+		return ErrMalformPacket
+	}
+	return nil
+}
+
+// Write buffers packets, flushing once enough are buffered
+func (m *compressIO) Write(b []byte) (int, error) {
+	m.wbuf.Write(b)
+	if m.wbuf.Len() >= compressFlushLength {
+		if err := m.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush the buffered packets as compressed frames
+func (m *compressIO) Flush() error {
+	for m.wbuf.Len() > 0 {
+		payload := m.wbuf.Next(MaxPayloadLen)
+		if err := m.writeFrame(payload); err != nil {
+			m.wbuf.Reset()
+			return err
+		}
+	}
+	m.wbuf.Reset()
+	return nil
+}
+
+func (m *compressIO) writeFrame(payload []byte) error {
+	ulength := 0
+	if len(payload) >= minCompressLength {
+		m.zbuf.Reset()
+		m.zw.Reset(&m.zbuf)
+		if _, err := m.zw.Write(payload); err != nil {
+			return err
+		}
+		if err := m.zw.Close(); err != nil {
+			return err
+		}
+		// incompressible payloads are sent as is
+		if m.zbuf.Len() < len(payload) {
+			ulength = len(payload)
+			payload = m.zbuf.Bytes()
+		}
+	}
+
+	length := len(payload)
+	frame := make([]byte, 7, 7+length)
+	frame[0] = byte(length)
+	frame[1] = byte(length >> 8)
+	frame[2] = byte(length >> 16)
+	frame[3] = m.sequence
+	frame[4] = byte(ulength)
+	frame[5] = byte(ulength >> 8)
+	frame[6] = byte(ulength >> 16)
+	frame = append(frame, payload...)
+
+	if n, err := m.wb.Write(frame); err != nil {
+		return ErrBadConn
+	} else if n != len(frame) {
+		return ErrBadConn
+	}
+	m.sequence++
+	return nil
+}
@@ -0,0 +1,56 @@
+package mysql
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestCompressedPackets(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	cp := NewPacketIO(client)
+	cp.SetCompressed()
+	sp := NewPacketIO(server)
+	sp.SetCompressed()
+
+	packets := [][]byte{
+		[]byte("small"),
+		bytes.Repeat([]byte("row data "), 1000),
+		bytes.Repeat([]byte{'x'}, compressFlushLength*2),
+	}
+	errs := make(chan error, 1)
+	go func() {
+		for _, p := range packets {
+			data := append(make([]byte, 4), p...)
+			if err := cp.WritePacket(data); err != nil {
+				errs <- err
+				return
+			}
+		}
+		errs <- cp.Flush()
+	}()
+
+	for i, p := range packets {
+		data, err := sp.ReadPacket()
+		if err != nil {
+			t.Fatalf("packet %d: %v", i, err)
+		}
+		if !bytes.Equal(p, data) {
+			t.Fatalf("packet %d: got %d bytes want %d", i, len(data), len(p))
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if cp.compress.sequence != sp.compress.sequence {
+		t.Fatalf("compressed sequence %d != %d", cp.compress.sequence, sp.compress.sequence)
+	}
+
+	sp.ResetSequence()
+	if sp.Sequence != 0 || sp.compress.sequence != 0 {
+		t.Fatal("expected sequence to be reset")
+	}
+}
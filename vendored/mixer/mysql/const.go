@@ -12,6 +12,28 @@ const (
 	ERR_HEADER         byte = 0xff
 	EOF_HEADER         byte = 0xfe
 	LocalInFile_HEADER byte = 0xfb
+
+	AUTH_MORE_DATA_HEADER  byte = 0x01
+	AUTH_SWITCH_REQ_HEADER byte = 0xfe
+)
+
+// COM_SET_OPTION options
+const (
+	MYSQL_OPTION_MULTI_STATEMENTS_ON  uint16 = 0
+	MYSQL_OPTION_MULTI_STATEMENTS_OFF uint16 = 1
+)
+
+// authentication plugins
+const (
+	AUTH_NATIVE_PASSWORD       = "mysql_native_password"
+	AUTH_CACHING_SHA2_PASSWORD = "caching_sha2_password"
+)
+
+// caching_sha2_password auth more data
+const (
+	CACHING_SHA2_REQUEST_PUBLIC_KEY byte = 2
+	CACHING_SHA2_FAST_AUTH_SUCCESS  byte = 3
+	CACHING_SHA2_PERFORM_FULL_AUTH  byte = 4
 )
 
 const (
@@ -868,3 +868,14 @@ const (
 	ER_ROW_IN_WRONG_PARTITION                                                  = 1863
 	ER_ERROR_LAST                                                              = 1863
 )
+
+// error codes of mysql 5.7+
+const (
+	ER_QUERY_TIMEOUT             = 3024
+	ER_SECURE_TRANSPORT_REQUIRED = 3159
+)
+
+// client error codes, sent for backends that could not be reached
+const (
+	CR_SERVER_LOST = 2013
+)
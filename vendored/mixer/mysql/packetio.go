@@ -12,8 +12,12 @@ var _ = u.EMPTY
 
 type PacketIO struct {
 	rb *bufio.Reader
+	r  io.Reader
 	wb io.Writer
 
+	// compressed framing once CLIENT_COMPRESS is negotiated
+	compress *compressIO
+
 	Sequence uint8
 }
 
@@ -21,6 +25,7 @@ func NewPacketIO(conn net.Conn) *PacketIO {
 	p := new(PacketIO)
 
 	p.rb = bufio.NewReaderSize(conn, 1024)
+	p.r = p.rb
 	p.wb = conn
 
 	p.Sequence = 0
@@ -28,10 +33,69 @@ func NewPacketIO(conn net.Conn) *PacketIO {
 	return p
 }
 
+// BufferedConn wraps conn so reads go through the read buffer of this
+// PacketIO first, for switching protocols (ie to tls) part way through
+// a connection when the client may already have sent more data.
+func (p *PacketIO) BufferedConn(conn net.Conn) net.Conn {
+	return &bufferedConn{Conn: conn, rb: p.rb}
+}
+
+type bufferedConn struct {
+	net.Conn
+	rb *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.rb.Read(b)
+}
+
+// SetCompressed switches to the compressed protocol, packets are then
+// read from and written in zlib compressed frames.  Writes are buffered
+// until Flush, or the next ReadPacket.
+func (p *PacketIO) SetCompressed() {
+	p.compress = newCompressIO(p.rb, p.wb)
+	p.r = p.compress
+	p.wb = p.compress
+}
+
+// Flush writes any buffered compressed packets
+func (p *PacketIO) Flush() error {
+	if p.compress == nil {
+		return nil
+	}
+	return p.compress.Flush()
+}
+
+// ResetSequence starts the sequence of a new command, buffered packets
+// of the previous command are flushed first.
+func (p *PacketIO) ResetSequence() error {
+	err := p.Flush()
+	p.Sequence = 0
+	if p.compress != nil {
+		p.compress.sequence = 0
+	}
+	return err
+}
+
 func (p *PacketIO) ReadPacket() ([]byte, error) {
+	return p.readPacket(false)
+}
+
+// ReadDataPacket reads a packet which may be empty, as the empty packet
+// a client ends the file it sends for LOAD DATA LOCAL INFILE with.
+func (p *PacketIO) ReadDataPacket() ([]byte, error) {
+	return p.readPacket(true)
+}
+
+func (p *PacketIO) readPacket(allowEmpty bool) ([]byte, error) {
 	header := []byte{0, 0, 0, 0}
 
-	if _, err := io.ReadFull(p.rb, header); err != nil {
+	// the peer can't answer what it hasn't received
+	if err := p.Flush(); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.ReadFull(p.r, header); err != nil {
 		if err == io.EOF {
 			//u.Errorf("eof on read? %v", err)
 			return nil, err
@@ -42,7 +106,7 @@ func (p *PacketIO) ReadPacket() ([]byte, error) {
 
 	//u.Infof("header:  %v %v", len(header), string(header))
 	length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
-	if length < 1 {
+	if length < 1 && !allowEmpty {
 		u.Warnf("invalid payload length?:  %v", length)
 		return nil, fmt.Errorf("invalid payload length %d", length)
 	}
@@ -58,7 +122,7 @@ func (p *PacketIO) ReadPacket() ([]byte, error) {
 
 	data := make([]byte, length)
 
-	if _, err := io.ReadFull(p.rb, data); err != nil {
+	if _, err := io.ReadFull(p.r, data); err != nil {
 		u.Errorf("err: %v", err)
 		return nil, ErrBadConn
 	} else {
@@ -68,7 +132,7 @@ func (p *PacketIO) ReadPacket() ([]byte, error) {
 		}
 
 		var buf []byte
-		buf, err = p.ReadPacket()
+		buf, err = p.readPacket(true)
 		if err != nil {
 			u.Errorf("bad conn? %v", err)
 			return nil, ErrBadConn
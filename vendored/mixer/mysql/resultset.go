@@ -18,6 +18,7 @@ type Result struct {
 	Status       uint16
 	InsertId     uint64
 	AffectedRows uint64
+	Info         string // message of the OK, ie the Records: line of a LOAD DATA
 	*Resultset
 }
 
@@ -137,6 +138,248 @@ func ValuesToRowData(values []driver.Value, fields []*Field) (RowData, error) {
 	return RowData(buf.Bytes()), nil
 }
 
+// ValuesToBinaryRowData serializes a row in the binary protocol used for
+// prepared statement results.  Values are coerced to the Type of their
+// Field, values that can't be coerced are sent as NULL.
+func ValuesToBinaryRowData(values []driver.Value, fields []*Field) (RowData, error) {
+
+	if len(values) != len(fields) {
+		return nil, fmt.Errorf("Number of values doesn't match number of fields:  fields:%v vals:%v", len(fields), len(values))
+	}
+
+	// [00] header, then null-bitmap with offset of 2 bits
+	nullBitmap := make([]byte, (len(fields)+7+2)>>3)
+	buf := make([]byte, 0, 1+len(nullBitmap)+len(fields)*8)
+	vals := make([]byte, 0, len(fields)*8)
+
+	setNull := func(i int) {
+		nullBitmap[(i+2)/8] |= 1 << (uint(i+2) % 8)
+	}
+
+	for i, f := range fields {
+		v := values[i]
+		if v == nil {
+			setNull(i)
+			continue
+		}
+
+		switch f.Type {
+		case MYSQL_TYPE_NULL:
+			setNull(i)
+
+		case MYSQL_TYPE_TINY:
+			n, ok := binaryInt(v)
+			if !ok {
+				setNull(i)
+				continue
+			}
+			vals = append(vals, byte(n))
+
+		case MYSQL_TYPE_SHORT, MYSQL_TYPE_YEAR:
+			n, ok := binaryInt(v)
+			if !ok {
+				setNull(i)
+				continue
+			}
+			vals = append(vals, Uint16ToBytes(uint16(n))...)
+
+		case MYSQL_TYPE_INT24, MYSQL_TYPE_LONG:
+			n, ok := binaryInt(v)
+			if !ok {
+				setNull(i)
+				continue
+			}
+			vals = append(vals, Uint32ToBytes(uint32(n))...)
+
+		case MYSQL_TYPE_LONGLONG:
+			n, ok := binaryInt(v)
+			if !ok {
+				setNull(i)
+				continue
+			}
+			vals = append(vals, Uint64ToBytes(uint64(n))...)
+
+		case MYSQL_TYPE_FLOAT:
+			n, ok := binaryFloat(v)
+			if !ok {
+				setNull(i)
+				continue
+			}
+			vals = append(vals, Uint32ToBytes(math.Float32bits(float32(n)))...)
+
+		case MYSQL_TYPE_DOUBLE:
+			n, ok := binaryFloat(v)
+			if !ok {
+				setNull(i)
+				continue
+			}
+			vals = append(vals, Uint64ToBytes(math.Float64bits(n))...)
+
+		case MYSQL_TYPE_DATE, MYSQL_TYPE_NEWDATE, MYSQL_TYPE_DATETIME, MYSQL_TYPE_TIMESTAMP:
+			t, ok := binaryTime(v)
+			if !ok {
+				setNull(i)
+				continue
+			}
+			vals = append(vals, binaryDateTime(t, f.Type)...)
+
+		default:
+			// decimal, strings, blobs, json, enum, etc are all length encoded strings
+			by, err := binaryBytes(v)
+			if err != nil {
+				u.Warnf("could not serialize T:%T v:%v err=%v", v, v, err)
+				setNull(i)
+				continue
+			}
+			vals = append(vals, PutLengthEncodedString(by)...)
+		}
+	}
+
+	buf = append(buf, OK_HEADER)
+	buf = append(buf, nullBitmap...)
+	buf = append(buf, vals...)
+	return RowData(buf), nil
+}
+
+func binaryInt(v driver.Value) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return int64(n), true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), true
+	case float32:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		if iv, err := strconv.ParseInt(n, 10, 64); err == nil {
+			return iv, true
+		}
+		if fv, err := strconv.ParseFloat(n, 64); err == nil {
+			return int64(fv), true
+		}
+	case []byte:
+		return binaryInt(string(n))
+	}
+	return 0, false
+}
+
+func binaryFloat(v driver.Value) (float64, bool) {
+	switch n := v.(type) {
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		if fv, err := strconv.ParseFloat(n, 64); err == nil {
+			return fv, true
+		}
+		return 0, false
+	case []byte:
+		return binaryFloat(string(n))
+	}
+	if iv, ok := binaryInt(v); ok {
+		return float64(iv), true
+	}
+	return 0, false
+}
+
+var binaryTimeFormats = []string{
+	"2006-01-02 15:04:05.999999",
+	time.RFC3339Nano,
+	"2006-01-02",
+}
+
+func binaryTime(v driver.Value) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case *time.Time:
+		if t != nil {
+			return *t, true
+		}
+	case string:
+		for _, layout := range binaryTimeFormats {
+			if tv, err := time.Parse(layout, t); err == nil {
+				return tv, true
+			}
+		}
+	case []byte:
+		return binaryTime(string(t))
+	}
+	return time.Time{}, false
+}
+
+// binaryDateTime serializes a date/datetime in shortest form,
+// length byte of 0, 4, 7 or 11 followed by the parts
+func binaryDateTime(t time.Time, typ byte) []byte {
+	if t.IsZero() {
+		return []byte{0}
+	}
+	data := make([]byte, 1, 12)
+	data = append(data, Uint16ToBytes(uint16(t.Year()))...)
+	data = append(data, byte(t.Month()), byte(t.Day()))
+	if typ == MYSQL_TYPE_DATE || typ == MYSQL_TYPE_NEWDATE {
+		data[0] = 4
+		return data
+	}
+	micros := t.Nanosecond() / 1000
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && micros == 0 {
+		data[0] = 4
+		return data
+	}
+	data = append(data, byte(t.Hour()), byte(t.Minute()), byte(t.Second()))
+	if micros == 0 {
+		data[0] = 7
+		return data
+	}
+	data = append(data, Uint32ToBytes(uint32(micros))...)
+	data[0] = 11
+	return data
+}
+
+func binaryBytes(v driver.Value) ([]byte, error) {
+	switch t := v.(type) {
+	case []byte:
+		return t, nil
+	case string:
+		return []byte(t), nil
+	case uint64:
+		return []byte(strconv.FormatUint(t, 10)), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, bool:
+		n, _ := binaryInt(t)
+		return []byte(strconv.FormatInt(n, 10)), nil
+	case float32:
+		return []byte(strconv.FormatFloat(float64(t), 'f', -1, 64)), nil
+	case float64:
+		return []byte(strconv.FormatFloat(t, 'f', -1, 64)), nil
+	case time.Time:
+		return []byte(t.Format(TimeFormat)), nil
+	}
+	return json.Marshal(v)
+}
+
 func (p RowData) ParseText(f []*Field) ([]driver.Value, error) {
 	data := make([]driver.Value, len(f))
 
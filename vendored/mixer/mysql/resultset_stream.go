@@ -0,0 +1,25 @@
+package mysql
+
+// A Resultset may be streamed to a client in pieces instead of being
+// buffered whole, the writer emits:
+//
+//    ResultsetHeader   column count, column definitions, EOF
+//    RowBatch          0..n batches of row packets
+//    ResultsetEnd      EOF (or an ERR in its place on failure)
+//
+
+// ResultsetHeader is the column-definition part of a streamed Resultset
+// and must be written before any RowBatch.
+type ResultsetHeader struct {
+	Fields []*Field
+}
+
+// RowBatch is a batch of serialized rows of a streamed Resultset.
+type RowBatch struct {
+	RowDatas []RowData
+}
+
+// ResultsetEnd terminates a streamed Resultset.
+type ResultsetEnd struct {
+	Status uint16
+}
@@ -0,0 +1,57 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+func TestValuesToBinaryRowData(t *testing.T) {
+	fields := []*Field{
+		{Name: []byte("id"), Type: MYSQL_TYPE_LONGLONG},
+		{Name: []byte("name"), Type: MYSQL_TYPE_VAR_STRING},
+		{Name: []byte("score"), Type: MYSQL_TYPE_DOUBLE},
+		{Name: []byte("ok"), Type: MYSQL_TYPE_TINY},
+		{Name: []byte("created"), Type: MYSQL_TYPE_DATETIME},
+		{Name: []byte("missing"), Type: MYSQL_TYPE_VAR_STRING},
+		{Name: []byte("ct"), Type: MYSQL_TYPE_LONG},
+	}
+	created := time.Date(2016, 6, 27, 12, 30, 15, 0, time.UTC)
+	row, err := ValuesToBinaryRowData([]driver.Value{
+		int64(12), "bob", float64(3.5), true, created, nil, "42",
+	}, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vals, err := row.ParseBinary(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vals[0] != int64(12) {
+		t.Errorf("expected 12 got %#v", vals[0])
+	}
+	if string(vals[1].([]byte)) != "bob" {
+		t.Errorf("expected bob got %#v", vals[1])
+	}
+	if vals[2] != float64(3.5) {
+		t.Errorf("expected 3.5 got %#v", vals[2])
+	}
+	if vals[3] != int64(1) {
+		t.Errorf("expected 1 got %#v", vals[3])
+	}
+	if string(vals[4].([]byte)) != "2016-06-27 12:30:15" {
+		t.Errorf("expected datetime got %s", vals[4])
+	}
+	if vals[5] != nil {
+		t.Errorf("expected nil got %#v", vals[5])
+	}
+	if vals[6] != int64(42) {
+		t.Errorf("expected 42 got %#v", vals[6])
+	}
+
+	_, err = ValuesToBinaryRowData([]driver.Value{int64(1)}, fields)
+	if err == nil {
+		t.Errorf("expected error on column count mismatch")
+	}
+}
@@ -3,6 +3,8 @@ package mysql
 import (
 	"crypto/rand"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -45,6 +47,104 @@ func CalcPassword(scramble, password []byte) []byte {
 	return scramble
 }
 
+// NativePasswordHash SHA1(SHA1(password)) the hash mysql_native_password
+// auth responses are verified against, nil if there is no password.
+func NativePasswordHash(password []byte) []byte {
+	if len(password) == 0 {
+		return nil
+	}
+	stage1 := sha1.Sum(password)
+	hash := sha1.Sum(stage1[:])
+	return hash[:]
+}
+
+// CheckNativePassword verifies the mysql_native_password auth response
+// of client against the stored hash SHA1(SHA1(password)) without
+// needing the plain text password:
+//
+//	stage1 = auth XOR SHA1(scramble + hash)
+//	valid if SHA1(stage1) == hash
+func CheckNativePassword(scramble, auth, hash []byte) bool {
+	if len(hash) == 0 {
+		return len(auth) == 0
+	}
+	if len(auth) != sha1.Size || len(hash) != sha1.Size {
+		return false
+	}
+
+	crypt := sha1.New()
+	crypt.Write(scramble)
+	crypt.Write(hash)
+	stage1 := crypt.Sum(nil)
+	for i := range stage1 {
+		stage1[i] ^= auth[i]
+	}
+
+	crypt.Reset()
+	crypt.Write(stage1)
+	return subtle.ConstantTimeCompare(crypt.Sum(nil), hash) == 1
+}
+
+// CalcCachingSha2Password the caching_sha2_password auth response for
+// password: XOR(SHA256(password), SHA256(SHA256(SHA256(password)), scramble))
+func CalcCachingSha2Password(scramble, password []byte) []byte {
+	if len(password) == 0 {
+		return nil
+	}
+
+	crypt := sha256.New()
+	crypt.Write(password)
+	stage1 := crypt.Sum(nil)
+
+	crypt.Reset()
+	crypt.Write(stage1)
+	digest := crypt.Sum(nil)
+
+	crypt.Reset()
+	crypt.Write(digest)
+	crypt.Write(scramble)
+	scramble = crypt.Sum(nil)
+
+	for i := range scramble {
+		scramble[i] ^= stage1[i]
+	}
+	return scramble
+}
+
+// CachingSha2Digest SHA256(SHA256(password)) the digest caching_sha2_password
+// auth responses are verified against, nil if there is no password.
+func CachingSha2Digest(password []byte) []byte {
+	if len(password) == 0 {
+		return nil
+	}
+	stage1 := sha256.Sum256(password)
+	digest := sha256.Sum256(stage1[:])
+	return digest[:]
+}
+
+// CheckCachingSha2Password verifies the caching_sha2_password auth
+// response of client against the digest SHA256(SHA256(password)).
+func CheckCachingSha2Password(scramble, auth, digest []byte) bool {
+	if len(digest) == 0 {
+		return len(auth) == 0
+	}
+	if len(auth) != sha256.Size || len(digest) != sha256.Size {
+		return false
+	}
+
+	crypt := sha256.New()
+	crypt.Write(digest)
+	crypt.Write(scramble)
+	stage1 := crypt.Sum(nil)
+	for i := range stage1 {
+		stage1[i] ^= auth[i]
+	}
+
+	crypt.Reset()
+	crypt.Write(stage1)
+	return subtle.ConstantTimeCompare(crypt.Sum(nil), digest) == 1
+}
+
 func RandomBuf(size int) ([]byte, error) {
 	buf := make([]byte, size)
 
@@ -0,0 +1,45 @@
+package mysql
+
+import (
+	"testing"
+)
+
+func TestCheckNativePassword(t *testing.T) {
+	scramble, _ := RandomBuf(20)
+	hash := NativePasswordHash([]byte("secret"))
+
+	if !CheckNativePassword(scramble, CalcPassword(scramble, []byte("secret")), hash) {
+		t.Fatal("expected valid password")
+	}
+	if CheckNativePassword(scramble, CalcPassword(scramble, []byte("wrong")), hash) {
+		t.Fatal("expected invalid password")
+	}
+	if CheckNativePassword(scramble, nil, hash) {
+		t.Fatal("expected empty password to be invalid")
+	}
+	// user without password
+	if !CheckNativePassword(scramble, nil, nil) {
+		t.Fatal("expected empty password to be valid")
+	}
+	if CheckNativePassword(scramble, CalcPassword(scramble, []byte("secret")), nil) {
+		t.Fatal("expected password to be invalid for user without one")
+	}
+}
+
+func TestCheckCachingSha2Password(t *testing.T) {
+	scramble, _ := RandomBuf(20)
+	digest := CachingSha2Digest([]byte("secret"))
+
+	if !CheckCachingSha2Password(scramble, CalcCachingSha2Password(scramble, []byte("secret")), digest) {
+		t.Fatal("expected valid password")
+	}
+	if CheckCachingSha2Password(scramble, CalcCachingSha2Password(scramble, []byte("wrong")), digest) {
+		t.Fatal("expected invalid password")
+	}
+	if CheckCachingSha2Password(scramble, CalcPassword(scramble, []byte("secret")), digest) {
+		t.Fatal("expected native auth response to be invalid")
+	}
+	if !CheckCachingSha2Password(scramble, nil, CachingSha2Digest(nil)) {
+		t.Fatal("expected empty password to be valid")
+	}
+}
@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"bytes"
+	"crypto/tls"
 	"database/sql/driver"
 	"encoding/binary"
 	"fmt"
@@ -45,9 +46,12 @@ type Conn struct {
 	capability   uint32
 	connectionId uint32
 	Status       uint16
-	collation    mysql.CollationId
-	charset      string
+	Warnings     *models.Warnings  // of the current statement, counted in OK and EOF packets
+	collation    mysql.CollationId // of the client, set in handshake or SET NAMES
+	charset      string            // of the client, statements are decoded from it
+	results      string            // charset results are sent in, empty sends them as is
 	user         string
+	authUser     *models.UserConfig // authenticated account, nil if listener has no authenticator
 	db           string
 	salt         []byte
 	schema       *schema.Schema
@@ -67,8 +71,6 @@ func newConn(m *mysqlListener, co net.Conn) *Conn {
 	c.pkg = mysql.NewPacketIO(co)
 
 	c.listener = m
-	//u.Debugf("has sc? %#v", m.sc)
-	c.handler = m.sc.Open(c)
 
 	c.noRecover = c.listener.cfg.SupressRecover
 	c.c = co
@@ -86,10 +88,15 @@ func newConn(m *mysqlListener, co net.Conn) *Conn {
 
 	c.collation = mysql.DEFAULT_COLLATION_ID
 	c.charset = mysql.DEFAULT_CHARSET
+	c.results = mysql.DEFAULT_CHARSET
 
 	c.stmtId = 0
 	c.stmts = make(map[uint32]*Stmt)
 
+	// open the handler last so it sees an initialized conn (ie ConnId)
+	//u.Debugf("has sc? %#v", m.sc)
+	c.handler = m.sc.Open(c)
+
 	return c
 }
 
@@ -137,7 +144,10 @@ func (c *Conn) Run() {
 			return
 		}
 
-		c.pkg.Sequence = 0
+		if err := c.pkg.ResetSequence(); err != nil {
+			u.Errorf("error on flush?  %v", err)
+			return
+		}
 	}
 }
 
@@ -176,6 +186,11 @@ func (c *Conn) Handshake() error {
 		return err
 	}
 
+	// the compressed protocol starts after the handshake
+	if c.capability&mysql.CLIENT_COMPRESS > 0 {
+		c.pkg.SetCompressed()
+	}
+
 	c.pkg.Sequence = 0
 
 	return nil
@@ -189,16 +204,53 @@ func (c *Conn) User() string {
 	return c.user
 }
 
+// AuthUser the account this connection authenticated as, nil if the
+// listener has no authenticator ie no grants apply.
+func (c *Conn) AuthUser() *models.UserConfig {
+	return c.authUser
+}
+
+// RemoteAddr the remote host:port of this connection, localhost for
+// unix socket connections
+func (c *Conn) RemoteAddr() string {
+	if c.isUnix() {
+		return "localhost"
+	}
+	return c.c.RemoteAddr().String()
+}
+
+// Host the remote host of this connection
+func (c *Conn) Host() string {
+	if c.isUnix() {
+		return "localhost"
+	}
+	host, _, err := net.SplitHostPort(c.c.RemoteAddr().String())
+	if err != nil {
+		return c.c.RemoteAddr().String()
+	}
+	return host
+}
+
 func (c *Conn) Close() error {
 	if c.closed {
 		return nil
 	}
+	c.closed = true
+	c.pkg.Flush()
 	c.c.Close()
 	c.rollback()
-	c.closed = true
+	if c.handler != nil {
+		c.handler.Close()
+	}
 	return nil
 }
 
+// Kill closes the network connection from another goroutine, the
+// connection's own goroutine then fails on read/write and cleans up.
+func (c *Conn) Kill() error {
+	return c.c.Close()
+}
+
 func (c *Conn) writeInitialHandshake() error {
 	data := make([]byte, 4, 128)
 
@@ -218,8 +270,10 @@ func (c *Conn) writeInitialHandshake() error {
 	//filter [00]
 	data = append(data, 0)
 
-	//capability flag lower 2 bytes, using default capability here
-	data = append(data, byte(DEFAULT_CAPABILITY), byte(DEFAULT_CAPABILITY>>8))
+	capability := c.serverCapability()
+
+	//capability flag lower 2 bytes
+	data = append(data, byte(capability), byte(capability>>8))
 
 	//charset, utf-8 default
 	data = append(data, uint8(mysql.DEFAULT_COLLATION_ID))
@@ -228,8 +282,8 @@ func (c *Conn) writeInitialHandshake() error {
 	data = append(data, byte(c.Status), byte(c.Status>>8))
 
 	//below 13 byte may not be used
-	//capability flag upper 2 bytes, using default capability here
-	data = append(data, byte(DEFAULT_CAPABILITY>>16), byte(DEFAULT_CAPABILITY>>24))
+	//capability flag upper 2 bytes
+	data = append(data, byte(capability>>16), byte(capability>>24))
 
 	//filter [0x15], for wireshark dump, value is 0x15
 	data = append(data, 0x15)
@@ -243,9 +297,187 @@ func (c *Conn) writeInitialHandshake() error {
 	//filter [00]
 	data = append(data, 0)
 
+	//auth-plugin name
+	data = append(data, mysql.AUTH_NATIVE_PASSWORD...)
+	data = append(data, 0)
+
 	return c.WritePacket(data)
 }
 
+// serverCapability the capabilities advertised to client in handshake
+func (c *Conn) serverCapability() uint32 {
+	capability := DEFAULT_CAPABILITY | mysql.CLIENT_PLUGIN_AUTH |
+		mysql.CLIENT_MULTI_STATEMENTS | mysql.CLIENT_MULTI_RESULTS |
+		mysql.CLIENT_COMPRESS | mysql.CLIENT_LOCAL_FILES
+	if c.listener.tlsConf != nil {
+		capability |= mysql.CLIENT_SSL
+	}
+	return capability
+}
+
+// MultiStatements has client enabled multiple ; separated statements
+// per query, by capability flag at connect or COM_SET_OPTION.
+func (c *Conn) MultiStatements() bool {
+	return c.capability&mysql.CLIENT_MULTI_STATEMENTS > 0
+}
+
+// SetMultiStatements enable/disable multiple statements per query
+func (c *Conn) SetMultiStatements(on bool) {
+	if on {
+		c.capability |= mysql.CLIENT_MULTI_STATEMENTS
+	} else {
+		c.capability &^= mysql.CLIENT_MULTI_STATEMENTS
+	}
+}
+
+// LocalInfile has client enabled LOAD DATA LOCAL INFILE, sending files
+// from its host
+func (c *Conn) LocalInfile() bool {
+	return c.capability&mysql.CLIENT_LOCAL_FILES > 0
+}
+
+// Charset of the client, statements it sends are in it
+func (c *Conn) Charset() string {
+	return c.charset
+}
+
+// Collation of the client connection
+func (c *Conn) Collation() mysql.CollationId {
+	return c.collation
+}
+
+// ResultsCharset the charset results are sent in, empty if they are sent
+// as they are
+func (c *Conn) ResultsCharset() string {
+	return c.results
+}
+
+// SetCharsets of the connection, ie after SET NAMES.  Client the charset
+// statements are sent in, results the charset results are sent in or
+// empty to send them as they are.
+func (c *Conn) SetCharsets(client, results string, collation mysql.CollationId) {
+	c.charset = mysql.CharsetName(client)
+	if c.charset == "" {
+		c.charset = mysql.DEFAULT_CHARSET
+	}
+	c.results = mysql.CharsetName(results)
+	if collation == 0 {
+		collation = mysql.CharsetIds[c.charset]
+	}
+	c.collation = collation
+}
+
+// resultField f with the charset of results, text columns are sent in the
+// collation of results and others are binary
+func (c *Conn) resultField(f *mysql.Field) *mysql.Field {
+	charset := uint16(mysql.BINARY_COLLATION_ID)
+	if mysql.IsTextType(f.Type) && f.Charset != charset {
+		if c.results == "" {
+			return f
+		}
+		charset = uint16(mysql.CharsetIds[c.results])
+		if mysql.CollationCharset(c.collation) == c.results {
+			charset = uint16(c.collation)
+		}
+	}
+	if f.Charset == charset {
+		return f
+	}
+	f = f.Clone()
+	f.Charset = charset
+	return f
+}
+
+// RequestLocalFile asks client to send the file name of a LOAD DATA LOCAL
+// INFILE.  The file is read as it arrives, it must be read or closed to
+// its end before the result of the statement is written.
+func (c *Conn) RequestLocalFile(name string) (io.ReadCloser, error) {
+	data := make([]byte, 4, 5+len(name))
+	data = append(data, mysql.LocalInFile_HEADER)
+	data = append(data, name...)
+	if err := c.WritePacket(data); err != nil {
+		return nil, err
+	}
+	return &localFileReader{c: c}, nil
+}
+
+// localFileReader reads the packets of a file client sends for LOAD DATA
+// LOCAL INFILE, the file ends with an empty packet.
+type localFileReader struct {
+	c    *Conn
+	buf  []byte
+	done bool
+	err  error
+}
+
+func (m *localFileReader) Read(p []byte) (int, error) {
+	for len(m.buf) == 0 {
+		if m.done {
+			return 0, io.EOF
+		}
+		if m.err != nil {
+			return 0, m.err
+		}
+		m.buf, m.err = m.c.pkg.ReadDataPacket()
+		if m.err == nil && len(m.buf) == 0 {
+			m.done = true
+		}
+	}
+	n := copy(p, m.buf)
+	m.buf = m.buf[n:]
+	return n, nil
+}
+
+// Close reads the rest of the file, so the packets that follow are in
+// sequence even if the load stopped on an error.
+func (m *localFileReader) Close() error {
+	m.buf = nil
+	for !m.done && m.err == nil {
+		m.buf, m.err = m.c.pkg.ReadDataPacket()
+		if m.err == nil && len(m.buf) == 0 {
+			m.done = true
+		}
+	}
+	m.buf = nil
+	return m.err
+}
+
+// isUnix is this a unix socket connection
+func (c *Conn) isUnix() bool {
+	addr := c.c.RemoteAddr()
+	return addr == nil || addr.Network() == "unix"
+}
+
+// IsTLS is this connection encrypted
+func (c *Conn) IsTLS() bool {
+	_, ok := c.c.(*tls.Conn)
+	return ok
+}
+
+// isSecure is this connection safe for clear text passwords, tls or a
+// local unix socket as mysql treats them
+func (c *Conn) isSecure() bool {
+	return c.IsTLS() || c.isUnix()
+}
+
+// upgradeTLS switches the connection to tls after client has sent
+// an SSLRequest, the handshake response is then read over tls.
+func (c *Conn) upgradeTLS() error {
+	if c.listener.tlsConf == nil {
+		return mysql.NewDefaultError(mysql.ER_HANDSHAKE_ERROR)
+	}
+	tlsConn := tls.Server(c.pkg.BufferedConn(c.c), c.listener.tlsConf)
+	if err := tlsConn.Handshake(); err != nil {
+		u.Warnf("tls handshake error %s: %v", c.c.RemoteAddr(), err)
+		return err
+	}
+	seq := c.pkg.Sequence
+	c.c = tlsConn
+	c.pkg = mysql.NewPacketIO(tlsConn)
+	c.pkg.Sequence = seq
+	return nil
+}
+
 func (c *Conn) readPacket() ([]byte, error) {
 	return c.pkg.ReadPacket()
 }
@@ -262,47 +494,98 @@ func (c *Conn) readHandshakeResponse() error {
 		return err
 	}
 
-	pos := 0
+	if len(data) < 4 {
+		return mysql.ErrMalformPacket
+	}
 
 	//capability
 	c.capability = binary.LittleEndian.Uint32(data[:4])
-	pos += 4
+
+	// an SSLRequest is a handshake response truncated after the
+	// reserved bytes, the full response follows over tls
+	if c.capability&mysql.CLIENT_SSL > 0 && len(data) == 32 {
+		if err := c.upgradeTLS(); err != nil {
+			return err
+		}
+		if data, err = c.readPacket(); err != nil {
+			return err
+		}
+		if len(data) < 4 {
+			return mysql.ErrMalformPacket
+		}
+		c.capability = binary.LittleEndian.Uint32(data[:4])
+	}
+
+	if c.listener.feconf.TLSRequire && !c.isSecure() {
+		return mysql.NewDefaultError(mysql.ER_SECURE_TRANSPORT_REQUIRED)
+	}
+
+	pos := 4
 
 	//skip max packet size
 	pos += 4
 
-	//charset, skip, if you want to use another charset, use set names
-	//c.collation = CollationId(data[pos])
+	//charset, clients may send one we don't know (ie 255 of mysql 8),
+	// keep the default for those
+	if charset := mysql.CollationCharset(mysql.CollationId(data[pos])); charset != "" && charset != "binary" {
+		c.SetCharsets(charset, charset, mysql.CollationId(data[pos]))
+	}
 	pos++
 
 	//skip reserved 23[00]
 	pos += 23
 
+	if len(data) <= pos {
+		return mysql.ErrMalformPacket
+	}
+
 	//user name
-	c.user = string(data[pos : pos+bytes.IndexByte(data[pos:], 0)])
+	c.user = string(readNullString(data[pos:]))
 	pos += len(c.user) + 1
 
 	//auth length and auth
-	authLen := int(data[pos])
-	pos++
-	auth := data[pos : pos+authLen]
-
-	checkAuth := mysql.CalcPassword(c.salt, []byte(c.listener.feconf.Password))
-
-	if !bytes.Equal(auth, checkAuth) {
-		return mysql.NewDefaultError(mysql.ER_ACCESS_DENIED_ERROR, c.c.RemoteAddr().String(), c.user, "Yes")
+	var auth []byte
+	switch {
+	case c.capability&mysql.CLIENT_PLUGIN_AUTH_LENENC_CLIENT_DATA > 0:
+		authLen, _, n := mysql.LengthEncodedInt(data[pos:])
+		pos += n
+		if len(data) < pos+int(authLen) {
+			return mysql.ErrMalformPacket
+		}
+		auth = data[pos : pos+int(authLen)]
+		pos += int(authLen)
+	case c.capability&mysql.CLIENT_SECURE_CONNECTION > 0:
+		if len(data) <= pos {
+			return mysql.ErrMalformPacket
+		}
+		authLen := int(data[pos])
+		pos++
+		if len(data) < pos+authLen {
+			return mysql.ErrMalformPacket
+		}
+		auth = data[pos : pos+authLen]
+		pos += authLen
+	default:
+		auth = readNullString(data[pos:])
+		pos += len(auth) + 1
 	}
 
-	pos += authLen
+	var db string
+	if c.capability&mysql.CLIENT_CONNECT_WITH_DB > 0 && pos < len(data) {
+		db = string(readNullString(data[pos:]))
+		pos += len(db) + 1
+	}
 
-	if c.capability|mysql.CLIENT_CONNECT_WITH_DB > 0 {
-		if len(data[pos:]) == 0 {
-			return nil
-		}
+	plugin := mysql.AUTH_NATIVE_PASSWORD
+	if c.capability&mysql.CLIENT_PLUGIN_AUTH > 0 && pos < len(data) {
+		plugin = string(readNullString(data[pos:]))
+	}
 
-		db := string(data[pos : pos+bytes.IndexByte(data[pos:], 0)])
-		pos += len(c.db) + 1
+	if err := c.authenticate(plugin, auth); err != nil {
+		return err
+	}
 
+	if db != "" {
 		if err := c.UseDb(db); err != nil {
 			return err
 		}
@@ -311,8 +594,20 @@ func (c *Conn) readHandshakeResponse() error {
 	return nil
 }
 
+// readNullString reads a null terminated string, or to the end of data
+// if there is no terminator.
+func readNullString(data []byte) []byte {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return data[:i]
+	}
+	return data
+}
+
 func (c *Conn) UseDb(db string) error {
 	//u.Debugf("listener connection UseDB: %v", db)
+	if c.authUser != nil && !c.authUser.AllowSchema(db) {
+		return mysql.NewDefaultError(mysql.ER_DBACCESS_DENIED_ERROR, c.user, c.Host(), db)
+	}
 	if s := c.handler.SchemaUse(db); s == nil {
 		u.Errorf("could not load schema: %v", db)
 		return mysql.NewDefaultError(mysql.ER_BAD_DB_ERROR, db)
@@ -327,6 +622,8 @@ func (c *Conn) WriteOK(r *mysql.Result) error {
 	if r == nil {
 		r = &mysql.Result{Status: c.Status}
 	}
+	// connection status such as more results exists apply to all results
+	status := r.Status | c.Status
 	data := make([]byte, 4, 32)
 
 	data = append(data, mysql.OK_HEADER)
@@ -337,20 +634,24 @@ func (c *Conn) WriteOK(r *mysql.Result) error {
 
 	if c.capability&mysql.CLIENT_PROTOCOL_41 > 0 {
 		//u.Debugf("protocol > 4.1")
-		data = append(data, byte(r.Status), byte(r.Status>>8))
-		data = append(data, 0, 0)
+		data = append(data, byte(status), byte(status>>8))
+		data = append(data, mysql.Uint16ToBytes(c.Warnings.Count())...)
 	}
 	if c.capability&mysql.CLIENT_SESSION_TRACK > 0 {
 		//u.Debugf("supports Session Track?")
 		//data = append(data, byte(r.Status), byte(r.Status>>8))
 		//data = append(data, 0, 0)
+		if r.Info != "" {
+			data = append(data, mysql.PutLengthEncodedString([]byte(r.Info))...)
+		}
+	} else {
+		data = append(data, r.Info...)
 	}
 	// res.affected_rows = pr.readLCB()
 	// res.insert_id = pr.readLCB()
 	// res.status = pr.readU16()
 	// my.status = res.status
 	// res.warning_count = int(pr.readU16())
-	data = append(data, mysql.Uint16ToBytes(5)...)
 	// res.message = pr.readAll()
 
 	// pr.checkEof()
@@ -369,7 +670,7 @@ func (c *Conn) WriteError(e error) error {
 	var m *mysql.SqlError
 	var ok bool
 	if m, ok = e.(*mysql.SqlError); !ok {
-		m = mysql.NewError(mysql.ER_UNKNOWN_ERROR, e.Error())
+		m = toSqlError(e)
 	}
 
 	data := make([]byte, 4, 16+len(m.Message))
@@ -387,12 +688,39 @@ func (c *Conn) WriteError(e error) error {
 	return c.WritePacket(data)
 }
 
+// toSqlError the mysql error of e, errors of a known kind from the
+// planner or backends get the error number and sqlstate of that kind.
+func toSqlError(e error) *mysql.SqlError {
+	switch models.ErrorKindOf(e) {
+	case models.ErrNotFound:
+		switch models.ErrorObjectOf(e) {
+		case models.ObjectSchema:
+			return mysql.NewError(mysql.ER_BAD_DB_ERROR, e.Error())
+		case models.ObjectColumn:
+			return mysql.NewError(mysql.ER_BAD_FIELD_ERROR, e.Error())
+		}
+		return mysql.NewError(mysql.ER_NO_SUCH_TABLE, e.Error())
+	case models.ErrUnavailable:
+		return mysql.NewError(mysql.CR_SERVER_LOST, e.Error())
+	case models.ErrTimeout:
+		// as max_execution_time, KILL is ER_QUERY_INTERRUPTED
+		return mysql.NewError(mysql.ER_QUERY_TIMEOUT, e.Error())
+	case models.ErrUnsupported:
+		return mysql.NewError(mysql.ER_NOT_SUPPORTED_YET, e.Error())
+	case models.ErrDenied:
+		return mysql.NewError(mysql.ER_TABLEACCESS_DENIED_ERROR, e.Error())
+	case models.ErrSyntax:
+		return mysql.NewError(mysql.ER_PARSE_ERROR, e.Error())
+	}
+	return mysql.NewError(mysql.ER_UNKNOWN_ERROR, e.Error())
+}
+
 func (c *Conn) WriteEOF(status uint16) error {
 	data := make([]byte, 4, 9)
 
 	data = append(data, mysql.EOF_HEADER)
 	if c.capability&mysql.CLIENT_PROTOCOL_41 > 0 {
-		data = append(data, 0, 0)
+		data = append(data, mysql.Uint16ToBytes(c.Warnings.Count())...)
 		data = append(data, byte(status), byte(status>>8))
 	}
 
@@ -435,7 +763,7 @@ func (c *Conn) WriteFieldList(status uint16, fs []*mysql.Field) error {
 
 	for _, v := range fs {
 		data = data[0:4]
-		data = append(data, v.Dump()...)
+		data = append(data, c.resultField(v).Dump()...)
 		u.Debug(string(data))
 		if err := c.WritePacket(data); err != nil {
 			u.Warn(err)
@@ -0,0 +1,235 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/pem"
+	"sync"
+
+	u "github.com/araddon/gou"
+
+	"github.com/dataux/dataux/models"
+	"github.com/dataux/dataux/vendored/mixer/mysql"
+)
+
+// authenticate the client, auth is the response of the client's auth
+// plugin to our scramble.  Users are found with the listener's
+// authenticator, or if there is none any user may connect with the
+// listener password.
+//
+//	mysql_native_password   verified against the users native hash
+//	caching_sha2_password   fast auth if we know the users sha2 digest,
+//	                        else full auth with the password sent over
+//	                        tls or rsa encrypted
+//	other                   client is asked to switch to native password
+func (c *Conn) authenticate(plugin string, auth []byte) error {
+
+	user, err := c.lookupUser()
+	if err != nil {
+		if err != models.ErrUserNotFound {
+			u.Warnf("could not find user %q: %v", c.user, err)
+		}
+		return c.accessDenied(auth)
+	}
+
+	switch plugin {
+	case mysql.AUTH_NATIVE_PASSWORD:
+	case mysql.AUTH_CACHING_SHA2_PASSWORD:
+		if err := c.authCachingSha2(user, auth); err != nil {
+			return err
+		}
+		c.setAuthUser(user)
+		return nil
+	default:
+		//u.Debugf("switching auth plugin %q to native", plugin)
+		if auth, err = c.authSwitch(mysql.AUTH_NATIVE_PASSWORD); err != nil {
+			return err
+		}
+	}
+
+	hash, err := user.NativePasswordHash()
+	if err != nil {
+		u.Warnf("%v", err)
+		return c.accessDenied(auth)
+	}
+	if !mysql.CheckNativePassword(c.salt, auth, hash) {
+		return c.accessDenied(auth)
+	}
+	c.setAuthUser(user)
+	return nil
+}
+
+// lookupUser the account of the connecting user
+func (c *Conn) lookupUser() (*models.UserConfig, error) {
+	if c.listener.auth == nil {
+		return &models.UserConfig{Name: c.user, Password: c.listener.feconf.Password}, nil
+	}
+	return c.listener.auth.User(c.user)
+}
+
+func (c *Conn) setAuthUser(user *models.UserConfig) {
+	// without an authenticator there are no grants
+	if c.listener.auth != nil {
+		c.authUser = user
+	}
+}
+
+func (c *Conn) accessDenied(auth []byte) error {
+	usingPassword := "NO"
+	if len(auth) > 0 {
+		usingPassword = "YES"
+	}
+	return mysql.NewDefaultError(mysql.ER_ACCESS_DENIED_ERROR, c.user, c.Host(), usingPassword)
+}
+
+// authSwitch asks client to re-authenticate with plugin, returning
+// the new auth response.
+func (c *Conn) authSwitch(plugin string) ([]byte, error) {
+	data := make([]byte, 4, 4+len(plugin)+len(c.salt)+3)
+	data = append(data, mysql.AUTH_SWITCH_REQ_HEADER)
+	data = append(data, plugin...)
+	data = append(data, 0)
+	data = append(data, c.salt...)
+	data = append(data, 0)
+	if err := c.WritePacket(data); err != nil {
+		return nil, err
+	}
+	return c.readPacket()
+}
+
+// writeAuthMoreData sends plugin specific data to client mid-authentication
+func (c *Conn) writeAuthMoreData(more []byte) error {
+	data := make([]byte, 4, 4+1+len(more))
+	data = append(data, mysql.AUTH_MORE_DATA_HEADER)
+	data = append(data, more...)
+	return c.WritePacket(data)
+}
+
+// authCachingSha2 caching_sha2_password, the scramble can only be checked
+// if we have the sha2 digest of the users password, which we get from a
+// configured plain text password or from a previous full auth.
+func (c *Conn) authCachingSha2(user *models.UserConfig, auth []byte) error {
+
+	hash, err := user.NativePasswordHash()
+	if err != nil {
+		u.Warnf("%v", err)
+		return c.accessDenied(auth)
+	}
+
+	// users without a password don't need the fast auth round trip
+	if len(hash) == 0 {
+		if len(auth) != 0 {
+			return c.accessDenied(auth)
+		}
+		return nil
+	}
+	if len(auth) == 0 {
+		return c.accessDenied(auth)
+	}
+
+	digest := c.listener.sha2Digest(user, hash)
+	if digest != nil {
+		if !mysql.CheckCachingSha2Password(c.salt, auth, digest) {
+			return c.accessDenied(auth)
+		}
+		return c.writeAuthMoreData([]byte{mysql.CACHING_SHA2_FAST_AUTH_SUCCESS})
+	}
+
+	// full auth, client sends the password in clear text over tls or a
+	// unix socket, otherwise encrypted with our rsa public key
+	if err := c.writeAuthMoreData([]byte{mysql.CACHING_SHA2_PERFORM_FULL_AUTH}); err != nil {
+		return err
+	}
+	data, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+
+	var password []byte
+	if c.isSecure() {
+		password = readNullString(data)
+	} else {
+		key, err := c.listener.rsaKey()
+		if err != nil {
+			u.Errorf("could not create rsa key: %v", err)
+			return c.accessDenied(auth)
+		}
+		if len(data) == 1 && data[0] == mysql.CACHING_SHA2_REQUEST_PUBLIC_KEY {
+			pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+			if err != nil {
+				return err
+			}
+			if err := c.writeAuthMoreData(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})); err != nil {
+				return err
+			}
+			if data, err = c.readPacket(); err != nil {
+				return err
+			}
+		}
+		plain, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, key, data, nil)
+		if err != nil {
+			u.Warnf("could not decrypt password user=%q: %v", c.user, err)
+			return c.accessDenied(auth)
+		}
+		for i := range plain {
+			plain[i] ^= c.salt[i%len(c.salt)]
+		}
+		password = readNullString(plain)
+	}
+
+	if subtle.ConstantTimeCompare(mysql.NativePasswordHash(password), hash) != 1 {
+		return c.accessDenied(auth)
+	}
+	c.listener.cacheSha2Digest(user, hash, mysql.CachingSha2Digest(password))
+	return nil
+}
+
+// sha2Cache the caching_sha2_password digests of users learned from full
+// auth, keyed by user name along with the native hash they were verified
+// against so a changed password is not served from the cache.
+type sha2Cache struct {
+	mu      sync.Mutex
+	digests map[string]sha2CacheEntry
+	keyOnce sync.Once
+	key     *rsa.PrivateKey
+	keyErr  error
+}
+
+type sha2CacheEntry struct {
+	hash   []byte
+	digest []byte
+}
+
+// sha2Digest the sha2 digest of users password, nil if not known
+func (m *sha2Cache) sha2Digest(user *models.UserConfig, hash []byte) []byte {
+	if user.Password != "" {
+		return mysql.CachingSha2Digest([]byte(user.Password))
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.digests[user.Name]; ok && subtle.ConstantTimeCompare(e.hash, hash) == 1 {
+		return e.digest
+	}
+	return nil
+}
+
+func (m *sha2Cache) cacheSha2Digest(user *models.UserConfig, hash, digest []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.digests == nil {
+		m.digests = make(map[string]sha2CacheEntry)
+	}
+	m.digests[user.Name] = sha2CacheEntry{hash: hash, digest: digest}
+}
+
+// rsaKey the key clients without tls encrypt their password with for
+// caching_sha2_password full auth, created on first use.
+func (m *sha2Cache) rsaKey() (*rsa.PrivateKey, error) {
+	m.keyOnce.Do(func() {
+		m.key, m.keyErr = rsa.GenerateKey(rand.Reader, 2048)
+	})
+	return m.key, m.keyErr
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dataux/dataux/models"
+	"github.com/dataux/dataux/vendored/mixer/mysql"
+)
+
+// unixConnPair a connected server and client over a unix socket
+func unixConnPair(t *testing.T) (net.Conn, net.Conn, func()) {
+	dir, err := ioutil.TempDir("", "dataux")
+	assert.Equal(t, nil, err)
+	l, err := net.Listen("unix", filepath.Join(dir, "dataux.sock"))
+	assert.Equal(t, nil, err)
+	cc, err := net.Dial("unix", l.Addr().String())
+	assert.Equal(t, nil, err)
+	sc, err := l.Accept()
+	assert.Equal(t, nil, err)
+	return sc, cc, func() {
+		cc.Close()
+		sc.Close()
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCachingSha2FullAuthUnix(t *testing.T) {
+	stage1 := sha1.Sum([]byte("secret"))
+	hash := sha1.Sum(stage1[:])
+	// only the native hash is configured so the sha2 digest isn't known
+	// and the client must send its password
+	user := &models.UserConfig{Name: "bob", PasswordHash: "*" + hex.EncodeToString(hash[:])}
+
+	for _, password := range []string{"wrong", "secret"} {
+		sc, cc, done := unixConnPair(t)
+
+		c := &Conn{c: sc, pkg: mysql.NewPacketIO(sc), listener: &mysqlListener{}, user: "bob"}
+		c.salt, _ = mysql.RandomBuf(20)
+		assert.True(t, c.isSecure())
+
+		clientErr := make(chan error, 1)
+		go func() {
+			pkg := mysql.NewPacketIO(cc)
+			data, err := pkg.ReadPacket()
+			if err == nil {
+				assert.Equal(t, []byte{mysql.AUTH_MORE_DATA_HEADER, mysql.CACHING_SHA2_PERFORM_FULL_AUTH}, data)
+				// clear text as over tls, not rsa encrypted
+				err = pkg.WritePacket(append(make([]byte, 4), password+"\x00"...))
+			}
+			clientErr <- err
+		}()
+
+		err := c.authCachingSha2(user, []byte("scramble"))
+		assert.Equal(t, nil, <-clientErr)
+		if password == "wrong" {
+			assert.NotEqual(t, nil, err)
+			assert.True(t, c.listener.sha2Digest(user, hash[:]) == nil)
+		} else {
+			assert.Equal(t, nil, err)
+			assert.Equal(t, mysql.CachingSha2Digest([]byte("secret")), c.listener.sha2Digest(user, hash[:]))
+		}
+		done()
+	}
+}
@@ -49,14 +49,12 @@ func (c *Conn) handleSetNames(val sqlparser.ValExpr) error {
 		return fmt.Errorf("set names charset error")
 	}
 
-	charset := strings.ToLower(string(value))
-	cid, ok := CharsetIds[charset]
-	if !ok {
-		return fmt.Errorf("invalid charset %s", charset)
+	charset := CharsetName(string(value))
+	if charset == "" {
+		return fmt.Errorf("invalid charset %s", value)
 	}
 
-	c.charset = charset
-	c.collation = cid
+	c.SetCharsets(charset, charset, CharsetIds[charset])
 
 	return c.WriteOK(nil)
 }
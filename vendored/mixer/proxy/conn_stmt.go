@@ -1,6 +1,10 @@
 package proxy
 
 import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
 	"github.com/dataux/dataux/vendored/mixer/mysql"
 	"github.com/dataux/dataux/vendored/mixer/sqlparser"
 )
@@ -34,16 +38,33 @@ func (s *Stmt) ResetParams() {
 }
 
 func (c *Conn) writePrepare(s *Stmt) error {
+	return c.WriteStmtPrepare(s.id, s.params, s.columns)
+}
+
+// WriteStmtPrepare writes the COM_STMT_PREPARE response followed by
+// placeholder definitions for each of the params and columns.
+func (c *Conn) WriteStmtPrepare(id uint32, params, columns int) error {
+	return c.writeStmtPrepare(id, params, columns, nil)
+}
+
+// WriteStmtPrepareFields writes the COM_STMT_PREPARE response followed by
+// placeholder definitions of the params and the definitions of the
+// result columns, if they are known when the statement is prepared.
+func (c *Conn) WriteStmtPrepareFields(id uint32, params int, columns []*mysql.Field) error {
+	return c.writeStmtPrepare(id, params, len(columns), columns)
+}
+
+func (c *Conn) writeStmtPrepare(id uint32, params, columns int, fields []*mysql.Field) error {
 	data := make([]byte, 4, 128)
 
 	//status ok
 	data = append(data, 0)
 	//stmt id
-	data = append(data, mysql.Uint32ToBytes(s.id)...)
+	data = append(data, mysql.Uint32ToBytes(id)...)
 	//number columns
-	data = append(data, mysql.Uint16ToBytes(uint16(s.columns))...)
+	data = append(data, mysql.Uint16ToBytes(uint16(columns))...)
 	//number params
-	data = append(data, mysql.Uint16ToBytes(uint16(s.params))...)
+	data = append(data, mysql.Uint16ToBytes(uint16(params))...)
 	//filter [00]
 	data = append(data, 0)
 	//warning count
@@ -53,8 +74,8 @@ func (c *Conn) writePrepare(s *Stmt) error {
 		return err
 	}
 
-	if s.params > 0 {
-		for i := 0; i < s.params; i++ {
+	if params > 0 {
+		for i := 0; i < params; i++ {
 			data = data[0:4]
 			data = append(data, []byte(paramFieldData)...)
 
@@ -68,10 +89,14 @@ func (c *Conn) writePrepare(s *Stmt) error {
 		}
 	}
 
-	if s.columns > 0 {
-		for i := 0; i < s.columns; i++ {
+	if columns > 0 {
+		for i := 0; i < columns; i++ {
 			data = data[0:4]
-			data = append(data, []byte(columnFieldData)...)
+			if fields != nil {
+				data = append(data, fields[i].Dump()...)
+			} else {
+				data = append(data, []byte(columnFieldData)...)
+			}
 
 			if err := c.WritePacket(data); err != nil {
 				return err
@@ -85,3 +110,137 @@ func (c *Conn) writePrepare(s *Stmt) error {
 	}
 	return nil
 }
+
+// BindStmtArgs decodes the binary protocol parameter values of a
+// COM_STMT_EXECUTE into args.  Params already holding data sent by
+// COM_STMT_SEND_LONG_DATA are not in paramValues so are skipped.
+func BindStmtArgs(args []interface{}, nullBitmap, paramTypes, paramValues []byte) error {
+	if len(paramTypes) < (len(args)<<1) || len(nullBitmap) < ((len(args)+7)>>3) {
+		return mysql.ErrMalformPacket
+	}
+
+	pos := 0
+
+	var v []byte
+	var n int = 0
+	var isNull bool
+	var err error
+
+	for i := 0; i < len(args); i++ {
+		if nullBitmap[i>>3]&(1<<(uint(i)%8)) > 0 {
+			args[i] = nil
+			continue
+		}
+
+		if _, isLongData := args[i].([]byte); isLongData {
+			continue
+		}
+
+		tp := paramTypes[i<<1]
+		isUnsigned := (paramTypes[(i<<1)+1] & 0x80) > 0
+
+		switch tp {
+		case mysql.MYSQL_TYPE_NULL:
+			args[i] = nil
+			continue
+
+		case mysql.MYSQL_TYPE_TINY:
+			if len(paramValues) < (pos + 1) {
+				return mysql.ErrMalformPacket
+			}
+
+			if isUnsigned {
+				args[i] = uint8(paramValues[pos])
+			} else {
+				args[i] = int8(paramValues[pos])
+			}
+
+			pos++
+			continue
+
+		case mysql.MYSQL_TYPE_SHORT, mysql.MYSQL_TYPE_YEAR:
+			if len(paramValues) < (pos + 2) {
+				return mysql.ErrMalformPacket
+			}
+
+			if isUnsigned {
+				args[i] = uint16(binary.LittleEndian.Uint16(paramValues[pos : pos+2]))
+			} else {
+				args[i] = int16((binary.LittleEndian.Uint16(paramValues[pos : pos+2])))
+			}
+			pos += 2
+			continue
+
+		case mysql.MYSQL_TYPE_INT24, mysql.MYSQL_TYPE_LONG:
+			if len(paramValues) < (pos + 4) {
+				return mysql.ErrMalformPacket
+			}
+
+			if isUnsigned {
+				args[i] = uint32(binary.LittleEndian.Uint32(paramValues[pos : pos+4]))
+			} else {
+				args[i] = int32(binary.LittleEndian.Uint32(paramValues[pos : pos+4]))
+			}
+			pos += 4
+			continue
+
+		case mysql.MYSQL_TYPE_LONGLONG:
+			if len(paramValues) < (pos + 8) {
+				return mysql.ErrMalformPacket
+			}
+
+			if isUnsigned {
+				args[i] = binary.LittleEndian.Uint64(paramValues[pos : pos+8])
+			} else {
+				args[i] = int64(binary.LittleEndian.Uint64(paramValues[pos : pos+8]))
+			}
+			pos += 8
+			continue
+
+		case mysql.MYSQL_TYPE_FLOAT:
+			if len(paramValues) < (pos + 4) {
+				return mysql.ErrMalformPacket
+			}
+
+			args[i] = float32(math.Float32frombits(binary.LittleEndian.Uint32(paramValues[pos : pos+4])))
+			pos += 4
+			continue
+
+		case mysql.MYSQL_TYPE_DOUBLE:
+			if len(paramValues) < (pos + 8) {
+				return mysql.ErrMalformPacket
+			}
+
+			args[i] = math.Float64frombits(binary.LittleEndian.Uint64(paramValues[pos : pos+8]))
+			pos += 8
+			continue
+
+		case mysql.MYSQL_TYPE_DECIMAL, mysql.MYSQL_TYPE_NEWDECIMAL, mysql.MYSQL_TYPE_VARCHAR,
+			mysql.MYSQL_TYPE_BIT, mysql.MYSQL_TYPE_ENUM, mysql.MYSQL_TYPE_SET, mysql.MYSQL_TYPE_TINY_BLOB,
+			mysql.MYSQL_TYPE_MEDIUM_BLOB, mysql.MYSQL_TYPE_LONG_BLOB, mysql.MYSQL_TYPE_BLOB,
+			mysql.MYSQL_TYPE_VAR_STRING, mysql.MYSQL_TYPE_STRING, mysql.MYSQL_TYPE_GEOMETRY, mysql.MYSQL_TYPE_JSON,
+			mysql.MYSQL_TYPE_DATE, mysql.MYSQL_TYPE_NEWDATE,
+			mysql.MYSQL_TYPE_TIMESTAMP, mysql.MYSQL_TYPE_DATETIME, mysql.MYSQL_TYPE_TIME:
+			if len(paramValues) < (pos + 1) {
+				return mysql.ErrMalformPacket
+			}
+
+			v, isNull, n, err = mysql.LengthEnodedString(paramValues[pos:])
+			pos += n
+			if err != nil {
+				return err
+			}
+
+			if !isNull {
+				args[i] = v
+				continue
+			} else {
+				args[i] = nil
+				continue
+			}
+		default:
+			return fmt.Errorf("Stmt Unknown FieldType %d", tp)
+		}
+	}
+	return nil
+}
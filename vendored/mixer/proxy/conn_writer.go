@@ -113,6 +113,12 @@ func (c *Conn) WriteResult(r models.Result) error {
 		return c.WriteHandlerResult(c.Status, resVal)
 	case *mysql.Result:
 		return c.WriteOK(resVal)
+	case *mysql.ResultsetHeader:
+		return c.WriteResultsetHeader(c.Status, resVal.Fields)
+	case *mysql.RowBatch:
+		return c.WriteRowDatas(resVal.RowDatas)
+	case *mysql.ResultsetEnd:
+		return c.WriteEOF(c.Status | resVal.Status)
 	}
 	u.Errorf("unknown result type?:  T:%T   v:%v", r, r)
 	return fmt.Errorf("Unknown result type: %T", r)
@@ -123,10 +129,30 @@ func (c *Conn) WriteResultset(status uint16, r *mysql.Resultset) error {
 }
 
 func (c *Conn) WriteHandlerResult(status uint16, r *mysql.Resultset) error {
+
+	if err := c.WriteResultsetHeader(status, r.Fields); err != nil {
+		return err
+	}
+
+	if err := c.WriteRowDatas(r.RowDatas); err != nil {
+		return err
+	}
+
+	if err := c.WriteEOF(status); err != nil {
+		u.Warn(err)
+		return err
+	}
+
+	return nil
+}
+
+// WriteResultsetHeader writes the column count, column definitions and
+// the EOF that separates them from the rows.
+func (c *Conn) WriteResultsetHeader(status uint16, fields []*mysql.Field) error {
 	c.affectedRows = int64(-1)
 
 	//u.Debugf("write result: status=%v", status)
-	columnLen := mysql.PutLengthEncodedInt(uint64(len(r.Fields)))
+	columnLen := mysql.PutLengthEncodedInt(uint64(len(fields)))
 
 	data := make([]byte, 4, 1024)
 
@@ -136,9 +162,9 @@ func (c *Conn) WriteHandlerResult(status uint16, r *mysql.Resultset) error {
 		return err
 	}
 
-	for _, v := range r.Fields {
+	for _, v := range fields {
 		data = data[0:4]
-		data = append(data, v.Dump()...)
+		data = append(data, c.resultField(v).Dump()...)
 		//u.Infof("field; %v", v.String())
 		//u.Debugf("data size %d", len(data))
 		if err := c.WritePacket(data); err != nil {
@@ -151,8 +177,16 @@ func (c *Conn) WriteHandlerResult(status uint16, r *mysql.Resultset) error {
 		u.Warn(err)
 		return err
 	}
+	return nil
+}
+
+// WriteRowDatas writes one packet per row, must be preceded by
+// WriteResultsetHeader and followed by an EOF.
+func (c *Conn) WriteRowDatas(rows []mysql.RowData) error {
+
+	data := make([]byte, 4, 1024)
 
-	for _, v := range r.RowDatas {
+	for _, v := range rows {
 		data = data[0:4]
 		data = append(data, v...)
 		if err := c.WritePacket(data); err != nil {
@@ -160,11 +194,5 @@ func (c *Conn) WriteHandlerResult(status uint16, r *mysql.Resultset) error {
 			return err
 		}
 	}
-
-	if err := c.WriteEOF(status); err != nil {
-		u.Warn(err)
-		return err
-	}
-
 	return nil
 }
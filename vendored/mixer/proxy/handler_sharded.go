@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"math"
 	"sort"
 	"strconv"
 	"strings"
@@ -685,128 +684,7 @@ func (m *HandlerSharded) handleStmtExecute(data []byte) error {
 }
 
 func (m *HandlerSharded) bindStmtArgs(s *Stmt, nullBitmap, paramTypes, paramValues []byte) error {
-	args := s.args
-
-	pos := 0
-
-	var v []byte
-	var n int = 0
-	var isNull bool
-	var err error
-
-	for i := 0; i < s.params; i++ {
-		if nullBitmap[i>>3]&(1<<(uint(i)%8)) > 0 {
-			args[i] = nil
-			continue
-		}
-
-		tp := paramTypes[i<<1]
-		isUnsigned := (paramTypes[(i<<1)+1] & 0x80) > 0
-
-		switch tp {
-		case mysql.MYSQL_TYPE_NULL:
-			args[i] = nil
-			continue
-
-		case mysql.MYSQL_TYPE_TINY:
-			if len(paramValues) < (pos + 1) {
-				return mysql.ErrMalformPacket
-			}
-
-			if isUnsigned {
-				args[i] = uint8(paramValues[pos])
-			} else {
-				args[i] = int8(paramValues[pos])
-			}
-
-			pos++
-			continue
-
-		case mysql.MYSQL_TYPE_SHORT, mysql.MYSQL_TYPE_YEAR:
-			if len(paramValues) < (pos + 2) {
-				return mysql.ErrMalformPacket
-			}
-
-			if isUnsigned {
-				args[i] = uint16(binary.LittleEndian.Uint16(paramValues[pos : pos+2]))
-			} else {
-				args[i] = int16((binary.LittleEndian.Uint16(paramValues[pos : pos+2])))
-			}
-			pos += 2
-			continue
-
-		case mysql.MYSQL_TYPE_INT24, mysql.MYSQL_TYPE_LONG:
-			if len(paramValues) < (pos + 4) {
-				return mysql.ErrMalformPacket
-			}
-
-			if isUnsigned {
-				args[i] = uint32(binary.LittleEndian.Uint32(paramValues[pos : pos+4]))
-			} else {
-				args[i] = int32(binary.LittleEndian.Uint32(paramValues[pos : pos+4]))
-			}
-			pos += 4
-			continue
-
-		case mysql.MYSQL_TYPE_LONGLONG:
-			if len(paramValues) < (pos + 8) {
-				return mysql.ErrMalformPacket
-			}
-
-			if isUnsigned {
-				args[i] = binary.LittleEndian.Uint64(paramValues[pos : pos+8])
-			} else {
-				args[i] = int64(binary.LittleEndian.Uint64(paramValues[pos : pos+8]))
-			}
-			pos += 8
-			continue
-
-		case mysql.MYSQL_TYPE_FLOAT:
-			if len(paramValues) < (pos + 4) {
-				return mysql.ErrMalformPacket
-			}
-
-			args[i] = float32(math.Float32frombits(binary.LittleEndian.Uint32(paramValues[pos : pos+4])))
-			pos += 4
-			continue
-
-		case mysql.MYSQL_TYPE_DOUBLE:
-			if len(paramValues) < (pos + 8) {
-				return mysql.ErrMalformPacket
-			}
-
-			args[i] = math.Float64frombits(binary.LittleEndian.Uint64(paramValues[pos : pos+8]))
-			pos += 8
-			continue
-
-		case mysql.MYSQL_TYPE_DECIMAL, mysql.MYSQL_TYPE_NEWDECIMAL, mysql.MYSQL_TYPE_VARCHAR,
-			mysql.MYSQL_TYPE_BIT, mysql.MYSQL_TYPE_ENUM, mysql.MYSQL_TYPE_SET, mysql.MYSQL_TYPE_TINY_BLOB,
-			mysql.MYSQL_TYPE_MEDIUM_BLOB, mysql.MYSQL_TYPE_LONG_BLOB, mysql.MYSQL_TYPE_BLOB,
-			mysql.MYSQL_TYPE_VAR_STRING, mysql.MYSQL_TYPE_STRING, mysql.MYSQL_TYPE_GEOMETRY,
-			mysql.MYSQL_TYPE_DATE, mysql.MYSQL_TYPE_NEWDATE,
-			mysql.MYSQL_TYPE_TIMESTAMP, mysql.MYSQL_TYPE_DATETIME, mysql.MYSQL_TYPE_TIME:
-			if len(paramValues) < (pos + 1) {
-				return mysql.ErrMalformPacket
-			}
-
-			v, isNull, n, err = mysql.LengthEnodedString(paramValues[pos:])
-			pos += n
-			if err != nil {
-				return err
-			}
-
-			if !isNull {
-				args[i] = v
-				continue
-			} else {
-				args[i] = nil
-				continue
-			}
-		default:
-			return fmt.Errorf("Stmt Unknown FieldType %d", tp)
-		}
-	}
-	return nil
+	return BindStmtArgs(s.args, nullBitmap, paramTypes, paramValues)
 }
 
 func (m *HandlerSharded) handleStmtSendLongData(data []byte) error {
@@ -1,9 +1,12 @@
 package proxy
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
+	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync/atomic"
 
@@ -22,8 +25,17 @@ var (
 	_ = u.EMPTY
 )
 
-func ListenerInit(feConf *models.ListenerConfig, conf *models.Config, sc models.StatementHandlerCreator) (models.Listener, error) {
-	return newMysqlListener(feConf, conf, sc)
+// ListenerInit create a mysql listener, auth looks up the users allowed
+// to connect, if nil the listener password applies to any user.
+func ListenerInit(feConf *models.ListenerConfig, conf *models.Config, auth models.Authenticator,
+	sc models.StatementHandlerCreator) (models.Listener, error) {
+
+	myl, err := newMysqlListener(feConf, conf, sc)
+	if err != nil {
+		return nil, err
+	}
+	myl.auth = auth
+	return myl, nil
 }
 
 func newMysqlListener(feConf *models.ListenerConfig, conf *models.Config, sc models.StatementHandlerCreator) (*mysqlListener, error) {
@@ -38,11 +50,16 @@ func newMysqlListener(feConf *models.ListenerConfig, conf *models.Config, sc mod
 	myl.password = feConf.Password
 
 	var err error
-	netProto := "tcp"
-	if strings.Contains(netProto, "/") {
-		netProto = "unix"
+	myl.tlsConf, err = feConf.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.Contains(myl.addr, "/") {
+		myl.netlistener, err = listenUnix(myl.addr, feConf.SocketMode)
+	} else {
+		myl.netlistener, err = net.Listen("tcp", myl.addr)
 	}
-	myl.netlistener, err = net.Listen(netProto, myl.addr)
 
 	if err != nil {
 		return nil, err
@@ -52,12 +69,54 @@ func newMysqlListener(feConf *models.ListenerConfig, conf *models.Config, sc mod
 	return myl, nil
 }
 
+// listenUnix listens on the unix socket file path, removing a stale socket
+// left by a server that did not shut down cleanly.  The socket file is
+// removed again when the listener is closed.
+func listenUnix(path, mode string) (net.Listener, error) {
+
+	perm := os.FileMode(0666)
+	if mode != "" {
+		m, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid socket_mode %q for %s: %v", mode, path, err)
+		}
+		perm = os.FileMode(m)
+	}
+
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("socket %s is in use by another server", path)
+		}
+		u.Warnf("removing stale socket %s", path)
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
 // mysqlListener implements proxy.Listener interface for
 //  running listener connections for mysql
 type mysqlListener struct {
 	cfg         *models.Config
 	feconf      *models.ListenerConfig
 	sc          models.StatementHandlerCreator
+	auth        models.Authenticator
+	tlsConf     *tls.Config // nil if tls is not enabled
+	sha2Cache               // caching_sha2_password digests, rsa key
 	handler     interface{}
 	connCt      int32 // current connection count
 	addr        string
@@ -2,6 +2,10 @@ package proxy
 
 import (
 	"flag"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -170,3 +174,33 @@ func newTestDBConn(t *testing.T) *client.SqlConn {
 func TestServer(t *testing.T) {
 	newTestServer(t)
 }
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dataux")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dataux.sock")
+
+	// a socket left behind by a server that did not shut down
+	stale, err := net.Listen("unix", path)
+	assert.Equal(t, nil, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := listenUnix(path, "0660")
+	assert.Equal(t, nil, err)
+	fi, err := os.Stat(path)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, os.FileMode(0660), fi.Mode().Perm())
+
+	// in use
+	_, err = listenUnix(path, "")
+	assert.NotEqual(t, nil, err)
+
+	l.Close()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = listenUnix(path, "rw")
+	assert.NotEqual(t, nil, err)
+}